@@ -0,0 +1,104 @@
+package cmdbackfill
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	servercmd "github.com/authgear/authgear-nft-indexer/cmd/server/cmd"
+	"github.com/authgear/authgear-nft-indexer/cmd/server/server"
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/job"
+	"github.com/authgear/authgear-nft-indexer/pkg/service"
+	"github.com/authgear/authgear-nft-indexer/pkg/web3"
+	"github.com/authgear/authgear-server/pkg/util/clock"
+	"github.com/authgear/authgear-server/pkg/util/log"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+func init() {
+	binder := servercmd.GetBinder()
+	binder.BindString(cmdBackfill.Flags(), servercmd.ArgConfig)
+	binder.BindString(cmdBackfill.Flags(), servercmd.ArgStartBlock)
+	servercmd.Root.AddCommand(cmdBackfill)
+}
+
+var cmdBackfill = &cobra.Command{
+	Use:   "backfill <contract_id>",
+	Short: "Index the full transfer history of a collection, then hand it over to the worker",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		binder := servercmd.GetBinder()
+		configPath, err := binder.GetRequiredString(cmd, servercmd.ArgConfig)
+		if err != nil {
+			return err
+		}
+		cfg := config.NewConfig(configPath)
+
+		err = servercmd.ValidateNetworks(cmd, cfg)
+		if err != nil {
+			return err
+		}
+
+		contractID, err := authgearweb3.ParseContractID(args[0])
+		if err != nil {
+			return err
+		}
+
+		var startBlock *int64
+		if s := binder.GetString(cmd, servercmd.ArgStartBlock); s != "" {
+			block, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || block < 0 {
+				return fmt.Errorf("invalid start block: %v", s)
+			}
+			startBlock = &block
+		}
+
+		lf := log.NewFactory(log.LevelInfo)
+		backfillService := server.NewBackfillService(&job.Provider{
+			Context:         cmd.Context(),
+			Config:          cfg,
+			Database:        database.GetDatabase(cfg.Database),
+			LogFactory:      lf,
+			RateLimiter:     web3.NewRateLimiter(cfg, clock.NewSystemClock(), lf),
+			APIKeyPool:      web3.NewAPIKeyPool(clock.NewSystemClock(), lf),
+			CircuitBreakers: web3.NewCircuitBreakers(cfg, clock.NewSystemClock(), lf),
+			FetchCoalescer:  service.NewFetchCoalescer(cfg),
+		})
+
+		out := cmd.OutOrStdout()
+		collection, err := backfillService.Backfill(*contractID, startBlock, func(progress service.IndexProgress) {
+			if progress.ToBlock == nil {
+				fmt.Fprintf(out, "start block is after head %v, nothing to index\n", progress.Head)
+				return
+			}
+			if progress.RolledBackTo != nil {
+				fmt.Fprintf(out, "rolled back to block %v after a reorganization\n", progress.RolledBackTo)
+			}
+			fmt.Fprintf(out, "indexed blocks %v-%v of %v (%.1f%%), %d transfers\n",
+				progress.FromBlock,
+				progress.ToBlock,
+				progress.Head,
+				percentage(progress),
+				progress.Transfers,
+			)
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "%v is caught up and followed by the worker from now on\n", collection.ContractID())
+		return nil
+	},
+}
+
+func percentage(progress service.IndexProgress) float64 {
+	if progress.Head.Sign() == 0 {
+		return 100
+	}
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(progress.ToBlock), new(big.Float).SetInt(progress.Head)).Float64()
+	return ratio * 100
+}
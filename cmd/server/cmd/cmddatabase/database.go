@@ -10,6 +10,11 @@ import (
 
 	servercmd "github.com/authgear/authgear-nft-indexer/cmd/server/cmd"
 	"github.com/authgear/authgear-nft-indexer/cmd/server/migrator"
+	"github.com/authgear/authgear-nft-indexer/cmd/server/server"
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/job"
+	"github.com/authgear/authgear-server/pkg/util/log"
 )
 
 func init() {
@@ -25,11 +30,14 @@ func init() {
 		binder.BindString(cmd.Flags(), servercmd.ArgConfig)
 	}
 
+	cmdDatabase.AddCommand(cmdGC)
+	binder.BindString(cmdGC.Flags(), servercmd.ArgConfig)
+
 	servercmd.Root.AddCommand(cmdDatabase)
 }
 
 var cmdDatabase = &cobra.Command{
-	Use:   "database migrate",
+	Use:   "database [migrate|gc]",
 	Short: "Database commands",
 }
 
@@ -142,3 +150,34 @@ var cmdMigrateStatus = &cobra.Command{
 		return
 	},
 }
+
+var cmdGC = &cobra.Command{
+	Use:   "gc",
+	Short: "Create upcoming ownership history partitions, drop expired history, delete ownerships past their retention and collections not queried recently",
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		binder := servercmd.GetBinder()
+		configPath, err := binder.GetRequiredString(cmd, servercmd.ArgConfig)
+		if err != nil {
+			return err
+		}
+
+		cfg := config.NewConfig(configPath)
+		result, err := server.NewGCService(&job.Provider{
+			Context:    cmd.Context(),
+			Config:     cfg,
+			Database:   database.GetDatabase(cfg.Database),
+			LogFactory: log.NewFactory(log.LevelInfo),
+		}).Run()
+		if result != nil && result.Skipped {
+			fmt.Fprintln(cmd.OutOrStdout(), "skipped, gc is running in another process")
+		} else if result != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "created %d and dropped %d ownership history partitions, deleted %d ownerships and %d collections\n",
+				result.OwnershipHistoryPartitionsCreated,
+				result.OwnershipHistoryPartitionsDropped,
+				result.OwnershipsDeleted,
+				result.CollectionsDeleted,
+			)
+		}
+		return err
+	},
+}
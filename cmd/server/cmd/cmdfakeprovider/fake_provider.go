@@ -0,0 +1,55 @@
+package cmdfakeprovider
+
+import (
+	"github.com/spf13/cobra"
+
+	servercmd "github.com/authgear/authgear-nft-indexer/cmd/server/cmd"
+	"github.com/authgear/authgear-nft-indexer/pkg/fakeprovider"
+	"github.com/authgear/authgear-server/pkg/util/log"
+	"github.com/authgear/authgear-server/pkg/util/server"
+	"github.com/authgear/authgear-server/pkg/util/signalutil"
+)
+
+func init() {
+	binder := servercmd.GetBinder()
+	binder.BindString(cmdFakeProvider.Flags(), servercmd.ArgFakeProviderWorld)
+	binder.BindString(cmdFakeProvider.Flags(), servercmd.ArgFakeProviderListenAddr)
+	servercmd.Root.AddCommand(cmdFakeProvider)
+}
+
+var cmdFakeProvider = &cobra.Command{
+	Use:   "fake-provider",
+	Short: "Serve a fake Alchemy API from a world file for local development",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		binder := servercmd.GetBinder()
+		worldPath, err := binder.GetRequiredString(cmd, servercmd.ArgFakeProviderWorld)
+		if err != nil {
+			return err
+		}
+		listenAddr, err := binder.GetRequiredString(cmd, servercmd.ArgFakeProviderListenAddr)
+		if err != nil {
+			return err
+		}
+
+		world, err := fakeprovider.LoadWorld(worldPath)
+		if err != nil {
+			return err
+		}
+
+		lf := log.NewFactory(log.LevelInfo)
+		logger := lf.New("fake-provider")
+
+		ctx := cmd.Context()
+		signalutil.Start(ctx, logger, []signalutil.Daemon{
+			server.NewSpec(ctx, &server.Spec{
+				Name:          "Fake Provider",
+				ListenAddress: listenAddr,
+				Handler: &fakeprovider.Handler{
+					World:  world,
+					Logger: logger,
+				},
+			}),
+		}...)
+		return nil
+	},
+}
@@ -1,6 +1,8 @@
 package cmdstart
 
 import (
+	"fmt"
+
 	"github.com/authgear/authgear-nft-indexer/cmd/server/cmd"
 	indexercmd "github.com/authgear/authgear-nft-indexer/cmd/server/cmd"
 	"github.com/authgear/authgear-nft-indexer/cmd/server/server"
@@ -17,10 +19,27 @@ var cmdStart = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		config := config.NewConfig(configPath)
+		cfg := config.NewConfig(configPath)
+
+		if mode := binder.GetString(cmd, indexercmd.ArgFixturesMode); mode != "" {
+			switch m := config.FixturesMode(mode); m {
+			case config.FixturesModeOff, config.FixturesModeRecord, config.FixturesModeReplay:
+				cfg.Upstream.Fixtures.Mode = m
+			default:
+				return fmt.Errorf("invalid fixtures mode: %v", mode)
+			}
+		}
+		if dir := binder.GetString(cmd, indexercmd.ArgFixturesDir); dir != "" {
+			cfg.Upstream.Fixtures.Dir = dir
+		}
+
+		err = indexercmd.ValidateNetworks(cmd, cfg)
+		if err != nil {
+			return err
+		}
 
 		ctrl := server.Controller{
-			Config: config,
+			Config: cfg,
 		}
 
 		ctrl.Start(cmd.Context())
@@ -31,5 +50,7 @@ var cmdStart = &cobra.Command{
 func init() {
 	binder := indexercmd.GetBinder()
 	binder.BindString(cmdStart.Flags(), indexercmd.ArgConfig)
+	binder.BindString(cmdStart.Flags(), indexercmd.ArgFixturesMode)
+	binder.BindString(cmdStart.Flags(), indexercmd.ArgFixturesDir)
 	cmd.Root.AddCommand(cmdStart)
 }
@@ -0,0 +1,40 @@
+package cmdworker
+
+import (
+	"github.com/spf13/cobra"
+
+	servercmd "github.com/authgear/authgear-nft-indexer/cmd/server/cmd"
+	"github.com/authgear/authgear-nft-indexer/cmd/server/server"
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+)
+
+func init() {
+	binder := servercmd.GetBinder()
+	binder.BindString(cmdWorker.Flags(), servercmd.ArgConfig)
+	servercmd.Root.AddCommand(cmdWorker)
+}
+
+var cmdWorker = &cobra.Command{
+	Use:   "worker",
+	Short: "Follow new blocks of tracked collections and run queued refresh jobs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		binder := servercmd.GetBinder()
+		configPath, err := binder.GetRequiredString(cmd, servercmd.ArgConfig)
+		if err != nil {
+			return err
+		}
+		cfg := config.NewConfig(configPath)
+
+		err = servercmd.ValidateNetworks(cmd, cfg)
+		if err != nil {
+			return err
+		}
+
+		ctrl := server.WorkerController{
+			Config: cfg,
+		}
+
+		ctrl.Start(cmd.Context())
+		return nil
+	},
+}
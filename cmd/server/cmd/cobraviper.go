@@ -19,3 +19,35 @@ var ArgConfig = &cobraviper.StringArgument{
 	Usage:        "Config Path",
 	DefaultValue: "authgear-nft-indexer.yaml",
 }
+
+var ArgFixturesMode = &cobraviper.StringArgument{
+	ArgumentName: "fixtures-mode",
+	EnvName:      "FIXTURES_MODE",
+	Usage:        "Record or replay upstream provider traffic (off, record, replay)",
+}
+
+var ArgFixturesDir = &cobraviper.StringArgument{
+	ArgumentName: "fixtures-dir",
+	EnvName:      "FIXTURES_DIR",
+	Usage:        "Directory of recorded upstream fixtures",
+}
+
+var ArgStartBlock = &cobraviper.StringArgument{
+	ArgumentName: "start-block",
+	EnvName:      "START_BLOCK",
+	Usage:        "Block to start indexing from, defaults to the block of the first transfer of the collection",
+}
+
+var ArgFakeProviderWorld = &cobraviper.StringArgument{
+	ArgumentName: "world",
+	EnvName:      "FAKE_PROVIDER_WORLD",
+	Usage:        "Path of the YAML or JSON world served by the fake provider",
+	DefaultValue: "fake-provider-world.yaml",
+}
+
+var ArgFakeProviderListenAddr = &cobraviper.StringArgument{
+	ArgumentName: "listen-addr",
+	EnvName:      "FAKE_PROVIDER_LISTEN_ADDR",
+	Usage:        "Listen address of the fake provider",
+	DefaultValue: "0.0.0.0:8090",
+}
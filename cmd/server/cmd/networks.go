@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// ValidateNetworks prints the warnings of config.ValidateNetworks and fails on its errors
+func ValidateNetworks(cmd *cobra.Command, cfg config.Config) error {
+	warnings, err := cfg.ValidateNetworks()
+	for _, warning := range warnings {
+		cmd.PrintErrln("warning: " + warning)
+	}
+	return err
+}
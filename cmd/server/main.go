@@ -5,8 +5,11 @@ import (
 	"os"
 
 	"github.com/authgear/authgear-nft-indexer/cmd/server/cmd"
+	_ "github.com/authgear/authgear-nft-indexer/cmd/server/cmd/cmdbackfill"
 	_ "github.com/authgear/authgear-nft-indexer/cmd/server/cmd/cmddatabase"
+	_ "github.com/authgear/authgear-nft-indexer/cmd/server/cmd/cmdfakeprovider"
 	_ "github.com/authgear/authgear-nft-indexer/cmd/server/cmd/cmdstart"
+	_ "github.com/authgear/authgear-nft-indexer/cmd/server/cmd/cmdworker"
 )
 
 func main() {
@@ -0,0 +1,28 @@
+-- +migrate Up
+
+ALTER TABLE eth_nft_ownership ADD COLUMN refreshed_at timestamp without time zone;
+
+-- Keep only the latest row of each ownership
+DELETE FROM eth_nft_ownership a
+USING eth_nft_ownership b
+WHERE a.blockchain = b.blockchain
+	AND a.network = b.network
+	AND a.contract_address = b.contract_address
+	AND a.token_id = b.token_id
+	AND a.owner_address = b.owner_address
+	AND (a.created_at < b.created_at OR (a.created_at = b.created_at AND a.ctid < b.ctid));
+
+UPDATE eth_nft_ownership SET refreshed_at = created_at;
+ALTER TABLE eth_nft_ownership ALTER COLUMN refreshed_at SET NOT NULL;
+
+CREATE UNIQUE INDEX eth_nft_ownership_unq_ownership_idx ON eth_nft_ownership (blockchain, network, contract_address, token_id, owner_address);
+
+DROP INDEX eth_nft_ownership_owned_idx;
+CREATE INDEX eth_nft_ownership_owned_idx ON eth_nft_ownership (blockchain, network, owner_address, refreshed_at);
+
+-- +migrate Down
+DROP INDEX eth_nft_ownership_owned_idx;
+CREATE INDEX eth_nft_ownership_owned_idx ON eth_nft_ownership (blockchain, network, owner_address, created_at);
+
+DROP INDEX eth_nft_ownership_unq_ownership_idx;
+ALTER TABLE eth_nft_ownership DROP COLUMN refreshed_at;
@@ -0,0 +1,13 @@
+-- +migrate Up
+
+ALTER TABLE eth_nft_collection ADD COLUMN last_queried_at timestamp without time zone;
+UPDATE eth_nft_collection SET last_queried_at = updated_at;
+ALTER TABLE eth_nft_collection ALTER COLUMN last_queried_at SET NOT NULL;
+
+CREATE INDEX eth_nft_collection_last_queried_at_idx ON eth_nft_collection (last_queried_at);
+CREATE INDEX eth_nft_ownership_refreshed_at_idx ON eth_nft_ownership (refreshed_at);
+
+-- +migrate Down
+DROP INDEX eth_nft_ownership_refreshed_at_idx;
+DROP INDEX eth_nft_collection_last_queried_at_idx;
+ALTER TABLE eth_nft_collection DROP COLUMN last_queried_at;
@@ -0,0 +1,49 @@
+-- +migrate Up
+
+-- Every refresh of an ownership is appended here, eth_nft_ownership keeps only the latest row of each ownership and serves the reads.
+-- Rows are partitioned by the day they are refreshed, so expired days are dropped instead of deleted row by row.
+CREATE TABLE eth_nft_ownership_history
+(
+	blockchain text NOT NULL,
+	network text NOT NULL,
+	contract_address text NOT NULL,
+	token_id text NOT NULL,
+	balance text NOT NULL,
+	block_number bigint NOT NULL,
+	owner_address text NOT NULL,
+	txn_hash text NOT NULL,
+	txn_index integer NOT NULL,
+	block_timestamp timestamp without time zone,
+	created_at timestamp without time zone NOT NULL,
+	refreshed_at timestamp without time zone NOT NULL,
+	refreshed_on date NOT NULL
+) PARTITION BY RANGE (refreshed_on);
+
+-- Catches rows of days whose partition has not been created in time
+CREATE TABLE eth_nft_ownership_history_default PARTITION OF eth_nft_ownership_history DEFAULT;
+
+CREATE INDEX eth_nft_ownership_history_owner_idx ON eth_nft_ownership_history (blockchain, network, owner_address, refreshed_on);
+
+-- +migrate StatementBegin
+DO $$
+DECLARE
+	day date;
+BEGIN
+	FOR day IN
+		SELECT generate_series(CURRENT_DATE, CURRENT_DATE + 7, interval '1 day')::date
+	LOOP
+		EXECUTE format(
+			'CREATE TABLE IF NOT EXISTS %I PARTITION OF eth_nft_ownership_history FOR VALUES FROM (%L) TO (%L)',
+			'eth_nft_ownership_history_p' || to_char(day, 'YYYYMMDD'),
+			day,
+			day + 1
+		);
+	END LOOP;
+END
+$$;
+-- +migrate StatementEnd
+
+-- +migrate Down
+
+-- Dropping the partitioned table drops all partitions
+DROP TABLE eth_nft_ownership_history;
@@ -0,0 +1,17 @@
+-- +migrate Up
+
+CREATE TABLE eth_nft_indexer_checkpoint
+(
+	blockchain text NOT NULL,
+	network text NOT NULL,
+	contract_address text NOT NULL,
+	block_number bigint NOT NULL,
+	synced_at timestamp without time zone,
+	created_at timestamp without time zone NOT NULL,
+	updated_at timestamp without time zone NOT NULL
+);
+
+CREATE UNIQUE INDEX eth_nft_indexer_checkpoint_unq_collection_idx ON eth_nft_indexer_checkpoint (blockchain, network, contract_address);
+
+-- +migrate Down
+DROP TABLE eth_nft_indexer_checkpoint;
@@ -0,0 +1,20 @@
+-- +migrate Up
+
+CREATE TABLE eth_nft_tracked_collection
+(
+	id text PRIMARY KEY,
+	blockchain text NOT NULL,
+	network text NOT NULL,
+	contract_address text NOT NULL,
+	mode text NOT NULL,
+	start_block bigint NOT NULL,
+	ttl_seconds integer,
+	paused_at timestamp without time zone,
+	created_at timestamp without time zone NOT NULL,
+	updated_at timestamp without time zone NOT NULL
+);
+
+CREATE UNIQUE INDEX eth_nft_tracked_collection_unq_collection_idx ON eth_nft_tracked_collection (blockchain, network, contract_address);
+
+-- +migrate Down
+DROP TABLE eth_nft_tracked_collection;
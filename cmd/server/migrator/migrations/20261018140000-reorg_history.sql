@@ -0,0 +1,42 @@
+-- +migrate Up
+
+-- The hash of the checkpoint block detects a reorganization of the blocks applied so far
+ALTER TABLE eth_nft_indexer_checkpoint ADD COLUMN block_hash text;
+
+-- Hashes of the blocks the worker stopped at, which are not final yet, to find where a reorganization forks
+CREATE TABLE eth_nft_indexer_block
+(
+	blockchain text NOT NULL,
+	network text NOT NULL,
+	contract_address text NOT NULL,
+	block_number bigint NOT NULL,
+	block_hash text NOT NULL,
+	created_at timestamp without time zone NOT NULL
+);
+
+CREATE UNIQUE INDEX eth_nft_indexer_block_unq_block_idx ON eth_nft_indexer_block (blockchain, network, contract_address, block_number);
+
+-- Ownerships before the transfers of blocks which are not final yet, to roll the blocks back
+CREATE TABLE eth_nft_ownership_undo
+(
+	blockchain text NOT NULL,
+	network text NOT NULL,
+	contract_address text NOT NULL,
+	block_number bigint NOT NULL,
+	token_id text NOT NULL,
+	owner_address text NOT NULL,
+	previous_balance text,
+	previous_block_number bigint,
+	previous_txn_hash text,
+	previous_txn_index integer,
+	previous_block_timestamp timestamp without time zone,
+	created_at timestamp without time zone NOT NULL
+);
+
+CREATE INDEX eth_nft_ownership_undo_block_idx ON eth_nft_ownership_undo (blockchain, network, contract_address, block_number);
+CREATE INDEX eth_nft_ownership_undo_owner_idx ON eth_nft_ownership_undo (blockchain, network, owner_address, block_number);
+
+-- +migrate Down
+DROP TABLE eth_nft_ownership_undo;
+DROP TABLE eth_nft_indexer_block;
+ALTER TABLE eth_nft_indexer_checkpoint DROP COLUMN block_hash;
@@ -0,0 +1,24 @@
+-- +migrate Up
+
+CREATE TABLE eth_nft_job
+(
+	id text PRIMARY KEY,
+	type text NOT NULL,
+	payload jsonb NOT NULL,
+	dedup_key text,
+	status text NOT NULL,
+	attempts integer NOT NULL,
+	max_attempts integer NOT NULL,
+	run_at timestamp without time zone NOT NULL,
+	locked_at timestamp without time zone,
+	last_error text,
+	created_at timestamp without time zone NOT NULL,
+	updated_at timestamp without time zone NOT NULL
+);
+
+-- A job is not enqueued again while the same work is waiting or running
+CREATE UNIQUE INDEX eth_nft_job_unq_dedup_key_idx ON eth_nft_job (dedup_key) WHERE status IN ('pending', 'running');
+CREATE INDEX eth_nft_job_status_run_at_idx ON eth_nft_job (status, run_at);
+
+-- +migrate Down
+DROP TABLE eth_nft_job;
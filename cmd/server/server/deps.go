@@ -2,6 +2,7 @@ package server
 
 import (
 	"github.com/authgear/authgear-nft-indexer/pkg/handler"
+	"github.com/authgear/authgear-nft-indexer/pkg/job"
 	"github.com/authgear/authgear-nft-indexer/pkg/mutator"
 	"github.com/authgear/authgear-nft-indexer/pkg/query"
 	"github.com/authgear/authgear-nft-indexer/pkg/service"
@@ -16,24 +17,85 @@ var DependencySet = wire.NewSet(
 
 	query.DependencySet,
 	wire.Bind(new(service.ProbeServiceNFTCollectionProbeQuery), new(*query.NFTCollectionProbeQuery)),
+	wire.Bind(new(service.TrackedCollectionServiceNFTTrackedCollectionQuery), new(*query.NFTTrackedCollectionQuery)),
+	wire.Bind(new(service.MetadataServiceNFTTrackedCollectionQuery), new(*query.NFTTrackedCollectionQuery)),
+	wire.Bind(new(service.OwnershipServiceNFTOwnershipQuery), new(*query.NFTOwnershipQuery)),
+	wire.Bind(new(service.OwnershipServiceNFTIndexerCheckpointQuery), new(*query.NFTIndexerCheckpointQuery)),
+	wire.Bind(new(service.OwnershipServiceNFTTrackedCollectionQuery), new(*query.NFTTrackedCollectionQuery)),
+	wire.Bind(new(service.OwnershipServiceNFTOwnershipUndoQuery), new(*query.NFTOwnershipUndoQuery)),
 
 	mutator.DependencySet,
 	wire.Bind(new(service.MetadataServiceNFTCollectionMutator), new(*mutator.NFTCollectionMutator)),
 	wire.Bind(new(service.ProbeServiceNFTCollectionProbeMutator), new(*mutator.NFTCollectionProbeMutator)),
 	wire.Bind(new(service.OwnershipServiceNFTOwnershipMutator), new(*mutator.NFTOwnershipMutator)),
+	wire.Bind(new(service.TrackedCollectionServiceNFTTrackedCollectionMutator), new(*mutator.NFTTrackedCollectionMutator)),
+	wire.Bind(new(service.JobQueueServiceNFTJobMutator), new(*mutator.NFTJobMutator)),
 
 	web3.DependencySet,
-	wire.Bind(new(service.MetadataServiceAlchemyAPI), new(*web3.AlchemyAPI)),
-	wire.Bind(new(service.ProbeServiceAlchemyAPI), new(*web3.AlchemyAPI)),
-	wire.Bind(new(service.OwnershipServiceAlchemyAPI), new(*web3.AlchemyAPI)),
+	wire.Bind(new(service.MetadataServiceNFTDataProvider), new(*web3.NFTDataProviderRouter)),
+	wire.Bind(new(service.ProbeServiceNFTDataProvider), new(*web3.NFTDataProviderRouter)),
+	wire.Bind(new(service.OwnershipServiceNFTDataProvider), new(*web3.NFTDataProviderRouter)),
 
 	service.DependencySet,
 	wire.Bind(new(handler.GetCollectionMetadataHandlerMetadataService), new(*service.MetadataService)),
 	wire.Bind(new(handler.ListOwnerNFTHandlerMetadataService), new(*service.MetadataService)),
 	wire.Bind(new(handler.ProbeCollectionHandlerProbeService), new(*service.ProbeService)),
 	wire.Bind(new(handler.ListOwnerNFTHandlerOwnershipService), new(*service.OwnershipService)),
+	wire.Bind(new(handler.UsageHandlerUsageReporter), new(*web3.UsageReporter)),
+	wire.Bind(new(handler.TrackedCollectionHandlerTrackedCollectionService), new(*service.TrackedCollectionService)),
+	wire.Bind(new(service.MetadataServiceJobQueue), new(*service.JobQueueService)),
+	wire.Bind(new(service.OwnershipServiceJobQueue), new(*service.JobQueueService)),
+	wire.Bind(new(service.ProbeServiceJobQueue), new(*service.JobQueueService)),
 
 	handler.DependencySet,
 	httputil.DependencySet,
 	wire.Bind(new(handler.JSONResponseWriter), new(*httputil.JSONResponseWriter)),
 )
+
+// JobDependencySet is DependencySet of background jobs
+var JobDependencySet = wire.NewSet(
+	clock.DependencySet,
+	job.DependencySet,
+
+	query.DependencySet,
+	mutator.DependencySet,
+	wire.Bind(new(service.GCServiceNFTOwnershipMutator), new(*mutator.NFTOwnershipMutator)),
+	wire.Bind(new(service.GCServiceNFTOwnershipHistoryPartitionQuery), new(*query.NFTOwnershipHistoryPartitionQuery)),
+	wire.Bind(new(service.GCServiceNFTOwnershipHistoryPartitionMutator), new(*mutator.NFTOwnershipHistoryPartitionMutator)),
+	wire.Bind(new(service.GCServiceNFTCollectionMutator), new(*mutator.NFTCollectionMutator)),
+	wire.Bind(new(service.GCServiceNFTTrackedCollectionQuery), new(*query.NFTTrackedCollectionQuery)),
+	wire.Bind(new(service.GCServiceLock), new(*mutator.AdvisoryLockMutator)),
+	wire.Bind(new(service.IndexerServiceNFTIndexerCheckpointQuery), new(*query.NFTIndexerCheckpointQuery)),
+	wire.Bind(new(service.IndexerServiceNFTIndexerMutator), new(*mutator.NFTIndexerMutator)),
+	wire.Bind(new(service.IndexerServiceNFTIndexerBlockQuery), new(*query.NFTIndexerBlockQuery)),
+	wire.Bind(new(service.IndexerServiceNFTTrackedCollectionQuery), new(*query.NFTTrackedCollectionQuery)),
+	wire.Bind(new(service.MetadataServiceNFTTrackedCollectionQuery), new(*query.NFTTrackedCollectionQuery)),
+	wire.Bind(new(service.MetadataServiceNFTCollectionMutator), new(*mutator.NFTCollectionMutator)),
+	wire.Bind(new(service.BackfillServiceNFTTrackedCollectionQuery), new(*query.NFTTrackedCollectionQuery)),
+	wire.Bind(new(service.BackfillServiceNFTTrackedCollectionMutator), new(*mutator.NFTTrackedCollectionMutator)),
+	wire.Bind(new(service.JobQueueServiceNFTJobMutator), new(*mutator.NFTJobMutator)),
+	wire.Bind(new(service.JobRunnerServiceNFTJobMutator), new(*mutator.NFTJobMutator)),
+	wire.Bind(new(service.OwnershipServiceNFTOwnershipMutator), new(*mutator.NFTOwnershipMutator)),
+	wire.Bind(new(service.OwnershipServiceNFTOwnershipQuery), new(*query.NFTOwnershipQuery)),
+	wire.Bind(new(service.OwnershipServiceNFTIndexerCheckpointQuery), new(*query.NFTIndexerCheckpointQuery)),
+	wire.Bind(new(service.OwnershipServiceNFTTrackedCollectionQuery), new(*query.NFTTrackedCollectionQuery)),
+	wire.Bind(new(service.OwnershipServiceNFTOwnershipUndoQuery), new(*query.NFTOwnershipUndoQuery)),
+	wire.Bind(new(service.ProbeServiceNFTCollectionProbeQuery), new(*query.NFTCollectionProbeQuery)),
+	wire.Bind(new(service.ProbeServiceNFTCollectionProbeMutator), new(*mutator.NFTCollectionProbeMutator)),
+
+	web3.DependencySet,
+	wire.Bind(new(service.IndexerServiceNFTDataProvider), new(*web3.NFTDataProviderRouter)),
+	wire.Bind(new(service.MetadataServiceNFTDataProvider), new(*web3.NFTDataProviderRouter)),
+	wire.Bind(new(service.OwnershipServiceNFTDataProvider), new(*web3.NFTDataProviderRouter)),
+	wire.Bind(new(service.ProbeServiceNFTDataProvider), new(*web3.NFTDataProviderRouter)),
+
+	service.DependencySet,
+	wire.Bind(new(service.IndexerServiceMetadataService), new(*service.MetadataService)),
+	wire.Bind(new(service.MetadataServiceJobQueue), new(*service.JobQueueService)),
+	wire.Bind(new(service.OwnershipServiceJobQueue), new(*service.JobQueueService)),
+	wire.Bind(new(service.ProbeServiceJobQueue), new(*service.JobQueueService)),
+	wire.Bind(new(service.JobRunnerServiceOwnershipService), new(*service.OwnershipService)),
+	wire.Bind(new(service.JobRunnerServiceMetadataService), new(*service.MetadataService)),
+	wire.Bind(new(service.JobRunnerServiceProbeService), new(*service.ProbeService)),
+	wire.Bind(new(service.BackfillServiceIndexerService), new(*service.IndexerService)),
+)
@@ -5,19 +5,30 @@ import (
 
 	"github.com/authgear/authgear-nft-indexer/pkg/config"
 	"github.com/authgear/authgear-nft-indexer/pkg/handler"
+	"github.com/authgear/authgear-nft-indexer/pkg/service"
+	"github.com/authgear/authgear-nft-indexer/pkg/web3"
+	"github.com/authgear/authgear-server/pkg/util/clock"
 	"github.com/authgear/authgear-server/pkg/util/httproute"
 	"github.com/authgear/authgear-server/pkg/util/log"
 	"github.com/uptrace/bun"
 )
 
-func NewRouter(config config.Config, session *bun.DB, lf *log.Factory) http.Handler {
+// NewRouteHandler shares the rate limiter, API key pool and circuit breakers between the public and admin routers
+func NewRouteHandler(config config.Config, session *bun.DB, lf *log.Factory) handler.RouteHandler {
+	return handler.RouteHandler{
+		Config:          config,
+		Database:        session,
+		LogFactory:      lf,
+		RateLimiter:     web3.NewRateLimiter(config, clock.NewSystemClock(), lf),
+		APIKeyPool:      web3.NewAPIKeyPool(clock.NewSystemClock(), lf),
+		CircuitBreakers: web3.NewCircuitBreakers(config, clock.NewSystemClock(), lf),
+		FetchCoalescer:  service.NewFetchCoalescer(config),
+	}
+}
+
+func NewRouter(routeHandler handler.RouteHandler) http.Handler {
 	router := httproute.NewRouter()
 
-	routeHandler := handler.RouteHandler{
-		Config:     config,
-		Database:   session,
-		LogFactory: lf,
-	}
 	route := httproute.Route{}
 	router.Add(handler.ConfigureHealthCheckRoute(route), routeHandler.Handle(NewHealthCheckAPIHandler))
 	router.Add(handler.ConfigureListOwnerNFTRoute(route), routeHandler.Handle(NewListOwnerNFTAPIHandler))
@@ -25,3 +36,17 @@ func NewRouter(config config.Config, session *bun.DB, lf *log.Factory) http.Hand
 	router.Add(handler.ConfigureProbeCollectionRoute(route), routeHandler.Handle(NewProbeCollectionAPIHandler))
 	return router.HTTPHandler()
 }
+
+// NewAdminRouter serves the operator routes on admin_listen_addr
+func NewAdminRouter(routeHandler handler.RouteHandler) http.Handler {
+	router := httproute.NewRouter()
+
+	route := httproute.Route{}
+	router.Add(handler.ConfigureHealthCheckRoute(route), routeHandler.Handle(NewHealthCheckAPIHandler))
+	router.Add(handler.ConfigureUsageRoute(route), routeHandler.Handle(NewUsageAPIHandler))
+	router.Add(handler.ConfigureRegisterTrackedCollectionRoute(route), routeHandler.Handle(NewRegisterTrackedCollectionAPIHandler))
+	router.Add(handler.ConfigureListTrackedCollectionsRoute(route), routeHandler.Handle(NewListTrackedCollectionsAPIHandler))
+	router.Add(handler.ConfigurePauseTrackedCollectionRoute(route), routeHandler.Handle(NewPauseTrackedCollectionAPIHandler))
+	router.Add(handler.ConfigureRemoveTrackedCollectionRoute(route), routeHandler.Handle(NewRemoveTrackedCollectionAPIHandler))
+	return router.HTTPHandler()
+}
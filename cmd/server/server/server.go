@@ -5,6 +5,7 @@ import (
 
 	"github.com/authgear/authgear-nft-indexer/pkg/config"
 	"github.com/authgear/authgear-nft-indexer/pkg/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/job"
 	"github.com/authgear/authgear-server/pkg/util/log"
 	"github.com/authgear/authgear-server/pkg/util/server"
 	"github.com/authgear/authgear-server/pkg/util/signalutil"
@@ -18,7 +19,7 @@ type Controller struct {
 func (c *Controller) Start(ctx context.Context) {
 	u, err := server.ParseListenAddress(c.Config.Server.ListenAddr)
 	if err != nil {
-		c.logger.WithError(err).Fatal("failed to parse admin API server listen address")
+		c.logger.WithError(err).Fatal("failed to parse API server listen address")
 	}
 
 	database := database.GetDatabase(c.Config.Database)
@@ -26,15 +27,60 @@ func (c *Controller) Start(ctx context.Context) {
 	lf := log.NewFactory(log.LevelInfo)
 	c.logger = lf.New("server")
 
-	signalutil.Start(ctx, c.logger, []signalutil.Daemon{
+	routeHandler := NewRouteHandler(c.Config, database, lf)
+
+	daemons := []signalutil.Daemon{
 		server.NewSpec(ctx, &server.Spec{
 			Name:          "Indexer API Server",
 			ListenAddress: u.Host,
-			Handler: NewRouter(
-				c.Config,
-				database,
-				lf,
-			),
+			Handler:       NewRouter(routeHandler),
 		}),
-	}...)
+	}
+
+	if c.Config.Server.AdminListenAddr != "" {
+		adminURL, err := server.ParseListenAddress(c.Config.Server.AdminListenAddr)
+		if err != nil {
+			c.logger.WithError(err).Fatal("failed to parse admin API server listen address")
+		}
+
+		daemons = append(daemons, server.NewSpec(ctx, &server.Spec{
+			Name:          "Indexer Admin API Server",
+			ListenAddress: adminURL.Host,
+			Handler:       NewAdminRouter(routeHandler),
+		}))
+	}
+
+	// Ownership history partitions are created even if gc is disabled, otherwise all rows end up in the default partition.
+	// Every replica runs the daemon, GCService takes an advisory lock so that only one of them does the work at a time.
+	daemons = append(daemons, &job.PeriodicDaemon{
+		Name:     "GC",
+		Interval: c.Config.GC.GetInterval(),
+		Run: func(ctx context.Context) error {
+			gcService := NewGCService(&job.Provider{
+				Context:    ctx,
+				Config:     c.Config,
+				Database:   database,
+				LogFactory: lf,
+			})
+			if c.Config.GC.Disabled {
+				_, err := gcService.CreateOwnershipHistoryPartitions()
+				return err
+			}
+			_, err := gcService.Run()
+			return err
+		},
+	})
+
+	// Stale data is revalidated by the jobs even if no worker is running, the upstream state is shared with the API
+	daemons = append(daemons, newJobDaemons(job.Provider{
+		Config:          c.Config,
+		Database:        database,
+		LogFactory:      lf,
+		RateLimiter:     routeHandler.RateLimiter,
+		APIKeyPool:      routeHandler.APIKeyPool,
+		CircuitBreakers: routeHandler.CircuitBreakers,
+		FetchCoalescer:  routeHandler.FetchCoalescer,
+	}, c.Config.Jobs.GetServerConcurrency())...)
+
+	signalutil.Start(ctx, c.logger, daemons...)
 }
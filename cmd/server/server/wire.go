@@ -7,6 +7,8 @@ import (
 	"net/http"
 
 	"github.com/authgear/authgear-nft-indexer/pkg/handler"
+	"github.com/authgear/authgear-nft-indexer/pkg/job"
+	"github.com/authgear/authgear-nft-indexer/pkg/service"
 	"github.com/google/wire"
 )
 
@@ -33,3 +35,57 @@ func NewProbeCollectionAPIHandler(
 ) http.Handler {
 	panic(wire.Build(DependencySet, wire.Bind(new(http.Handler), new(*handler.ProbeCollectionAPIHandler))))
 }
+
+func NewUsageAPIHandler(
+	p *handler.RequestProvider,
+) http.Handler {
+	panic(wire.Build(DependencySet, wire.Bind(new(http.Handler), new(*handler.UsageAPIHandler))))
+}
+
+func NewRegisterTrackedCollectionAPIHandler(
+	p *handler.RequestProvider,
+) http.Handler {
+	panic(wire.Build(DependencySet, wire.Bind(new(http.Handler), new(*handler.RegisterTrackedCollectionAPIHandler))))
+}
+
+func NewListTrackedCollectionsAPIHandler(
+	p *handler.RequestProvider,
+) http.Handler {
+	panic(wire.Build(DependencySet, wire.Bind(new(http.Handler), new(*handler.ListTrackedCollectionsAPIHandler))))
+}
+
+func NewPauseTrackedCollectionAPIHandler(
+	p *handler.RequestProvider,
+) http.Handler {
+	panic(wire.Build(DependencySet, wire.Bind(new(http.Handler), new(*handler.PauseTrackedCollectionAPIHandler))))
+}
+
+func NewRemoveTrackedCollectionAPIHandler(
+	p *handler.RequestProvider,
+) http.Handler {
+	panic(wire.Build(DependencySet, wire.Bind(new(http.Handler), new(*handler.RemoveTrackedCollectionAPIHandler))))
+}
+
+func NewGCService(
+	p *job.Provider,
+) *service.GCService {
+	panic(wire.Build(JobDependencySet))
+}
+
+func NewIndexerService(
+	p *job.Provider,
+) *service.IndexerService {
+	panic(wire.Build(JobDependencySet))
+}
+
+func NewBackfillService(
+	p *job.Provider,
+) *service.BackfillService {
+	panic(wire.Build(JobDependencySet))
+}
+
+func NewJobRunnerService(
+	p *job.Provider,
+) *service.JobRunnerService {
+	panic(wire.Build(JobDependencySet))
+}
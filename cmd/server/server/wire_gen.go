@@ -8,6 +8,7 @@ package server
 
 import (
 	"github.com/authgear/authgear-nft-indexer/pkg/handler"
+	"github.com/authgear/authgear-nft-indexer/pkg/job"
 	"github.com/authgear/authgear-nft-indexer/pkg/mutator"
 	"github.com/authgear/authgear-nft-indexer/pkg/query"
 	"github.com/authgear/authgear-nft-indexer/pkg/service"
@@ -49,42 +50,89 @@ func NewListOwnerNFTAPIHandler(p *handler.RequestProvider) http.Handler {
 	listOwnerNFTHandlerLogger := handler.NewListOwnerNFTHandlerLogger(factory)
 	config := p.Config
 	clock := _wireSystemClockValue
+	ownershipServiceLogger := service.NewOwnershipServiceLogger(factory)
+	rateLimiter := p.RateLimiter
+	apiKeyPool := p.APIKeyPool
+	circuitBreakers := p.CircuitBreakers
 	alchemyAPI := &web3.AlchemyAPI{
-		Config: config,
+		Config:          config,
+		RateLimiter:     rateLimiter,
+		APIKeyPool:      apiKeyPool,
+		CircuitBreakers: circuitBreakers,
+	}
+	jsonrpcapi := &web3.JSONRPCAPI{
+		Config:          config,
+		RateLimiter:     rateLimiter,
+		CircuitBreakers: circuitBreakers,
+	}
+	nftDataProviderRouter := &web3.NFTDataProviderRouter{
+		Config:     config,
+		AlchemyAPI: alchemyAPI,
+		JSONRPCAPI: jsonrpcapi,
 	}
 	request := p.Request
 	context := handler.ProvideRequestContext(request)
 	db := p.Database
-	nftCollectionQuery := query.NFTCollectionQuery{
+	nftOwnershipQuery := &query.NFTOwnershipQuery{
 		Ctx:     context,
 		Session: db,
 	}
-	nftOwnershipQuery := query.NFTOwnershipQuery{
+	nftOwnershipMutator := &mutator.NFTOwnershipMutator{
 		Ctx:     context,
 		Session: db,
 	}
-	nftOwnershipMutator := &mutator.NFTOwnershipMutator{
+	fetchCoalescer := p.FetchCoalescer
+	nftIndexerCheckpointQuery := &query.NFTIndexerCheckpointQuery{
 		Ctx:     context,
 		Session: db,
 	}
+	nftTrackedCollectionQuery := &query.NFTTrackedCollectionQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftOwnershipUndoQuery := &query.NFTOwnershipUndoQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftJobMutator := &mutator.NFTJobMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	jobQueueService := &service.JobQueueService{
+		Clock:         clock,
+		Config:        config,
+		NFTJobMutator: nftJobMutator,
+	}
 	ownershipService := &service.OwnershipService{
-		Clock:               clock,
-		Config:              config,
-		AlchemyAPI:          alchemyAPI,
-		NFTCollectionQuery:  nftCollectionQuery,
-		NFTOwnershipQuery:   nftOwnershipQuery,
-		NFTOwnershipMutator: nftOwnershipMutator,
+		Clock:                     clock,
+		Logger:                    ownershipServiceLogger,
+		Config:                    config,
+		NFTDataProvider:           nftDataProviderRouter,
+		NFTOwnershipQuery:         nftOwnershipQuery,
+		NFTOwnershipMutator:       nftOwnershipMutator,
+		FetchCoalescer:            fetchCoalescer,
+		NFTIndexerCheckpointQuery: nftIndexerCheckpointQuery,
+		NFTTrackedCollectionQuery: nftTrackedCollectionQuery,
+		NFTOwnershipUndoQuery:     nftOwnershipUndoQuery,
+		JobQueue:                  jobQueueService,
+	}
+	nftCollectionQuery := query.NFTCollectionQuery{
+		Ctx:     context,
+		Session: db,
 	}
 	nftCollectionMutator := &mutator.NFTCollectionMutator{
 		Ctx:     context,
 		Session: db,
 	}
 	metadataService := &service.MetadataService{
-		Clock:                clock,
-		Config:               config,
-		AlchemyAPI:           alchemyAPI,
-		NFTCollectionQuery:   nftCollectionQuery,
-		NFTCollectionMutator: nftCollectionMutator,
+		Clock:                     clock,
+		Config:                    config,
+		NFTDataProvider:           nftDataProviderRouter,
+		NFTCollectionQuery:        nftCollectionQuery,
+		NFTCollectionMutator:      nftCollectionMutator,
+		FetchCoalescer:            fetchCoalescer,
+		NFTTrackedCollectionQuery: nftTrackedCollectionQuery,
+		JobQueue:                  jobQueueService,
 	}
 	listOwnerNFTAPIHandler := &handler.ListOwnerNFTAPIHandler{
 		JSON:             jsonResponseWriter,
@@ -107,10 +155,26 @@ func NewGetCollectionMetadataAPIHandler(p *handler.RequestProvider) http.Handler
 		Logger: jsonResponseWriterLogger,
 	}
 	getCollectionMetadataHandlerLogger := handler.NewGetCollectionMetadataHandlerLogger(factory)
-	clockClock := _wireSystemClockValue
 	config := p.Config
+	clockClock := _wireSystemClockValue
+	rateLimiter := p.RateLimiter
+	apiKeyPool := p.APIKeyPool
+	circuitBreakers := p.CircuitBreakers
 	alchemyAPI := &web3.AlchemyAPI{
-		Config: config,
+		Config:          config,
+		RateLimiter:     rateLimiter,
+		APIKeyPool:      apiKeyPool,
+		CircuitBreakers: circuitBreakers,
+	}
+	jsonrpcapi := &web3.JSONRPCAPI{
+		Config:          config,
+		RateLimiter:     rateLimiter,
+		CircuitBreakers: circuitBreakers,
+	}
+	nftDataProviderRouter := &web3.NFTDataProviderRouter{
+		Config:     config,
+		AlchemyAPI: alchemyAPI,
+		JSONRPCAPI: jsonrpcapi,
 	}
 	request := p.Request
 	context := handler.ProvideRequestContext(request)
@@ -123,16 +187,34 @@ func NewGetCollectionMetadataAPIHandler(p *handler.RequestProvider) http.Handler
 		Ctx:     context,
 		Session: db,
 	}
+	fetchCoalescer := p.FetchCoalescer
+	nftTrackedCollectionQuery := &query.NFTTrackedCollectionQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftJobMutator := &mutator.NFTJobMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	jobQueueService := &service.JobQueueService{
+		Clock:         clockClock,
+		Config:        config,
+		NFTJobMutator: nftJobMutator,
+	}
 	metadataService := &service.MetadataService{
-		Clock:                clockClock,
-		Config:               config,
-		AlchemyAPI:           alchemyAPI,
-		NFTCollectionQuery:   nftCollectionQuery,
-		NFTCollectionMutator: nftCollectionMutator,
+		Clock:                     clockClock,
+		Config:                    config,
+		NFTDataProvider:           nftDataProviderRouter,
+		NFTCollectionQuery:        nftCollectionQuery,
+		NFTCollectionMutator:      nftCollectionMutator,
+		FetchCoalescer:            fetchCoalescer,
+		NFTTrackedCollectionQuery: nftTrackedCollectionQuery,
+		JobQueue:                  jobQueueService,
 	}
 	getCollectionMetadataAPIHandler := &handler.GetCollectionMetadataAPIHandler{
 		JSON:            jsonResponseWriter,
 		Logger:          getCollectionMetadataHandlerLogger,
+		Config:          config,
 		MetadataService: metadataService,
 	}
 	return getCollectionMetadataAPIHandler
@@ -146,8 +228,24 @@ func NewProbeCollectionAPIHandler(p *handler.RequestProvider) http.Handler {
 	}
 	probeCollectionHandlerLogger := handler.NewProbeCollectionHandlerLogger(factory)
 	config := p.Config
+	rateLimiter := p.RateLimiter
+	apiKeyPool := p.APIKeyPool
+	circuitBreakers := p.CircuitBreakers
 	alchemyAPI := &web3.AlchemyAPI{
-		Config: config,
+		Config:          config,
+		RateLimiter:     rateLimiter,
+		APIKeyPool:      apiKeyPool,
+		CircuitBreakers: circuitBreakers,
+	}
+	jsonrpcapi := &web3.JSONRPCAPI{
+		Config:          config,
+		RateLimiter:     rateLimiter,
+		CircuitBreakers: circuitBreakers,
+	}
+	nftDataProviderRouter := &web3.NFTDataProviderRouter{
+		Config:     config,
+		AlchemyAPI: alchemyAPI,
+		JSONRPCAPI: jsonrpcapi,
 	}
 	request := p.Request
 	context := handler.ProvideRequestContext(request)
@@ -160,15 +258,534 @@ func NewProbeCollectionAPIHandler(p *handler.RequestProvider) http.Handler {
 		Ctx:     context,
 		Session: db,
 	}
+	clockClock := _wireSystemClockValue
+	nftJobMutator := &mutator.NFTJobMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	jobQueueService := &service.JobQueueService{
+		Clock:         clockClock,
+		Config:        config,
+		NFTJobMutator: nftJobMutator,
+	}
 	probeService := &service.ProbeService{
-		AlchemyAPI:                alchemyAPI,
+		Config:                    config,
+		NFTDataProvider:           nftDataProviderRouter,
 		NFTCollectionProbeQuery:   nftCollectionProbeQuery,
 		NFTCollectionProbeMutator: nftCollectionProbeMutator,
+		JobQueue:                  jobQueueService,
 	}
 	probeCollectionAPIHandler := &handler.ProbeCollectionAPIHandler{
 		JSON:         jsonResponseWriter,
 		Logger:       probeCollectionHandlerLogger,
+		Config:       config,
 		ProbeService: probeService,
 	}
 	return probeCollectionAPIHandler
 }
+
+func NewUsageAPIHandler(p *handler.RequestProvider) http.Handler {
+	factory := p.LogFactory
+	jsonResponseWriterLogger := httputil.NewJSONResponseWriterLogger(factory)
+	jsonResponseWriter := &httputil.JSONResponseWriter{
+		Logger: jsonResponseWriterLogger,
+	}
+	usageHandlerLogger := handler.NewUsageHandlerLogger(factory)
+	config := p.Config
+	rateLimiter := p.RateLimiter
+	apiKeyPool := p.APIKeyPool
+	usageReporter := &web3.UsageReporter{
+		Config:      config,
+		RateLimiter: rateLimiter,
+		APIKeyPool:  apiKeyPool,
+	}
+	usageAPIHandler := &handler.UsageAPIHandler{
+		JSON:          jsonResponseWriter,
+		Logger:        usageHandlerLogger,
+		UsageReporter: usageReporter,
+	}
+	return usageAPIHandler
+}
+
+func NewRegisterTrackedCollectionAPIHandler(p *handler.RequestProvider) http.Handler {
+	factory := p.LogFactory
+	jsonResponseWriterLogger := httputil.NewJSONResponseWriterLogger(factory)
+	jsonResponseWriter := &httputil.JSONResponseWriter{
+		Logger: jsonResponseWriterLogger,
+	}
+	trackedCollectionHandlerLogger := handler.NewTrackedCollectionHandlerLogger(factory)
+	config := p.Config
+	clockClock := _wireSystemClockValue
+	request := p.Request
+	context := handler.ProvideRequestContext(request)
+	db := p.Database
+	nftTrackedCollectionQuery := &query.NFTTrackedCollectionQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftTrackedCollectionMutator := &mutator.NFTTrackedCollectionMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	trackedCollectionService := &service.TrackedCollectionService{
+		Clock:                       clockClock,
+		NFTTrackedCollectionQuery:   nftTrackedCollectionQuery,
+		NFTTrackedCollectionMutator: nftTrackedCollectionMutator,
+	}
+	registerTrackedCollectionAPIHandler := &handler.RegisterTrackedCollectionAPIHandler{
+		JSON:                     jsonResponseWriter,
+		Logger:                   trackedCollectionHandlerLogger,
+		Config:                   config,
+		TrackedCollectionService: trackedCollectionService,
+	}
+	return registerTrackedCollectionAPIHandler
+}
+
+func NewListTrackedCollectionsAPIHandler(p *handler.RequestProvider) http.Handler {
+	factory := p.LogFactory
+	jsonResponseWriterLogger := httputil.NewJSONResponseWriterLogger(factory)
+	jsonResponseWriter := &httputil.JSONResponseWriter{
+		Logger: jsonResponseWriterLogger,
+	}
+	trackedCollectionHandlerLogger := handler.NewTrackedCollectionHandlerLogger(factory)
+	clockClock := _wireSystemClockValue
+	request := p.Request
+	context := handler.ProvideRequestContext(request)
+	db := p.Database
+	nftTrackedCollectionQuery := &query.NFTTrackedCollectionQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftTrackedCollectionMutator := &mutator.NFTTrackedCollectionMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	trackedCollectionService := &service.TrackedCollectionService{
+		Clock:                       clockClock,
+		NFTTrackedCollectionQuery:   nftTrackedCollectionQuery,
+		NFTTrackedCollectionMutator: nftTrackedCollectionMutator,
+	}
+	listTrackedCollectionsAPIHandler := &handler.ListTrackedCollectionsAPIHandler{
+		JSON:                     jsonResponseWriter,
+		Logger:                   trackedCollectionHandlerLogger,
+		TrackedCollectionService: trackedCollectionService,
+	}
+	return listTrackedCollectionsAPIHandler
+}
+
+func NewPauseTrackedCollectionAPIHandler(p *handler.RequestProvider) http.Handler {
+	factory := p.LogFactory
+	jsonResponseWriterLogger := httputil.NewJSONResponseWriterLogger(factory)
+	jsonResponseWriter := &httputil.JSONResponseWriter{
+		Logger: jsonResponseWriterLogger,
+	}
+	trackedCollectionHandlerLogger := handler.NewTrackedCollectionHandlerLogger(factory)
+	clockClock := _wireSystemClockValue
+	request := p.Request
+	context := handler.ProvideRequestContext(request)
+	db := p.Database
+	nftTrackedCollectionQuery := &query.NFTTrackedCollectionQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftTrackedCollectionMutator := &mutator.NFTTrackedCollectionMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	trackedCollectionService := &service.TrackedCollectionService{
+		Clock:                       clockClock,
+		NFTTrackedCollectionQuery:   nftTrackedCollectionQuery,
+		NFTTrackedCollectionMutator: nftTrackedCollectionMutator,
+	}
+	pauseTrackedCollectionAPIHandler := &handler.PauseTrackedCollectionAPIHandler{
+		JSON:                     jsonResponseWriter,
+		Logger:                   trackedCollectionHandlerLogger,
+		TrackedCollectionService: trackedCollectionService,
+	}
+	return pauseTrackedCollectionAPIHandler
+}
+
+func NewRemoveTrackedCollectionAPIHandler(p *handler.RequestProvider) http.Handler {
+	factory := p.LogFactory
+	jsonResponseWriterLogger := httputil.NewJSONResponseWriterLogger(factory)
+	jsonResponseWriter := &httputil.JSONResponseWriter{
+		Logger: jsonResponseWriterLogger,
+	}
+	trackedCollectionHandlerLogger := handler.NewTrackedCollectionHandlerLogger(factory)
+	clockClock := _wireSystemClockValue
+	request := p.Request
+	context := handler.ProvideRequestContext(request)
+	db := p.Database
+	nftTrackedCollectionQuery := &query.NFTTrackedCollectionQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftTrackedCollectionMutator := &mutator.NFTTrackedCollectionMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	trackedCollectionService := &service.TrackedCollectionService{
+		Clock:                       clockClock,
+		NFTTrackedCollectionQuery:   nftTrackedCollectionQuery,
+		NFTTrackedCollectionMutator: nftTrackedCollectionMutator,
+	}
+	removeTrackedCollectionAPIHandler := &handler.RemoveTrackedCollectionAPIHandler{
+		JSON:                     jsonResponseWriter,
+		Logger:                   trackedCollectionHandlerLogger,
+		TrackedCollectionService: trackedCollectionService,
+	}
+	return removeTrackedCollectionAPIHandler
+}
+
+func NewGCService(p *job.Provider) *service.GCService {
+	context := p.Context
+	clockClock := _wireSystemClockValue
+	config := p.Config
+	factory := p.LogFactory
+	gcServiceLogger := service.NewGCServiceLogger(factory)
+	db := p.Database
+	nftOwnershipMutator := &mutator.NFTOwnershipMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	nftOwnershipHistoryPartitionQuery := &query.NFTOwnershipHistoryPartitionQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftOwnershipHistoryPartitionMutator := &mutator.NFTOwnershipHistoryPartitionMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	nftCollectionMutator := &mutator.NFTCollectionMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	nftTrackedCollectionQuery := &query.NFTTrackedCollectionQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	advisoryLockMutator := &mutator.AdvisoryLockMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	gcService := &service.GCService{
+		Context:                             context,
+		Clock:                               clockClock,
+		Config:                              config,
+		Logger:                              gcServiceLogger,
+		NFTOwnershipMutator:                 nftOwnershipMutator,
+		NFTOwnershipHistoryPartitionQuery:   nftOwnershipHistoryPartitionQuery,
+		NFTOwnershipHistoryPartitionMutator: nftOwnershipHistoryPartitionMutator,
+		NFTCollectionMutator:                nftCollectionMutator,
+		NFTTrackedCollectionQuery:           nftTrackedCollectionQuery,
+		Lock:                                advisoryLockMutator,
+	}
+	return gcService
+}
+
+func NewIndexerService(p *job.Provider) *service.IndexerService {
+	context := p.Context
+	clockClock := _wireSystemClockValue
+	config := p.Config
+	factory := p.LogFactory
+	indexerServiceLogger := service.NewIndexerServiceLogger(factory)
+	rateLimiter := p.RateLimiter
+	apiKeyPool := p.APIKeyPool
+	circuitBreakers := p.CircuitBreakers
+	alchemyAPI := &web3.AlchemyAPI{
+		Config:          config,
+		RateLimiter:     rateLimiter,
+		APIKeyPool:      apiKeyPool,
+		CircuitBreakers: circuitBreakers,
+	}
+	jsonrpcapi := &web3.JSONRPCAPI{
+		Config:          config,
+		RateLimiter:     rateLimiter,
+		CircuitBreakers: circuitBreakers,
+	}
+	nftDataProviderRouter := &web3.NFTDataProviderRouter{
+		Config:     config,
+		AlchemyAPI: alchemyAPI,
+		JSONRPCAPI: jsonrpcapi,
+	}
+	db := p.Database
+	nftOwnershipQuery := query.NFTOwnershipQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftIndexerCheckpointQuery := &query.NFTIndexerCheckpointQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftIndexerBlockQuery := &query.NFTIndexerBlockQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftIndexerMutator := &mutator.NFTIndexerMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	nftTrackedCollectionQuery := &query.NFTTrackedCollectionQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftCollectionQuery := query.NFTCollectionQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftCollectionMutator := &mutator.NFTCollectionMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	fetchCoalescer := p.FetchCoalescer
+	nftJobMutator := &mutator.NFTJobMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	jobQueueService := &service.JobQueueService{
+		Clock:         clockClock,
+		Config:        config,
+		NFTJobMutator: nftJobMutator,
+	}
+	metadataService := &service.MetadataService{
+		Clock:                     clockClock,
+		Config:                    config,
+		NFTDataProvider:           nftDataProviderRouter,
+		NFTCollectionQuery:        nftCollectionQuery,
+		NFTCollectionMutator:      nftCollectionMutator,
+		FetchCoalescer:            fetchCoalescer,
+		NFTTrackedCollectionQuery: nftTrackedCollectionQuery,
+		JobQueue:                  jobQueueService,
+	}
+	indexerService := &service.IndexerService{
+		Context:                   context,
+		Clock:                     clockClock,
+		Config:                    config,
+		Logger:                    indexerServiceLogger,
+		NFTDataProvider:           nftDataProviderRouter,
+		NFTOwnershipQuery:         nftOwnershipQuery,
+		NFTIndexerCheckpointQuery: nftIndexerCheckpointQuery,
+		NFTIndexerBlockQuery:      nftIndexerBlockQuery,
+		NFTIndexerMutator:         nftIndexerMutator,
+		NFTTrackedCollectionQuery: nftTrackedCollectionQuery,
+		MetadataService:           metadataService,
+	}
+	return indexerService
+}
+
+func NewBackfillService(p *job.Provider) *service.BackfillService {
+	clockClock := _wireSystemClockValue
+	config := p.Config
+	context := p.Context
+	factory := p.LogFactory
+	indexerServiceLogger := service.NewIndexerServiceLogger(factory)
+	rateLimiter := p.RateLimiter
+	apiKeyPool := p.APIKeyPool
+	circuitBreakers := p.CircuitBreakers
+	alchemyAPI := &web3.AlchemyAPI{
+		Config:          config,
+		RateLimiter:     rateLimiter,
+		APIKeyPool:      apiKeyPool,
+		CircuitBreakers: circuitBreakers,
+	}
+	jsonrpcapi := &web3.JSONRPCAPI{
+		Config:          config,
+		RateLimiter:     rateLimiter,
+		CircuitBreakers: circuitBreakers,
+	}
+	nftDataProviderRouter := &web3.NFTDataProviderRouter{
+		Config:     config,
+		AlchemyAPI: alchemyAPI,
+		JSONRPCAPI: jsonrpcapi,
+	}
+	db := p.Database
+	nftOwnershipQuery := query.NFTOwnershipQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftIndexerCheckpointQuery := &query.NFTIndexerCheckpointQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftIndexerBlockQuery := &query.NFTIndexerBlockQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftIndexerMutator := &mutator.NFTIndexerMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	nftTrackedCollectionQuery := &query.NFTTrackedCollectionQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftCollectionQuery := query.NFTCollectionQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftCollectionMutator := &mutator.NFTCollectionMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	fetchCoalescer := p.FetchCoalescer
+	nftJobMutator := &mutator.NFTJobMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	jobQueueService := &service.JobQueueService{
+		Clock:         clockClock,
+		Config:        config,
+		NFTJobMutator: nftJobMutator,
+	}
+	metadataService := &service.MetadataService{
+		Clock:                     clockClock,
+		Config:                    config,
+		NFTDataProvider:           nftDataProviderRouter,
+		NFTCollectionQuery:        nftCollectionQuery,
+		NFTCollectionMutator:      nftCollectionMutator,
+		FetchCoalescer:            fetchCoalescer,
+		NFTTrackedCollectionQuery: nftTrackedCollectionQuery,
+		JobQueue:                  jobQueueService,
+	}
+	indexerService := &service.IndexerService{
+		Context:                   context,
+		Clock:                     clockClock,
+		Config:                    config,
+		Logger:                    indexerServiceLogger,
+		NFTDataProvider:           nftDataProviderRouter,
+		NFTOwnershipQuery:         nftOwnershipQuery,
+		NFTIndexerCheckpointQuery: nftIndexerCheckpointQuery,
+		NFTIndexerBlockQuery:      nftIndexerBlockQuery,
+		NFTIndexerMutator:         nftIndexerMutator,
+		NFTTrackedCollectionQuery: nftTrackedCollectionQuery,
+		MetadataService:           metadataService,
+	}
+	nftTrackedCollectionMutator := &mutator.NFTTrackedCollectionMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	backfillService := &service.BackfillService{
+		Clock:                       clockClock,
+		Config:                      config,
+		IndexerService:              indexerService,
+		NFTTrackedCollectionQuery:   nftTrackedCollectionQuery,
+		NFTTrackedCollectionMutator: nftTrackedCollectionMutator,
+	}
+	return backfillService
+}
+
+func NewJobRunnerService(p *job.Provider) *service.JobRunnerService {
+	context := p.Context
+	clockClock := _wireSystemClockValue
+	config := p.Config
+	factory := p.LogFactory
+	jobRunnerServiceLogger := service.NewJobRunnerServiceLogger(factory)
+	db := p.Database
+	nftJobMutator := &mutator.NFTJobMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	ownershipServiceLogger := service.NewOwnershipServiceLogger(factory)
+	rateLimiter := p.RateLimiter
+	apiKeyPool := p.APIKeyPool
+	circuitBreakers := p.CircuitBreakers
+	alchemyAPI := &web3.AlchemyAPI{
+		Config:          config,
+		RateLimiter:     rateLimiter,
+		APIKeyPool:      apiKeyPool,
+		CircuitBreakers: circuitBreakers,
+	}
+	jsonrpcapi := &web3.JSONRPCAPI{
+		Config:          config,
+		RateLimiter:     rateLimiter,
+		CircuitBreakers: circuitBreakers,
+	}
+	nftDataProviderRouter := &web3.NFTDataProviderRouter{
+		Config:     config,
+		AlchemyAPI: alchemyAPI,
+		JSONRPCAPI: jsonrpcapi,
+	}
+	nftOwnershipQuery := &query.NFTOwnershipQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftOwnershipMutator := &mutator.NFTOwnershipMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	fetchCoalescer := p.FetchCoalescer
+	nftIndexerCheckpointQuery := &query.NFTIndexerCheckpointQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftTrackedCollectionQuery := &query.NFTTrackedCollectionQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftOwnershipUndoQuery := &query.NFTOwnershipUndoQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	jobQueueService := &service.JobQueueService{
+		Clock:         clockClock,
+		Config:        config,
+		NFTJobMutator: nftJobMutator,
+	}
+	ownershipService := &service.OwnershipService{
+		Clock:                     clockClock,
+		Logger:                    ownershipServiceLogger,
+		Config:                    config,
+		NFTDataProvider:           nftDataProviderRouter,
+		NFTOwnershipQuery:         nftOwnershipQuery,
+		NFTOwnershipMutator:       nftOwnershipMutator,
+		FetchCoalescer:            fetchCoalescer,
+		NFTIndexerCheckpointQuery: nftIndexerCheckpointQuery,
+		NFTTrackedCollectionQuery: nftTrackedCollectionQuery,
+		NFTOwnershipUndoQuery:     nftOwnershipUndoQuery,
+		JobQueue:                  jobQueueService,
+	}
+	nftCollectionQuery := query.NFTCollectionQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftCollectionMutator := &mutator.NFTCollectionMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	metadataService := &service.MetadataService{
+		Clock:                     clockClock,
+		Config:                    config,
+		NFTDataProvider:           nftDataProviderRouter,
+		NFTCollectionQuery:        nftCollectionQuery,
+		NFTCollectionMutator:      nftCollectionMutator,
+		FetchCoalescer:            fetchCoalescer,
+		NFTTrackedCollectionQuery: nftTrackedCollectionQuery,
+		JobQueue:                  jobQueueService,
+	}
+	nftCollectionProbeQuery := &query.NFTCollectionProbeQuery{
+		Ctx:     context,
+		Session: db,
+	}
+	nftCollectionProbeMutator := &mutator.NFTCollectionProbeMutator{
+		Ctx:     context,
+		Session: db,
+	}
+	probeService := &service.ProbeService{
+		Config:                    config,
+		NFTDataProvider:           nftDataProviderRouter,
+		NFTCollectionProbeQuery:   nftCollectionProbeQuery,
+		NFTCollectionProbeMutator: nftCollectionProbeMutator,
+		JobQueue:                  jobQueueService,
+	}
+	jobRunnerService := &service.JobRunnerService{
+		Context:          context,
+		Clock:            clockClock,
+		Config:           config,
+		Logger:           jobRunnerServiceLogger,
+		NFTJobMutator:    nftJobMutator,
+		OwnershipService: ownershipService,
+		MetadataService:  metadataService,
+		ProbeService:     probeService,
+	}
+	return jobRunnerService
+}
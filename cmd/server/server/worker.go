@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/job"
+	"github.com/authgear/authgear-nft-indexer/pkg/service"
+	"github.com/authgear/authgear-nft-indexer/pkg/web3"
+	"github.com/authgear/authgear-server/pkg/util/clock"
+	"github.com/authgear/authgear-server/pkg/util/log"
+	"github.com/authgear/authgear-server/pkg/util/signalutil"
+)
+
+// WorkerController keeps the collections registered in eth_nft_tracked_collection current,
+// and runs the jobs enqueued in eth_nft_job
+type WorkerController struct {
+	Config config.Config
+	logger *log.Logger
+}
+
+func (c *WorkerController) Start(ctx context.Context) {
+	database := database.GetDatabase(c.Config.Database)
+
+	lf := log.NewFactory(log.LevelInfo)
+	c.logger = lf.New("worker")
+
+	provider := job.Provider{
+		Config:          c.Config,
+		Database:        database,
+		LogFactory:      lf,
+		RateLimiter:     web3.NewRateLimiter(c.Config, clock.NewSystemClock(), lf),
+		APIKeyPool:      web3.NewAPIKeyPool(clock.NewSystemClock(), lf),
+		CircuitBreakers: web3.NewCircuitBreakers(c.Config, clock.NewSystemClock(), lf),
+		FetchCoalescer:  service.NewFetchCoalescer(c.Config),
+	}
+
+	daemons := []signalutil.Daemon{&job.PeriodicDaemon{
+		Name:     "Indexer",
+		Interval: c.Config.Worker.GetPollInterval(),
+		Run: func(ctx context.Context) error {
+			p := provider
+			p.Context = ctx
+			indexerService := NewIndexerService(&p)
+
+			// Keep going without waiting for the next poll until every chain is caught up
+			for ctx.Err() == nil {
+				caughtUp, err := indexerService.IndexAll()
+				if err != nil {
+					return err
+				}
+				if caughtUp {
+					return nil
+				}
+			}
+			return nil
+		},
+	}}
+
+	daemons = append(daemons, newJobDaemons(provider, c.Config.Jobs.GetConcurrency())...)
+
+	signalutil.Start(ctx, c.logger, daemons...)
+}
+
+// newJobDaemons runs concurrency jobs at once, workers and API servers of several replicas share the queue
+func newJobDaemons(provider job.Provider, concurrency int) []signalutil.Daemon {
+	daemons := make([]signalutil.Daemon, 0, concurrency)
+	// Each daemon runs one job at a time
+	for i := 1; i <= concurrency; i++ {
+		daemons = append(daemons, &job.PeriodicDaemon{
+			Name:     fmt.Sprintf("Jobs %d", i),
+			Interval: provider.Config.Jobs.GetPollInterval(),
+			Run: func(ctx context.Context) error {
+				p := provider
+				p.Context = ctx
+				jobRunnerService := NewJobRunnerService(&p)
+
+				// Keep going without waiting for the next poll until the queue is drained
+				for ctx.Err() == nil {
+					ran, err := jobRunnerService.RunNext()
+					if err != nil {
+						return err
+					}
+					if !ran {
+						return nil
+					}
+				}
+				return nil
+			},
+		})
+	}
+	return daemons
+}
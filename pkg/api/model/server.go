@@ -56,6 +56,14 @@ type NFTOwnership struct {
 	AccountIdentifier AccountIdentifier `json:"account_identifier"`
 	NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
 	NFTs              []NFT             `json:"nfts"`
+	// Stale is true if cached data past its fresh TTL is returned, while it is refreshed in the background or because the upstream is unavailable
+	Stale bool `json:"stale"`
+	// FetchedAt is when the least recently fetched ownerships were fetched from the upstream
+	FetchedAt *time.Time `json:"fetched_at,omitempty"`
+	// Truncated is true if not all NFTs could be fetched, so a missing NFT does not mean it is not owned.
+	// TruncatedReason is one of timeout, nft_page_limit and transfer_page_limit
+	Truncated       bool   `json:"truncated,omitempty"`
+	TruncatedReason string `json:"truncated_reason,omitempty"`
 }
 
 func NewNFTOwnership(ownerID authgearweb3.ContractID, nfts []NFT) NFTOwnership {
@@ -76,6 +84,10 @@ type GetContractMetadataRequestData struct {
 }
 type GetContractMetadataResponse struct {
 	Collections []NFTCollection `json:"collections"`
+	// Stale is true if cached data past its fresh TTL is returned, while it is refreshed in the background or because the upstream is unavailable
+	Stale bool `json:"stale"`
+	// FetchedAt is when the least recently fetched collection was fetched from the upstream
+	FetchedAt *time.Time `json:"fetched_at,omitempty"`
 }
 
 type ProbeCollectionRequestData struct {
@@ -89,4 +101,62 @@ type ProbeCollectionResponse struct {
 type ListOwnerNFTRequestData struct {
 	OwnerAddress authgearweb3.ContractID   `json:"owner_address"`
 	ContractIDs  []authgearweb3.ContractID `json:"contract_ids"`
+	// Commitment is latest, safe or finalized, latest if empty
+	Commitment string `json:"commitment,omitempty"`
+}
+
+type APIKeyUsage struct {
+	Blockchain        string     `json:"blockchain"`
+	Network           string     `json:"network"`
+	Key               string     `json:"key"`
+	Requests          int64      `json:"requests"`
+	Failures          int64      `json:"failures"`
+	LastFailure       string     `json:"last_failure,omitempty"`
+	CooldownUntil     *time.Time `json:"cooldown_until,omitempty"`
+	ComputeUnitsToday int64      `json:"compute_units_today"`
+}
+
+// UsageScopeReplica means the usage is counted in memory by the replica serving the request,
+// it is neither shared with nor summed over other replicas
+const UsageScopeReplica = "replica"
+
+type GetUsageResponse struct {
+	Scope   string        `json:"scope"`
+	APIKeys []APIKeyUsage `json:"api_keys"`
+}
+
+type TrackedCollection struct {
+	ContractID authgearweb3.ContractID `json:"contract_id"`
+	// Mode is indexed or cached
+	Mode       string     `json:"mode"`
+	StartBlock int64      `json:"start_block"`
+	TTLSeconds *int       `json:"ttl_seconds,omitempty"`
+	PausedAt   *time.Time `json:"paused_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type RegisterTrackedCollectionRequestData struct {
+	ContractID authgearweb3.ContractID `json:"contract_id"`
+	Mode       string                  `json:"mode"`
+	StartBlock int64                   `json:"start_block"`
+	TTLSeconds *int                    `json:"ttl_seconds"`
+}
+
+type PauseTrackedCollectionRequestData struct {
+	ContractID authgearweb3.ContractID `json:"contract_id"`
+	// Paused false resumes the collection
+	Paused bool `json:"paused"`
+}
+
+type RemoveTrackedCollectionRequestData struct {
+	ContractID authgearweb3.ContractID `json:"contract_id"`
+}
+
+type TrackedCollectionResponse struct {
+	Collection TrackedCollection `json:"collection"`
+}
+
+type ListTrackedCollectionsResponse struct {
+	Collections []TrackedCollection `json:"collections"`
 }
@@ -1,5 +1,9 @@
 package config
 
+import (
+	"time"
+)
+
 var _ = Schema.Add("AlchemyConfig", `
 {
 	"type": "object",
@@ -7,14 +11,108 @@ var _ = Schema.Add("AlchemyConfig", `
 	"properties": {
 		"blockchain": { "type": "string" },
 		"network": { "type": "string" },
-		"api_key": { "type": "string" }
+		"api_key": { "type": "string" },
+		"api_version": { "type": "string", "enum": ["v2", "v3"] },
+		"api_keys": {
+			"type": "array",
+			"items": { "$ref": "#/$defs/AlchemyAPIKeyConfig" }
+		},
+		"key_selection": { "type": "string", "enum": ["round_robin", "weighted"] },
+		"key_cooldown_seconds": { "type": "integer", "minimum": 0 }
 	},
-	"required": ["blockchain", "network", "api_key"]
+	"required": ["blockchain", "network"],
+	"anyOf": [
+		{ "required": ["api_key"] },
+		{ "required": ["api_keys"] }
+	]
 }
 `)
 
+var _ = Schema.Add("AlchemyAPIKeyConfig", `
+{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"key": { "type": "string", "minLength": 1 },
+		"weight": { "type": "integer", "minimum": 1 }
+	},
+	"required": ["key"]
+}
+`)
+
+type AlchemyAPIVersion string
+
+const (
+	AlchemyAPIVersionV2 AlchemyAPIVersion = "v2"
+	AlchemyAPIVersionV3 AlchemyAPIVersion = "v3"
+)
+
+type KeySelection string
+
+const (
+	KeySelectionRoundRobin KeySelection = "round_robin"
+	KeySelectionWeighted   KeySelection = "weighted"
+)
+
+const DefaultKeyCooldown = 60 * time.Second
+
+type AlchemyAPIKeyConfig struct {
+	Key string `json:"key"`
+	// Weight is only used by weighted selection, defaults to 1
+	Weight int `json:"weight,omitempty"`
+}
+
+func (c AlchemyAPIKeyConfig) GetWeight() int {
+	if c.Weight == 0 {
+		return 1
+	}
+	return c.Weight
+}
+
 type AlchemyConfig struct {
 	Blockchain string `json:"blockchain"`
 	Network    string `json:"network"`
-	APIKey     string `json:"api_key"`
+	// APIKey is kept for compatibility, it is used together with APIKeys
+	APIKey       string                `json:"api_key,omitempty"`
+	APIKeys      []AlchemyAPIKeyConfig `json:"api_keys,omitempty"`
+	KeySelection KeySelection          `json:"key_selection,omitempty"`
+	// KeyCooldownSeconds is how long a key is taken out of rotation after an auth or quota error
+	KeyCooldownSeconds *int `json:"key_cooldown_seconds,omitempty"`
+	// APIVersion is the version of the NFT API, defaults to v2
+	APIVersion AlchemyAPIVersion `json:"api_version,omitempty"`
+}
+
+func (c AlchemyConfig) GetAPIVersion() AlchemyAPIVersion {
+	if c.APIVersion == "" {
+		return AlchemyAPIVersionV2
+	}
+	return c.APIVersion
+}
+
+// GetAPIKeys returns api_key followed by api_keys
+func (c AlchemyConfig) GetAPIKeys() []AlchemyAPIKeyConfig {
+	keys := make([]AlchemyAPIKeyConfig, 0, len(c.APIKeys)+1)
+	if c.APIKey != "" {
+		keys = append(keys, AlchemyAPIKeyConfig{Key: c.APIKey})
+	}
+	for _, key := range c.APIKeys {
+		if key.Key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (c AlchemyConfig) GetKeySelection() KeySelection {
+	if c.KeySelection == "" {
+		return KeySelectionRoundRobin
+	}
+	return c.KeySelection
+}
+
+func (c AlchemyConfig) GetKeyCooldown() time.Duration {
+	if c.KeyCooldownSeconds == nil {
+		return DefaultKeyCooldown
+	}
+	return time.Duration(*c.KeyCooldownSeconds) * time.Second
 }
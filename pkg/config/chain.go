@@ -0,0 +1,177 @@
+package config
+
+import (
+	"strconv"
+)
+
+var _ = Schema.Add("ChainConfig", `
+{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"blockchain": { "type": "string" },
+		"chain_id": { "type": "integer", "minimum": 1 },
+		"name": { "type": "string" },
+		"endpoints": { "$ref": "#/$defs/ChainEndpointsConfig" },
+		"native_currency": { "$ref": "#/$defs/NativeCurrencyConfig" },
+		"confirmations": { "type": "integer", "minimum": 0 },
+		"safe_confirmations": { "type": "integer", "minimum": 0 }
+	},
+	"required": ["blockchain", "chain_id", "name"]
+}
+`)
+
+var _ = Schema.Add("ChainEndpointsConfig", `
+{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"alchemy": { "type": "string", "format": "uri" },
+		"json_rpc": { "type": "string", "format": "uri" }
+	}
+}
+`)
+
+var _ = Schema.Add("NativeCurrencyConfig", `
+{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"name": { "type": "string" },
+		"symbol": { "type": "string" },
+		"decimals": { "type": "integer", "minimum": 0 }
+	},
+	"required": ["name", "symbol", "decimals"]
+}
+`)
+
+type ChainEndpointsConfig struct {
+	// Alchemy is the base URL of the Alchemy API, the API key is appended to the path
+	Alchemy string `json:"alchemy,omitempty"`
+	// JSONRPC is the default URL of the json_rpc provider
+	JSONRPC string `json:"json_rpc,omitempty"`
+}
+
+type NativeCurrencyConfig struct {
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+}
+
+type ChainConfig struct {
+	Blockchain     string               `json:"blockchain"`
+	ChainID        int64                `json:"chain_id"`
+	Name           string               `json:"name"`
+	Endpoints      ChainEndpointsConfig `json:"endpoints"`
+	NativeCurrency NativeCurrencyConfig `json:"native_currency"`
+	// Confirmations is the number of blocks after which a block is considered final
+	Confirmations int `json:"confirmations"`
+	// SafeConfirmations is the number of blocks after which a block is unlikely to be reorganized, it defaults to Confirmations
+	SafeConfirmations *int `json:"safe_confirmations,omitempty"`
+}
+
+func (c ChainConfig) GetSafeConfirmations() int {
+	if c.SafeConfirmations == nil {
+		return c.Confirmations
+	}
+	return *c.SafeConfirmations
+}
+
+// Network is the network of contract IDs on this chain, which is the chain ID
+func (c ChainConfig) Network() string {
+	return strconv.FormatInt(c.ChainID, 10)
+}
+
+func confirmations(n int) *int {
+	return &n
+}
+
+var ether = NativeCurrencyConfig{Name: "Ether", Symbol: "ETH", Decimals: 18}
+var pol = NativeCurrencyConfig{Name: "POL", Symbol: "POL", Decimals: 18}
+
+// DefaultChains are available without configuration, entries in the chains section with the same chain ID override them
+var DefaultChains = []ChainConfig{
+	{
+		Blockchain:        "ethereum",
+		ChainID:           1,
+		Name:              "Ethereum Mainnet",
+		Endpoints:         ChainEndpointsConfig{Alchemy: "https://eth-mainnet.g.alchemy.com/"},
+		NativeCurrency:    ether,
+		Confirmations:     12,
+		SafeConfirmations: confirmations(3),
+	},
+	{
+		Blockchain:        "ethereum",
+		ChainID:           11155111,
+		Name:              "Ethereum Sepolia",
+		Endpoints:         ChainEndpointsConfig{Alchemy: "https://eth-sepolia.g.alchemy.com/"},
+		NativeCurrency:    NativeCurrencyConfig{Name: "Sepolia Ether", Symbol: "ETH", Decimals: 18},
+		Confirmations:     12,
+		SafeConfirmations: confirmations(3),
+	},
+	{
+		Blockchain:        "ethereum",
+		ChainID:           137,
+		Name:              "Polygon Mainnet",
+		Endpoints:         ChainEndpointsConfig{Alchemy: "https://polygon-mainnet.g.alchemy.com/"},
+		NativeCurrency:    pol,
+		Confirmations:     128,
+		SafeConfirmations: confirmations(16),
+	},
+	{
+		Blockchain:        "ethereum",
+		ChainID:           80002,
+		Name:              "Polygon Amoy",
+		Endpoints:         ChainEndpointsConfig{Alchemy: "https://polygon-amoy.g.alchemy.com/"},
+		NativeCurrency:    pol,
+		Confirmations:     128,
+		SafeConfirmations: confirmations(16),
+	},
+	{
+		Blockchain:        "ethereum",
+		ChainID:           8453,
+		Name:              "Base Mainnet",
+		Endpoints:         ChainEndpointsConfig{Alchemy: "https://base-mainnet.g.alchemy.com/"},
+		NativeCurrency:    ether,
+		Confirmations:     12,
+		SafeConfirmations: confirmations(3),
+	},
+	{
+		Blockchain:        "ethereum",
+		ChainID:           42161,
+		Name:              "Arbitrum One",
+		Endpoints:         ChainEndpointsConfig{Alchemy: "https://arb-mainnet.g.alchemy.com/"},
+		NativeCurrency:    ether,
+		Confirmations:     12,
+		SafeConfirmations: confirmations(3),
+	},
+	{
+		Blockchain:        "ethereum",
+		ChainID:           10,
+		Name:              "OP Mainnet",
+		Endpoints:         ChainEndpointsConfig{Alchemy: "https://opt-mainnet.g.alchemy.com/"},
+		NativeCurrency:    ether,
+		Confirmations:     12,
+		SafeConfirmations: confirmations(3),
+	},
+}
+
+// mergeChains overrides the default chains with the configured ones by blockchain and chain ID
+func mergeChains(defaults []ChainConfig, configured []ChainConfig) []ChainConfig {
+	chains := make([]ChainConfig, 0, len(defaults)+len(configured))
+	for _, defaultChain := range defaults {
+		overridden := false
+		for _, chain := range configured {
+			if chain.Blockchain == defaultChain.Blockchain && chain.ChainID == defaultChain.ChainID {
+				overridden = true
+				break
+			}
+		}
+
+		if !overridden {
+			chains = append(chains, defaultChain)
+		}
+	}
+
+	return append(chains, configured...)
+}
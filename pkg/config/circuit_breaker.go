@@ -0,0 +1,97 @@
+package config
+
+import (
+	"time"
+)
+
+var _ = Schema.Add("CircuitBreakerConfig", `
+{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"disabled": { "type": "boolean" },
+		"window_seconds": { "type": "integer", "minimum": 1 },
+		"min_requests": { "type": "integer", "minimum": 1 },
+		"error_rate_threshold": { "type": "number", "exclusiveMinimum": 0, "maximum": 1 },
+		"slow_call_ms": { "type": "integer", "minimum": 1 },
+		"slow_call_rate_threshold": { "type": "number", "exclusiveMinimum": 0, "maximum": 1 },
+		"open_seconds": { "type": "integer", "minimum": 1 },
+		"half_open_requests": { "type": "integer", "minimum": 1 }
+	}
+}
+`)
+
+const (
+	DefaultCircuitBreakerWindow                = 30 * time.Second
+	DefaultCircuitBreakerMinRequests           = 10
+	DefaultCircuitBreakerErrorRateThreshold    = 0.5
+	DefaultCircuitBreakerSlowCall              = 3 * time.Second
+	DefaultCircuitBreakerSlowCallRateThreshold = 0.5
+	DefaultCircuitBreakerOpenDuration          = 30 * time.Second
+	DefaultCircuitBreakerHalfOpenRequests      = 3
+)
+
+// CircuitBreakerConfig configures when calls to an upstream endpoint stop being made
+type CircuitBreakerConfig struct {
+	Disabled bool `json:"disabled,omitempty"`
+	// WindowSeconds is the period over which error and slow call rates are measured
+	WindowSeconds int `json:"window_seconds,omitempty"`
+	// MinRequests is the number of calls in the window before the breaker can trip
+	MinRequests           int     `json:"min_requests,omitempty"`
+	ErrorRateThreshold    float64 `json:"error_rate_threshold,omitempty"`
+	SlowCallMs            int     `json:"slow_call_ms,omitempty"`
+	SlowCallRateThreshold float64 `json:"slow_call_rate_threshold,omitempty"`
+	// OpenSeconds is how long calls fail fast before probing recovery
+	OpenSeconds int `json:"open_seconds,omitempty"`
+	// HalfOpenRequests is the number of probe calls that must succeed to close the breaker
+	HalfOpenRequests int `json:"half_open_requests,omitempty"`
+}
+
+func (c CircuitBreakerConfig) GetWindow() time.Duration {
+	if c.WindowSeconds == 0 {
+		return DefaultCircuitBreakerWindow
+	}
+	return time.Duration(c.WindowSeconds) * time.Second
+}
+
+func (c CircuitBreakerConfig) GetMinRequests() int {
+	if c.MinRequests == 0 {
+		return DefaultCircuitBreakerMinRequests
+	}
+	return c.MinRequests
+}
+
+func (c CircuitBreakerConfig) GetErrorRateThreshold() float64 {
+	if c.ErrorRateThreshold == 0 {
+		return DefaultCircuitBreakerErrorRateThreshold
+	}
+	return c.ErrorRateThreshold
+}
+
+func (c CircuitBreakerConfig) GetSlowCall() time.Duration {
+	if c.SlowCallMs == 0 {
+		return DefaultCircuitBreakerSlowCall
+	}
+	return time.Duration(c.SlowCallMs) * time.Millisecond
+}
+
+func (c CircuitBreakerConfig) GetSlowCallRateThreshold() float64 {
+	if c.SlowCallRateThreshold == 0 {
+		return DefaultCircuitBreakerSlowCallRateThreshold
+	}
+	return c.SlowCallRateThreshold
+}
+
+func (c CircuitBreakerConfig) GetOpenDuration() time.Duration {
+	if c.OpenSeconds == 0 {
+		return DefaultCircuitBreakerOpenDuration
+	}
+	return time.Duration(c.OpenSeconds) * time.Second
+}
+
+func (c CircuitBreakerConfig) GetHalfOpenRequests() int {
+	if c.HalfOpenRequests == 0 {
+		return DefaultCircuitBreakerHalfOpenRequests
+	}
+	return c.HalfOpenRequests
+}
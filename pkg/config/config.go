@@ -3,6 +3,8 @@ package config
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/authgear/authgear-server/pkg/util/validation"
@@ -16,16 +18,157 @@ var _ = Schema.Add("Config", `
 	"properties": {
 		"database": { "$ref": "#/$defs/DatabaseConfig" },
 		"server": { "$ref": "#/$defs/ServerConfig" },
-		"alchemy": { "type": "array", "items": { "$ref": "#/$defs/AlchemyConfig" } }
+		"alchemy": { "type": "array", "items": { "$ref": "#/$defs/AlchemyConfig" } },
+		"providers": { "type": "array", "items": { "$ref": "#/$defs/ProviderConfig" } },
+		"chains": { "type": "array", "items": { "$ref": "#/$defs/ChainConfig" } },
+		"upstream": { "$ref": "#/$defs/UpstreamConfig" },
+		"rate_limits": { "type": "array", "items": { "$ref": "#/$defs/RateLimitConfig" } },
+		"gc": { "$ref": "#/$defs/GCConfig" },
+		"worker": { "$ref": "#/$defs/WorkerConfig" },
+		"jobs": { "$ref": "#/$defs/JobsConfig" }
 	},
 	"required": ["database", "server", "alchemy"]
 }
 `)
 
 type Config struct {
-	Database DatabaseConfig  `json:"database"`
-	Server   ServerConfig    `json:"server"`
-	Alchemy  []AlchemyConfig `json:"alchemy"`
+	Database   DatabaseConfig    `json:"database"`
+	Server     ServerConfig      `json:"server"`
+	Alchemy    []AlchemyConfig   `json:"alchemy"`
+	Providers  []ProviderConfig  `json:"providers"`
+	Chains     []ChainConfig     `json:"chains"`
+	Upstream   UpstreamConfig    `json:"upstream"`
+	RateLimits []RateLimitConfig `json:"rate_limits"`
+	GC         GCConfig          `json:"gc"`
+	Worker     WorkerConfig      `json:"worker"`
+	Jobs       JobsConfig        `json:"jobs"`
+}
+
+func (c Config) GetRateLimitConfig(blockchain string, network string) *RateLimitConfig {
+	for i, rateLimit := range c.RateLimits {
+		if rateLimit.Blockchain == blockchain && rateLimit.Network == network {
+			return &c.RateLimits[i]
+		}
+	}
+
+	return nil
+}
+
+// GetChainConfig resolves the network from the chain registry
+func (c Config) GetChainConfig(blockchain string, network string) *ChainConfig {
+	for i, chain := range c.Chains {
+		if chain.Blockchain == blockchain && chain.Network() == network {
+			return &c.Chains[i]
+		}
+	}
+
+	return nil
+}
+
+// GetAlchemyConfig returns the Alchemy config of the network, nil if the network is not in the chain registry
+func (c Config) GetAlchemyConfig(blockchain string, network string) *AlchemyConfig {
+	if c.GetChainConfig(blockchain, network) == nil {
+		return nil
+	}
+
+	for i, alchemyConfig := range c.Alchemy {
+		if alchemyConfig.Blockchain == blockchain && alchemyConfig.Network == network {
+			return &c.Alchemy[i]
+		}
+	}
+
+	return nil
+}
+
+func (c Config) GetProviderConfig(blockchain string, network string) *ProviderConfig {
+	for i, provider := range c.Providers {
+		if provider.Blockchain == blockchain && provider.Network == network {
+			return &c.Providers[i]
+		}
+	}
+
+	return nil
+}
+
+// GetProviderType returns the NFT data provider configured for the network, defaults to Alchemy
+func (c Config) GetProviderType(blockchain string, network string) ProviderType {
+	provider := c.GetProviderConfig(blockchain, network)
+	if provider == nil {
+		return ProviderTypeAlchemy
+	}
+
+	return provider.Type
+}
+
+// GetJSONRPCURL returns the URL of the json_rpc provider, defaults to the json_rpc endpoint of the chain
+func (c Config) GetJSONRPCURL(blockchain string, network string) string {
+	if provider := c.GetProviderConfig(blockchain, network); provider != nil && provider.URL != "" {
+		return provider.URL
+	}
+
+	if chain := c.GetChainConfig(blockchain, network); chain != nil {
+		return chain.Endpoints.JSONRPC
+	}
+
+	return ""
+}
+
+// IsNetworkConfigured checks the network is in the chain registry and its provider has the required credentials
+func (c Config) IsNetworkConfigured(blockchain string, network string) bool {
+	chain := c.GetChainConfig(blockchain, network)
+	if chain == nil {
+		return false
+	}
+
+	switch c.GetProviderType(blockchain, network) {
+	case ProviderTypeAlchemy:
+		alchemyConfig := c.GetAlchemyConfig(blockchain, network)
+		return alchemyConfig != nil && len(alchemyConfig.GetAPIKeys()) != 0 && chain.Endpoints.Alchemy != ""
+	case ProviderTypeJSONRPC:
+		return c.GetJSONRPCURL(blockchain, network) != ""
+	}
+
+	return false
+}
+
+func (c Config) ConfiguredChains() []ChainConfig {
+	chains := make([]ChainConfig, 0)
+	for _, chain := range c.Chains {
+		if c.IsNetworkConfigured(chain.Blockchain, chain.Network()) {
+			chains = append(chains, chain)
+		}
+	}
+
+	return chains
+}
+
+// ValidateNetworks checks every network referenced by the alchemy and providers sections is usable.
+// Networks missing from the chain registry, e.g. retired testnets, are skipped with a warning
+func (c Config) ValidateNetworks() (warnings []string, err error) {
+	var errs []error
+	for _, alchemyConfig := range c.Alchemy {
+		if c.GetChainConfig(alchemyConfig.Blockchain, alchemyConfig.Network) == nil {
+			warnings = append(warnings, fmt.Sprintf("alchemy: network %v %v is not in the chain registry and is skipped", alchemyConfig.Blockchain, alchemyConfig.Network))
+			continue
+		}
+
+		if len(alchemyConfig.GetAPIKeys()) == 0 {
+			errs = append(errs, fmt.Errorf("alchemy: missing api_key or api_keys for network %v %v", alchemyConfig.Blockchain, alchemyConfig.Network))
+		}
+	}
+
+	for _, provider := range c.Providers {
+		if c.GetChainConfig(provider.Blockchain, provider.Network) == nil {
+			warnings = append(warnings, fmt.Sprintf("providers: network %v %v is not in the chain registry and is skipped", provider.Blockchain, provider.Network))
+			continue
+		}
+
+		if !c.IsNetworkConfigured(provider.Blockchain, provider.Network) {
+			errs = append(errs, fmt.Errorf("providers: %v provider of network %v %v is missing credentials or endpoint", provider.Type, provider.Blockchain, provider.Network))
+		}
+	}
+
+	return warnings, errors.Join(errs...)
 }
 
 func Parse(inputYAML []byte) (*Config, error) {
@@ -53,6 +196,8 @@ func Parse(inputYAML []byte) (*Config, error) {
 		return nil, err
 	}
 
+	config.Chains = mergeChains(DefaultChains, config.Chains)
+
 	return &config, nil
 }
 
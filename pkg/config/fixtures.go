@@ -0,0 +1,42 @@
+package config
+
+var _ = Schema.Add("FixturesConfig", `
+{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"mode": { "type": "string", "enum": ["off", "record", "replay"] },
+		"dir": { "type": "string", "minLength": 1 }
+	}
+}
+`)
+
+type FixturesMode string
+
+const (
+	FixturesModeOff    FixturesMode = "off"
+	FixturesModeRecord FixturesMode = "record"
+	FixturesModeReplay FixturesMode = "replay"
+)
+
+const DefaultFixturesDir = "fixtures"
+
+// FixturesConfig records upstream responses to files, or replays them instead of calling the providers
+type FixturesConfig struct {
+	Mode FixturesMode `json:"mode,omitempty"`
+	Dir  string       `json:"dir,omitempty"`
+}
+
+func (c FixturesConfig) GetMode() FixturesMode {
+	if c.Mode == "" {
+		return FixturesModeOff
+	}
+	return c.Mode
+}
+
+func (c FixturesConfig) GetDir() string {
+	if c.Dir == "" {
+		return DefaultFixturesDir
+	}
+	return c.Dir
+}
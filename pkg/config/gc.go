@@ -0,0 +1,97 @@
+package config
+
+import (
+	"time"
+)
+
+var _ = Schema.Add("GCConfig", `
+{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"disabled": { "type": "boolean" },
+		"interval_seconds": { "type": "integer", "minimum": 1 },
+		"ownership_retention_seconds": { "type": "integer", "minimum": 0 },
+		"collection_retention_days": { "type": "integer", "minimum": 1 },
+		"batch_size": { "type": "integer", "minimum": 1 },
+		"batch_pause_ms": { "type": "integer", "minimum": 0 },
+		"ownership_history_retention_days": { "type": "integer", "minimum": 1 },
+		"ownership_history_partitions_ahead_days": { "type": "integer", "minimum": 1 }
+	}
+}
+`)
+
+const (
+	DefaultGCInterval                        = time.Hour
+	DefaultGCOwnershipRetention              = 7 * 24 * time.Hour
+	DefaultGCCollectionRetention             = 30 * 24 * time.Hour
+	DefaultGCBatchSize                       = 1000
+	DefaultGCBatchPause                      = 100 * time.Millisecond
+	DefaultGCOwnershipHistoryRetention       = 30 * 24 * time.Hour
+	DefaultGCOwnershipHistoryPartitionsAhead = 7
+)
+
+// GCConfig configures the removal of rows nobody needs anymore
+type GCConfig struct {
+	Disabled        bool `json:"disabled,omitempty"`
+	IntervalSeconds int  `json:"interval_seconds,omitempty"`
+	// OwnershipRetentionSeconds is how long ownerships are kept past ownership_cache_ttl, e.g. to be served while the upstream is down
+	OwnershipRetentionSeconds *int `json:"ownership_retention_seconds,omitempty"`
+	// CollectionRetentionDays is how long collections are kept since they were last queried
+	CollectionRetentionDays int  `json:"collection_retention_days,omitempty"`
+	BatchSize               int  `json:"batch_size,omitempty"`
+	BatchPauseMs            *int `json:"batch_pause_ms,omitempty"`
+	// OwnershipHistoryRetentionDays is how many days of ownership history are kept, older days are dropped as a whole
+	OwnershipHistoryRetentionDays int `json:"ownership_history_retention_days,omitempty"`
+	// OwnershipHistoryPartitionsAheadDays is how many daily ownership history partitions are created ahead of today
+	OwnershipHistoryPartitionsAheadDays int `json:"ownership_history_partitions_ahead_days,omitempty"`
+}
+
+func (c GCConfig) GetInterval() time.Duration {
+	if c.IntervalSeconds == 0 {
+		return DefaultGCInterval
+	}
+	return time.Duration(c.IntervalSeconds) * time.Second
+}
+
+func (c GCConfig) GetOwnershipRetention() time.Duration {
+	if c.OwnershipRetentionSeconds == nil {
+		return DefaultGCOwnershipRetention
+	}
+	return time.Duration(*c.OwnershipRetentionSeconds) * time.Second
+}
+
+func (c GCConfig) GetCollectionRetention() time.Duration {
+	if c.CollectionRetentionDays == 0 {
+		return DefaultGCCollectionRetention
+	}
+	return time.Duration(c.CollectionRetentionDays) * 24 * time.Hour
+}
+
+func (c GCConfig) GetBatchSize() int {
+	if c.BatchSize == 0 {
+		return DefaultGCBatchSize
+	}
+	return c.BatchSize
+}
+
+func (c GCConfig) GetBatchPause() time.Duration {
+	if c.BatchPauseMs == nil {
+		return DefaultGCBatchPause
+	}
+	return time.Duration(*c.BatchPauseMs) * time.Millisecond
+}
+
+func (c GCConfig) GetOwnershipHistoryRetention() time.Duration {
+	if c.OwnershipHistoryRetentionDays == 0 {
+		return DefaultGCOwnershipHistoryRetention
+	}
+	return time.Duration(c.OwnershipHistoryRetentionDays) * 24 * time.Hour
+}
+
+func (c GCConfig) GetOwnershipHistoryPartitionsAheadDays() int {
+	if c.OwnershipHistoryPartitionsAheadDays == 0 {
+		return DefaultGCOwnershipHistoryPartitionsAhead
+	}
+	return c.OwnershipHistoryPartitionsAheadDays
+}
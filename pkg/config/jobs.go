@@ -0,0 +1,102 @@
+package config
+
+import (
+	"time"
+)
+
+var _ = Schema.Add("JobsConfig", `
+{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"concurrency": { "type": "integer", "minimum": 1 },
+		"server_concurrency": { "type": "integer", "minimum": 0 },
+		"poll_interval_seconds": { "type": "integer", "minimum": 1 },
+		"max_attempts": { "type": "integer", "minimum": 1 },
+		"backoff_seconds": { "type": "integer", "minimum": 1 },
+		"max_backoff_seconds": { "type": "integer", "minimum": 1 },
+		"lock_timeout_seconds": { "type": "integer", "minimum": 1 }
+	}
+}
+`)
+
+const (
+	DefaultJobsConcurrency       = 4
+	DefaultJobsServerConcurrency = 1
+	DefaultJobsPollInterval      = 1 * time.Second
+	DefaultJobsMaxAttempts       = 5
+	DefaultJobsBackoff           = 10 * time.Second
+	DefaultJobsMaxBackoff        = 10 * time.Minute
+	DefaultJobsLockTimeout       = 5 * time.Minute
+)
+
+// JobsConfig configures the job queue in eth_nft_job, which workers and API servers run asynchronous refresh work from
+type JobsConfig struct {
+	// Concurrency is the number of jobs run at once by each worker
+	Concurrency int `json:"concurrency,omitempty"`
+	// ServerConcurrency is the number of jobs run at once by each API server, so that stale data is revalidated without a worker.
+	// 0 leaves the jobs to the workers.
+	ServerConcurrency   *int `json:"server_concurrency,omitempty"`
+	PollIntervalSeconds int  `json:"poll_interval_seconds,omitempty"`
+	MaxAttempts         int  `json:"max_attempts,omitempty"`
+	// BackoffSeconds is the delay before the first retry, it doubles on every further attempt up to MaxBackoffSeconds
+	BackoffSeconds    int `json:"backoff_seconds,omitempty"`
+	MaxBackoffSeconds int `json:"max_backoff_seconds,omitempty"`
+	// LockTimeoutSeconds is how long a job may run before it is assumed its worker is gone
+	LockTimeoutSeconds int `json:"lock_timeout_seconds,omitempty"`
+}
+
+func (c JobsConfig) GetConcurrency() int {
+	if c.Concurrency == 0 {
+		return DefaultJobsConcurrency
+	}
+	return c.Concurrency
+}
+
+func (c JobsConfig) GetServerConcurrency() int {
+	if c.ServerConcurrency == nil {
+		return DefaultJobsServerConcurrency
+	}
+	return *c.ServerConcurrency
+}
+
+func (c JobsConfig) GetPollInterval() time.Duration {
+	if c.PollIntervalSeconds == 0 {
+		return DefaultJobsPollInterval
+	}
+	return time.Duration(c.PollIntervalSeconds) * time.Second
+}
+
+func (c JobsConfig) GetMaxAttempts() int {
+	if c.MaxAttempts == 0 {
+		return DefaultJobsMaxAttempts
+	}
+	return c.MaxAttempts
+}
+
+// GetBackoff returns the delay before retrying a job which has failed attempts times
+func (c JobsConfig) GetBackoff(attempts int) time.Duration {
+	backoff := DefaultJobsBackoff
+	if c.BackoffSeconds != 0 {
+		backoff = time.Duration(c.BackoffSeconds) * time.Second
+	}
+	maxBackoff := DefaultJobsMaxBackoff
+	if c.MaxBackoffSeconds != 0 {
+		maxBackoff = time.Duration(c.MaxBackoffSeconds) * time.Second
+	}
+
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+func (c JobsConfig) GetLockTimeout() time.Duration {
+	if c.LockTimeoutSeconds == 0 {
+		return DefaultJobsLockTimeout
+	}
+	return time.Duration(c.LockTimeoutSeconds) * time.Second
+}
@@ -0,0 +1,33 @@
+package config
+
+var _ = Schema.Add("ProviderConfig", `
+{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"blockchain": { "type": "string" },
+		"network": { "type": "string" },
+		"type": { "type": "string", "enum": ["alchemy", "json_rpc"] },
+		"url": { "type": "string", "format": "uri" },
+		"max_block_range": { "type": "integer", "minimum": 0 }
+	},
+	"required": ["blockchain", "network", "type"]
+}
+`)
+
+type ProviderType string
+
+const (
+	ProviderTypeAlchemy ProviderType = "alchemy"
+	ProviderTypeJSONRPC ProviderType = "json_rpc"
+)
+
+type ProviderConfig struct {
+	Blockchain string       `json:"blockchain"`
+	Network    string       `json:"network"`
+	Type       ProviderType `json:"type"`
+	// URL is the JSON-RPC endpoint, only used by the json_rpc provider, defaults to the json_rpc endpoint of the chain
+	URL string `json:"url,omitempty"`
+	// MaxBlockRange limits the block range of a single eth_getLogs call, 0 means unlimited
+	MaxBlockRange int64 `json:"max_block_range,omitempty"`
+}
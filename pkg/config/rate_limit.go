@@ -0,0 +1,70 @@
+package config
+
+import (
+	"time"
+)
+
+var _ = Schema.Add("RateLimitConfig", `
+{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"blockchain": { "type": "string" },
+		"network": { "type": "string" },
+		"compute_units_per_second": { "type": "integer", "minimum": 1 },
+		"burst": { "type": "integer", "minimum": 1 },
+		"max_wait_ms": { "type": "integer", "minimum": 0 },
+		"daily_compute_units": { "type": "integer", "minimum": 0 },
+		"daily_warning_ratio": { "type": "number", "exclusiveMinimum": 0, "maximum": 1 },
+		"compute_unit_costs": {
+			"type": "object",
+			"additionalProperties": { "type": "integer", "minimum": 0 }
+		}
+	},
+	"required": ["blockchain", "network", "compute_units_per_second"]
+}
+`)
+
+const (
+	DefaultRateLimitMaxWait           = time.Second
+	DefaultRateLimitDailyWarningRatio = 0.8
+)
+
+// RateLimitConfig limits the compute units spent on upstream calls of a network, per API key and replica
+type RateLimitConfig struct {
+	Blockchain            string `json:"blockchain"`
+	Network               string `json:"network"`
+	ComputeUnitsPerSecond int    `json:"compute_units_per_second"`
+	// Burst defaults to compute_units_per_second, and is raised to the largest method cost
+	Burst int `json:"burst,omitempty"`
+	// MaxWaitMs is how long a call may wait for the bucket to refill before failing
+	MaxWaitMs *int `json:"max_wait_ms,omitempty"`
+	// DailyComputeUnits is the hard daily budget, 0 means unlimited.
+	// The usage is counted in memory, so every replica spends up to the full budget and restarts reset it
+	DailyComputeUnits int64 `json:"daily_compute_units,omitempty"`
+	// DailyWarningRatio is the fraction of the daily budget after which a warning is logged
+	DailyWarningRatio float64 `json:"daily_warning_ratio,omitempty"`
+	// ComputeUnitCosts overrides the cost of each upstream method
+	ComputeUnitCosts map[string]int `json:"compute_unit_costs,omitempty"`
+}
+
+func (c RateLimitConfig) GetBurst() int {
+	if c.Burst == 0 {
+		return c.ComputeUnitsPerSecond
+	}
+	return c.Burst
+}
+
+func (c RateLimitConfig) GetMaxWait() time.Duration {
+	if c.MaxWaitMs == nil {
+		return DefaultRateLimitMaxWait
+	}
+	return time.Duration(*c.MaxWaitMs) * time.Millisecond
+}
+
+func (c RateLimitConfig) GetDailyWarningRatio() float64 {
+	if c.DailyWarningRatio == 0 {
+		return DefaultRateLimitDailyWarningRatio
+	}
+	return c.DailyWarningRatio
+}
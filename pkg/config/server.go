@@ -1,22 +1,121 @@
 package config
 
+import (
+	"time"
+)
+
+var _ = Schema.Add("CacheConfig", `
+{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"fresh_ttl": { "type": "integer", "minimum": 0 },
+		"stale_ttl": { "type": "integer", "minimum": 0 }
+	}
+}
+`)
+
 var _ = Schema.Add("ServerConfig", `
 {
 	"type": "object",
 	"additionalProperties": false,
 	"properties": {
 		"listen_addr": { "type": "string" },
+		"admin_listen_addr": { "type": "string" },
 		"collection_cache_ttl": { "type": "integer" },
 		"ownership_cache_ttl": { "type": "integer" },
-		"max_nft_pages": { "type": "integer" }
+		"collection_cache": { "$ref": "#/$defs/CacheConfig" },
+		"ownership_cache": { "$ref": "#/$defs/CacheConfig" },
+		"max_nft_pages": { "type": "integer" },
+		"max_transfer_pages": { "type": "integer", "minimum": 1 },
+		"transfer_page_size": { "type": "integer", "minimum": 1, "maximum": 1000 },
+		"request_timeout": { "type": "integer", "minimum": 1 }
 	},
-	"required": ["listen_addr", "collection_cache_ttl", "ownership_cache_ttl", "max_nft_pages"]
+	"required": ["listen_addr", "max_nft_pages"]
 }
 `)
 
+const (
+	DefaultOwnershipFreshTTL  = 5 * time.Minute
+	DefaultCollectionFreshTTL = 1 * time.Hour
+	DefaultRequestTimeout     = 30 * time.Second
+	DefaultMaxNFTPages        = 5
+	DefaultMaxTransferPages   = 5
+	DefaultTransferPageSize   = 1000
+)
+
+// CacheConfig is in seconds. Cached data within FreshTTL is served as is, within StaleTTL it is served and refreshed in the background,
+// past StaleTTL it is refetched before answering.
+type CacheConfig struct {
+	FreshTTL int `json:"fresh_ttl,omitempty"`
+	StaleTTL int `json:"stale_ttl,omitempty"`
+}
+
+// getTTLs returns legacyTTL or defaultFreshTTL if fresh_ttl is not set, the stale TTL is never shorter than the fresh one
+func (c CacheConfig) getTTLs(legacyTTL int, defaultFreshTTL time.Duration) (fresh time.Duration, stale time.Duration) {
+	fresh = defaultFreshTTL
+	if c.FreshTTL != 0 {
+		fresh = time.Duration(c.FreshTTL) * time.Second
+	} else if legacyTTL != 0 {
+		fresh = time.Duration(legacyTTL) * time.Second
+	}
+
+	stale = time.Duration(c.StaleTTL) * time.Second
+	if stale < fresh {
+		stale = fresh
+	}
+	return fresh, stale
+}
+
 type ServerConfig struct {
-	ListenAddr         string `json:"listen_addr"`
-	OwnershipCacheTTL  int    `json:"ownership_cache_ttl"`
-	CollectionCacheTTL int    `json:"collection_cache_ttl"`
-	MaxNFTPages        int    `json:"max_nft_pages"`
+	ListenAddr string `json:"listen_addr"`
+	// AdminListenAddr serves the admin API, which is not served if it is empty. It should not be reachable publicly.
+	AdminListenAddr string `json:"admin_listen_addr,omitempty"`
+	// OwnershipCacheTTL and CollectionCacheTTL are the fresh TTLs if ownership_cache and collection_cache do not set them
+	OwnershipCacheTTL  int         `json:"ownership_cache_ttl,omitempty"`
+	CollectionCacheTTL int         `json:"collection_cache_ttl,omitempty"`
+	OwnershipCache     CacheConfig `json:"ownership_cache"`
+	CollectionCache    CacheConfig `json:"collection_cache"`
+	MaxNFTPages        int         `json:"max_nft_pages"`
+	// MaxTransferPages limits the pages of transfers fetched to locate the latest transfer of each owned token
+	MaxTransferPages int `json:"max_transfer_pages,omitempty"`
+	TransferPageSize int `json:"transfer_page_size,omitempty"`
+	// RequestTimeout is the time budget of each API request in seconds, shared by its upstream calls
+	RequestTimeout int `json:"request_timeout,omitempty"`
+}
+
+func (c ServerConfig) GetOwnershipCacheTTLs() (fresh time.Duration, stale time.Duration) {
+	return c.OwnershipCache.getTTLs(c.OwnershipCacheTTL, DefaultOwnershipFreshTTL)
+}
+
+func (c ServerConfig) GetCollectionCacheTTLs() (fresh time.Duration, stale time.Duration) {
+	return c.CollectionCache.getTTLs(c.CollectionCacheTTL, DefaultCollectionFreshTTL)
+}
+
+func (c ServerConfig) GetRequestTimeout() time.Duration {
+	if c.RequestTimeout == 0 {
+		return DefaultRequestTimeout
+	}
+	return time.Duration(c.RequestTimeout) * time.Second
+}
+
+func (c ServerConfig) GetMaxNFTPages() int {
+	if c.MaxNFTPages <= 0 {
+		return DefaultMaxNFTPages
+	}
+	return c.MaxNFTPages
+}
+
+func (c ServerConfig) GetMaxTransferPages() int {
+	if c.MaxTransferPages == 0 {
+		return DefaultMaxTransferPages
+	}
+	return c.MaxTransferPages
+}
+
+func (c ServerConfig) GetTransferPageSize() int64 {
+	if c.TransferPageSize == 0 {
+		return DefaultTransferPageSize
+	}
+	return int64(c.TransferPageSize)
 }
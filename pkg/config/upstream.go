@@ -0,0 +1,67 @@
+package config
+
+import (
+	"time"
+)
+
+var _ = Schema.Add("UpstreamConfig", `
+{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"timeout": { "type": "integer", "minimum": 1 },
+		"max_attempts": { "type": "integer", "minimum": 1 },
+		"initial_backoff_ms": { "type": "integer", "minimum": 1 },
+		"max_backoff_ms": { "type": "integer", "minimum": 1 },
+		"circuit_breaker": { "$ref": "#/$defs/CircuitBreakerConfig" },
+		"fixtures": { "$ref": "#/$defs/FixturesConfig" }
+	}
+}
+`)
+
+const (
+	DefaultUpstreamTimeout          = 5 * time.Second
+	DefaultUpstreamMaxAttempts      = 3
+	DefaultUpstreamInitialBackoffMs = 200
+	DefaultUpstreamMaxBackoffMs     = 2000
+)
+
+// UpstreamConfig configures the HTTP client of NFT data providers
+type UpstreamConfig struct {
+	// Timeout is the timeout of each attempt in seconds
+	Timeout          int `json:"timeout,omitempty"`
+	MaxAttempts      int `json:"max_attempts,omitempty"`
+	InitialBackoffMs int `json:"initial_backoff_ms,omitempty"`
+	MaxBackoffMs     int `json:"max_backoff_ms,omitempty"`
+
+	CircuitBreaker CircuitBreakerConfig `json:"circuit_breaker"`
+	Fixtures       FixturesConfig       `json:"fixtures"`
+}
+
+func (c UpstreamConfig) GetTimeout() time.Duration {
+	if c.Timeout == 0 {
+		return DefaultUpstreamTimeout
+	}
+	return time.Duration(c.Timeout) * time.Second
+}
+
+func (c UpstreamConfig) GetMaxAttempts() int {
+	if c.MaxAttempts == 0 {
+		return DefaultUpstreamMaxAttempts
+	}
+	return c.MaxAttempts
+}
+
+func (c UpstreamConfig) GetInitialBackoff() time.Duration {
+	if c.InitialBackoffMs == 0 {
+		return DefaultUpstreamInitialBackoffMs * time.Millisecond
+	}
+	return time.Duration(c.InitialBackoffMs) * time.Millisecond
+}
+
+func (c UpstreamConfig) GetMaxBackoff() time.Duration {
+	if c.MaxBackoffMs == 0 {
+		return DefaultUpstreamMaxBackoffMs * time.Millisecond
+	}
+	return time.Duration(c.MaxBackoffMs) * time.Millisecond
+}
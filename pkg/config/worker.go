@@ -0,0 +1,42 @@
+package config
+
+import (
+	"time"
+)
+
+var _ = Schema.Add("WorkerConfig", `
+{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"poll_interval_seconds": { "type": "integer", "minimum": 1 },
+		"block_range": { "type": "integer", "minimum": 1 }
+	}
+}
+`)
+
+const (
+	DefaultWorkerPollInterval = 15 * time.Second
+	DefaultWorkerBlockRange   = 1000
+)
+
+// WorkerConfig configures the worker, which follows new blocks and keeps tracked collections current
+type WorkerConfig struct {
+	PollIntervalSeconds int `json:"poll_interval_seconds,omitempty"`
+	// BlockRange is the maximum number of blocks of a collection applied in one transaction
+	BlockRange int64 `json:"block_range,omitempty"`
+}
+
+func (c WorkerConfig) GetPollInterval() time.Duration {
+	if c.PollIntervalSeconds == 0 {
+		return DefaultWorkerPollInterval
+	}
+	return time.Duration(c.PollIntervalSeconds) * time.Second
+}
+
+func (c WorkerConfig) GetBlockRange() int64 {
+	if c.BlockRange == 0 {
+		return DefaultWorkerBlockRange
+	}
+	return c.BlockRange
+}
@@ -0,0 +1,501 @@
+package fakeprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/alchemy"
+	"github.com/authgear/authgear-server/pkg/util/log"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+// Handler serves the subset of Alchemy API used by the indexer from a World.
+// Any API key and path prefix is accepted, so one server can stand in for every network.
+type Handler struct {
+	World  *World
+	Logger *log.Logger
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	// .../v2/<key> and .../nft/v2/<key>/<method>
+	versionIndex := -1
+	for i, s := range segments {
+		if s == "v2" {
+			versionIndex = i
+		}
+	}
+	if versionIndex < 0 || versionIndex+1 >= len(segments) {
+		http.NotFound(w, r)
+		return
+	}
+	isNFTAPI := versionIndex > 0 && segments[versionIndex-1] == "nft"
+	method := strings.Join(segments[versionIndex+2:], "/")
+
+	h.Logger.WithFields(map[string]interface{}{
+		"method": r.Method,
+		"path":   scrubbedPath(segments, versionIndex),
+	}).Info("fake provider request")
+
+	switch {
+	case !isNFTAPI && method == "" && r.Method == http.MethodPost:
+		h.handleJSONRPC(w, r)
+	case !isNFTAPI && method == "getContractMetadata":
+		h.handleGetContractMetadata(w, r)
+	case isNFTAPI && method == "getNFTs":
+		h.handleGetNFTs(w, r)
+	case isNFTAPI && method == "getOwnersForCollection":
+		h.handleGetOwnersForCollection(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// scrubbedPath hides the API key segment in logs
+func scrubbedPath(segments []string, versionIndex int) string {
+	scrubbed := make([]string, len(segments))
+	copy(scrubbed, segments)
+	scrubbed[versionIndex+1] = "REDACTED"
+	return "/" + strings.Join(scrubbed, "/")
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]interface{}{
+		"error": message,
+	})
+}
+
+// pageKeys are offsets into the result, opaque to clients like real Alchemy page keys
+func parsePageKey(pageKey string) (int, error) {
+	if pageKey == "" {
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(pageKey)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid pageKey: %v", pageKey)
+	}
+	return offset, nil
+}
+
+func paginate(total int, offset int, pageSize int) (end int, nextPageKey *string) {
+	end = offset + pageSize
+	if end >= total {
+		return total, nil
+	}
+	next := strconv.Itoa(end)
+	return end, &next
+}
+
+func parseAddress(s string) (authgearweb3.EIP55, error) {
+	return authgearweb3.NewEIP55(s)
+}
+
+func (h *Handler) handleGetNFTs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	owner, err := parseAddress(query.Get("owner"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid owner")
+		return
+	}
+
+	offset, err := parsePageKey(query.Get("pageKey"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	contracts := map[authgearweb3.EIP55]struct{}{}
+	for _, c := range query["contractAddresses[]"] {
+		address, err := parseAddress(c)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid contractAddresses")
+			return
+		}
+		contracts[address] = struct{}{}
+	}
+
+	var owned []alchemy.OwnedNFT
+	for _, o := range h.World.Ownerships {
+		if o.Owner != owner {
+			continue
+		}
+		if _, ok := contracts[o.Contract]; len(contracts) > 0 && !ok {
+			continue
+		}
+		owned = append(owned, alchemy.OwnedNFT{
+			Contract: alchemy.OwnedNFTContract{Address: o.Contract.String()},
+			ID:       alchemy.OwnedNFTID{TokenID: "0x" + o.TokenID.Text(16)},
+			Balance:  o.Balance.String(),
+		})
+	}
+
+	if offset > len(owned) {
+		offset = len(owned)
+	}
+	end, pageKey := paginate(len(owned), offset, h.World.nftsPageSize())
+
+	writeJSON(w, http.StatusOK, alchemy.GetNFTsResponse{
+		OwnedNFTs: append([]alchemy.OwnedNFT{}, owned[offset:end]...),
+		PageKey:   pageKey,
+	})
+}
+
+func (h *Handler) handleGetContractMetadata(w http.ResponseWriter, r *http.Request) {
+	address, err := parseAddress(r.URL.Query().Get("contractAddress"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid contractAddress")
+		return
+	}
+
+	collection, ok := h.World.Collections[address]
+	if !ok {
+		// Alchemy answers unknown contracts with empty metadata
+		writeJSON(w, http.StatusOK, alchemy.ContractMetadataResponse{
+			Address: address.String(),
+			ContractMetadata: alchemy.ContractMetadata{
+				TokenType: "UNKNOWN",
+			},
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, alchemy.ContractMetadataResponse{
+		Address: collection.Address.String(),
+		ContractMetadata: alchemy.ContractMetadata{
+			Name:        collection.Name,
+			Symbol:      collection.Symbol,
+			TotalSupply: collection.TotalSupply,
+			TokenType:   collection.TokenType,
+		},
+	})
+}
+
+func (h *Handler) handleGetOwnersForCollection(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	address, err := parseAddress(query.Get("contractAddress"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid contractAddress")
+		return
+	}
+
+	offset, err := parsePageKey(query.Get("pageKey"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	seen := map[authgearweb3.EIP55]struct{}{}
+	owners := []string{}
+	for _, o := range h.World.Ownerships {
+		if o.Contract != address {
+			continue
+		}
+		if _, ok := seen[o.Owner]; ok {
+			continue
+		}
+		seen[o.Owner] = struct{}{}
+		owners = append(owners, strings.ToLower(o.Owner.String()))
+	}
+
+	if offset > len(owners) {
+		offset = len(owners)
+	}
+	end, pageKey := paginate(len(owners), offset, h.World.ownersPageSize())
+
+	writeJSON(w, http.StatusOK, alchemy.GetOwnersForCollectionResponse{
+		OwnerAddresses: owners[offset:end],
+		PageKey:        pageKey,
+	})
+}
+
+type jsonRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      interface{}     `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+// parseAssetTransferParams accepts params as an array like Alchemy documents, or as the object the indexer sends
+func parseAssetTransferParams(raw json.RawMessage) (*alchemy.AssetTransferRequestParams, error) {
+	var list []alchemy.AssetTransferRequestParams
+	if err := json.Unmarshal(raw, &list); err == nil {
+		if len(list) != 1 {
+			return nil, fmt.Errorf("expected 1 param, got %v", len(list))
+		}
+		return &list[0], nil
+	}
+
+	var params alchemy.AssetTransferRequestParams
+	err := json.Unmarshal(raw, &params)
+	if err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+func writeJSONRPCError(w http.ResponseWriter, id interface{}, code int, message string) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error": alchemy.AssetTransferError{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+// handleGetBlockByNumber treats block tags like safe and finalized as the latest block
+func (h *Handler) handleGetBlockByNumber(w http.ResponseWriter, request jsonRPCRequest) {
+	var params []interface{}
+	err := json.Unmarshal(request.Params, &params)
+	if err != nil || len(params) == 0 {
+		writeJSONRPCError(w, request.ID, -32602, "invalid params")
+		return
+	}
+
+	blockNumber := h.World.LatestBlock
+	if tag, ok := params[0].(string); ok && strings.HasPrefix(tag, "0x") {
+		n, err := strconv.ParseInt(strings.TrimPrefix(tag, "0x"), 16, 64)
+		if err != nil {
+			writeJSONRPCError(w, request.ID, -32602, fmt.Sprintf("invalid block number: %v", tag))
+			return
+		}
+		blockNumber = n
+	}
+
+	var result interface{}
+	if blockNumber <= h.World.LatestBlock {
+		parentHash := h.World.BlockHash(0)
+		if blockNumber > 0 {
+			parentHash = h.World.BlockHash(blockNumber - 1)
+		}
+		result = map[string]interface{}{
+			"number":     fmt.Sprintf("0x%x", blockNumber),
+			"hash":       h.World.BlockHash(blockNumber),
+			"parentHash": parentHash,
+			"timestamp":  "0x0",
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      request.ID,
+		"result":  result,
+	})
+}
+
+func (h *Handler) handleJSONRPC(w http.ResponseWriter, r *http.Request) {
+	var request jsonRPCRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeJSONRPCError(w, nil, -32700, "parse error")
+		return
+	}
+
+	switch request.Method {
+	case "alchemy_getAssetTransfers":
+	case "eth_blockNumber":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  fmt.Sprintf("0x%x", h.World.LatestBlock),
+		})
+		return
+	case "eth_getBlockByNumber":
+		h.handleGetBlockByNumber(w, request)
+		return
+	default:
+		writeJSONRPCError(w, request.ID, -32601, fmt.Sprintf("method %v is not supported by the fake provider", request.Method))
+		return
+	}
+
+	params, err := parseAssetTransferParams(request.Params)
+	if err != nil {
+		writeJSONRPCError(w, request.ID, -32602, fmt.Sprintf("invalid params: %v", err))
+		return
+	}
+
+	result, err := h.getAssetTransfers(*params)
+	if err != nil {
+		writeJSONRPCError(w, request.ID, -32602, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      request.ID,
+		"result":  result,
+	})
+}
+
+func (h *Handler) parseBlock(tag string, defaultBlock int64) (int64, error) {
+	switch tag {
+	case "":
+		return defaultBlock, nil
+	case "latest", "safe", "finalized":
+		return h.World.LatestBlock, nil
+	case "earliest":
+		return 0, nil
+	}
+	block, ok := new(big.Int).SetString(tag, 0)
+	if !ok {
+		return 0, fmt.Errorf("invalid block: %v", tag)
+	}
+	return block.Int64(), nil
+}
+
+func (h *Handler) getAssetTransfers(params alchemy.AssetTransferRequestParams) (*alchemy.AssetTransferResult, error) {
+	fromBlock, err := h.parseBlock(params.FromBlock, 0)
+	if err != nil {
+		return nil, err
+	}
+	toBlock, err := h.parseBlock(params.ToBlock, h.World.LatestBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := parsePageKey(params.PageKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := h.World.transfersPageSize()
+	if params.MaxCount != "" {
+		maxCount, ok := new(big.Int).SetString(params.MaxCount, 0)
+		if !ok || maxCount.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid maxCount: %v", params.MaxCount)
+		}
+		if maxCount.IsInt64() && maxCount.Int64() < int64(pageSize) {
+			pageSize = int(maxCount.Int64())
+		}
+	}
+
+	categories := map[string]struct{}{}
+	for _, c := range params.Category {
+		categories[strings.ToLower(c)] = struct{}{}
+	}
+
+	contracts := map[authgearweb3.EIP55]struct{}{}
+	for _, c := range params.ContractAddresses {
+		address, err := parseAddress(c.String())
+		if err != nil {
+			return nil, err
+		}
+		contracts[address] = struct{}{}
+	}
+
+	var fromAddress, toAddress authgearweb3.EIP55
+	if params.FromAddress != "" {
+		if fromAddress, err = parseAddress(params.FromAddress.String()); err != nil {
+			return nil, err
+		}
+	}
+	if params.ToAddress != "" {
+		if toAddress, err = parseAddress(params.ToAddress.String()); err != nil {
+			return nil, err
+		}
+	}
+
+	var matched []Transfer
+	for _, t := range h.World.Transfers {
+		if t.BlockNumber < fromBlock || t.BlockNumber > toBlock {
+			continue
+		}
+		if _, ok := contracts[t.Contract]; len(contracts) > 0 && !ok {
+			continue
+		}
+		if fromAddress != "" && t.From != fromAddress {
+			continue
+		}
+		if toAddress != "" && t.To != toAddress {
+			continue
+		}
+		if params.ExcludeZeroValue && t.Value.Sign() == 0 {
+			continue
+		}
+		if _, ok := categories[h.category(t)]; len(categories) > 0 && !ok {
+			continue
+		}
+		matched = append(matched, t)
+	}
+
+	if strings.EqualFold(params.Order, "desc") {
+		for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+			matched[i], matched[j] = matched[j], matched[i]
+		}
+	}
+
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	end, pageKey := paginate(len(matched), offset, pageSize)
+
+	transfers := make([]alchemy.TokenTransfer, 0, end-offset)
+	for _, t := range matched[offset:end] {
+		transfers = append(transfers, h.toTokenTransfer(t))
+	}
+
+	result := &alchemy.AssetTransferResult{
+		Transfers: transfers,
+	}
+	if pageKey != nil {
+		result.PageKey = *pageKey
+	}
+
+	return result, nil
+}
+
+func (h *Handler) category(t Transfer) string {
+	if h.World.Collections[t.Contract].IsERC1155() {
+		return "erc1155"
+	}
+	return "erc721"
+}
+
+func (h *Handler) toTokenTransfer(t Transfer) alchemy.TokenTransfer {
+	collection := h.World.Collections[t.Contract]
+	tokenID := fmt.Sprintf("0x%064x", t.TokenID)
+
+	transfer := alchemy.TokenTransfer{
+		Category: h.category(t),
+		UniqueID: fmt.Sprintf("%v:log:%v", t.TransactionHash, t.LogIndex),
+		BlockNum: fmt.Sprintf("0x%x", t.BlockNumber),
+		From:     authgearweb3.EIP55(strings.ToLower(t.From.String())),
+		To:       authgearweb3.EIP55(strings.ToLower(t.To.String())),
+		TokenID:  tokenID,
+		Asset:    collection.Symbol,
+		Hash:     t.TransactionHash,
+		RawContract: alchemy.RawContract{
+			Address: authgearweb3.EIP55(strings.ToLower(t.Contract.String())),
+		},
+		Metadata: alchemy.Metadata{
+			BlockTimestamp: t.BlockTimestamp.UTC().Format("2006-01-02T15:04:05.000Z"),
+		},
+	}
+
+	if collection.IsERC1155() {
+		transfer.ERC1155Metadata = &[]alchemy.ERC1155Metadata{
+			{
+				TokenID: tokenID,
+				Value:   fmt.Sprintf("0x%x", t.Value),
+			},
+		}
+	} else {
+		transfer.ERC721TokenID = &tokenID
+	}
+
+	return transfer
+}
@@ -0,0 +1,329 @@
+package fakeprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"sigs.k8s.io/yaml"
+)
+
+const zeroAddress = "0x0000000000000000000000000000000000000000"
+
+const (
+	DefaultNFTsPageSize      = 100
+	DefaultOwnersPageSize    = 50000
+	DefaultTransfersPageSize = 1000
+)
+
+// WorldFile describes the wallets, collections, tokens and transfers served by the fake provider.
+// Addresses can be given as wallet names.
+type WorldFile struct {
+	Wallets     map[string]string `json:"wallets,omitempty"`
+	Collections []CollectionFile  `json:"collections,omitempty"`
+	Tokens      []TokenFile       `json:"tokens,omitempty"`
+	Transfers   []TransferFile    `json:"transfers,omitempty"`
+	PageSize    PageSizeFile      `json:"page_size,omitempty"`
+	// LatestBlock defaults to the highest block of all transfers
+	LatestBlock int64 `json:"latest_block,omitempty"`
+}
+
+type CollectionFile struct {
+	Address     string `json:"address"`
+	Name        string `json:"name"`
+	Symbol      string `json:"symbol"`
+	TokenType   string `json:"token_type"`
+	TotalSupply string `json:"total_supply,omitempty"`
+}
+
+// TokenFile is a shorthand of a mint transfer to Owner
+type TokenFile struct {
+	Contract    string `json:"contract"`
+	TokenID     string `json:"token_id"`
+	Owner       string `json:"owner"`
+	Balance     string `json:"balance,omitempty"`
+	BlockNumber int64  `json:"block_number,omitempty"`
+}
+
+type TransferFile struct {
+	Contract        string    `json:"contract"`
+	TokenID         string    `json:"token_id"`
+	From            string    `json:"from,omitempty"`
+	To              string    `json:"to"`
+	Value           string    `json:"value,omitempty"`
+	BlockNumber     int64     `json:"block_number"`
+	BlockTimestamp  time.Time `json:"block_timestamp,omitempty"`
+	TransactionHash string    `json:"transaction_hash,omitempty"`
+	LogIndex        int       `json:"log_index,omitempty"`
+}
+
+type PageSizeFile struct {
+	NFTs      int `json:"nfts,omitempty"`
+	Owners    int `json:"owners,omitempty"`
+	Transfers int `json:"transfers,omitempty"`
+}
+
+type Collection struct {
+	Address     authgearweb3.EIP55
+	Name        string
+	Symbol      string
+	TokenType   string
+	TotalSupply string
+}
+
+func (c Collection) IsERC1155() bool {
+	return strings.EqualFold(c.TokenType, "ERC1155")
+}
+
+type Transfer struct {
+	Contract        authgearweb3.EIP55
+	TokenID         *big.Int
+	From            authgearweb3.EIP55
+	To              authgearweb3.EIP55
+	Value           *big.Int
+	BlockNumber     int64
+	BlockTimestamp  time.Time
+	TransactionHash string
+	LogIndex        int
+}
+
+type Ownership struct {
+	Contract authgearweb3.EIP55
+	TokenID  *big.Int
+	Owner    authgearweb3.EIP55
+	Balance  *big.Int
+}
+
+// World is the parsed WorldFile, with transfers ordered by block and ownerships derived from them
+type World struct {
+	Collections map[authgearweb3.EIP55]Collection
+	Transfers   []Transfer
+	Ownerships  []Ownership
+	PageSize    PageSizeFile
+	LatestBlock int64
+}
+
+func LoadWorld(path string) (*World, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML is a superset of JSON
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var file WorldFile
+	err = json.Unmarshal(jsonData, &file)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWorld(file)
+}
+
+func NewWorld(file WorldFile) (*World, error) {
+	resolve := func(s string) (authgearweb3.EIP55, error) {
+		if s == "" {
+			s = zeroAddress
+		}
+		if address, ok := file.Wallets[s]; ok {
+			s = address
+		}
+		return authgearweb3.NewEIP55(s)
+	}
+
+	w := &World{
+		Collections: map[authgearweb3.EIP55]Collection{},
+		PageSize:    file.PageSize,
+		LatestBlock: file.LatestBlock,
+	}
+
+	for _, c := range file.Collections {
+		address, err := resolve(c.Address)
+		if err != nil {
+			return nil, fmt.Errorf("collection %v: %w", c.Address, err)
+		}
+		tokenType := c.TokenType
+		if tokenType == "" {
+			tokenType = "ERC721"
+		}
+		w.Collections[address] = Collection{
+			Address:     address,
+			Name:        c.Name,
+			Symbol:      c.Symbol,
+			TokenType:   strings.ToUpper(tokenType),
+			TotalSupply: c.TotalSupply,
+		}
+	}
+
+	transferFiles := make([]TransferFile, 0, len(file.Tokens)+len(file.Transfers))
+	for _, t := range file.Tokens {
+		transferFiles = append(transferFiles, TransferFile{
+			Contract:    t.Contract,
+			TokenID:     t.TokenID,
+			To:          t.Owner,
+			Value:       t.Balance,
+			BlockNumber: t.BlockNumber,
+		})
+	}
+	transferFiles = append(transferFiles, file.Transfers...)
+
+	for i, t := range transferFiles {
+		transfer, err := newTransfer(t, i, resolve)
+		if err != nil {
+			return nil, fmt.Errorf("transfer %v: %w", i, err)
+		}
+		if _, ok := w.Collections[transfer.Contract]; !ok {
+			return nil, fmt.Errorf("transfer %v: unknown collection %v", i, transfer.Contract)
+		}
+		w.Transfers = append(w.Transfers, *transfer)
+	}
+
+	sort.SliceStable(w.Transfers, func(i, j int) bool {
+		if w.Transfers[i].BlockNumber != w.Transfers[j].BlockNumber {
+			return w.Transfers[i].BlockNumber < w.Transfers[j].BlockNumber
+		}
+		return w.Transfers[i].LogIndex < w.Transfers[j].LogIndex
+	})
+
+	for _, t := range w.Transfers {
+		if t.BlockNumber > w.LatestBlock {
+			w.LatestBlock = t.BlockNumber
+		}
+	}
+
+	w.Ownerships = deriveOwnerships(w.Transfers)
+
+	return w, nil
+}
+
+func newTransfer(t TransferFile, index int, resolve func(string) (authgearweb3.EIP55, error)) (*Transfer, error) {
+	contract, err := resolve(t.Contract)
+	if err != nil {
+		return nil, err
+	}
+	from, err := resolve(t.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := resolve(t.To)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenID, ok := new(big.Int).SetString(t.TokenID, 0)
+	if !ok {
+		return nil, fmt.Errorf("invalid token_id: %v", t.TokenID)
+	}
+
+	value := big.NewInt(1)
+	if t.Value != "" {
+		value, ok = new(big.Int).SetString(t.Value, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid value: %v", t.Value)
+		}
+	}
+
+	blockTimestamp := t.BlockTimestamp
+	if blockTimestamp.IsZero() {
+		// Roughly the block time of Ethereum mainnet since the merge
+		blockTimestamp = time.Unix(1600000000+t.BlockNumber*12, 0).UTC()
+	}
+
+	transactionHash := t.TransactionHash
+	if transactionHash == "" {
+		transactionHash = fmt.Sprintf("0x%064x", index+1)
+	}
+
+	return &Transfer{
+		Contract:        contract,
+		TokenID:         tokenID,
+		From:            from,
+		To:              to,
+		Value:           value,
+		BlockNumber:     t.BlockNumber,
+		BlockTimestamp:  blockTimestamp,
+		TransactionHash: transactionHash,
+		LogIndex:        t.LogIndex,
+	}, nil
+}
+
+func deriveOwnerships(transfers []Transfer) []Ownership {
+	type key struct {
+		Contract authgearweb3.EIP55
+		TokenID  string
+		Owner    authgearweb3.EIP55
+	}
+
+	balances := map[key]*big.Int{}
+	var keys []key
+	add := func(k key, delta *big.Int) {
+		if k.Owner == zeroAddress {
+			return
+		}
+		balance, ok := balances[k]
+		if !ok {
+			balance = new(big.Int)
+			balances[k] = balance
+			keys = append(keys, k)
+		}
+		balance.Add(balance, delta)
+	}
+
+	for _, t := range transfers {
+		tokenID := t.TokenID.String()
+		add(key{t.Contract, tokenID, t.From}, new(big.Int).Neg(t.Value))
+		add(key{t.Contract, tokenID, t.To}, t.Value)
+	}
+
+	ownerships := make([]Ownership, 0, len(keys))
+	for _, k := range keys {
+		balance := balances[k]
+		if balance.Sign() <= 0 {
+			continue
+		}
+		tokenID, _ := new(big.Int).SetString(k.TokenID, 10)
+		ownerships = append(ownerships, Ownership{
+			Contract: k.Contract,
+			TokenID:  tokenID,
+			Owner:    k.Owner,
+			Balance:  balance,
+		})
+	}
+
+	return ownerships
+}
+
+// BlockHash is derived from the block number, the fake chain never reorganizes
+func (w *World) BlockHash(blockNumber int64) string {
+	return fmt.Sprintf("0x%064x", blockNumber)
+}
+
+func (w *World) nftsPageSize() int {
+	if w.PageSize.NFTs == 0 {
+		return DefaultNFTsPageSize
+	}
+	return w.PageSize.NFTs
+}
+
+func (w *World) ownersPageSize() int {
+	if w.PageSize.Owners == 0 {
+		return DefaultOwnersPageSize
+	}
+	return w.PageSize.Owners
+}
+
+func (w *World) transfersPageSize() int {
+	if w.PageSize.Transfers == 0 {
+		return DefaultTransfersPageSize
+	}
+	return w.PageSize.Transfers
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	apimodel "github.com/authgear/authgear-nft-indexer/pkg/api/model"
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/web3"
+	authgearapi "github.com/authgear/authgear-server/pkg/api"
+	"github.com/authgear/authgear-server/pkg/api/apierrors"
+	"github.com/authgear/authgear-server/pkg/util/httproute"
+	"github.com/authgear/authgear-server/pkg/util/log"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+func ConfigureRegisterTrackedCollectionRoute(route httproute.Route) httproute.Route {
+	return route.
+		WithMethods("POST").
+		WithPathPattern("/admin/tracked_collections/register")
+}
+
+func ConfigureListTrackedCollectionsRoute(route httproute.Route) httproute.Route {
+	return route.
+		WithMethods("GET").
+		WithPathPattern("/admin/tracked_collections")
+}
+
+func ConfigurePauseTrackedCollectionRoute(route httproute.Route) httproute.Route {
+	return route.
+		WithMethods("POST").
+		WithPathPattern("/admin/tracked_collections/pause")
+}
+
+func ConfigureRemoveTrackedCollectionRoute(route httproute.Route) httproute.Route {
+	return route.
+		WithMethods("POST").
+		WithPathPattern("/admin/tracked_collections/remove")
+}
+
+type TrackedCollectionHandlerLogger struct{ *log.Logger }
+
+func NewTrackedCollectionHandlerLogger(lf *log.Factory) TrackedCollectionHandlerLogger {
+	return TrackedCollectionHandlerLogger{lf.New("api-admin-tracked-collection")}
+}
+
+type TrackedCollectionHandlerTrackedCollectionService interface {
+	Register(contract authgearweb3.ContractID, mode database.TrackedCollectionMode, startBlock int64, ttlSeconds *int) (*database.NFTTrackedCollection, error)
+	List() ([]database.NFTTrackedCollection, error)
+	SetPaused(contract authgearweb3.ContractID, paused bool) (*database.NFTTrackedCollection, error)
+	Remove(contract authgearweb3.ContractID) error
+}
+
+type RegisterTrackedCollectionAPIHandler struct {
+	JSON                     JSONResponseWriter
+	Logger                   TrackedCollectionHandlerLogger
+	Config                   config.Config
+	TrackedCollectionService TrackedCollectionHandlerTrackedCollectionService
+}
+
+func (h *RegisterTrackedCollectionAPIHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	var body apimodel.RegisterTrackedCollectionRequestData
+
+	defer req.Body.Close()
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil {
+		h.Logger.WithError(err).Error("failed to decode request body")
+		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: apierrors.NewBadRequest("failed to decode request body")})
+		return
+	}
+
+	contractID := body.ContractID.StripQuery()
+	err = web3.CheckNetwork(h.Config, contractID.Blockchain, contractID.Network)
+	if err != nil {
+		h.Logger.WithError(err).Error("invalid contract network")
+		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: err})
+		return
+	}
+
+	mode, err := database.ParseTrackedCollectionMode(body.Mode)
+	if err != nil {
+		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: apierrors.NewBadRequest("mode must be indexed or cached")})
+		return
+	}
+
+	if body.StartBlock < 0 {
+		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: apierrors.NewBadRequest("start_block must not be negative")})
+		return
+	}
+
+	if body.TTLSeconds != nil && *body.TTLSeconds <= 0 {
+		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: apierrors.NewBadRequest("ttl_seconds must be positive")})
+		return
+	}
+
+	collection, err := h.TrackedCollectionService.Register(contractID, mode, body.StartBlock, body.TTLSeconds)
+	if err != nil {
+		h.Logger.WithError(err).Error("failed to register tracked collection")
+		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: err})
+		return
+	}
+
+	h.JSON.WriteResponse(resp, &authgearapi.Response{
+		Result: &apimodel.TrackedCollectionResponse{
+			Collection: collection.ToAPIModel(),
+		},
+	})
+}
+
+type ListTrackedCollectionsAPIHandler struct {
+	JSON                     JSONResponseWriter
+	Logger                   TrackedCollectionHandlerLogger
+	TrackedCollectionService TrackedCollectionHandlerTrackedCollectionService
+}
+
+func (h *ListTrackedCollectionsAPIHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	collections, err := h.TrackedCollectionService.List()
+	if err != nil {
+		h.Logger.WithError(err).Error("failed to list tracked collections")
+		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: err})
+		return
+	}
+
+	res := make([]apimodel.TrackedCollection, 0, len(collections))
+	for _, collection := range collections {
+		res = append(res, collection.ToAPIModel())
+	}
+
+	h.JSON.WriteResponse(resp, &authgearapi.Response{
+		Result: &apimodel.ListTrackedCollectionsResponse{
+			Collections: res,
+		},
+	})
+}
+
+type PauseTrackedCollectionAPIHandler struct {
+	JSON                     JSONResponseWriter
+	Logger                   TrackedCollectionHandlerLogger
+	TrackedCollectionService TrackedCollectionHandlerTrackedCollectionService
+}
+
+func (h *PauseTrackedCollectionAPIHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	var body apimodel.PauseTrackedCollectionRequestData
+
+	defer req.Body.Close()
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil {
+		h.Logger.WithError(err).Error("failed to decode request body")
+		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: apierrors.NewBadRequest("failed to decode request body")})
+		return
+	}
+
+	collection, err := h.TrackedCollectionService.SetPaused(body.ContractID.StripQuery(), body.Paused)
+	if err != nil {
+		h.Logger.WithError(err).Error("failed to pause tracked collection")
+		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: err})
+		return
+	}
+
+	h.JSON.WriteResponse(resp, &authgearapi.Response{
+		Result: &apimodel.TrackedCollectionResponse{
+			Collection: collection.ToAPIModel(),
+		},
+	})
+}
+
+type RemoveTrackedCollectionAPIHandler struct {
+	JSON                     JSONResponseWriter
+	Logger                   TrackedCollectionHandlerLogger
+	TrackedCollectionService TrackedCollectionHandlerTrackedCollectionService
+}
+
+func (h *RemoveTrackedCollectionAPIHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	var body apimodel.RemoveTrackedCollectionRequestData
+
+	defer req.Body.Close()
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil {
+		h.Logger.WithError(err).Error("failed to decode request body")
+		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: apierrors.NewBadRequest("failed to decode request body")})
+		return
+	}
+
+	err = h.TrackedCollectionService.Remove(body.ContractID.StripQuery())
+	if err != nil {
+		h.Logger.WithError(err).Error("failed to remove tracked collection")
+		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: err})
+		return
+	}
+
+	h.JSON.WriteResponse(resp, &authgearapi.Response{
+		Result: map[string]interface{}{},
+	})
+}
@@ -17,6 +17,10 @@ var DependencySet = wire.NewSet(
 		"LogFactory",
 		"Database",
 		"Request",
+		"RateLimiter",
+		"APIKeyPool",
+		"CircuitBreakers",
+		"FetchCoalescer",
 	),
 	wire.Struct(new(HealthCheckAPIHandler), "*"),
 	NewHealthCheckHandlerLogger,
@@ -26,4 +30,11 @@ var DependencySet = wire.NewSet(
 	NewGetCollectionMetadataHandlerLogger,
 	wire.Struct(new(ProbeCollectionAPIHandler), "*"),
 	NewProbeCollectionHandlerLogger,
+	wire.Struct(new(UsageAPIHandler), "*"),
+	NewUsageHandlerLogger,
+	wire.Struct(new(RegisterTrackedCollectionAPIHandler), "*"),
+	wire.Struct(new(ListTrackedCollectionsAPIHandler), "*"),
+	wire.Struct(new(PauseTrackedCollectionAPIHandler), "*"),
+	wire.Struct(new(RemoveTrackedCollectionAPIHandler), "*"),
+	NewTrackedCollectionHandlerLogger,
 )
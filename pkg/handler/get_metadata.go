@@ -1,11 +1,14 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
 	apimodel "github.com/authgear/authgear-nft-indexer/pkg/api/model"
-	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/service"
+	"github.com/authgear/authgear-nft-indexer/pkg/web3"
 	authgearapi "github.com/authgear/authgear-server/pkg/api"
 	"github.com/authgear/authgear-server/pkg/api/apierrors"
 	"github.com/authgear/authgear-server/pkg/util/httproute"
@@ -26,12 +29,13 @@ func NewGetCollectionMetadataHandlerLogger(lf *log.Factory) GetCollectionMetadat
 }
 
 type GetCollectionMetadataHandlerMetadataService interface {
-	GetContractMetadata(contracts []authgearweb3.ContractID) ([]database.NFTCollection, error)
+	GetContractMetadata(ctx context.Context, contracts []authgearweb3.ContractID) (*service.ContractMetadataResult, error)
 }
 
 type GetCollectionMetadataAPIHandler struct {
 	JSON            JSONResponseWriter
 	Logger          GetCollectionMetadataHandlerLogger
+	Config          config.Config
 	MetadataService GetCollectionMetadataHandlerMetadataService
 }
 
@@ -53,7 +57,16 @@ func (h *GetCollectionMetadataAPIHandler) ServeHTTP(resp http.ResponseWriter, re
 		return
 	}
 
-	metadatas, err := h.MetadataService.GetContractMetadata(contracts)
+	for _, contract := range contracts {
+		err = web3.CheckNetwork(h.Config, contract.Blockchain, contract.Network)
+		if err != nil {
+			h.Logger.WithError(err).Error("invalid contract network")
+			h.JSON.WriteResponse(resp, &authgearapi.Response{Error: err})
+			return
+		}
+	}
+
+	result, err := h.MetadataService.GetContractMetadata(req.Context(), contracts)
 	if err != nil {
 		h.Logger.WithError(err).Error("failed to get contract metadata")
 		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: err})
@@ -61,13 +74,15 @@ func (h *GetCollectionMetadataAPIHandler) ServeHTTP(resp http.ResponseWriter, re
 	}
 
 	res := make([]apimodel.NFTCollection, 0, len(contracts))
-	for _, metadata := range metadatas {
+	for _, metadata := range result.Collections {
 		res = append(res, metadata.ToAPIModel())
 	}
 
 	h.JSON.WriteResponse(resp, &authgearapi.Response{
 		Result: &apimodel.GetContractMetadataResponse{
 			Collections: res,
+			Stale:       result.Stale,
+			FetchedAt:   result.FetchedAt,
 		},
 	})
 }
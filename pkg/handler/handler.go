@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/service"
+	"github.com/authgear/authgear-nft-indexer/pkg/web3"
 	authgearapi "github.com/authgear/authgear-server/pkg/api"
 	"github.com/authgear/authgear-server/pkg/lib/infra/redis/appredis"
 	"github.com/authgear/authgear-server/pkg/util/log"
@@ -15,28 +18,45 @@ type JSONResponseWriter interface {
 }
 
 type RequestProvider struct {
-	Config         config.Config
-	Database       *bun.DB
-	Request        *http.Request
-	LogFactory     *log.Factory
-	ResponseWriter http.ResponseWriter
+	Config          config.Config
+	Database        *bun.DB
+	Request         *http.Request
+	LogFactory      *log.Factory
+	ResponseWriter  http.ResponseWriter
+	RateLimiter     *web3.RateLimiter
+	APIKeyPool      *web3.APIKeyPool
+	CircuitBreakers *web3.CircuitBreakers
+	FetchCoalescer  *service.FetchCoalescer
 }
 
 type RouteHandler struct {
-	Config     config.Config
-	Database   *bun.DB
-	Redis      *appredis.Handle
-	LogFactory *log.Factory
+	Config          config.Config
+	Database        *bun.DB
+	Redis           *appredis.Handle
+	LogFactory      *log.Factory
+	RateLimiter     *web3.RateLimiter
+	APIKeyPool      *web3.APIKeyPool
+	CircuitBreakers *web3.CircuitBreakers
+	FetchCoalescer  *service.FetchCoalescer
 }
 
 func (rh *RouteHandler) Handle(factory func(*RequestProvider) http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The time budget is shared by everything done for the request, including upstream pages and queries
+		ctx, cancel := context.WithTimeout(r.Context(), rh.Config.Server.GetRequestTimeout())
+		defer cancel()
+		r = r.WithContext(ctx)
+
 		p := &RequestProvider{
-			Config:         rh.Config,
-			Database:       rh.Database,
-			LogFactory:     rh.LogFactory,
-			Request:        r,
-			ResponseWriter: w,
+			Config:          rh.Config,
+			Database:        rh.Database,
+			LogFactory:      rh.LogFactory,
+			Request:         r,
+			ResponseWriter:  w,
+			RateLimiter:     rh.RateLimiter,
+			APIKeyPool:      rh.APIKeyPool,
+			CircuitBreakers: rh.CircuitBreakers,
+			FetchCoalescer:  rh.FetchCoalescer,
 		}
 
 		router := factory(p)
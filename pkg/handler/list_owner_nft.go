@@ -1,12 +1,16 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
 	apimodel "github.com/authgear/authgear-nft-indexer/pkg/api/model"
 	"github.com/authgear/authgear-nft-indexer/pkg/config"
 	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
+	"github.com/authgear/authgear-nft-indexer/pkg/service"
+	"github.com/authgear/authgear-nft-indexer/pkg/web3"
 	authgearapi "github.com/authgear/authgear-server/pkg/api"
 	"github.com/authgear/authgear-server/pkg/api/apierrors"
 	"github.com/authgear/authgear-server/pkg/util/httproute"
@@ -27,11 +31,11 @@ func NewListOwnerNFTHandlerLogger(lf *log.Factory) ListOwnerNFTHandlerLogger {
 }
 
 type ListOwnerNFTHandlerOwnershipService interface {
-	GetOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID) ([]database.NFTOwnership, error)
+	GetOwnerships(ctx context.Context, ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID, commitment nft.Commitment) (*service.OwnershipsResult, error)
 }
 
 type ListOwnerNFTHandlerMetadataService interface {
-	GetContractMetadata(contracts []authgearweb3.ContractID) ([]database.NFTCollection, error)
+	GetContractMetadata(ctx context.Context, contracts []authgearweb3.ContractID) (*service.ContractMetadataResult, error)
 }
 
 type ListOwnerNFTAPIHandler struct {
@@ -52,7 +56,21 @@ func (h *ListOwnerNFTAPIHandler) ServeHTTP(resp http.ResponseWriter, req *http.R
 		return
 	}
 
+	commitment, err := nft.ParseCommitment(body.Commitment)
+	if err != nil {
+		h.Logger.WithError(err).Error("invalid commitment")
+		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: apierrors.NewBadRequest(err.Error())})
+		return
+	}
+
 	ownerID := body.OwnerAddress
+	err = web3.CheckNetwork(h.Config, ownerID.Blockchain, ownerID.Network)
+	if err != nil {
+		h.Logger.WithError(err).Error("invalid owner network")
+		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: err})
+		return
+	}
+
 	contracts := make([]authgearweb3.ContractID, 0)
 	for _, e := range body.ContractIDs {
 		// Filter out contracts that are not in owner's network
@@ -70,7 +88,7 @@ func (h *ListOwnerNFTAPIHandler) ServeHTTP(resp http.ResponseWriter, req *http.R
 		return
 	}
 
-	collections, err := h.MetadataService.GetContractMetadata(contracts)
+	collectionsResult, err := h.MetadataService.GetContractMetadata(req.Context(), contracts)
 	if err != nil {
 		h.Logger.WithError(err).Error("failed to get nft collections")
 		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: err})
@@ -78,6 +96,7 @@ func (h *ListOwnerNFTAPIHandler) ServeHTTP(resp http.ResponseWriter, req *http.R
 	}
 
 	// Check if the input contract IDs have token ids if they are erc1155
+	collections := collectionsResult.Collections
 	contractIDToCollection := make(map[string]database.NFTCollection)
 	for _, collection := range collections {
 		contractID := collection.ContractID().String()
@@ -97,7 +116,7 @@ func (h *ListOwnerNFTAPIHandler) ServeHTTP(resp http.ResponseWriter, req *http.R
 		}
 	}
 
-	ownerships, err := h.OwnershipService.GetOwnerships(ownerID, contracts)
+	ownershipsResult, err := h.OwnershipService.GetOwnerships(req.Context(), ownerID, contracts, commitment)
 	if err != nil {
 		h.Logger.WithError(err).Error("failed to get nft ownerships")
 		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: err})
@@ -107,7 +126,7 @@ func (h *ListOwnerNFTAPIHandler) ServeHTTP(resp http.ResponseWriter, req *http.R
 	// Build response
 	nfts := make([]apimodel.NFT, 0)
 	for _, collection := range collections {
-		apiNFT := collection.ToAPINFT(ownerships)
+		apiNFT := collection.ToAPINFT(ownershipsResult.Ownerships)
 		if apiNFT != nil {
 			nfts = append(nfts, *apiNFT)
 		}
@@ -115,6 +134,10 @@ func (h *ListOwnerNFTAPIHandler) ServeHTTP(resp http.ResponseWriter, req *http.R
 	}
 
 	ownership := apimodel.NewNFTOwnership(ownerID, nfts)
+	ownership.Stale = collectionsResult.Stale || ownershipsResult.Stale
+	ownership.FetchedAt = ownershipsResult.FetchedAt
+	ownership.Truncated = ownershipsResult.Truncated
+	ownership.TruncatedReason = string(ownershipsResult.TruncatedReason)
 
 	h.JSON.WriteResponse(resp, &authgearapi.Response{
 		Result: &ownership,
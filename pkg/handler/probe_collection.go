@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
 	apimodel "github.com/authgear/authgear-nft-indexer/pkg/api/model"
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/web3"
 	authgearapi "github.com/authgear/authgear-server/pkg/api"
 	"github.com/authgear/authgear-server/pkg/api/apierrors"
 	"github.com/authgear/authgear-server/pkg/util/httproute"
@@ -25,11 +28,12 @@ func NewProbeCollectionHandlerLogger(lf *log.Factory) ProbeCollectionHandlerLogg
 }
 
 type ProbeCollectionHandlerProbeService interface {
-	ProbeCollection(contractID authgearweb3.ContractID) (bool, error)
+	ProbeCollection(ctx context.Context, contractID authgearweb3.ContractID) (bool, error)
 }
 type ProbeCollectionAPIHandler struct {
 	JSON         JSONResponseWriter
 	Logger       ProbeCollectionHandlerLogger
+	Config       config.Config
 	ProbeService ProbeCollectionHandlerProbeService
 }
 
@@ -45,7 +49,14 @@ func (h *ProbeCollectionAPIHandler) ServeHTTP(resp http.ResponseWriter, req *htt
 	}
 
 	contractID := body.ContractID
-	probe, err := h.ProbeService.ProbeCollection(contractID)
+	err = web3.CheckNetwork(h.Config, contractID.Blockchain, contractID.Network)
+	if err != nil {
+		h.Logger.WithError(err).Error("invalid contract network")
+		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: err})
+		return
+	}
+
+	probe, err := h.ProbeService.ProbeCollection(req.Context(), contractID)
 	if err != nil {
 		h.Logger.WithError(err).Error("failed to probe nft collection")
 		h.JSON.WriteResponse(resp, &authgearapi.Response{Error: err})
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+
+	apimodel "github.com/authgear/authgear-nft-indexer/pkg/api/model"
+	"github.com/authgear/authgear-nft-indexer/pkg/web3"
+	authgearapi "github.com/authgear/authgear-server/pkg/api"
+	"github.com/authgear/authgear-server/pkg/util/httproute"
+	"github.com/authgear/authgear-server/pkg/util/log"
+)
+
+func ConfigureUsageRoute(route httproute.Route) httproute.Route {
+	return route.
+		WithMethods("GET").
+		WithPathPattern("/usage")
+}
+
+type UsageHandlerLogger struct{ *log.Logger }
+
+func NewUsageHandlerLogger(lf *log.Factory) UsageHandlerLogger {
+	return UsageHandlerLogger{lf.New("api-usage")}
+}
+
+type UsageHandlerUsageReporter interface {
+	GetAPIKeyUsage() []web3.APIKeyUsage
+}
+
+type UsageAPIHandler struct {
+	JSON          JSONResponseWriter
+	Logger        UsageHandlerLogger
+	UsageReporter UsageHandlerUsageReporter
+}
+
+func (h *UsageAPIHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	usages := h.UsageReporter.GetAPIKeyUsage()
+
+	apiKeys := make([]apimodel.APIKeyUsage, 0, len(usages))
+	for _, usage := range usages {
+		apiKeys = append(apiKeys, apimodel.APIKeyUsage{
+			Blockchain:        usage.Blockchain,
+			Network:           usage.Network,
+			Key:               usage.MaskedKey,
+			Requests:          usage.Requests,
+			Failures:          usage.Failures,
+			LastFailure:       usage.LastFailure,
+			CooldownUntil:     usage.CooldownUntil,
+			ComputeUnitsToday: usage.ComputeUnitsToday,
+		})
+	}
+
+	h.JSON.WriteResponse(resp, &authgearapi.Response{
+		Result: &apimodel.GetUsageResponse{
+			Scope:   apimodel.UsageScopeReplica,
+			APIKeys: apiKeys,
+		},
+	})
+}
@@ -0,0 +1,67 @@
+package job
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/authgear/authgear-server/pkg/util/log"
+)
+
+// PeriodicDaemon runs Run every Interval until stopped, it implements signalutil.Daemon
+type PeriodicDaemon struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func (d *PeriodicDaemon) DisplayName() string {
+	return d.Name
+}
+
+func (d *PeriodicDaemon) Start(ctx context.Context, logger *log.Logger) {
+	ctx, d.cancel = context.WithCancel(ctx)
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(d.Interval)
+		defer ticker.Stop()
+
+		for {
+			err := d.Run(ctx)
+			if err != nil && ctx.Err() == nil {
+				logger.WithError(err).WithField("daemon", d.Name).Error("periodic job failed")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (d *PeriodicDaemon) Stop(ctx context.Context, logger *log.Logger) error {
+	if d.cancel != nil {
+		d.cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
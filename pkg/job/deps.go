@@ -0,0 +1,18 @@
+package job
+
+import (
+	"github.com/google/wire"
+)
+
+var DependencySet = wire.NewSet(
+	wire.FieldsOf(new(*Provider),
+		"Context",
+		"Config",
+		"Database",
+		"LogFactory",
+		"RateLimiter",
+		"APIKeyPool",
+		"CircuitBreakers",
+		"FetchCoalescer",
+	),
+)
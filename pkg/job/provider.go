@@ -0,0 +1,24 @@
+package job
+
+import (
+	"context"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/service"
+	"github.com/authgear/authgear-nft-indexer/pkg/web3"
+	"github.com/authgear/authgear-server/pkg/util/log"
+	"github.com/uptrace/bun"
+)
+
+// Provider is the root of dependencies of background jobs, like RequestProvider is for API requests
+type Provider struct {
+	Context    context.Context
+	Config     config.Config
+	Database   *bun.DB
+	LogFactory *log.Factory
+	// Upstream state is only needed by jobs calling the providers
+	RateLimiter     *web3.RateLimiter
+	APIKeyPool      *web3.APIKeyPool
+	CircuitBreakers *web3.CircuitBreakers
+	FetchCoalescer  *service.FetchCoalescer
+}
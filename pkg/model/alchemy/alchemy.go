@@ -2,15 +2,14 @@ package alchemy
 
 import (
 	"fmt"
-	"net/url"
+	"math/big"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
 	"github.com/authgear/authgear-server/pkg/util/hexstring"
 	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
-	"github.com/uptrace/bun/extra/bunbig"
 )
 
 type RawContract struct {
@@ -133,127 +132,128 @@ type GetNFTsResponse struct {
 	PageKey   *string    `json:"pageKey,omitempty"`
 }
 
-func MakeNFTOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID, transfers []TokenTransfer, ownedNFTs []OwnedNFT) ([]database.NFTOwnership, error) {
-	contractIDToTokenIDToBalance := make(map[string]map[string]string)
-	for _, ownedNFT := range ownedNFTs {
-		contractID, err := authgearweb3.NewContractID(ownerID.Blockchain, ownerID.Network, ownedNFT.Contract.Address, url.Values{})
+func (r GetNFTsResponse) ToOwnedTokens() (*nft.OwnedTokens, error) {
+	tokens := make([]nft.OwnedToken, 0, len(r.OwnedNFTs))
+	for _, ownedNFT := range r.OwnedNFTs {
+		tokenID, err := hexstring.TrimmedParse(ownedNFT.ID.TokenID)
 		if err != nil {
-			return []database.NFTOwnership{}, err
+			return nil, err
 		}
 
-		contractURL := contractID.String()
+		tokens = append(tokens, nft.OwnedToken{
+			ContractAddress: authgearweb3.EIP55(ownedNFT.Contract.Address),
+			TokenID:         tokenID.String(),
+			Balance:         ownedNFT.Balance,
+		})
+	}
 
-		if _, ok := contractIDToTokenIDToBalance[contractURL]; !ok {
-			contractIDToTokenIDToBalance[contractURL] = make(map[string]string)
-		}
-		contractIDToTokenIDToBalance[contractURL][ownedNFT.ID.TokenID] = ownedNFT.Balance
+	pageKey := ""
+	if r.PageKey != nil {
+		pageKey = *r.PageKey
 	}
 
-	contractIDToTokenIDToOwnership := make(map[string]map[string]database.NFTOwnership, 0)
-	for _, transfer := range transfers {
-		blockNumber, err := hexstring.Parse(transfer.BlockNum)
-		if err != nil {
-			return []database.NFTOwnership{}, err
-		}
+	return &nft.OwnedTokens{
+		Tokens:  tokens,
+		PageKey: pageKey,
+	}, nil
+}
 
-		blockTime, err := time.Parse(time.RFC3339, transfer.Metadata.BlockTimestamp)
-		if err != nil {
-			return []database.NFTOwnership{}, err
-		}
+func (t TokenTransfer) ToTransfers() ([]nft.Transfer, error) {
+	blockNumber, err := hexstring.Parse(t.BlockNum)
+	if err != nil {
+		return nil, err
+	}
 
-		uniqueID, err := ParseTransactionUniqueID(transfer.UniqueID)
-		if err != nil {
-			return []database.NFTOwnership{}, err
-		}
+	blockTime, err := time.Parse(time.RFC3339, t.Metadata.BlockTimestamp)
+	if err != nil {
+		return nil, err
+	}
 
-		contractID, err := authgearweb3.NewContractID(ownerID.Blockchain, ownerID.Network, transfer.RawContract.Address.String(), url.Values{})
+	uniqueID, err := ParseTransactionUniqueID(t.UniqueID)
+	if err != nil {
+		return nil, err
+	}
+
+	newTransfer := func(tokenID string, value *big.Int) (nft.Transfer, error) {
+		trimmedTokenID, err := hexstring.TrimmedParse(tokenID)
 		if err != nil {
-			return []database.NFTOwnership{}, err
+			return nft.Transfer{}, err
 		}
 
-		contractURL := contractID.String()
+		return nft.Transfer{
+			ContractAddress: t.RawContract.Address,
+			TokenID:         trimmedTokenID.String(),
+			Value:           value,
+			From:            t.From,
+			To:              t.To,
+			BlockNumber:     blockNumber.ToBigInt(),
+			BlockTimestamp:  &blockTime,
+			TransactionHash: t.Hash,
+			LogIndex:        uniqueID.TransactionIndex,
+		}, nil
+	}
 
-		if _, ok := contractIDToTokenIDToOwnership[contractURL]; !ok {
-			contractIDToTokenIDToOwnership[contractURL] = make(map[string]database.NFTOwnership)
-		}
+	// Transfer is ERC-1155
+	if t.ERC1155Metadata != nil {
+		transfers := make([]nft.Transfer, 0, len(*t.ERC1155Metadata))
+		for _, erc1155 := range *t.ERC1155Metadata {
+			value, err := hexstring.Parse(erc1155.Value)
+			if err != nil {
+				return nil, err
+			}
 
-		if transfer.ERC1155Metadata != nil {
-			for _, erc1155 := range *transfer.ERC1155Metadata {
-				balance := contractIDToTokenIDToBalance[contractURL][erc1155.TokenID]
-				if _, ok := contractIDToTokenIDToOwnership[contractURL][erc1155.TokenID]; !ok {
-					tokenID, err := hexstring.TrimmedParse(erc1155.TokenID)
-					if err != nil {
-						return []database.NFTOwnership{}, err
-					}
-
-					contractIDToTokenIDToOwnership[contractURL][erc1155.TokenID] = database.NFTOwnership{
-						Blockchain:       contractID.Blockchain,
-						Network:          contractID.Network,
-						ContractAddress:  contractID.Address,
-						TokenID:          tokenID.String(),
-						Balance:          balance,
-						BlockNumber:      bunbig.FromMathBig(blockNumber.ToBigInt()),
-						OwnerAddress:     transfer.To,
-						TransactionHash:  transfer.Hash,
-						TransactionIndex: uniqueID.TransactionIndex,
-						BlockTimestamp:   &blockTime,
-					}
-				}
+			transfer, err := newTransfer(erc1155.TokenID, value.ToBigInt())
+			if err != nil {
+				return nil, err
 			}
-			continue
+			transfers = append(transfers, transfer)
 		}
+		return transfers, nil
+	}
 
-		tokenID, err := hexstring.TrimmedParse(transfer.TokenID)
-		if err != nil {
-			return []database.NFTOwnership{}, err
-		}
+	// Transfer is ERC-721
+	transfer, err := newTransfer(t.TokenID, big.NewInt(1))
+	if err != nil {
+		return nil, err
+	}
 
-		// Transfer is ERC-721
-		balance := contractIDToTokenIDToBalance[contractURL][transfer.TokenID]
-		if _, ok := contractIDToTokenIDToOwnership[contractURL][transfer.TokenID]; !ok {
-			contractIDToTokenIDToOwnership[contractURL][transfer.TokenID] = database.NFTOwnership{
-				Blockchain:       contractID.Blockchain,
-				Network:          contractID.Network,
-				ContractAddress:  contractID.Address,
-				TokenID:          tokenID.String(),
-				Balance:          balance,
-				BlockNumber:      bunbig.FromMathBig(blockNumber.ToBigInt()),
-				OwnerAddress:     transfer.To,
-				TransactionHash:  transfer.Hash,
-				TransactionIndex: uniqueID.TransactionIndex,
-				BlockTimestamp:   &blockTime,
-			}
+	return []nft.Transfer{transfer}, nil
+}
+
+func (r AssetTransferResult) ToTransfers() (*nft.Transfers, error) {
+	transfers := make([]nft.Transfer, 0, len(r.Transfers))
+	for _, tokenTransfer := range r.Transfers {
+		t, err := tokenTransfer.ToTransfers()
+		if err != nil {
+			return nil, err
 		}
+		transfers = append(transfers, t...)
 	}
 
-	ownerships := make([]database.NFTOwnership, 0)
-	for _, contract := range contracts {
-		tokenIDs := contract.Query["token_ids"]
-		strippedContractID := contract.StripQuery().String()
-
-		contractOwnerships, ownershipsOk := contractIDToTokenIDToOwnership[strippedContractID]
-		// Handle ERC-1155
-		if len(tokenIDs) != 0 {
-			// Append either existing ownership or empty ownership for each tokenID
-			for _, tokenID := range tokenIDs {
-				erc1155ownership, ok := contractOwnerships[tokenID]
-				if !ownershipsOk || !ok {
-					ownerships = append(ownerships, database.NewEmptyNFTOwnership(contract, tokenID, ownerID))
-				}
-
-				if ok {
-					ownerships = append(ownerships, erc1155ownership)
-				}
-			}
-		} else if ownershipsOk {
-			for _, erc721ownership := range contractOwnerships {
-				ownerships = append(ownerships, erc721ownership)
-			}
-		} else {
-			ownerships = append(ownerships, database.NewEmptyNFTOwnership(contract, "0x0", ownerID))
-		}
+	return &nft.Transfers{
+		Transfers: transfers,
+		PageKey:   r.PageKey,
+	}, nil
+}
 
+func (r ContractMetadataResponse) ToContractMetadata() *nft.ContractMetadata {
+	return &nft.ContractMetadata{
+		Address:     authgearweb3.EIP55(r.Address),
+		Name:        r.ContractMetadata.Name,
+		Symbol:      r.ContractMetadata.Symbol,
+		TotalSupply: r.ContractMetadata.TotalSupply,
+		TokenType:   r.ContractMetadata.TokenType,
 	}
+}
 
-	return ownerships, nil
+func (r GetOwnersForCollectionResponse) ToHolders() *nft.Holders {
+	pageKey := ""
+	if r.PageKey != nil {
+		pageKey = *r.PageKey
+	}
+
+	return &nft.Holders{
+		OwnerAddresses: r.OwnerAddresses,
+		PageKey:        pageKey,
+	}
 }
@@ -0,0 +1,155 @@
+package alchemy
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+// decimalToTrimmedHex converts token ids of NFT API v3, which are in decimal
+func decimalToTrimmedHex(tokenID string) (string, error) {
+	i, ok := new(big.Int).SetString(tokenID, 10)
+	if !ok {
+		return "", fmt.Errorf("invalid token id: %v", tokenID)
+	}
+	return "0x" + i.Text(16), nil
+}
+
+func TrimmedHexToDecimal(tokenID string) (string, error) {
+	i, ok := new(big.Int).SetString(tokenID, 0)
+	if !ok {
+		return "", fmt.Errorf("invalid token id: %v", tokenID)
+	}
+	return i.Text(10), nil
+}
+
+type ContractV3 struct {
+	Address     string `json:"address"`
+	Name        string `json:"name"`
+	Symbol      string `json:"symbol"`
+	TotalSupply string `json:"totalSupply,omitempty"`
+	TokenType   string `json:"tokenType"`
+}
+
+func (c ContractV3) ToContractMetadata() nft.ContractMetadata {
+	return nft.ContractMetadata{
+		Address:     authgearweb3.EIP55(c.Address),
+		Name:        c.Name,
+		Symbol:      c.Symbol,
+		TotalSupply: c.TotalSupply,
+		TokenType:   c.TokenType,
+	}
+}
+
+type OwnedNFTV3 struct {
+	ContractAddress string `json:"contractAddress"`
+	TokenID         string `json:"tokenId"`
+	Balance         string `json:"balance"`
+}
+
+type GetNFTsForOwnerResponse struct {
+	OwnedNFTs []OwnedNFTV3 `json:"ownedNfts"`
+	PageKey   *string      `json:"pageKey,omitempty"`
+}
+
+func (r GetNFTsForOwnerResponse) ToOwnedTokens() (*nft.OwnedTokens, error) {
+	tokens := make([]nft.OwnedToken, 0, len(r.OwnedNFTs))
+	for _, ownedNFT := range r.OwnedNFTs {
+		tokenID, err := decimalToTrimmedHex(ownedNFT.TokenID)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, nft.OwnedToken{
+			ContractAddress: authgearweb3.EIP55(ownedNFT.ContractAddress),
+			TokenID:         tokenID,
+			Balance:         ownedNFT.Balance,
+		})
+	}
+
+	pageKey := ""
+	if r.PageKey != nil {
+		pageKey = *r.PageKey
+	}
+
+	return &nft.OwnedTokens{
+		Tokens:  tokens,
+		PageKey: pageKey,
+	}, nil
+}
+
+type GetContractMetadataBatchRequest struct {
+	ContractAddresses []authgearweb3.EIP55 `json:"contractAddresses"`
+}
+
+type GetContractMetadataBatchResponse struct {
+	Contracts []ContractV3 `json:"contracts"`
+}
+
+type GetOwnersForContractResponse struct {
+	Owners  []string `json:"owners"`
+	PageKey *string  `json:"pageKey,omitempty"`
+}
+
+func (r GetOwnersForContractResponse) ToHolders() *nft.Holders {
+	pageKey := ""
+	if r.PageKey != nil {
+		pageKey = *r.PageKey
+	}
+
+	return &nft.Holders{
+		OwnerAddresses: r.Owners,
+		PageKey:        pageKey,
+	}
+}
+
+type NFTMetadataToken struct {
+	ContractAddress authgearweb3.EIP55 `json:"contractAddress"`
+	TokenID         string             `json:"tokenId"`
+}
+
+type GetNFTMetadataBatchRequest struct {
+	Tokens []NFTMetadataToken `json:"tokens"`
+}
+
+type NFTImageV3 struct {
+	OriginalURL string `json:"originalUrl"`
+}
+
+type NFTV3 struct {
+	Contract    ContractV3 `json:"contract"`
+	TokenID     string     `json:"tokenId"`
+	TokenType   string     `json:"tokenType"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	TokenURI    string     `json:"tokenUri"`
+	Image       NFTImageV3 `json:"image"`
+}
+
+type GetNFTMetadataBatchResponse struct {
+	NFTs []NFTV3 `json:"nfts"`
+}
+
+func (r GetNFTMetadataBatchResponse) ToTokenMetadata() ([]nft.TokenMetadata, error) {
+	tokens := make([]nft.TokenMetadata, 0, len(r.NFTs))
+	for _, n := range r.NFTs {
+		tokenID, err := decimalToTrimmedHex(n.TokenID)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, nft.TokenMetadata{
+			ContractAddress: authgearweb3.EIP55(n.Contract.Address),
+			TokenID:         tokenID,
+			TokenType:       n.TokenType,
+			Name:            n.Name,
+			Description:     n.Description,
+			TokenURI:        n.TokenURI,
+			ImageURL:        n.Image.OriginalURL,
+		})
+	}
+
+	return tokens, nil
+}
@@ -5,6 +5,7 @@ import (
 	"math/big"
 	"net/url"
 	"strings"
+	"time"
 
 	apimodel "github.com/authgear/authgear-nft-indexer/pkg/api/model"
 	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
@@ -41,6 +42,7 @@ type NFTCollection struct {
 	Name            string             `bun:"name,notnull"`
 	TotalSupply     *bunbig.Int        `bun:"total_supply"`
 	Type            NFTCollectionType  `bun:"type,notnull"`
+	LastQueriedAt   time.Time          `bun:"last_queried_at,notnull"`
 }
 
 func (c NFTCollection) ContractID() *authgearweb3.ContractID {
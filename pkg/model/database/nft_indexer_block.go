@@ -0,0 +1,19 @@
+package database
+
+import (
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/extra/bunbig"
+)
+
+// NFTIndexerBlock is a block the worker stopped at while indexing a collection, it is kept until the block is final
+type NFTIndexerBlock struct {
+	bun.BaseModel `bun:"table:eth_nft_indexer_block"`
+	Base
+
+	Blockchain      string             `bun:"blockchain,notnull"`
+	Network         string             `bun:"network,notnull"`
+	ContractAddress authgearweb3.EIP55 `bun:"contract_address,notnull"`
+	BlockNumber     *bunbig.Int        `bun:"block_number,notnull"`
+	BlockHash       string             `bun:"block_hash,notnull"`
+}
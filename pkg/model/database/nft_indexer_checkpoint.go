@@ -0,0 +1,37 @@
+package database
+
+import (
+	"net/url"
+	"time"
+
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/extra/bunbig"
+)
+
+// NFTIndexerCheckpoint is the last block of a tracked collection applied to eth_nft_ownership by the worker
+type NFTIndexerCheckpoint struct {
+	bun.BaseModel `bun:"table:eth_nft_indexer_checkpoint"`
+	BaseWithUpdateAt
+
+	Blockchain      string             `bun:"blockchain,notnull"`
+	Network         string             `bun:"network,notnull"`
+	ContractAddress authgearweb3.EIP55 `bun:"contract_address,notnull"`
+	BlockNumber     *bunbig.Int        `bun:"block_number,notnull"`
+	// BlockHash is empty for checkpoints saved before reorganizations were detected
+	BlockHash string `bun:"block_hash,nullzero"`
+	// SyncedAt is the first time the worker caught up with the chain, ownerships are incomplete before
+	SyncedAt *time.Time `bun:"synced_at"`
+}
+
+func (c NFTIndexerCheckpoint) ContractID() *authgearweb3.ContractID {
+	cid, err := authgearweb3.NewContractID(c.Blockchain, c.Network, c.ContractAddress.String(), url.Values{})
+	if err != nil {
+		panic(err)
+	}
+	return cid
+}
+
+func (c NFTIndexerCheckpoint) IsSynced() bool {
+	return c.SyncedAt != nil
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type NFTJobType string
+
+const (
+	NFTJobTypeRefreshOwnerships NFTJobType = "refresh_ownerships"
+	NFTJobTypeRefreshMetadata   NFTJobType = "refresh_metadata"
+	NFTJobTypeProbeCollection   NFTJobType = "probe_collection"
+)
+
+type NFTJobStatus string
+
+const (
+	NFTJobStatusPending NFTJobStatus = "pending"
+	NFTJobStatusRunning NFTJobStatus = "running"
+	// NFTJobStatusDead jobs have run out of attempts, they are kept for inspection and never run again
+	NFTJobStatusDead NFTJobStatus = "dead"
+)
+
+// NFTJob is a unit of asynchronous refresh work, claimed by one worker at a time
+type NFTJob struct {
+	bun.BaseModel `bun:"table:eth_nft_job"`
+	BaseWithID
+
+	Type    NFTJobType      `bun:"type,notnull"`
+	Payload json.RawMessage `bun:"payload,type:jsonb,notnull"`
+	// DedupKey identifies the work, a job is not enqueued while another one of the same key is pending or running
+	DedupKey    string       `bun:"dedup_key,nullzero"`
+	Status      NFTJobStatus `bun:"status,notnull"`
+	Attempts    int          `bun:"attempts,notnull"`
+	MaxAttempts int          `bun:"max_attempts,notnull"`
+	RunAt       time.Time    `bun:"run_at,notnull"`
+	// LockedAt is when a worker claimed the job, a running job locked for too long is claimed again
+	LockedAt  *time.Time `bun:"locked_at"`
+	LastError string     `bun:"last_error,nullzero"`
+}
+
+// IsLastAttempt is true if the job is dead-lettered when the running attempt fails
+func (j NFTJob) IsLastAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
@@ -24,6 +24,8 @@ type NFTOwnership struct {
 	TransactionHash  string             `bun:"txn_hash,notnull"`
 	TransactionIndex int                `bun:"txn_index,notnull"`
 	BlockTimestamp   *time.Time         `bun:"block_timestamp"`
+	// RefreshedAt is the last time the ownership was confirmed by the provider
+	RefreshedAt time.Time `bun:"refreshed_at,notnull"`
 }
 
 func (c NFTOwnership) ContractID() *authgearweb3.ContractID {
@@ -37,7 +39,7 @@ func (c NFTOwnership) ContractID() *authgearweb3.ContractID {
 func (c NFTOwnership) ContractTokenID() *authgearweb3.ContractID {
 	values := url.Values{}
 	values.Set("token_ids", c.TokenID)
-	cid, err := authgearweb3.NewContractID(c.Blockchain, c.Network, c.ContractAddress.String(), url.Values{})
+	cid, err := authgearweb3.NewContractID(c.Blockchain, c.Network, c.ContractAddress.String(), values)
 	if err != nil {
 		panic(err)
 	}
@@ -62,6 +64,21 @@ func (c NFTOwnership) IsEmpty() bool {
 	return c.TransactionHash == "0x0"
 }
 
+// LatestNFTOwnerships keeps the first row of each token, given rows ordered by refreshed_at DESC
+func LatestNFTOwnerships(ownerships []NFTOwnership) []NFTOwnership {
+	seen := make(map[string]struct{})
+	latest := make([]NFTOwnership, 0, len(ownerships))
+	for _, ownership := range ownerships {
+		key := ownership.ContractTokenID().String()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		latest = append(latest, ownership)
+	}
+	return latest
+}
+
 func NewEmptyNFTOwnership(contractID authgearweb3.ContractID, tokenID string, ownerID authgearweb3.ContractID) NFTOwnership {
 	return NFTOwnership{
 		Blockchain:       contractID.Blockchain,
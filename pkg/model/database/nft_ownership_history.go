@@ -0,0 +1,91 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/extra/bunbig"
+)
+
+const (
+	nftOwnershipHistoryPartitionPrefix     = "eth_nft_ownership_history_p"
+	nftOwnershipHistoryPartitionNameLayout = "20060102"
+)
+
+// NFTOwnershipHistory is an ownership as stored by one refresh, rows are only appended
+type NFTOwnershipHistory struct {
+	bun.BaseModel `bun:"table:eth_nft_ownership_history"`
+	Base
+
+	Blockchain       string             `bun:"blockchain,notnull"`
+	Network          string             `bun:"network,notnull"`
+	ContractAddress  authgearweb3.EIP55 `bun:"contract_address,notnull"`
+	TokenID          string             `bun:"token_id,notnull"`
+	Balance          string             `bun:"balance,notnull"`
+	BlockNumber      *bunbig.Int        `bun:"block_number,notnull"`
+	OwnerAddress     authgearweb3.EIP55 `bun:"owner_address,notnull"`
+	TransactionHash  string             `bun:"txn_hash,notnull"`
+	TransactionIndex int                `bun:"txn_index,notnull"`
+	BlockTimestamp   *time.Time         `bun:"block_timestamp"`
+	RefreshedAt      time.Time          `bun:"refreshed_at,notnull"`
+	// RefreshedOn is the day of RefreshedAt, the table is partitioned by it
+	RefreshedOn time.Time `bun:"refreshed_on,type:date,notnull"`
+}
+
+func NewNFTOwnershipHistory(ownership NFTOwnership) NFTOwnershipHistory {
+	return NFTOwnershipHistory{
+		Blockchain:       ownership.Blockchain,
+		Network:          ownership.Network,
+		ContractAddress:  ownership.ContractAddress,
+		TokenID:          ownership.TokenID,
+		Balance:          ownership.Balance,
+		BlockNumber:      ownership.BlockNumber,
+		OwnerAddress:     ownership.OwnerAddress,
+		TransactionHash:  ownership.TransactionHash,
+		TransactionIndex: ownership.TransactionIndex,
+		BlockTimestamp:   ownership.BlockTimestamp,
+		RefreshedAt:      ownership.RefreshedAt,
+		RefreshedOn:      NFTOwnershipHistoryPartitionDay(ownership.RefreshedAt),
+	}
+}
+
+// NFTOwnershipHistoryPartition holds the history of ownerships refreshed on Day
+type NFTOwnershipHistoryPartition struct {
+	Name string
+	Day  time.Time
+}
+
+// NFTOwnershipHistoryPartitionDay is the UTC day of t, which is the partition key of an ownership refreshed at t
+func NFTOwnershipHistoryPartitionDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func NewNFTOwnershipHistoryPartition(day time.Time) NFTOwnershipHistoryPartition {
+	day = NFTOwnershipHistoryPartitionDay(day)
+	return NFTOwnershipHistoryPartition{
+		Name: nftOwnershipHistoryPartitionPrefix + day.Format(nftOwnershipHistoryPartitionNameLayout),
+		Day:  day,
+	}
+}
+
+// ParseNFTOwnershipHistoryPartition returns false if name is not a daily partition, e.g. the default partition
+func ParseNFTOwnershipHistoryPartition(name string) (NFTOwnershipHistoryPartition, bool) {
+	if !strings.HasPrefix(name, nftOwnershipHistoryPartitionPrefix) {
+		return NFTOwnershipHistoryPartition{}, false
+	}
+
+	day, err := time.Parse(nftOwnershipHistoryPartitionNameLayout, strings.TrimPrefix(name, nftOwnershipHistoryPartitionPrefix))
+	if err != nil {
+		return NFTOwnershipHistoryPartition{}, false
+	}
+
+	return NFTOwnershipHistoryPartition{Name: name, Day: day}, true
+}
+
+// End is the exclusive upper bound of the partition
+func (p NFTOwnershipHistoryPartition) End() time.Time {
+	return p.Day.AddDate(0, 0, 1)
+}
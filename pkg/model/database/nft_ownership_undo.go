@@ -0,0 +1,127 @@
+package database
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/extra/bunbig"
+)
+
+// NFTOwnershipUndo is an ownership before the transfers of a block which is not final yet.
+// The previous columns are nil if the owner held none of the token before the block.
+type NFTOwnershipUndo struct {
+	bun.BaseModel `bun:"table:eth_nft_ownership_undo"`
+	Base
+
+	Blockchain      string             `bun:"blockchain,notnull"`
+	Network         string             `bun:"network,notnull"`
+	ContractAddress authgearweb3.EIP55 `bun:"contract_address,notnull"`
+	// BlockNumber is the block whose transfers changed the ownership
+	BlockNumber  int64              `bun:"block_number,notnull"`
+	TokenID      string             `bun:"token_id,notnull"`
+	OwnerAddress authgearweb3.EIP55 `bun:"owner_address,notnull"`
+
+	PreviousBalance          *string     `bun:"previous_balance"`
+	PreviousBlockNumber      *bunbig.Int `bun:"previous_block_number"`
+	PreviousTransactionHash  *string     `bun:"previous_txn_hash"`
+	PreviousTransactionIndex *int        `bun:"previous_txn_index"`
+	PreviousBlockTimestamp   *time.Time  `bun:"previous_block_timestamp"`
+}
+
+// NewNFTOwnershipUndo records previous as the ownership before the block, previous is nil if there was none
+func NewNFTOwnershipUndo(blockNumber int64, current NFTOwnership, previous *NFTOwnership) NFTOwnershipUndo {
+	undo := NFTOwnershipUndo{
+		Blockchain:      current.Blockchain,
+		Network:         current.Network,
+		ContractAddress: current.ContractAddress,
+		BlockNumber:     blockNumber,
+		TokenID:         current.TokenID,
+		OwnerAddress:    current.OwnerAddress,
+	}
+
+	if previous != nil {
+		undo.PreviousBalance = &previous.Balance
+		undo.PreviousBlockNumber = previous.BlockNumber
+		undo.PreviousTransactionHash = &previous.TransactionHash
+		undo.PreviousTransactionIndex = &previous.TransactionIndex
+		undo.PreviousBlockTimestamp = previous.BlockTimestamp
+	}
+
+	return undo
+}
+
+func (u NFTOwnershipUndo) ContractID() *authgearweb3.ContractID {
+	cid, err := authgearweb3.NewContractID(u.Blockchain, u.Network, u.ContractAddress.String(), url.Values{})
+	if err != nil {
+		panic(err)
+	}
+	return cid
+}
+
+func nftOwnershipKey(contractAddress authgearweb3.EIP55, tokenID string, ownerAddress authgearweb3.EIP55) string {
+	return strings.ToLower(contractAddress.String()) + "/" + tokenID + "/" + strings.ToLower(ownerAddress.String())
+}
+
+// Previous returns the ownership before the block, nil if there was none
+func (u NFTOwnershipUndo) Previous() *NFTOwnership {
+	if u.PreviousBalance == nil {
+		return nil
+	}
+
+	ownership := &NFTOwnership{
+		Blockchain:      u.Blockchain,
+		Network:         u.Network,
+		ContractAddress: u.ContractAddress,
+		TokenID:         u.TokenID,
+		Balance:         *u.PreviousBalance,
+		BlockNumber:     u.PreviousBlockNumber,
+		OwnerAddress:    u.OwnerAddress,
+		BlockTimestamp:  u.PreviousBlockTimestamp,
+	}
+	if u.PreviousTransactionHash != nil {
+		ownership.TransactionHash = *u.PreviousTransactionHash
+	}
+	if u.PreviousTransactionIndex != nil {
+		ownership.TransactionIndex = *u.PreviousTransactionIndex
+	}
+	return ownership
+}
+
+// NFTOwnershipsAsOf rolls ownerships back with the undos of later blocks, given undos ordered by block ascending.
+// The earliest undo of an ownership holds its state before all later blocks.
+func NFTOwnershipsAsOf(ownerships []NFTOwnership, undos []NFTOwnershipUndo) []NFTOwnership {
+	previous := make(map[string]*NFTOwnership)
+	for _, undo := range undos {
+		key := nftOwnershipKey(undo.ContractAddress, undo.TokenID, undo.OwnerAddress)
+		if _, ok := previous[key]; ok {
+			continue
+		}
+		previous[key] = undo.Previous()
+	}
+
+	result := make([]NFTOwnership, 0, len(ownerships))
+	for _, ownership := range ownerships {
+		key := nftOwnershipKey(ownership.ContractAddress, ownership.TokenID, ownership.OwnerAddress)
+		if _, ok := previous[key]; ok {
+			continue
+		}
+		result = append(result, ownership)
+	}
+
+	for _, undo := range undos {
+		key := nftOwnershipKey(undo.ContractAddress, undo.TokenID, undo.OwnerAddress)
+		p, ok := previous[key]
+		if !ok {
+			continue
+		}
+		delete(previous, key)
+		if p != nil {
+			result = append(result, *p)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	apimodel "github.com/authgear/authgear-nft-indexer/pkg/api/model"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun"
+)
+
+type TrackedCollectionMode string
+
+const (
+	// TrackedCollectionModeIndexed collections are followed block by block by the worker, ownerships are answered from the database alone
+	TrackedCollectionModeIndexed TrackedCollectionMode = "indexed"
+	// TrackedCollectionModeCached collections are fetched lazily like untracked ones, with their own TTL
+	TrackedCollectionModeCached TrackedCollectionMode = "cached"
+)
+
+func ParseTrackedCollectionMode(m string) (TrackedCollectionMode, error) {
+	switch mode := TrackedCollectionMode(strings.ToLower(m)); mode {
+	case TrackedCollectionModeIndexed, TrackedCollectionModeCached:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown tracked collection mode: %v", m)
+	}
+}
+
+// NFTTrackedCollection is a collection the indexer keeps warm proactively
+type NFTTrackedCollection struct {
+	bun.BaseModel `bun:"table:eth_nft_tracked_collection"`
+	BaseWithID
+
+	Blockchain      string                `bun:"blockchain,notnull"`
+	Network         string                `bun:"network,notnull"`
+	ContractAddress authgearweb3.EIP55    `bun:"contract_address,notnull"`
+	Mode            TrackedCollectionMode `bun:"mode,notnull"`
+	// StartBlock is where the worker starts indexing, e.g. the deployment block of the contract
+	StartBlock int64 `bun:"start_block,notnull"`
+	// TTLSeconds overrides collection_cache_ttl and ownership_cache_ttl, nil means the global ones
+	TTLSeconds *int       `bun:"ttl_seconds"`
+	PausedAt   *time.Time `bun:"paused_at"`
+}
+
+func (c NFTTrackedCollection) ContractID() *authgearweb3.ContractID {
+	cid, err := authgearweb3.NewContractID(c.Blockchain, c.Network, c.ContractAddress.String(), url.Values{})
+	if err != nil {
+		panic(err)
+	}
+	return cid
+}
+
+func (c NFTTrackedCollection) IsPaused() bool {
+	return c.PausedAt != nil
+}
+
+// IsIndexed is true if the worker maintains the ownerships, even if it is paused
+func (c NFTTrackedCollection) IsIndexed() bool {
+	return c.Mode == TrackedCollectionModeIndexed
+}
+
+// GetTTL returns defaultTTL if the collection has no TTL of its own
+func (c NFTTrackedCollection) GetTTL(defaultTTL time.Duration) time.Duration {
+	if c.TTLSeconds == nil {
+		return defaultTTL
+	}
+	return time.Duration(*c.TTLSeconds) * time.Second
+}
+
+func (c NFTTrackedCollection) ToAPIModel() apimodel.TrackedCollection {
+	return apimodel.TrackedCollection{
+		ContractID: *c.ContractID(),
+		Mode:       string(c.Mode),
+		StartBlock: c.StartBlock,
+		TTLSeconds: c.TTLSeconds,
+		PausedAt:   c.PausedAt,
+		CreatedAt:  c.CreatedAt,
+		UpdatedAt:  c.UpdatedAt,
+	}
+}
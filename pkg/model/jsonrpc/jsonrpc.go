@@ -0,0 +1,377 @@
+package jsonrpc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
+	"github.com/authgear/authgear-server/pkg/util/hexstring"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+const (
+	// Transfer(address indexed from, address indexed to, uint256 indexed tokenId)
+	ERC721TransferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	// TransferSingle(address indexed operator, address indexed from, address indexed to, uint256 id, uint256 value)
+	ERC1155TransferSingleTopic = "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62"
+	// TransferBatch(address indexed operator, address indexed from, address indexed to, uint256[] ids, uint256[] values)
+	ERC1155TransferBatchTopic = "0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb"
+)
+
+const wordSize = 32
+
+type Request struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int             `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// LogFilter is the filter object of eth_getLogs, a nil topic matches any value
+type LogFilter struct {
+	FromBlock string               `json:"fromBlock,omitempty"`
+	ToBlock   string               `json:"toBlock,omitempty"`
+	Address   []authgearweb3.EIP55 `json:"address,omitempty"`
+	Topics    []interface{}        `json:"topics"`
+}
+
+type Log struct {
+	Address         authgearweb3.EIP55 `json:"address"`
+	Topics          []string           `json:"topics"`
+	Data            string             `json:"data"`
+	BlockNumber     string             `json:"blockNumber"`
+	BlockHash       string             `json:"blockHash"`
+	TransactionHash string             `json:"transactionHash"`
+	LogIndex        string             `json:"logIndex"`
+	Removed         bool               `json:"removed"`
+}
+
+type Block struct {
+	Number     string `json:"number"`
+	Hash       string `json:"hash"`
+	ParentHash string `json:"parentHash"`
+	Timestamp  string `json:"timestamp"`
+}
+
+func (b Block) Time() (*time.Time, error) {
+	timestamp, err := hexstring.Parse(b.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	t := time.Unix(timestamp.ToBigInt().Int64(), 0).UTC()
+	return &t, nil
+}
+
+func (b Block) ToBlock() (*nft.Block, error) {
+	number, err := hexstring.Parse(b.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	return &nft.Block{
+		Number:     number.ToBigInt(),
+		Hash:       b.Hash,
+		ParentHash: b.ParentHash,
+	}, nil
+}
+
+// AddressTopic left-pads an address to a 32 bytes topic
+func AddressTopic(address authgearweb3.EIP55) string {
+	return "0x" + strings.Repeat("0", 24) + strings.ToLower(strings.TrimPrefix(address.String(), "0x"))
+}
+
+func NewERC721TransferFilter(contractAddresses []authgearweb3.EIP55, fromAddress authgearweb3.EIP55, toAddress authgearweb3.EIP55) LogFilter {
+	return LogFilter{
+		Address: contractAddresses,
+		Topics:  []interface{}{ERC721TransferTopic, optionalAddressTopic(fromAddress), optionalAddressTopic(toAddress)},
+	}
+}
+
+func NewERC1155TransferFilter(contractAddresses []authgearweb3.EIP55, fromAddress authgearweb3.EIP55, toAddress authgearweb3.EIP55) LogFilter {
+	return LogFilter{
+		Address: contractAddresses,
+		Topics: []interface{}{
+			[]string{ERC1155TransferSingleTopic, ERC1155TransferBatchTopic},
+			nil,
+			optionalAddressTopic(fromAddress),
+			optionalAddressTopic(toAddress),
+		},
+	}
+}
+
+func optionalAddressTopic(address authgearweb3.EIP55) interface{} {
+	if address == "" {
+		return nil
+	}
+	return AddressTopic(address)
+}
+
+func topicToAddress(topic string) (authgearweb3.EIP55, error) {
+	if len(topic) != 2+2*wordSize {
+		return "", fmt.Errorf("invalid address topic: %v", topic)
+	}
+	return authgearweb3.NewEIP55("0x" + topic[len(topic)-40:])
+}
+
+func topicToTokenID(topic string) (string, error) {
+	word, err := hex.DecodeString(strings.TrimPrefix(topic, "0x"))
+	if err != nil {
+		return "", err
+	}
+	return toTokenID(new(big.Int).SetBytes(word)), nil
+}
+
+func toTokenID(i *big.Int) string {
+	return "0x" + i.Text(16)
+}
+
+func decodeWords(data string) ([][]byte, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(data, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	if len(b)%wordSize != 0 {
+		return nil, fmt.Errorf("invalid abi data length: %v", len(b))
+	}
+
+	words := make([][]byte, 0, len(b)/wordSize)
+	for i := 0; i < len(b); i += wordSize {
+		words = append(words, b[i:i+wordSize])
+	}
+	return words, nil
+}
+
+// decodeOffset returns the word index of the dynamic value at offsetWord and its length in units,
+// both checked against the words so they can be used without overflow
+func decodeOffset(words [][]byte, offsetWord []byte, unitSize int) (start int, length int, err error) {
+	offset := new(big.Int).SetBytes(offsetWord)
+	if offset.Cmp(big.NewInt(int64(len(words)*wordSize))) >= 0 || offset.Int64()%wordSize != 0 {
+		return 0, 0, fmt.Errorf("abi offset out of range: %v", offset)
+	}
+	start = int(offset.Int64() / wordSize)
+
+	lengthValue := new(big.Int).SetBytes(words[start])
+	available := big.NewInt(int64((len(words) - start - 1) * wordSize / unitSize))
+	if lengthValue.Cmp(available) > 0 {
+		return 0, 0, fmt.Errorf("abi length out of range: %v", lengthValue)
+	}
+
+	return start, int(lengthValue.Int64()), nil
+}
+
+func decodeUint256Array(words [][]byte, offsetWord []byte) ([]*big.Int, error) {
+	start, length, err := decodeOffset(words, offsetWord, wordSize)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]*big.Int, 0, length)
+	for _, word := range words[start+1 : start+1+length] {
+		values = append(values, new(big.Int).SetBytes(word))
+	}
+	return values, nil
+}
+
+// ToTransfers decodes ERC-721 Transfer and ERC-1155 TransferSingle / TransferBatch logs,
+// logs of other events such as ERC-20 Transfer are ignored
+func (l Log) ToTransfers(blockTimestamp *time.Time) ([]nft.Transfer, error) {
+	if len(l.Topics) == 0 {
+		return nil, nil
+	}
+
+	blockNumber, err := hexstring.Parse(l.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	logIndex, err := hexstring.Parse(l.LogIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	newTransfer := func(fromTopic string, toTopic string, tokenID string, value *big.Int) (nft.Transfer, error) {
+		from, err := topicToAddress(fromTopic)
+		if err != nil {
+			return nft.Transfer{}, err
+		}
+
+		to, err := topicToAddress(toTopic)
+		if err != nil {
+			return nft.Transfer{}, err
+		}
+
+		contractAddress, err := authgearweb3.NewEIP55(l.Address.String())
+		if err != nil {
+			return nft.Transfer{}, err
+		}
+
+		return nft.Transfer{
+			ContractAddress: contractAddress,
+			TokenID:         tokenID,
+			Value:           value,
+			From:            from,
+			To:              to,
+			BlockNumber:     blockNumber.ToBigInt(),
+			BlockTimestamp:  blockTimestamp,
+			TransactionHash: l.TransactionHash,
+			LogIndex:        int(logIndex.ToBigInt().Int64()),
+		}, nil
+	}
+
+	switch l.Topics[0] {
+	case ERC721TransferTopic:
+		// ERC-20 Transfer shares the same signature but the value is not indexed
+		if len(l.Topics) != 4 {
+			return nil, nil
+		}
+
+		tokenID, err := topicToTokenID(l.Topics[3])
+		if err != nil {
+			return nil, err
+		}
+
+		transfer, err := newTransfer(l.Topics[1], l.Topics[2], tokenID, big.NewInt(1))
+		if err != nil {
+			return nil, err
+		}
+		return []nft.Transfer{transfer}, nil
+
+	case ERC1155TransferSingleTopic:
+		if len(l.Topics) != 4 {
+			return nil, fmt.Errorf("invalid TransferSingle log: %v", l.TransactionHash)
+		}
+
+		words, err := decodeWords(l.Data)
+		if err != nil {
+			return nil, err
+		}
+		if len(words) != 2 {
+			return nil, fmt.Errorf("invalid TransferSingle data: %v", l.TransactionHash)
+		}
+
+		tokenID := toTokenID(new(big.Int).SetBytes(words[0]))
+		transfer, err := newTransfer(l.Topics[2], l.Topics[3], tokenID, new(big.Int).SetBytes(words[1]))
+		if err != nil {
+			return nil, err
+		}
+		return []nft.Transfer{transfer}, nil
+
+	case ERC1155TransferBatchTopic:
+		if len(l.Topics) != 4 {
+			return nil, fmt.Errorf("invalid TransferBatch log: %v", l.TransactionHash)
+		}
+
+		words, err := decodeWords(l.Data)
+		if err != nil {
+			return nil, err
+		}
+		if len(words) < 2 {
+			return nil, fmt.Errorf("invalid TransferBatch data: %v", l.TransactionHash)
+		}
+
+		ids, err := decodeUint256Array(words, words[0])
+		if err != nil {
+			return nil, err
+		}
+
+		values, err := decodeUint256Array(words, words[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if len(ids) != len(values) {
+			return nil, fmt.Errorf("mismatched TransferBatch ids and values: %v", l.TransactionHash)
+		}
+
+		transfers := make([]nft.Transfer, 0, len(ids))
+		for i, id := range ids {
+			transfer, err := newTransfer(l.Topics[2], l.Topics[3], toTokenID(id), values[i])
+			if err != nil {
+				return nil, err
+			}
+			transfers = append(transfers, transfer)
+		}
+		return transfers, nil
+	}
+
+	return nil, nil
+}
+
+const (
+	NameSelector              = "0x06fdde03"
+	SymbolSelector            = "0x95d89b41"
+	TotalSupplySelector       = "0x18160ddd"
+	SupportsInterfaceSelector = "0x01ffc9a7"
+
+	ERC721InterfaceID  = "80ac58cd"
+	ERC1155InterfaceID = "d9b67a26"
+)
+
+type CallMessage struct {
+	To   authgearweb3.EIP55 `json:"to"`
+	Data string             `json:"data"`
+}
+
+func NewSupportsInterfaceCall(contractAddress authgearweb3.EIP55, interfaceID string) CallMessage {
+	return CallMessage{
+		To:   contractAddress,
+		Data: SupportsInterfaceSelector + interfaceID + strings.Repeat("0", 2*wordSize-len(interfaceID)),
+	}
+}
+
+func DecodeUint256(data string) (*big.Int, error) {
+	words, err := decodeWords(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty abi data")
+	}
+	return new(big.Int).SetBytes(words[0]), nil
+}
+
+func DecodeBool(data string) (bool, error) {
+	value, err := DecodeUint256(data)
+	if err != nil {
+		return false, err
+	}
+	return value.Sign() != 0, nil
+}
+
+func DecodeString(data string) (string, error) {
+	words, err := decodeWords(data)
+	if err != nil {
+		return "", err
+	}
+	if len(words) < 2 {
+		return "", fmt.Errorf("invalid abi string data")
+	}
+
+	start, length, err := decodeOffset(words, words[0], 1)
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 0, length)
+	for _, word := range words[start+1:] {
+		b = append(b, word...)
+	}
+	return string(b[:length]), nil
+}
@@ -0,0 +1,235 @@
+package jsonrpc
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+const (
+	testContract = "0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D"
+	testOperator = "0x5B38Da6a701c568545dCfcB03FcB875f56beddC4"
+	testFrom     = "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+	testTo       = "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+)
+
+func uint256Word(i int64) string {
+	return fmt.Sprintf("%064x", i)
+}
+
+func uint256Topic(i int64) string {
+	return "0x" + uint256Word(i)
+}
+
+// abiData encodes words as the data of a log
+func abiData(words ...string) string {
+	return "0x" + strings.Join(words, "")
+}
+
+const maxUint256 = "115792089237316195423570985008687907853269984665640564039457584007913129639935"
+
+func newTestLog(topics []string, data string) Log {
+	return Log{
+		Address:         authgearweb3.EIP55(strings.ToLower(testContract)),
+		Topics:          topics,
+		Data:            data,
+		BlockNumber:     "0x10",
+		BlockHash:       "0xblock",
+		TransactionHash: "0xtx",
+		LogIndex:        "0x2",
+	}
+}
+
+type expectedTransfer struct {
+	TokenID string
+	Value   int64
+	From    string
+	To      string
+}
+
+func TestLogToTransfers(t *testing.T) {
+	blockTimestamp := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	from := AddressTopic(testFrom)
+	to := AddressTopic(testTo)
+	operator := AddressTopic(testOperator)
+
+	cases := []struct {
+		Name     string
+		Log      Log
+		Expected []expectedTransfer
+		Error    string
+	}{
+		{
+			Name:     "ERC-721 Transfer",
+			Log:      newTestLog([]string{ERC721TransferTopic, from, to, uint256Topic(42)}, "0x"),
+			Expected: []expectedTransfer{{TokenID: "0x2a", Value: 1, From: testFrom, To: testTo}},
+		},
+		{
+			Name: "ERC-20 Transfer with an unindexed value is skipped",
+			Log:  newTestLog([]string{ERC721TransferTopic, from, to}, abiData(uint256Word(1000))),
+		},
+		{
+			Name:     "ERC-1155 TransferSingle",
+			Log:      newTestLog([]string{ERC1155TransferSingleTopic, operator, from, to}, abiData(uint256Word(7), uint256Word(5))),
+			Expected: []expectedTransfer{{TokenID: "0x7", Value: 5, From: testFrom, To: testTo}},
+		},
+		{
+			Name:  "ERC-1155 TransferSingle without values",
+			Log:   newTestLog([]string{ERC1155TransferSingleTopic, operator, from, to}, abiData(uint256Word(7))),
+			Error: "invalid TransferSingle data: 0xtx",
+		},
+		{
+			Name: "ERC-1155 TransferBatch",
+			Log: newTestLog([]string{ERC1155TransferBatchTopic, operator, from, to}, abiData(
+				uint256Word(0x40), uint256Word(0xa0),
+				uint256Word(2), uint256Word(1), uint256Word(2),
+				uint256Word(2), uint256Word(10), uint256Word(20),
+			)),
+			Expected: []expectedTransfer{
+				{TokenID: "0x1", Value: 10, From: testFrom, To: testTo},
+				{TokenID: "0x2", Value: 20, From: testFrom, To: testTo},
+			},
+		},
+		{
+			Name: "ERC-1155 TransferBatch with mismatched ids and values",
+			Log: newTestLog([]string{ERC1155TransferBatchTopic, operator, from, to}, abiData(
+				uint256Word(0x40), uint256Word(0xa0),
+				uint256Word(2), uint256Word(1), uint256Word(2),
+				uint256Word(1), uint256Word(10),
+			)),
+			Error: "mismatched TransferBatch ids and values: 0xtx",
+		},
+		{
+			Name: "ERC-1155 TransferBatch with an array out of range",
+			Log: newTestLog([]string{ERC1155TransferBatchTopic, operator, from, to}, abiData(
+				uint256Word(0x40), uint256Word(0xa0),
+				uint256Word(2), uint256Word(1), uint256Word(2),
+				uint256Word(3), uint256Word(10),
+			)),
+			Error: "abi length out of range: 3",
+		},
+		{
+			Name: "ERC-1155 TransferBatch with an overflowing array length",
+			Log: newTestLog([]string{ERC1155TransferBatchTopic, operator, from, to}, abiData(
+				uint256Word(0x40), uint256Word(0x60),
+				strings.Repeat("f", 64),
+			)),
+			Error: "abi length out of range: " + maxUint256,
+		},
+		{
+			Name: "ERC-1155 TransferBatch with an overflowing array offset",
+			Log: newTestLog([]string{ERC1155TransferBatchTopic, operator, from, to}, abiData(
+				"7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe0", uint256Word(0x40),
+				uint256Word(0),
+			)),
+			Error: "abi offset out of range: 57896044618658097711785492504343953926634992332820282019728792003956564819936",
+		},
+		{
+			Name: "Unknown event is skipped",
+			Log:  newTestLog([]string{"0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925", from, to}, "0x"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			transfers, err := c.Log.ToTransfers(&blockTimestamp)
+			if c.Error != "" {
+				if err == nil || err.Error() != c.Error {
+					t.Fatalf("expected error %q, got %v", c.Error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(transfers) != len(c.Expected) {
+				t.Fatalf("expected %v transfers, got %v", len(c.Expected), len(transfers))
+			}
+
+			for i, expected := range c.Expected {
+				transfer := transfers[i]
+				if transfer.ContractAddress.String() != testContract {
+					t.Errorf("transfer %v: expected contract %v, got %v", i, testContract, transfer.ContractAddress)
+				}
+				if transfer.TokenID != expected.TokenID {
+					t.Errorf("transfer %v: expected token ID %v, got %v", i, expected.TokenID, transfer.TokenID)
+				}
+				if transfer.Value.Cmp(big.NewInt(expected.Value)) != 0 {
+					t.Errorf("transfer %v: expected value %v, got %v", i, expected.Value, transfer.Value)
+				}
+				if transfer.From.String() != expected.From || transfer.To.String() != expected.To {
+					t.Errorf("transfer %v: expected %v -> %v, got %v -> %v", i, expected.From, expected.To, transfer.From, transfer.To)
+				}
+				if transfer.BlockNumber.Cmp(big.NewInt(16)) != 0 || transfer.LogIndex != 2 {
+					t.Errorf("transfer %v: unexpected position %v/%v", i, transfer.BlockNumber, transfer.LogIndex)
+				}
+				if transfer.BlockTimestamp == nil || !transfer.BlockTimestamp.Equal(blockTimestamp) {
+					t.Errorf("transfer %v: unexpected block timestamp %v", i, transfer.BlockTimestamp)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeString(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Data     string
+		Expected string
+		Error    string
+	}{
+		{
+			Name:     "String",
+			Data:     abiData(uint256Word(0x20), uint256Word(4), fmt.Sprintf("%-64s", "4e616d65")),
+			Expected: "Name",
+		},
+		{
+			Name:     "Empty string",
+			Data:     abiData(uint256Word(0x20), uint256Word(0)),
+			Expected: "",
+		},
+		{
+			Name:  "Length past the data",
+			Data:  abiData(uint256Word(0x20), uint256Word(33), uint256Word(0)),
+			Error: "abi length out of range: 33",
+		},
+		{
+			Name:  "Overflowing length",
+			Data:  abiData(uint256Word(0x20), strings.Repeat("f", 64)),
+			Error: "abi length out of range: " + maxUint256,
+		},
+		{
+			Name:  "Offset past the data",
+			Data:  abiData(uint256Word(0x40), uint256Word(0)),
+			Error: "abi offset out of range: 64",
+		},
+		{
+			Name:  "Overflowing offset",
+			Data:  abiData("8000000000000000000000000000000000000000000000000000000000000000", uint256Word(0)),
+			Error: "abi offset out of range: 57896044618658097711785492504343953926634992332820282019728792003956564819968",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			value, err := DecodeString(strings.ReplaceAll(c.Data, " ", "0"))
+			if c.Error != "" {
+				if err == nil || err.Error() != c.Error {
+					t.Fatalf("expected error %q, got %v", c.Error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if value != c.Expected {
+				t.Errorf("expected %q, got %q", c.Expected, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package nft
+
+import (
+	"math/big"
+	"sort"
+
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+const ZeroAddress authgearweb3.EIP55 = "0x0000000000000000000000000000000000000000"
+
+type TokenKey struct {
+	ContractAddress authgearweb3.EIP55
+	TokenID         string
+}
+
+// Balances replays transfers into net balances per token and holder
+type Balances struct {
+	tokenToHolderToBalance map[TokenKey]map[authgearweb3.EIP55]*big.Int
+}
+
+func NewBalances() *Balances {
+	return &Balances{
+		tokenToHolderToBalance: make(map[TokenKey]map[authgearweb3.EIP55]*big.Int),
+	}
+}
+
+func (b *Balances) add(key TokenKey, holder authgearweb3.EIP55, value *big.Int) {
+	if holder == ZeroAddress {
+		return
+	}
+
+	if _, ok := b.tokenToHolderToBalance[key]; !ok {
+		b.tokenToHolderToBalance[key] = make(map[authgearweb3.EIP55]*big.Int)
+	}
+
+	balance, ok := b.tokenToHolderToBalance[key][holder]
+	if !ok {
+		balance = new(big.Int)
+		b.tokenToHolderToBalance[key][holder] = balance
+	}
+	balance.Add(balance, value)
+}
+
+func (b *Balances) Apply(transfer Transfer) {
+	key := TokenKey{ContractAddress: transfer.ContractAddress, TokenID: transfer.TokenID}
+	value := transfer.Value
+	if value == nil {
+		value = big.NewInt(1)
+	}
+
+	b.add(key, transfer.From, new(big.Int).Neg(value))
+	b.add(key, transfer.To, value)
+}
+
+func (b *Balances) BalanceOf(key TokenKey, holder authgearweb3.EIP55) *big.Int {
+	balance, ok := b.tokenToHolderToBalance[key][holder]
+	if !ok {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(balance)
+}
+
+// Holdings returns tokens with a positive balance held by the holder
+func (b *Balances) Holdings(holder authgearweb3.EIP55) []OwnedToken {
+	tokens := make([]OwnedToken, 0)
+	for key, holderToBalance := range b.tokenToHolderToBalance {
+		balance, ok := holderToBalance[holder]
+		if !ok || balance.Sign() <= 0 {
+			continue
+		}
+
+		tokens = append(tokens, OwnedToken{
+			ContractAddress: key.ContractAddress,
+			TokenID:         key.TokenID,
+			Balance:         balance.String(),
+		})
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].ContractAddress != tokens[j].ContractAddress {
+			return tokens[i].ContractAddress < tokens[j].ContractAddress
+		}
+		return tokens[i].TokenID < tokens[j].TokenID
+	})
+
+	return tokens
+}
+
+// Holders returns addresses holding a positive balance of any token
+func (b *Balances) Holders() []authgearweb3.EIP55 {
+	holderSet := make(map[authgearweb3.EIP55]struct{})
+	for _, holderToBalance := range b.tokenToHolderToBalance {
+		for holder, balance := range holderToBalance {
+			if balance.Sign() > 0 {
+				holderSet[holder] = struct{}{}
+			}
+		}
+	}
+
+	holders := make([]authgearweb3.EIP55, 0, len(holderSet))
+	for holder := range holderSet {
+		holders = append(holders, holder)
+	}
+
+	sort.Slice(holders, func(i, j int) bool {
+		return holders[i] < holders[j]
+	})
+
+	return holders
+}
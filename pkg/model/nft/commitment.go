@@ -0,0 +1,29 @@
+package nft
+
+import (
+	"fmt"
+)
+
+// Commitment is how settled the blocks behind an answer must be
+type Commitment string
+
+const (
+	// CommitmentLatest includes the latest block, which may still be reorganized
+	CommitmentLatest Commitment = "latest"
+	// CommitmentSafe excludes blocks within the safe confirmations of the chain
+	CommitmentSafe Commitment = "safe"
+	// CommitmentFinalized excludes blocks within the confirmations of the chain
+	CommitmentFinalized Commitment = "finalized"
+)
+
+// ParseCommitment defaults to CommitmentLatest
+func ParseCommitment(c string) (Commitment, error) {
+	switch commitment := Commitment(c); commitment {
+	case "":
+		return CommitmentLatest, nil
+	case CommitmentLatest, CommitmentSafe, CommitmentFinalized:
+		return commitment, nil
+	default:
+		return "", fmt.Errorf("unknown commitment: %v", c)
+	}
+}
@@ -0,0 +1,88 @@
+package nft
+
+import (
+	"math/big"
+	"time"
+
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+type TransferOrder string
+
+const (
+	TransferOrderAscending  TransferOrder = "asc"
+	TransferOrderDescending TransferOrder = "desc"
+)
+
+type OwnedToken struct {
+	ContractAddress authgearweb3.EIP55
+	// TokenID is a trimmed hex string, e.g. 0x1
+	TokenID string
+	Balance string
+}
+
+type OwnedTokens struct {
+	Tokens  []OwnedToken
+	PageKey string
+}
+
+type Transfer struct {
+	ContractAddress authgearweb3.EIP55
+	// TokenID is a trimmed hex string, e.g. 0x1
+	TokenID         string
+	Value           *big.Int
+	From            authgearweb3.EIP55
+	To              authgearweb3.EIP55
+	BlockNumber     *big.Int
+	BlockTimestamp  *time.Time
+	TransactionHash string
+	LogIndex        int
+}
+
+type Transfers struct {
+	Transfers []Transfer
+	PageKey   string
+}
+
+type Block struct {
+	Number     *big.Int
+	Hash       string
+	ParentHash string
+}
+
+type TransferQuery struct {
+	ContractIDs []authgearweb3.ContractID
+	FromAddress authgearweb3.EIP55
+	ToAddress   authgearweb3.EIP55
+	// FromBlock is inclusive, nil means from genesis
+	FromBlock *big.Int
+	// ToBlock is inclusive, nil means up to the latest block
+	ToBlock  *big.Int
+	PageKey  string
+	MaxCount int64
+	Order    TransferOrder
+}
+
+type ContractMetadata struct {
+	Address     authgearweb3.EIP55
+	Name        string
+	Symbol      string
+	TotalSupply string
+	TokenType   string
+}
+
+type Holders struct {
+	OwnerAddresses []string
+	PageKey        string
+}
+
+type TokenMetadata struct {
+	ContractAddress authgearweb3.EIP55
+	// TokenID is a trimmed hex string, e.g. 0x1
+	TokenID     string
+	TokenType   string
+	Name        string
+	Description string
+	TokenURI    string
+	ImageURL    string
+}
@@ -0,0 +1,241 @@
+package nft
+
+import (
+	"fmt"
+	"math/big"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun/extra/bunbig"
+)
+
+// BalanceMismatch is a token whose provider balance is not explained by the transfers, Unaccounted is the difference
+type BalanceMismatch struct {
+	TokenKey
+	ProviderBalance *big.Int
+	Unaccounted     *big.Int
+}
+
+type NFTOwnerships struct {
+	Ownerships []database.NFTOwnership
+	// Unresolved are owned tokens acquired before the earliest transfer, with no stored ownership to fall back to
+	Unresolved []TokenKey
+	// Mismatches are only meaningful if the transfers are the complete history of the owner
+	Mismatches []BalanceMismatch
+}
+
+type tokenHistory struct {
+	key       TokenKey
+	contract  authgearweb3.ContractID
+	transfers []Transfer
+}
+
+// MakeNFTOwnerships reconciles the provider balances of the owner with transfers from and to the owner.
+// Walking back from the current balance, the acquisition of a token is the incoming transfer before which the owner held none of it.
+// If that is before the earliest transfer given, the stored ownership of the token is kept.
+func MakeNFTOwnerships(
+	ownerID authgearweb3.ContractID,
+	contracts []authgearweb3.ContractID,
+	transfers []Transfer,
+	ownedTokens []OwnedToken,
+	storedOwnerships []database.NFTOwnership,
+) (*NFTOwnerships, error) {
+	histories := make(map[string]*tokenHistory)
+	getHistory := func(contractAddress authgearweb3.EIP55, tokenID string) (*tokenHistory, error) {
+		contractID, err := authgearweb3.NewContractID(ownerID.Blockchain, ownerID.Network, contractAddress.String(), url.Values{})
+		if err != nil {
+			return nil, err
+		}
+
+		key := contractID.String() + "/" + tokenID
+		history, ok := histories[key]
+		if !ok {
+			history = &tokenHistory{
+				key:      TokenKey{ContractAddress: contractID.Address, TokenID: tokenID},
+				contract: *contractID,
+			}
+			histories[key] = history
+		}
+		return history, nil
+	}
+
+	sortedTransfers := make([]Transfer, len(transfers))
+	copy(sortedTransfers, transfers)
+	sort.SliceStable(sortedTransfers, func(i, j int) bool {
+		if c := sortedTransfers[i].BlockNumber.Cmp(sortedTransfers[j].BlockNumber); c != 0 {
+			return c > 0
+		}
+		return sortedTransfers[i].LogIndex > sortedTransfers[j].LogIndex
+	})
+	for _, transfer := range sortedTransfers {
+		history, err := getHistory(transfer.ContractAddress, transfer.TokenID)
+		if err != nil {
+			return nil, err
+		}
+		history.transfers = append(history.transfers, transfer)
+	}
+
+	tokenToBalance := make(map[TokenKey]*big.Int)
+	for _, ownedToken := range ownedTokens {
+		history, err := getHistory(ownedToken.ContractAddress, ownedToken.TokenID)
+		if err != nil {
+			return nil, err
+		}
+
+		balance, ok := new(big.Int).SetString(ownedToken.Balance, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid balance of %v %v: %v", ownedToken.ContractAddress, ownedToken.TokenID, ownedToken.Balance)
+		}
+		tokenToBalance[history.key] = balance
+	}
+
+	tokenToStored := make(map[TokenKey]database.NFTOwnership)
+	for _, stored := range storedOwnerships {
+		history, err := getHistory(stored.ContractAddress, stored.TokenID)
+		if err != nil {
+			return nil, err
+		}
+		tokenToStored[history.key] = stored
+	}
+
+	result := &NFTOwnerships{}
+	contractIDToTokenIDToOwnership := make(map[string]map[string]database.NFTOwnership, 0)
+	for _, history := range histories {
+		providerBalance, ok := tokenToBalance[history.key]
+		if !ok {
+			providerBalance = new(big.Int)
+		}
+
+		acquisition, unaccounted := history.walkBack(ownerID.Address, providerBalance)
+		if unaccounted.Sign() != 0 {
+			result.Mismatches = append(result.Mismatches, BalanceMismatch{
+				TokenKey:        history.key,
+				ProviderBalance: providerBalance,
+				Unaccounted:     unaccounted,
+			})
+		}
+
+		if providerBalance.Sign() <= 0 {
+			continue
+		}
+
+		var ownership database.NFTOwnership
+		stored, hasStored := tokenToStored[history.key]
+		switch {
+		case acquisition != nil:
+			ownership = NewNFTOwnership(history.contract, ownerID, *acquisition)
+		case hasStored:
+			ownership = stored
+		default:
+			result.Unresolved = append(result.Unresolved, history.key)
+			ownership = history.earliestOwnership(ownerID)
+		}
+		ownership.Balance = providerBalance.String()
+
+		contractURL := history.contract.String()
+		if _, ok := contractIDToTokenIDToOwnership[contractURL]; !ok {
+			contractIDToTokenIDToOwnership[contractURL] = make(map[string]database.NFTOwnership)
+		}
+		contractIDToTokenIDToOwnership[contractURL][history.key.TokenID] = ownership
+	}
+
+	ownerships := make([]database.NFTOwnership, 0)
+	for _, contract := range contracts {
+		tokenIDs := contract.Query["token_ids"]
+		strippedContractID := contract.StripQuery().String()
+
+		contractOwnerships, ownershipsOk := contractIDToTokenIDToOwnership[strippedContractID]
+		// Handle ERC-1155
+		if len(tokenIDs) != 0 {
+			// Append either existing ownership or empty ownership for each tokenID
+			for _, tokenID := range tokenIDs {
+				erc1155ownership, ok := contractOwnerships[tokenID]
+				if !ownershipsOk || !ok {
+					ownerships = append(ownerships, database.NewEmptyNFTOwnership(contract, tokenID, ownerID))
+				}
+
+				if ok {
+					ownerships = append(ownerships, erc1155ownership)
+				}
+			}
+		} else if ownershipsOk {
+			for _, erc721ownership := range contractOwnerships {
+				ownerships = append(ownerships, erc721ownership)
+			}
+		} else {
+			ownerships = append(ownerships, database.NewEmptyNFTOwnership(contract, "0x0", ownerID))
+		}
+
+	}
+
+	result.Ownerships = ownerships
+	return result, nil
+}
+
+// walkBack undoes the transfers from latest to earliest starting at the current balance,
+// unaccounted is the balance left before the earliest transfer. A token no longer held has no acquisition.
+func (h *tokenHistory) walkBack(owner authgearweb3.EIP55, balance *big.Int) (acquisition *Transfer, unaccounted *big.Int) {
+	held := balance.Sign() > 0
+	current := new(big.Int).Set(balance)
+	for i, transfer := range h.transfers {
+		isIncoming := strings.EqualFold(transfer.To.String(), owner.String())
+		isOutgoing := strings.EqualFold(transfer.From.String(), owner.String())
+		if isIncoming == isOutgoing {
+			continue
+		}
+
+		value := transfer.Value
+		if value == nil {
+			value = big.NewInt(1)
+		}
+
+		if isOutgoing {
+			current.Add(current, value)
+			continue
+		}
+
+		before := new(big.Int).Sub(current, value)
+		if held && acquisition == nil && current.Sign() > 0 && before.Sign() <= 0 {
+			acquisition = &h.transfers[i]
+		}
+		current = before
+	}
+
+	return acquisition, current
+}
+
+// earliestOwnership is the best guess of an unresolved token, the earliest incoming transfer or no provenance at all
+func (h *tokenHistory) earliestOwnership(ownerID authgearweb3.ContractID) database.NFTOwnership {
+	for i := len(h.transfers) - 1; i >= 0; i-- {
+		if strings.EqualFold(h.transfers[i].To.String(), ownerID.Address.String()) {
+			return NewNFTOwnership(h.contract, ownerID, h.transfers[i])
+		}
+	}
+
+	return database.NFTOwnership{
+		Blockchain:      h.contract.Blockchain,
+		Network:         h.contract.Network,
+		ContractAddress: h.contract.Address,
+		TokenID:         h.key.TokenID,
+		BlockNumber:     bunbig.FromInt64(0),
+		OwnerAddress:    ownerID.Address,
+	}
+}
+
+// NewNFTOwnership is the ownership acquired by transfer
+func NewNFTOwnership(contractID authgearweb3.ContractID, ownerID authgearweb3.ContractID, transfer Transfer) database.NFTOwnership {
+	return database.NFTOwnership{
+		Blockchain:       contractID.Blockchain,
+		Network:          contractID.Network,
+		ContractAddress:  contractID.Address,
+		TokenID:          transfer.TokenID,
+		BlockNumber:      bunbig.FromMathBig(transfer.BlockNumber),
+		OwnerAddress:     ownerID.Address,
+		TransactionHash:  transfer.TransactionHash,
+		TransactionIndex: transfer.LogIndex,
+		BlockTimestamp:   transfer.BlockTimestamp,
+	}
+}
@@ -0,0 +1,237 @@
+package nft
+
+import (
+	"fmt"
+	"math/big"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun/extra/bunbig"
+)
+
+const (
+	testERC721Contract  authgearweb3.EIP55 = "0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D"
+	testERC1155Contract authgearweb3.EIP55 = "0x76BE3b62873462d2142405439777e971754E8E77"
+	testOwner           authgearweb3.EIP55 = "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+	testOther           authgearweb3.EIP55 = "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+)
+
+func testContractID(t *testing.T, address authgearweb3.EIP55, tokenIDs ...string) authgearweb3.ContractID {
+	query := url.Values{}
+	if len(tokenIDs) > 0 {
+		query["token_ids"] = tokenIDs
+	}
+	contractID, err := authgearweb3.NewContractID("ethereum", "1", address.String(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *contractID
+}
+
+func testTransfer(contract authgearweb3.EIP55, tokenID string, from authgearweb3.EIP55, to authgearweb3.EIP55, value int64, blockNumber int64) Transfer {
+	return Transfer{
+		ContractAddress: contract,
+		TokenID:         tokenID,
+		Value:           big.NewInt(value),
+		From:            from,
+		To:              to,
+		BlockNumber:     big.NewInt(blockNumber),
+		TransactionHash: fmt.Sprintf("0xtx%v", blockNumber),
+	}
+}
+
+// describeOwnerships formats ownerships as contract/token@block=balance, sorted
+func describeOwnerships(ownerships []database.NFTOwnership) string {
+	descriptions := make([]string, 0, len(ownerships))
+	for _, ownership := range ownerships {
+		if ownership.IsEmpty() {
+			descriptions = append(descriptions, fmt.Sprintf("%v/%v:empty", ownership.ContractAddress.String()[:6], ownership.TokenID))
+			continue
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%v/%v@%v=%v", ownership.ContractAddress.String()[:6], ownership.TokenID, ownership.BlockNumber.ToMathBig(), ownership.Balance))
+	}
+	sort.Strings(descriptions)
+	return strings.Join(descriptions, ",")
+}
+
+func TestMakeNFTOwnerships(t *testing.T) {
+	ownerID := testContractID(t, testOwner)
+
+	cases := []struct {
+		Name        string
+		Contracts   []authgearweb3.ContractID
+		Transfers   []Transfer
+		OwnedTokens []OwnedToken
+		Stored      []database.NFTOwnership
+		Expected    string
+		Unresolved  int
+		Mismatches  int
+	}{
+		{
+			Name:        "Mint",
+			Contracts:   []authgearweb3.ContractID{testContractID(t, testERC721Contract)},
+			Transfers:   []Transfer{testTransfer(testERC721Contract, "0x1", ZeroAddress, testOwner, 1, 100)},
+			OwnedTokens: []OwnedToken{{ContractAddress: testERC721Contract, TokenID: "0x1", Balance: "1"}},
+			Expected:    "0xBC4C/0x1@100=1",
+		},
+		{
+			Name:      "Burn",
+			Contracts: []authgearweb3.ContractID{testContractID(t, testERC721Contract)},
+			Transfers: []Transfer{
+				testTransfer(testERC721Contract, "0x1", ZeroAddress, testOwner, 1, 100),
+				testTransfer(testERC721Contract, "0x1", testOwner, ZeroAddress, 1, 150),
+			},
+			Expected: "0xBC4C/0x0:empty",
+		},
+		{
+			Name:      "Transfer out and back in",
+			Contracts: []authgearweb3.ContractID{testContractID(t, testERC721Contract)},
+			Transfers: []Transfer{
+				testTransfer(testERC721Contract, "0x1", ZeroAddress, testOwner, 1, 100),
+				testTransfer(testERC721Contract, "0x1", testOwner, testOther, 1, 110),
+				testTransfer(testERC721Contract, "0x2", ZeroAddress, testOwner, 1, 105),
+				testTransfer(testERC721Contract, "0x2", testOwner, testOther, 1, 115),
+				testTransfer(testERC721Contract, "0x1", testOther, testOwner, 1, 120),
+			},
+			OwnedTokens: []OwnedToken{{ContractAddress: testERC721Contract, TokenID: "0x1", Balance: "1"}},
+			Expected:    "0xBC4C/0x1@120=1",
+		},
+		{
+			Name:      "ERC-1155 partial balance",
+			Contracts: []authgearweb3.ContractID{testContractID(t, testERC1155Contract, "0x10", "0x11")},
+			Transfers: []Transfer{
+				testTransfer(testERC1155Contract, "0x10", ZeroAddress, testOwner, 2, 100),
+				testTransfer(testERC1155Contract, "0x10", ZeroAddress, testOwner, 3, 130),
+				testTransfer(testERC1155Contract, "0x10", testOwner, testOther, 4, 140),
+			},
+			OwnedTokens: []OwnedToken{{ContractAddress: testERC1155Contract, TokenID: "0x10", Balance: "1"}},
+			// The balance never dropped to zero since block 100
+			Expected: "0x76BE/0x10@100=1,0x76BE/0x11:empty",
+		},
+		{
+			Name:      "ERC-1155 balance sold out and bought again",
+			Contracts: []authgearweb3.ContractID{testContractID(t, testERC1155Contract, "0x10")},
+			Transfers: []Transfer{
+				testTransfer(testERC1155Contract, "0x10", ZeroAddress, testOwner, 5, 100),
+				testTransfer(testERC1155Contract, "0x10", testOwner, testOther, 5, 110),
+				testTransfer(testERC1155Contract, "0x10", testOther, testOwner, 2, 120),
+			},
+			OwnedTokens: []OwnedToken{{ContractAddress: testERC1155Contract, TokenID: "0x10", Balance: "2"}},
+			Expected:    "0x76BE/0x10@120=2",
+		},
+		{
+			Name:        "Acquired before the earliest transfer keeps the stored ownership",
+			Contracts:   []authgearweb3.ContractID{testContractID(t, testERC721Contract)},
+			OwnedTokens: []OwnedToken{{ContractAddress: testERC721Contract, TokenID: "0x1", Balance: "1"}},
+			Stored: []database.NFTOwnership{{
+				Blockchain:      "ethereum",
+				Network:         "1",
+				ContractAddress: testERC721Contract,
+				TokenID:         "0x1",
+				OwnerAddress:    testOwner,
+				BlockNumber:     bunbig.FromInt64(42),
+				TransactionHash: "0xstored",
+				Balance:         "1",
+			}},
+			Expected: "0xBC4C/0x1@42=1",
+			// Without transfers the balance is not explained, which only matters for the complete history
+			Mismatches: 1,
+		},
+		{
+			Name:        "Acquired before the earliest transfer without a stored ownership is unresolved",
+			Contracts:   []authgearweb3.ContractID{testContractID(t, testERC721Contract)},
+			OwnedTokens: []OwnedToken{{ContractAddress: testERC721Contract, TokenID: "0x1", Balance: "1"}},
+			Expected:    "0xBC4C/0x1@0=1",
+			Unresolved:  1,
+			Mismatches:  1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			result, err := MakeNFTOwnerships(ownerID, c.Contracts, c.Transfers, c.OwnedTokens, c.Stored)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if actual := describeOwnerships(result.Ownerships); actual != c.Expected {
+				t.Errorf("expected ownerships %v, got %v", c.Expected, actual)
+			}
+			if len(result.Unresolved) != c.Unresolved {
+				t.Errorf("expected %v unresolved tokens, got %v", c.Unresolved, result.Unresolved)
+			}
+			if len(result.Mismatches) != c.Mismatches {
+				t.Errorf("expected %v mismatches, got %v", c.Mismatches, result.Mismatches)
+			}
+		})
+	}
+}
+
+func TestWalkBack(t *testing.T) {
+	cases := []struct {
+		Name                string
+		Transfers           []Transfer
+		Balance             int64
+		ExpectedAcquisition int64
+		ExpectedUnaccounted int64
+	}{
+		{
+			Name: "Latest acquisition after a transfer out",
+			Transfers: []Transfer{
+				testTransfer(testERC721Contract, "0x1", testOther, testOwner, 1, 120),
+				testTransfer(testERC721Contract, "0x1", testOwner, testOther, 1, 110),
+				testTransfer(testERC721Contract, "0x1", ZeroAddress, testOwner, 1, 100),
+			},
+			Balance:             1,
+			ExpectedAcquisition: 120,
+		},
+		{
+			Name: "Burned token has no acquisition",
+			Transfers: []Transfer{
+				testTransfer(testERC721Contract, "0x1", testOwner, ZeroAddress, 1, 150),
+				testTransfer(testERC721Contract, "0x1", ZeroAddress, testOwner, 1, 100),
+			},
+			Balance: 0,
+		},
+		{
+			Name: "Self transfers are ignored",
+			Transfers: []Transfer{
+				testTransfer(testERC1155Contract, "0x10", testOwner, testOwner, 3, 130),
+				testTransfer(testERC1155Contract, "0x10", ZeroAddress, testOwner, 3, 100),
+			},
+			Balance:             3,
+			ExpectedAcquisition: 100,
+		},
+		{
+			Name: "Balance held before the earliest transfer is unaccounted",
+			Transfers: []Transfer{
+				testTransfer(testERC1155Contract, "0x10", ZeroAddress, testOwner, 2, 100),
+			},
+			Balance:             5,
+			ExpectedUnaccounted: 3,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			history := &tokenHistory{transfers: c.Transfers}
+			acquisition, unaccounted := history.walkBack(testOwner, big.NewInt(c.Balance))
+
+			if c.ExpectedAcquisition == 0 {
+				if acquisition != nil {
+					t.Errorf("expected no acquisition, got block %v", acquisition.BlockNumber)
+				}
+			} else if acquisition == nil || acquisition.BlockNumber.Int64() != c.ExpectedAcquisition {
+				t.Errorf("expected acquisition at block %v, got %v", c.ExpectedAcquisition, acquisition)
+			}
+
+			if unaccounted.Cmp(big.NewInt(c.ExpectedUnaccounted)) != 0 {
+				t.Errorf("expected unaccounted %v, got %v", c.ExpectedUnaccounted, unaccounted)
+			}
+		})
+	}
+}
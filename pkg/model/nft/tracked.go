@@ -0,0 +1,203 @@
+package nft
+
+import (
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+func ownershipKey(tokenID string, owner authgearweb3.EIP55) string {
+	return tokenID + "/" + strings.ToLower(owner.String())
+}
+
+type trackedOwnership struct {
+	ownership database.NFTOwnership
+	balance   *big.Int
+}
+
+// ApplyTransfers applies transfers of the contract in ascending order to the stored ownerships of the tokens involved.
+// An owner acquiring a token it did not hold takes the provenance of the transfer.
+// Changed ownerships with a positive balance are returned in ownerships, the others in removed.
+func ApplyTransfers(contractID authgearweb3.ContractID, stored []database.NFTOwnership, transfers []Transfer) (ownerships []database.NFTOwnership, removed []database.NFTOwnership, err error) {
+	state := make(map[string]*trackedOwnership)
+	for _, ownership := range stored {
+		k := ownershipKey(ownership.TokenID, ownership.OwnerAddress)
+		// Rows are ordered by refreshed_at DESC, the first one is the latest
+		if _, ok := state[k]; ok {
+			continue
+		}
+
+		balance, ok := new(big.Int).SetString(ownership.Balance, 10)
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid balance of %v %v: %v", ownership.ContractAddress, ownership.TokenID, ownership.Balance)
+		}
+		state[k] = &trackedOwnership{ownership: ownership, balance: balance}
+	}
+
+	changed := make([]string, 0)
+	changedSet := make(map[string]struct{})
+	markChanged := func(k string) {
+		if _, ok := changedSet[k]; !ok {
+			changedSet[k] = struct{}{}
+			changed = append(changed, k)
+		}
+	}
+
+	for _, transfer := range transfers {
+		value := transfer.Value
+		if value == nil {
+			value = big.NewInt(1)
+		}
+
+		if !strings.EqualFold(transfer.From.String(), ZeroAddress.String()) {
+			k := ownershipKey(transfer.TokenID, transfer.From)
+			from, ok := state[k]
+			if !ok {
+				// The sender acquired the token before the start block
+				from = &trackedOwnership{
+					ownership: database.NFTOwnership{},
+					balance:   new(big.Int),
+				}
+				state[k] = from
+			}
+			from.balance.Sub(from.balance, value)
+			// Balances acquired before the start block are unknown, a sender never holds less than nothing
+			if from.balance.Sign() < 0 {
+				from.balance.SetInt64(0)
+			}
+			markChanged(k)
+		}
+
+		if !strings.EqualFold(transfer.To.String(), ZeroAddress.String()) {
+			k := ownershipKey(transfer.TokenID, transfer.To)
+			to, ok := state[k]
+			if !ok || to.balance.Sign() <= 0 {
+				ownerID, err := authgearweb3.NewContractID(contractID.Blockchain, contractID.Network, transfer.To.String(), url.Values{})
+				if err != nil {
+					return nil, nil, err
+				}
+
+				balance := new(big.Int)
+				if ok {
+					balance = to.balance
+				}
+				to = &trackedOwnership{
+					ownership: NewNFTOwnership(contractID, *ownerID, transfer),
+					balance:   balance,
+				}
+				state[k] = to
+			}
+			to.balance.Add(to.balance, value)
+			markChanged(k)
+		}
+	}
+
+	for _, k := range changed {
+		s := state[k]
+		if s.balance.Sign() <= 0 {
+			// A sender without stored ownership has nothing to remove
+			if s.ownership.TokenID != "" {
+				removed = append(removed, s.ownership)
+			}
+			continue
+		}
+
+		ownership := s.ownership
+		ownership.Balance = s.balance.String()
+		ownerships = append(ownerships, ownership)
+	}
+
+	return ownerships, removed, nil
+}
+
+// ApplyTransfersWithUndo applies transfers block by block like ApplyTransfers.
+// The ownerships before each block after undoAfter are returned in undos, so that the block can be rolled back, nil undoAfter records all blocks.
+func ApplyTransfersWithUndo(contractID authgearweb3.ContractID, stored []database.NFTOwnership, transfers []Transfer, undoAfter *big.Int) (ownerships []database.NFTOwnership, removed []database.NFTOwnership, undos []database.NFTOwnershipUndo, err error) {
+	state := make(map[string]database.NFTOwnership)
+	initial := make(map[string]database.NFTOwnership)
+	for _, ownership := range stored {
+		k := ownershipKey(ownership.TokenID, ownership.OwnerAddress)
+		// Rows are ordered by refreshed_at DESC, the first one is the latest
+		if _, ok := state[k]; ok {
+			continue
+		}
+		state[k] = ownership
+		initial[k] = ownership
+	}
+
+	changed := make([]string, 0)
+	changedSet := make(map[string]struct{})
+	markChanged := func(k string) {
+		if _, ok := changedSet[k]; !ok {
+			changedSet[k] = struct{}{}
+			changed = append(changed, k)
+		}
+	}
+
+	for start := 0; start < len(transfers); {
+		blockNumber := transfers[start].BlockNumber
+		end := start
+		for end < len(transfers) && transfers[end].BlockNumber.Cmp(blockNumber) == 0 {
+			end++
+		}
+		blockTransfers := transfers[start:end]
+		start = end
+
+		blockStored := make([]database.NFTOwnership, 0)
+		blockStoredSet := make(map[string]struct{})
+		for _, transfer := range blockTransfers {
+			for _, address := range []authgearweb3.EIP55{transfer.From, transfer.To} {
+				k := ownershipKey(transfer.TokenID, address)
+				if _, ok := blockStoredSet[k]; ok {
+					continue
+				}
+				if ownership, ok := state[k]; ok {
+					blockStoredSet[k] = struct{}{}
+					blockStored = append(blockStored, ownership)
+				}
+			}
+		}
+
+		blockOwnerships, blockRemoved, err := ApplyTransfers(contractID, blockStored, blockTransfers)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		recordUndo := undoAfter == nil || blockNumber.Cmp(undoAfter) > 0
+		for _, ownership := range blockOwnerships {
+			k := ownershipKey(ownership.TokenID, ownership.OwnerAddress)
+			if recordUndo {
+				var previous *database.NFTOwnership
+				if p, ok := state[k]; ok {
+					previous = &p
+				}
+				undos = append(undos, database.NewNFTOwnershipUndo(blockNumber.Int64(), ownership, previous))
+			}
+			state[k] = ownership
+			markChanged(k)
+		}
+		for _, ownership := range blockRemoved {
+			k := ownershipKey(ownership.TokenID, ownership.OwnerAddress)
+			if recordUndo {
+				previous := state[k]
+				undos = append(undos, database.NewNFTOwnershipUndo(blockNumber.Int64(), ownership, &previous))
+			}
+			delete(state, k)
+			markChanged(k)
+		}
+	}
+
+	for _, k := range changed {
+		if ownership, ok := state[k]; ok {
+			ownerships = append(ownerships, ownership)
+		} else if ownership, ok := initial[k]; ok {
+			removed = append(removed, ownership)
+		}
+	}
+
+	return ownerships, removed, undos, nil
+}
@@ -0,0 +1,73 @@
+package nft
+
+import (
+	"testing"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/uptrace/bun/extra/bunbig"
+)
+
+func TestApplyTransfers(t *testing.T) {
+	contractID := testContractID(t, testERC1155Contract)
+	stored := func(balance string, blockNumber int64) database.NFTOwnership {
+		return database.NFTOwnership{
+			Blockchain:      "ethereum",
+			Network:         "1",
+			ContractAddress: testERC1155Contract,
+			TokenID:         "0x10",
+			OwnerAddress:    testOwner,
+			Balance:         balance,
+			BlockNumber:     bunbig.FromInt64(blockNumber),
+		}
+	}
+
+	cases := []struct {
+		Name            string
+		Stored          []database.NFTOwnership
+		Transfers       []Transfer
+		ExpectedOwned   string
+		ExpectedRemoved string
+	}{
+		{
+			Name:   "Partial transfer out keeps the provenance",
+			Stored: []database.NFTOwnership{stored("5", 100)},
+			Transfers: []Transfer{
+				testTransfer(testERC1155Contract, "0x10", testOwner, testOther, 2, 110),
+			},
+			ExpectedOwned: "0x76BE/0x10@100=3,0x76BE/0x10@110=2",
+		},
+		{
+			Name:   "Transfer of the whole balance removes the ownership",
+			Stored: []database.NFTOwnership{stored("5", 100)},
+			Transfers: []Transfer{
+				testTransfer(testERC1155Contract, "0x10", testOwner, testOther, 5, 110),
+			},
+			ExpectedOwned:   "0x76BE/0x10@110=5",
+			ExpectedRemoved: "0x76BE/0x10@100=5",
+		},
+		{
+			Name: "Sender holding tokens from before the start block is clamped at zero",
+			Transfers: []Transfer{
+				testTransfer(testERC1155Contract, "0x10", testOwner, testOther, 3, 110),
+				testTransfer(testERC1155Contract, "0x10", testOther, testOwner, 2, 120),
+			},
+			ExpectedOwned: "0x76BE/0x10@110=1,0x76BE/0x10@120=2",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ownerships, removed, err := ApplyTransfers(contractID, c.Stored, c.Transfers)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if actual := describeOwnerships(ownerships); actual != c.ExpectedOwned {
+				t.Errorf("expected ownerships %v, got %v", c.ExpectedOwned, actual)
+			}
+			if actual := describeOwnerships(removed); actual != c.ExpectedRemoved {
+				t.Errorf("expected removed %v, got %v", c.ExpectedRemoved, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package mutator
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+type AdvisoryLockMutator struct {
+	Ctx     context.Context
+	Session *bun.DB
+}
+
+// WithTryAdvisoryLock runs fn only if the session-level advisory lock of key is acquired,
+// and reports whether it was. The lock is held on a dedicated connection, so fn may use the pool.
+func (m *AdvisoryLockMutator) WithTryAdvisoryLock(key int64, fn func() error) (acquired bool, err error) {
+	conn, err := m.Session.Conn(m.Ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	err = conn.QueryRowContext(m.Ctx, "SELECT pg_try_advisory_lock(?)", key).Scan(&acquired)
+	if err != nil || !acquired {
+		return false, err
+	}
+	defer func() {
+		// Unlock even if the context is cancelled, otherwise the lock lives as long as the pooled connection
+		_, unlockErr := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(?)", key)
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+
+	return true, fn()
+}
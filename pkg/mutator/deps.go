@@ -8,4 +8,9 @@ var DependencySet = wire.NewSet(
 	wire.Struct(new(NFTCollectionMutator), "*"),
 	wire.Struct(new(NFTOwnershipMutator), "*"),
 	wire.Struct(new(NFTCollectionProbeMutator), "*"),
+	wire.Struct(new(AdvisoryLockMutator), "*"),
+	wire.Struct(new(NFTOwnershipHistoryPartitionMutator), "*"),
+	wire.Struct(new(NFTIndexerMutator), "*"),
+	wire.Struct(new(NFTTrackedCollectionMutator), "*"),
+	wire.Struct(new(NFTJobMutator), "*"),
 )
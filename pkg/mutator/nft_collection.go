@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"math/big"
+	"time"
 
 	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
 	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
@@ -11,6 +12,9 @@ import (
 	"github.com/uptrace/bun/extra/bunbig"
 )
 
+// Touching a collection on every query would turn reads into writes
+const collectionTouchInterval = time.Hour
+
 type NFTCollectionMutator struct {
 	Ctx     context.Context
 	Session *bun.DB
@@ -24,12 +28,14 @@ func (q *NFTCollectionMutator) InsertNFTCollection(contractID authgearweb3.Contr
 		Name:            contractName,
 		TotalSupply:     bunbig.FromMathBig(totalSupply),
 		Type:            tokenType,
+		LastQueriedAt:   database.NewTimestamp(),
 	}
 
 	err := q.Session.RunInTx(q.Ctx, nil, func(ctx context.Context, tx bun.Tx) error {
 		// Query record ID if exists, if not, generate new id and insert
 		tx.NewSelect().
 			Model(collection).
+			Column("id").
 			Where("blockchain = ? AND network = ? AND contract_address = ?", collection.Blockchain, collection.Network, collection.ContractAddress).
 			Limit(1).
 			Scan(ctx) //nolint:errcheck
@@ -37,7 +43,8 @@ func (q *NFTCollectionMutator) InsertNFTCollection(contractID authgearweb3.Contr
 		_, err := tx.NewInsert().
 			Model(collection).
 			On("CONFLICT (blockchain, network, contract_address) DO UPDATE").
-			Set("total_supply = EXCLUDED.total_supply, updated_at = NOW()").
+			Set("name = EXCLUDED.name, type = EXCLUDED.type").
+			Set("total_supply = EXCLUDED.total_supply, updated_at = NOW(), last_queried_at = EXCLUDED.last_queried_at").
 			Returning("*").
 			Exec(ctx)
 		return err
@@ -74,3 +81,46 @@ func (q *NFTCollectionMutator) DeleteNFTCollection(id string) (*database.NFTColl
 
 	return collection, nil
 }
+
+// TouchNFTCollections records that the collections are queried, at most once per collectionTouchInterval
+func (q *NFTCollectionMutator) TouchNFTCollections(ids []string, queriedAt time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := q.Session.NewUpdate().
+		Model((*database.NFTCollection)(nil)).
+		Set("last_queried_at = ?", queriedAt).
+		Where("id IN (?)", bun.In(ids)).
+		Where("last_queried_at < ?", queriedAt.Add(-collectionTouchInterval)).
+		Exec(q.Ctx)
+	return err
+}
+
+// DeleteNFTCollectionsQueriedBefore deletes at most limit collections last queried before t, tracked collections are kept
+func (q *NFTCollectionMutator) DeleteNFTCollectionsQueriedBefore(t time.Time, limit int) (int64, error) {
+	tracked := q.Session.NewSelect().
+		TableExpr("eth_nft_tracked_collection AS ntc").
+		ColumnExpr("1").
+		Where("ntc.blockchain = nc.blockchain").
+		Where("ntc.network = nc.network").
+		Where("lower(ntc.contract_address) = lower(nc.contract_address)")
+
+	subquery := q.Session.NewSelect().
+		Model((*database.NFTCollection)(nil)).
+		ModelTableExpr("eth_nft_collection AS nc").
+		ColumnExpr("nc.id").
+		Where("nc.last_queried_at < ?", t).
+		Where("NOT EXISTS (?)", tracked).
+		Limit(limit)
+
+	res, err := q.Session.NewDelete().
+		Model((*database.NFTCollection)(nil)).
+		Where("id IN (?)", subquery).
+		Exec(q.Ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
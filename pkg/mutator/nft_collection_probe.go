@@ -36,3 +36,24 @@ func (q *NFTCollectionProbeMutator) InsertNFTCollectionProbe(contractID authgear
 
 	return probe, nil
 }
+
+// UpsertNFTCollectionProbe replaces the stored probe of the contract
+func (q *NFTCollectionProbeMutator) UpsertNFTCollectionProbe(contractID authgearweb3.ContractID, isLargeCollection bool) (*database.NFTCollectionProbe, error) {
+	probe := &database.NFTCollectionProbe{
+		Blockchain:        contractID.Blockchain,
+		Network:           contractID.Network,
+		ContractAddress:   contractID.Address,
+		IsLargeCollection: isLargeCollection,
+	}
+
+	_, err := q.Session.NewInsert().
+		Model(probe).
+		On("CONFLICT (blockchain, network, contract_address) DO UPDATE").
+		Set("is_large_collection = EXCLUDED.is_large_collection").
+		Exec(q.Ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return probe, nil
+}
@@ -0,0 +1,237 @@
+package mutator
+
+import (
+	"context"
+	"database/sql"
+	"math/big"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/extra/bunbig"
+)
+
+// NFTIndexerMutator writes the ownerships of tracked collections, which are maintained by the worker only
+type NFTIndexerMutator struct {
+	Ctx     context.Context
+	Session *bun.DB
+}
+
+// ResetTrackedNFTOwnerships deletes the ownerships and the indexed state of the contract before it is indexed from the start block,
+// so that transfers are not applied on top of ownerships fetched from the provider
+func (m *NFTIndexerMutator) ResetTrackedNFTOwnerships(contract authgearweb3.ContractID) error {
+	return m.Session.RunInTx(m.Ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return deleteIndexedState(ctx, tx, contract)
+	})
+}
+
+// ApplyNFTOwnershipChanges saves the ownerships changed by the transfers up to the checkpoint, ownerships without balance left are deleted.
+// Ownerships, their undos and the checkpoint are saved in one transaction, so that no transfer is applied twice after a restart.
+// The changed ownerships are appended to the history as well.
+func (m *NFTIndexerMutator) ApplyNFTOwnershipChanges(checkpoint database.NFTIndexerCheckpoint, ownerships []database.NFTOwnership, removed []database.NFTOwnership, undos []database.NFTOwnershipUndo) error {
+	now := database.NewTimestamp()
+
+	histories := make([]database.NFTOwnershipHistory, 0, len(ownerships))
+	for i := range ownerships {
+		ownerships[i].RefreshedAt = now
+		histories = append(histories, database.NewNFTOwnershipHistory(ownerships[i]))
+	}
+
+	removedKeys := make([][]string, 0, len(removed))
+	for _, ownership := range removed {
+		removedKeys = append(removedKeys, []string{ownership.TokenID, ownership.OwnerAddress.String()})
+	}
+
+	return m.Session.RunInTx(m.Ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if len(removedKeys) > 0 {
+			_, err := tx.NewDelete().
+				Model((*database.NFTOwnership)(nil)).
+				Where("blockchain = ? AND network = ? AND contract_address = ?", checkpoint.Blockchain, checkpoint.Network, checkpoint.ContractAddress).
+				Where("(token_id, owner_address) IN (?)", bun.In(removedKeys)).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(ownerships) > 0 {
+			_, err := tx.NewInsert().
+				Model(&ownerships).
+				On("CONFLICT (blockchain, network, contract_address, token_id, owner_address) DO UPDATE").
+				Set("balance = EXCLUDED.balance").
+				Set("block_number = EXCLUDED.block_number").
+				Set("txn_hash = EXCLUDED.txn_hash").
+				Set("txn_index = EXCLUDED.txn_index").
+				Set("block_timestamp = EXCLUDED.block_timestamp").
+				Set("refreshed_at = EXCLUDED.refreshed_at").
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.NewInsert().
+				Model(&histories).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(undos) > 0 {
+			_, err := tx.NewInsert().Model(&undos).Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		if checkpoint.BlockHash != "" {
+			_, err := tx.NewInsert().
+				Model(&database.NFTIndexerBlock{
+					Blockchain:      checkpoint.Blockchain,
+					Network:         checkpoint.Network,
+					ContractAddress: checkpoint.ContractAddress,
+					BlockNumber:     checkpoint.BlockNumber,
+					BlockHash:       checkpoint.BlockHash,
+				}).
+				On("CONFLICT (blockchain, network, contract_address, block_number) DO UPDATE").
+				Set("block_hash = EXCLUDED.block_hash").
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.NewInsert().
+			Model(&checkpoint).
+			On("CONFLICT (blockchain, network, contract_address) DO UPDATE").
+			Set("block_number = EXCLUDED.block_number").
+			Set("block_hash = EXCLUDED.block_hash").
+			Set("synced_at = COALESCE(?TableAlias.synced_at, EXCLUDED.synced_at)").
+			Set("updated_at = EXCLUDED.updated_at").
+			Exec(ctx)
+		return err
+	})
+}
+
+// RollbackNFTOwnerships restores the ownerships of the contract as of the checkpoint block with the undos of later blocks,
+// which are orphaned by a reorganization, and moves the checkpoint back. The number of restored ownerships is returned.
+func (m *NFTIndexerMutator) RollbackNFTOwnerships(checkpoint database.NFTIndexerCheckpoint) (int, error) {
+	now := database.NewTimestamp()
+
+	var restored int
+	err := m.Session.RunInTx(m.Ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		undos := make([]database.NFTOwnershipUndo, 0)
+		err := tx.NewSelect().
+			Model(&undos).
+			Where("blockchain = ? AND network = ? AND contract_address = ?", checkpoint.Blockchain, checkpoint.Network, checkpoint.ContractAddress).
+			Where("block_number > ?", checkpoint.BlockNumber).
+			Order("block_number ASC").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		// The earliest undo of an ownership is its state as of the checkpoint block
+		keys := make([][]string, 0)
+		previous := make([]database.NFTOwnership, 0)
+		histories := make([]database.NFTOwnershipHistory, 0)
+		seen := make(map[string]struct{})
+		for _, undo := range undos {
+			key := undo.TokenID + "/" + undo.OwnerAddress.String()
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			keys = append(keys, []string{undo.TokenID, undo.OwnerAddress.String()})
+
+			if p := undo.Previous(); p != nil {
+				p.RefreshedAt = now
+				previous = append(previous, *p)
+				histories = append(histories, database.NewNFTOwnershipHistory(*p))
+			}
+		}
+
+		if len(keys) > 0 {
+			_, err = tx.NewDelete().
+				Model((*database.NFTOwnership)(nil)).
+				Where("blockchain = ? AND network = ? AND contract_address = ?", checkpoint.Blockchain, checkpoint.Network, checkpoint.ContractAddress).
+				Where("(token_id, owner_address) IN (?)", bun.In(keys)).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(previous) > 0 {
+			_, err = tx.NewInsert().Model(&previous).Exec(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.NewInsert().Model(&histories).Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		restored = len(keys)
+
+		for _, model := range []interface{}{(*database.NFTOwnershipUndo)(nil), (*database.NFTIndexerBlock)(nil)} {
+			_, err = tx.NewDelete().
+				Model(model).
+				Where("blockchain = ? AND network = ? AND contract_address = ?", checkpoint.Blockchain, checkpoint.Network, checkpoint.ContractAddress).
+				Where("block_number > ?", checkpoint.BlockNumber).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.NewUpdate().
+			Model(&checkpoint).
+			Column("block_number", "block_hash", "updated_at").
+			Where("blockchain = ? AND network = ? AND contract_address = ?", checkpoint.Blockchain, checkpoint.Network, checkpoint.ContractAddress).
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return restored, nil
+}
+
+// PruneReorgHistory deletes the undos and block hashes of the contract which are final.
+// The highest final block is kept, a reorganization cannot fork below it.
+func (m *NFTIndexerMutator) PruneReorgHistory(contract authgearweb3.ContractID, finalized *big.Int) error {
+	return m.Session.RunInTx(m.Ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var anchor sql.NullInt64
+		err := tx.NewSelect().
+			Model((*database.NFTIndexerBlock)(nil)).
+			ColumnExpr("MAX(block_number)").
+			Where("blockchain = ? AND network = ? AND contract_address = ?", contract.Blockchain, contract.Network, contract.Address).
+			Where("block_number <= ?", bunbig.FromMathBig(finalized)).
+			Scan(ctx, &anchor)
+		if err != nil {
+			return err
+		}
+		if !anchor.Valid {
+			return nil
+		}
+
+		_, err = tx.NewDelete().
+			Model((*database.NFTIndexerBlock)(nil)).
+			Where("blockchain = ? AND network = ? AND contract_address = ?", contract.Blockchain, contract.Network, contract.Address).
+			Where("block_number < ?", anchor.Int64).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().
+			Model((*database.NFTOwnershipUndo)(nil)).
+			Where("blockchain = ? AND network = ? AND contract_address = ?", contract.Blockchain, contract.Network, contract.Address).
+			Where("block_number <= ?", anchor.Int64).
+			Exec(ctx)
+		return err
+	})
+}
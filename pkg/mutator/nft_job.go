@@ -0,0 +1,124 @@
+package mutator
+
+import (
+	"context"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/uptrace/bun"
+)
+
+type NFTJobMutator struct {
+	Ctx     context.Context
+	Session *bun.DB
+}
+
+// EnqueueNFTJob inserts the job unless another one of the same dedup key is pending or running, enqueued tells which
+func (m *NFTJobMutator) EnqueueNFTJob(job database.NFTJob) (enqueued bool, err error) {
+	res, err := m.Session.NewInsert().
+		Model(&job).
+		On("CONFLICT (dedup_key) WHERE status IN (?) DO NOTHING", bun.In([]database.NFTJobStatus{database.NFTJobStatusPending, database.NFTJobStatusRunning})).
+		Exec(m.Ctx)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// ClaimNFTJobs locks up to limit jobs which are due, or running but locked before lockedBefore because their worker is gone.
+// Jobs locked by other workers are skipped, so that workers of several replicas never claim the same job.
+// Abandoned jobs without attempts left are dead-lettered instead of being claimed again.
+func (m *NFTJobMutator) ClaimNFTJobs(limit int, lockedBefore time.Time) ([]database.NFTJob, error) {
+	now := database.NewTimestamp()
+	jobs := make([]database.NFTJob, 0)
+	err := m.Session.RunInTx(m.Ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		abandoned := tx.NewSelect().
+			Model((*database.NFTJob)(nil)).
+			Column("id").
+			Where("status = ? AND locked_at < ?", database.NFTJobStatusRunning, lockedBefore).
+			Where("attempts >= max_attempts").
+			For("UPDATE SKIP LOCKED")
+
+		_, err := tx.NewUpdate().
+			Model((*database.NFTJob)(nil)).
+			Set("status = ?", database.NFTJobStatusDead).
+			Set("locked_at = NULL").
+			Set("last_error = ?", "worker stopped while running the job").
+			Set("updated_at = ?", now).
+			Where("id IN (?)", abandoned).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		due := tx.NewSelect().
+			Model((*database.NFTJob)(nil)).
+			Column("id").
+			WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+				return q.
+					WhereOr("status = ? AND run_at <= ?", database.NFTJobStatusPending, now).
+					WhereOr("status = ? AND locked_at < ? AND attempts < max_attempts", database.NFTJobStatusRunning, lockedBefore)
+			}).
+			Order("run_at ASC").
+			Limit(limit).
+			For("UPDATE SKIP LOCKED")
+
+		_, err = tx.NewUpdate().
+			Model((*database.NFTJob)(nil)).
+			Set("status = ?", database.NFTJobStatusRunning).
+			Set("attempts = attempts + 1").
+			Set("locked_at = ?", now).
+			Set("updated_at = ?", now).
+			Where("id IN (?)", due).
+			Returning("*").
+			Exec(ctx, &jobs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// CompleteNFTJob deletes the job which has succeeded
+func (m *NFTJobMutator) CompleteNFTJob(id string) error {
+	_, err := m.Session.NewDelete().
+		Model((*database.NFTJob)(nil)).
+		Where("id = ?", id).
+		Exec(m.Ctx)
+	return err
+}
+
+// RetryNFTJob releases the failed job to be claimed again at runAt
+func (m *NFTJobMutator) RetryNFTJob(id string, runAt time.Time, lastError string) error {
+	_, err := m.Session.NewUpdate().
+		Model((*database.NFTJob)(nil)).
+		Set("status = ?", database.NFTJobStatusPending).
+		Set("run_at = ?", runAt).
+		Set("locked_at = NULL").
+		Set("last_error = ?", lastError).
+		Set("updated_at = ?", database.NewTimestamp()).
+		Where("id = ?", id).
+		Exec(m.Ctx)
+	return err
+}
+
+// DeadLetterNFTJob stops retrying the failed job
+func (m *NFTJobMutator) DeadLetterNFTJob(id string, lastError string) error {
+	_, err := m.Session.NewUpdate().
+		Model((*database.NFTJob)(nil)).
+		Set("status = ?", database.NFTJobStatusDead).
+		Set("locked_at = NULL").
+		Set("last_error = ?", lastError).
+		Set("updated_at = ?", database.NewTimestamp()).
+		Where("id = ?", id).
+		Exec(m.Ctx)
+	return err
+}
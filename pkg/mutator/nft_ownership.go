@@ -2,8 +2,11 @@ package mutator
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
 	"github.com/uptrace/bun"
 )
 
@@ -12,20 +15,115 @@ type NFTOwnershipMutator struct {
 	Session *bun.DB
 }
 
-func (q *NFTOwnershipMutator) InsertNFTOwnerships(ownerships []database.NFTOwnership) error {
-
+// UpsertNFTOwnerships replaces the stored ownerships of the owner in contracts with ownerships,
+// tokens of the contracts not in ownerships are no longer owned and deleted.
+// The ownerships are appended to the history as well.
+func (q *NFTOwnershipMutator) UpsertNFTOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID, ownerships []database.NFTOwnership) error {
 	if len(ownerships) == 0 {
 		return nil
 	}
 
+	// Upsert fails if a row is affected twice in one statement
+	seen := make(map[string]int)
+	dedupedOwnerships := make([]database.NFTOwnership, 0, len(ownerships))
+	now := database.NewTimestamp()
+	for _, ownership := range ownerships {
+		ownership.RefreshedAt = now
+
+		key := ownership.ContractTokenID().String()
+		if i, ok := seen[key]; ok {
+			dedupedOwnerships[i] = ownership
+			continue
+		}
+		seen[key] = len(dedupedOwnerships)
+		dedupedOwnerships = append(dedupedOwnerships, ownership)
+	}
+
+	contractIDToTokenIDs := make(map[string][]string)
+	for _, ownership := range dedupedOwnerships {
+		contractID := ownership.ContractID().String()
+		contractIDToTokenIDs[contractID] = append(contractIDToTokenIDs[contractID], ownership.TokenID)
+	}
+
 	err := q.Session.RunInTx(q.Ctx, nil, func(ctx context.Context, tx bun.Tx) error {
 		_, err := tx.NewInsert().
-			Model(&ownerships).
-			Returning("*").
+			Model(&dedupedOwnerships).
+			On("CONFLICT (blockchain, network, contract_address, token_id, owner_address) DO UPDATE").
+			Set("balance = EXCLUDED.balance").
+			Set("block_number = EXCLUDED.block_number").
+			Set("txn_hash = EXCLUDED.txn_hash").
+			Set("txn_index = EXCLUDED.txn_index").
+			Set("block_timestamp = EXCLUDED.block_timestamp").
+			Set("refreshed_at = EXCLUDED.refreshed_at").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		histories := make([]database.NFTOwnershipHistory, 0, len(dedupedOwnerships))
+		for _, ownership := range dedupedOwnerships {
+			histories = append(histories, database.NewNFTOwnershipHistory(ownership))
+		}
+		_, err = tx.NewInsert().
+			Model(&histories).
 			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, contract := range contracts {
+			// Every requested token id has a row, either owned or empty
+			if len(contract.Query["token_ids"]) > 0 {
+				continue
+			}
+
+			tokenIDs, ok := contractIDToTokenIDs[contract.StripQuery().String()]
+			if !ok {
+				continue
+			}
 
-		return err
+			_, err := tx.NewDelete().
+				Model((*database.NFTOwnership)(nil)).
+				Where("blockchain = ? AND network = ? AND contract_address = ? AND owner_address = ?", contract.Blockchain, contract.Network, contract.Address, ownerID.Address).
+				Where("token_id NOT IN (?)", bun.In(tokenIDs)).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
 	})
 
 	return err
 }
+
+// DeleteNFTOwnershipsRefreshedBefore deletes at most limit ownerships, including empty ones, last refreshed before t.
+// Ownerships of excludedContracts are kept.
+func (q *NFTOwnershipMutator) DeleteNFTOwnershipsRefreshedBefore(t time.Time, excludedContracts []authgearweb3.ContractID, limit int) (int64, error) {
+	// The table has no primary key, rows are picked by ctid
+	subquery := q.Session.NewSelect().
+		Model((*database.NFTOwnership)(nil)).
+		Column("ctid").
+		Where("refreshed_at < ?", t).
+		Limit(limit)
+
+	if len(excludedContracts) > 0 {
+		// Addresses are compared case-insensitively as not every writer checksums them
+		excludedKeys := make([][]string, 0, len(excludedContracts))
+		for _, contract := range excludedContracts {
+			excludedKeys = append(excludedKeys, []string{contract.Blockchain, contract.Network, strings.ToLower(contract.Address.String())})
+		}
+		subquery = subquery.Where("(blockchain, network, lower(contract_address)) NOT IN (?)", bun.In(excludedKeys))
+	}
+
+	res, err := q.Session.NewDelete().
+		Model((*database.NFTOwnership)(nil)).
+		Where("ctid IN (?)", subquery).
+		Exec(q.Ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
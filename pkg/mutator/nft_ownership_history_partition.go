@@ -0,0 +1,37 @@
+package mutator
+
+import (
+	"context"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/uptrace/bun"
+)
+
+type NFTOwnershipHistoryPartitionMutator struct {
+	Ctx     context.Context
+	Session *bun.DB
+}
+
+// CreateNFTOwnershipHistoryPartition is a no-op if the partition exists
+func (m *NFTOwnershipHistoryPartitionMutator) CreateNFTOwnershipHistoryPartition(partition database.NFTOwnershipHistoryPartition) error {
+	_, err := m.Session.ExecContext(m.Ctx,
+		"CREATE TABLE IF NOT EXISTS ? PARTITION OF eth_nft_ownership_history FOR VALUES FROM (?) TO (?)",
+		bun.Ident(partition.Name),
+		partition.Day.Format("2006-01-02"),
+		partition.End().Format("2006-01-02"),
+	)
+	return err
+}
+
+// DropNFTOwnershipHistoryPartition detaches the partition before dropping it
+func (m *NFTOwnershipHistoryPartitionMutator) DropNFTOwnershipHistoryPartition(partition database.NFTOwnershipHistoryPartition) error {
+	return m.Session.RunInTx(m.Ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, "ALTER TABLE eth_nft_ownership_history DETACH PARTITION ?", bun.Ident(partition.Name))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "DROP TABLE ?", bun.Ident(partition.Name))
+		return err
+	})
+}
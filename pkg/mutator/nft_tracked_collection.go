@@ -0,0 +1,144 @@
+package mutator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun"
+)
+
+type NFTTrackedCollectionMutator struct {
+	Ctx     context.Context
+	Session *bun.DB
+}
+
+// UpsertTrackedCollection registers the collection or updates its registration.
+// Changing the mode or the start block of an indexed collection discards what the worker has indexed, so that it starts over.
+func (m *NFTTrackedCollectionMutator) UpsertTrackedCollection(collection database.NFTTrackedCollection) (*database.NFTTrackedCollection, error) {
+	err := m.Session.RunInTx(m.Ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		existing := new(database.NFTTrackedCollection)
+		err := tx.NewSelect().
+			Model(existing).
+			Where("blockchain = ? AND network = ? AND contract_address = ?", collection.Blockchain, collection.Network, collection.ContractAddress).
+			For("UPDATE").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			existing = nil
+		} else if err != nil {
+			return err
+		}
+
+		if existing != nil && existing.IsIndexed() && (existing.Mode != collection.Mode || existing.StartBlock != collection.StartBlock) {
+			err = deleteIndexedState(ctx, tx, *existing.ContractID())
+			if err != nil {
+				return err
+			}
+		}
+
+		if existing != nil {
+			collection.ID = existing.ID
+			collection.CreatedAt = existing.CreatedAt
+			collection.PausedAt = existing.PausedAt
+			_, err = tx.NewUpdate().
+				Model(&collection).
+				Column("mode", "start_block", "ttl_seconds", "updated_at").
+				WherePK().
+				Exec(ctx)
+			return err
+		}
+
+		_, err = tx.NewInsert().Model(&collection).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &collection, nil
+}
+
+// SetTrackedCollectionPausedAt pauses the collection, or resumes it if pausedAt is nil, sql.ErrNoRows is returned if it is not tracked
+func (m *NFTTrackedCollectionMutator) SetTrackedCollectionPausedAt(contract authgearweb3.ContractID, pausedAt *time.Time) (*database.NFTTrackedCollection, error) {
+	collection := new(database.NFTTrackedCollection)
+	collection.PausedAt = pausedAt
+	res, err := m.Session.NewUpdate().
+		Model(collection).
+		Column("paused_at", "updated_at").
+		Where("blockchain = ? AND network = ? AND contract_address = ?", contract.Blockchain, contract.Network, contract.Address).
+		Returning("*").
+		Exec(m.Ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return collection, nil
+}
+
+// DeleteTrackedCollection unregisters the collection with the checkpoint and ownerships of the worker,
+// from then on the collection is fetched lazily like any other. It returns false if the collection is not tracked.
+func (m *NFTTrackedCollectionMutator) DeleteTrackedCollection(contract authgearweb3.ContractID) (bool, error) {
+	deleted := false
+	err := m.Session.RunInTx(m.Ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		collection := new(database.NFTTrackedCollection)
+		res, err := tx.NewDelete().
+			Model(collection).
+			Where("blockchain = ? AND network = ? AND contract_address = ?", contract.Blockchain, contract.Network, contract.Address).
+			Returning("*").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return nil
+		}
+		deleted = true
+
+		if !collection.IsIndexed() {
+			return nil
+		}
+		return deleteIndexedState(ctx, tx, contract)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+// deleteIndexedState deletes the checkpoint, the reorganization history and the ownerships written by the worker
+func deleteIndexedState(ctx context.Context, tx bun.Tx, contract authgearweb3.ContractID) error {
+	models := []interface{}{
+		(*database.NFTIndexerCheckpoint)(nil),
+		(*database.NFTIndexerBlock)(nil),
+		(*database.NFTOwnershipUndo)(nil),
+		(*database.NFTOwnership)(nil),
+	}
+	for _, model := range models {
+		_, err := tx.NewDelete().
+			Model(model).
+			Where("blockchain = ? AND network = ? AND contract_address = ?", contract.Blockchain, contract.Network, contract.Address).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -8,4 +8,9 @@ var DependencySet = wire.NewSet(
 	wire.Struct(new(NFTCollectionQuery), "*"),
 	wire.Struct(new(NFTOwnershipQuery), "*"),
 	wire.Struct(new(NFTCollectionProbeQuery), "*"),
+	wire.Struct(new(NFTOwnershipHistoryPartitionQuery), "*"),
+	wire.Struct(new(NFTIndexerCheckpointQuery), "*"),
+	wire.Struct(new(NFTTrackedCollectionQuery), "*"),
+	wire.Struct(new(NFTIndexerBlockQuery), "*"),
+	wire.Struct(new(NFTOwnershipUndoQuery), "*"),
 )
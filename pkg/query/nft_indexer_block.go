@@ -0,0 +1,32 @@
+package query
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/extra/bunbig"
+)
+
+type NFTIndexerBlockQuery struct {
+	Ctx     context.Context
+	Session *bun.DB
+}
+
+// QueryBlocksBefore returns the recorded blocks of the contract below blockNumber, the highest first
+func (q *NFTIndexerBlockQuery) QueryBlocksBefore(contract authgearweb3.ContractID, blockNumber *big.Int) ([]database.NFTIndexerBlock, error) {
+	blocks := make([]database.NFTIndexerBlock, 0)
+	err := q.Session.NewSelect().
+		Model(&blocks).
+		Where("blockchain = ? AND network = ? AND contract_address = ?", contract.Blockchain, contract.Network, contract.Address).
+		Where("block_number < ?", bunbig.FromMathBig(blockNumber)).
+		Order("block_number DESC").
+		Scan(q.Ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
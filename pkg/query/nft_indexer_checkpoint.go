@@ -0,0 +1,37 @@
+package query
+
+import (
+	"context"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun"
+)
+
+type NFTIndexerCheckpointQuery struct {
+	Ctx     context.Context
+	Session *bun.DB
+}
+
+// QueryCheckpoints returns the checkpoints of contracts, contracts never indexed are left out
+func (q *NFTIndexerCheckpointQuery) QueryCheckpoints(contracts []authgearweb3.ContractID) ([]database.NFTIndexerCheckpoint, error) {
+	checkpoints := make([]database.NFTIndexerCheckpoint, 0)
+	if len(contracts) == 0 {
+		return checkpoints, nil
+	}
+
+	query := q.Session.NewSelect().Model(&checkpoints)
+	for _, contract := range contracts {
+		contract := contract
+		query = query.WhereGroup(" OR ", func(sq *bun.SelectQuery) *bun.SelectQuery {
+			return sq.Where("blockchain = ? AND network = ? AND contract_address = ?", contract.Blockchain, contract.Network, contract.Address)
+		})
+	}
+
+	err := query.Scan(q.Ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpoints, nil
+}
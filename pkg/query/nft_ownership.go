@@ -61,7 +61,7 @@ func (b NFTOwnershipQueryBuilder) WithOwner(ownerID *authgearweb3.ContractID) NF
 
 func (b NFTOwnershipQueryBuilder) WithMinimumFreshness(t time.Time) NFTOwnershipQueryBuilder {
 	return NFTOwnershipQueryBuilder{
-		b.Where("created_at > ?", t),
+		b.Where("refreshed_at > ?", t),
 	}
 }
 
@@ -71,10 +71,19 @@ func (q *NFTOwnershipQuery) NewQueryBuilder() NFTOwnershipQueryBuilder {
 	}
 }
 
+// QueryOwnerOwnerships returns the ownerships of the owner in contracts, only the ones refreshed after minimumFreshness if it is not nil
+func (q *NFTOwnershipQuery) QueryOwnerOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID, minimumFreshness *time.Time) ([]database.NFTOwnership, error) {
+	qb := q.NewQueryBuilder().WithContracts(contracts).WithOwner(&ownerID)
+	if minimumFreshness != nil {
+		qb = qb.WithMinimumFreshness(*minimumFreshness)
+	}
+	return q.ExecuteQuery(qb)
+}
+
 func (q *NFTOwnershipQuery) ExecuteQuery(qb NFTOwnershipQueryBuilder) ([]database.NFTOwnership, error) {
 	nftOwnerships := make([]database.NFTOwnership, 0)
 
-	query := qb.Order("created_at DESC")
+	query := qb.Order("refreshed_at DESC")
 
 	err := query.Scan(q.Ctx, &nftOwnerships)
 	if err != nil {
@@ -0,0 +1,43 @@
+package query
+
+import (
+	"context"
+	"sort"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/uptrace/bun"
+)
+
+type NFTOwnershipHistoryPartitionQuery struct {
+	Ctx     context.Context
+	Session *bun.DB
+}
+
+// ListNFTOwnershipHistoryPartitions returns the daily partitions of eth_nft_ownership_history ordered by day, the default partition is excluded
+func (q *NFTOwnershipHistoryPartitionQuery) ListNFTOwnershipHistoryPartitions() ([]database.NFTOwnershipHistoryPartition, error) {
+	names := make([]string, 0)
+	err := q.Session.NewSelect().
+		TableExpr("pg_inherits").
+		ColumnExpr("c.relname").
+		Join("JOIN pg_class AS c ON c.oid = pg_inherits.inhrelid").
+		Where("pg_inherits.inhparent = 'eth_nft_ownership_history'::regclass").
+		Scan(q.Ctx, &names)
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := make([]database.NFTOwnershipHistoryPartition, 0, len(names))
+	for _, name := range names {
+		partition, ok := database.ParseNFTOwnershipHistoryPartition(name)
+		if !ok {
+			continue
+		}
+		partitions = append(partitions, partition)
+	}
+
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].Day.Before(partitions[j].Day)
+	})
+
+	return partitions, nil
+}
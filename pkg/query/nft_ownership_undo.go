@@ -0,0 +1,41 @@
+package query
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun"
+)
+
+type NFTOwnershipUndoQuery struct {
+	Ctx     context.Context
+	Session *bun.DB
+}
+
+// QueryUndosAfter returns the undos of the owner in contracts of blocks after blockNumber, ordered by block ascending
+func (q *NFTOwnershipUndoQuery) QueryUndosAfter(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID, blockNumber *big.Int) ([]database.NFTOwnershipUndo, error) {
+	undos := make([]database.NFTOwnershipUndo, 0)
+	if len(contracts) == 0 {
+		return undos, nil
+	}
+
+	contractAddresses := make([]string, 0, len(contracts))
+	for _, contract := range contracts {
+		contractAddresses = append(contractAddresses, contract.Address.String())
+	}
+
+	err := q.Session.NewSelect().
+		Model(&undos).
+		Where("blockchain = ? AND network = ? AND owner_address = ?", ownerID.Blockchain, ownerID.Network, ownerID.Address).
+		Where("contract_address IN (?)", bun.In(contractAddresses)).
+		Where("block_number > ?", blockNumber.Int64()).
+		Order("block_number ASC").
+		Scan(q.Ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return undos, nil
+}
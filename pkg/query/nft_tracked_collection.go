@@ -0,0 +1,50 @@
+package query
+
+import (
+	"context"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun"
+)
+
+type NFTTrackedCollectionQuery struct {
+	Ctx     context.Context
+	Session *bun.DB
+}
+
+// QueryTrackedCollections returns the tracked collections among contracts, untracked contracts are left out
+func (q *NFTTrackedCollectionQuery) QueryTrackedCollections(contracts []authgearweb3.ContractID) ([]database.NFTTrackedCollection, error) {
+	collections := make([]database.NFTTrackedCollection, 0)
+	if len(contracts) == 0 {
+		return collections, nil
+	}
+
+	query := q.Session.NewSelect().Model(&collections)
+	for _, contract := range contracts {
+		contract := contract
+		query = query.WhereGroup(" OR ", func(sq *bun.SelectQuery) *bun.SelectQuery {
+			return sq.Where("blockchain = ? AND network = ? AND contract_address = ?", contract.Blockchain, contract.Network, contract.Address)
+		})
+	}
+
+	err := query.Scan(q.Ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+func (q *NFTTrackedCollectionQuery) ListTrackedCollections() ([]database.NFTTrackedCollection, error) {
+	collections := make([]database.NFTTrackedCollection, 0)
+	err := q.Session.NewSelect().
+		Model(&collections).
+		Order("blockchain", "network", "created_at").
+		Scan(q.Ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/web3"
+	"github.com/authgear/authgear-server/pkg/api/apierrors"
+	"github.com/authgear/authgear-server/pkg/util/clock"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+type BackfillServiceIndexerService interface {
+	DetectStartBlock(contract authgearweb3.ContractID) (*big.Int, error)
+	Backfill(collection database.NFTTrackedCollection, onProgress func(progress IndexProgress)) error
+}
+
+type BackfillServiceNFTTrackedCollectionQuery interface {
+	QueryTrackedCollections(contracts []authgearweb3.ContractID) ([]database.NFTTrackedCollection, error)
+}
+
+type BackfillServiceNFTTrackedCollectionMutator interface {
+	UpsertTrackedCollection(collection database.NFTTrackedCollection) (*database.NFTTrackedCollection, error)
+	SetTrackedCollectionPausedAt(contract authgearweb3.ContractID, pausedAt *time.Time) (*database.NFTTrackedCollection, error)
+}
+
+type BackfillService struct {
+	Clock                       clock.Clock
+	Config                      config.Config
+	IndexerService              BackfillServiceIndexerService
+	NFTTrackedCollectionQuery   BackfillServiceNFTTrackedCollectionQuery
+	NFTTrackedCollectionMutator BackfillServiceNFTTrackedCollectionMutator
+}
+
+// Backfill indexes the full history of the collection before the worker takes it over.
+// The collection is registered as indexed and kept paused meanwhile, so that the worker leaves it alone,
+// it is resumed once caught up. startBlock nil means the block of its first transfer.
+func (s *BackfillService) Backfill(contract authgearweb3.ContractID, startBlock *int64, onProgress func(progress IndexProgress)) (*database.NFTTrackedCollection, error) {
+	contract = contract.StripQuery()
+	err := web3.CheckNetwork(s.Config, contract.Blockchain, contract.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := s.prepareCollection(contract, startBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.IndexerService.Backfill(*collection, onProgress)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.NFTTrackedCollectionMutator.SetTrackedCollectionPausedAt(contract, nil)
+}
+
+func (s *BackfillService) prepareCollection(contract authgearweb3.ContractID, startBlock *int64) (*database.NFTTrackedCollection, error) {
+	collections, err := s.NFTTrackedCollectionQuery.QueryTrackedCollections([]authgearweb3.ContractID{contract})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(collections) != 0 {
+		collection := collections[0]
+		if !collection.IsIndexed() {
+			return nil, ErrBackfillNotAllowed.NewWithDetails("collection is tracked in cached mode", apierrors.Details{"contract": contract.String()})
+		}
+		if !collection.IsPaused() {
+			return nil, ErrBackfillNotAllowed.NewWithDetails("collection is followed by the worker, pause it first", apierrors.Details{"contract": contract.String()})
+		}
+
+		// A different start block discards the indexed history, so that it starts over
+		if startBlock == nil || *startBlock == collection.StartBlock {
+			return &collection, nil
+		}
+		collection.StartBlock = *startBlock
+		return s.NFTTrackedCollectionMutator.UpsertTrackedCollection(collection)
+	}
+
+	var block int64
+	if startBlock != nil {
+		block = *startBlock
+	} else {
+		detected, err := s.IndexerService.DetectStartBlock(contract)
+		if err != nil {
+			return nil, err
+		}
+		block = detected.Int64()
+	}
+
+	now := s.Clock.NowUTC()
+	return s.NFTTrackedCollectionMutator.UpsertTrackedCollection(database.NFTTrackedCollection{
+		Blockchain:      contract.Blockchain,
+		Network:         contract.Network,
+		ContractAddress: contract.Address,
+		Mode:            database.TrackedCollectionModeIndexed,
+		StartBlock:      block,
+		PausedAt:        &now,
+	})
+}
@@ -0,0 +1,17 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// pageContext lets a page use up to half of the remaining time budget,
+// so that a slow page still leaves time to return what has been fetched
+func pageContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, time.Until(deadline)/2)
+}
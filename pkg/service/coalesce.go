@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"golang.org/x/sync/singleflight"
+)
+
+// FetchCoalescer lets concurrent identical lookups share one upstream fetch and one DB write
+type FetchCoalescer struct {
+	// Timeout bounds the shared fetch, which outlives the caller that started it
+	Timeout time.Duration
+
+	group singleflight.Group
+}
+
+func NewFetchCoalescer(cfg config.Config) *FetchCoalescer {
+	return &FetchCoalescer{
+		Timeout: cfg.Server.GetRequestTimeout(),
+	}
+}
+
+// Do runs fn once for concurrent callers of the same key. fn runs on a context detached from the caller
+// that started it, so that the caller going away does not fail the fetch for the others.
+// Each caller stops waiting when its own ctx is done
+func (c *FetchCoalescer) Do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if c == nil {
+		return fn(ctx)
+	}
+
+	resultChan := c.group.DoChan(key, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.Timeout)
+		defer cancel()
+
+		v, err := fn(fetchCtx)
+		return v, wrapContextError(fetchCtx, err)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-resultChan:
+		return result.Val, result.Err
+	}
+}
+
+// contractKey identifies a contract and its token ids regardless of their order
+func contractKey(contract authgearweb3.ContractID) string {
+	tokenIDs := append([]string{}, contract.Query["token_ids"]...)
+	sort.Strings(tokenIDs)
+
+	return contract.StripQuery().String() + "#" + strings.Join(tokenIDs, ",")
+}
+
+func collectionsFetchKey(contracts []authgearweb3.ContractID) string {
+	contractIDs := make([]string, 0, len(contracts))
+	for _, contract := range contracts {
+		contractIDs = append(contractIDs, contract.StripQuery().String())
+	}
+	sort.Strings(contractIDs)
+
+	return "collections:" + strings.Join(contractIDs, "|")
+}
+
+func ownershipFetchKey(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID) string {
+	contractKeys := make([]string, 0, len(contracts))
+	for _, contract := range contracts {
+		contractKeys = append(contractKeys, contractKey(contract))
+	}
+	sort.Strings(contractKeys)
+
+	return "ownership:" + ownerID.String() + ":" + strings.Join(contractKeys, "|")
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+func mustParseContractID(t *testing.T, s string) authgearweb3.ContractID {
+	contractID, err := authgearweb3.ParseContractID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *contractID
+}
+
+func TestFetchCoalescerDo(t *testing.T) {
+	coalescer := NewFetchCoalescer(config.Config{})
+
+	var calls int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return "result", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := coalescer.Do(context.Background(), "key", fn)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			results[i] = v
+		}(i)
+		if i == 0 {
+			<-started
+		}
+	}
+
+	// Let the other callers join the fetch in flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected one fetch, got %v", calls)
+	}
+	for i, v := range results {
+		if v != "result" {
+			t.Errorf("caller %v: unexpected result %v", i, v)
+		}
+	}
+}
+
+func TestFetchCoalescerDoCancel(t *testing.T) {
+	coalescer := NewFetchCoalescer(config.Config{})
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fetchErr := make(chan error, 1)
+	fn := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		fetchErr <- ctx.Err()
+		return "result", nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := coalescer.Do(ctx, "key", fn)
+		cancelled <- err
+	}()
+	<-started
+
+	joined := make(chan interface{}, 1)
+	go func() {
+		v, err := coalescer.Do(context.Background(), "key", fn)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		joined <- v
+	}()
+
+	// The caller that started the fetch goes away before it is done
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := <-fetchErr; err != nil {
+		t.Errorf("expected the shared fetch to keep running, got %v", err)
+	}
+	if v := <-joined; v != "result" {
+		t.Errorf("unexpected result %v", v)
+	}
+}
+
+func TestOwnershipFetchKey(t *testing.T) {
+	owner := mustParseContractID(t, "ethereum:0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045@1")
+	contractA := "ethereum:0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D@1"
+	contractB := "ethereum:0x60E4d786628Fea6478F785A6d7e704777c86a7c6@1"
+
+	cases := []struct {
+		Name     string
+		Left     []string
+		Right    []string
+		Expected bool
+	}{
+		{
+			Name:     "Contract order is ignored",
+			Left:     []string{contractA, contractB},
+			Right:    []string{contractB, contractA},
+			Expected: true,
+		},
+		{
+			Name:     "Token ID order is ignored",
+			Left:     []string{contractA + "?token_ids=0x1&token_ids=0x2"},
+			Right:    []string{contractA + "?token_ids=0x2&token_ids=0x1"},
+			Expected: true,
+		},
+		{
+			Name:     "Different token IDs are different fetches",
+			Left:     []string{contractA + "?token_ids=0x1"},
+			Right:    []string{contractA + "?token_ids=0x2"},
+			Expected: false,
+		},
+		{
+			Name:     "Different contracts are different fetches",
+			Left:     []string{contractA},
+			Right:    []string{contractA, contractB},
+			Expected: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			parse := func(contracts []string) []authgearweb3.ContractID {
+				contractIDs := make([]authgearweb3.ContractID, 0, len(contracts))
+				for _, contract := range contracts {
+					contractIDs = append(contractIDs, mustParseContractID(t, contract))
+				}
+				return contractIDs
+			}
+
+			left := ownershipFetchKey(owner, parse(c.Left))
+			right := ownershipFetchKey(owner, parse(c.Right))
+			if (left == right) != c.Expected {
+				t.Errorf("expected keys equal to be %v, got %q and %q", c.Expected, left, right)
+			}
+		})
+	}
+}
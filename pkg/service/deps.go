@@ -5,7 +5,17 @@ import (
 )
 
 var DependencySet = wire.NewSet(
+	NewOwnershipServiceLogger,
 	wire.Struct(new(MetadataService), "*"),
 	wire.Struct(new(ProbeService), "*"),
 	wire.Struct(new(OwnershipService), "*"),
+	NewGCServiceLogger,
+	wire.Struct(new(GCService), "*"),
+	NewIndexerServiceLogger,
+	wire.Struct(new(IndexerService), "*"),
+	wire.Struct(new(TrackedCollectionService), "*"),
+	wire.Struct(new(BackfillService), "*"),
+	wire.Struct(new(JobQueueService), "*"),
+	NewJobRunnerServiceLogger,
+	wire.Struct(new(JobRunnerService), "*"),
 )
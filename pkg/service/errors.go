@@ -1,7 +1,21 @@
 package service
 
 import (
+	"context"
+	"errors"
+
 	"github.com/authgear/authgear-server/pkg/api/apierrors"
 )
 
 var ErrBadNFTCollection = apierrors.Forbidden.WithReason("BadNFTCollection")
+var ErrRequestTimeout = apierrors.ServiceUnavailable.WithReason("RequestTimeout")
+var ErrTrackedCollectionNotFound = apierrors.NotFound.WithReason("TrackedCollectionNotFound")
+var ErrBackfillNotAllowed = apierrors.Invalid.WithReason("BackfillNotAllowed")
+
+// wrapContextError reports an error caused by the request time budget running out as ErrRequestTimeout
+func wrapContextError(ctx context.Context, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrRequestTimeout.Wrap(err, "request time budget exceeded")
+	}
+	return err
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-server/pkg/util/clock"
+	"github.com/authgear/authgear-server/pkg/util/log"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+type GCServiceNFTOwnershipMutator interface {
+	DeleteNFTOwnershipsRefreshedBefore(t time.Time, excludedContracts []authgearweb3.ContractID, limit int) (int64, error)
+}
+
+type GCServiceNFTOwnershipHistoryPartitionQuery interface {
+	ListNFTOwnershipHistoryPartitions() ([]database.NFTOwnershipHistoryPartition, error)
+}
+
+type GCServiceNFTOwnershipHistoryPartitionMutator interface {
+	CreateNFTOwnershipHistoryPartition(partition database.NFTOwnershipHistoryPartition) error
+	DropNFTOwnershipHistoryPartition(partition database.NFTOwnershipHistoryPartition) error
+}
+
+type GCServiceNFTCollectionMutator interface {
+	DeleteNFTCollectionsQueriedBefore(t time.Time, limit int) (int64, error)
+}
+
+type GCServiceNFTTrackedCollectionQuery interface {
+	ListTrackedCollections() ([]database.NFTTrackedCollection, error)
+}
+
+type GCServiceLock interface {
+	WithTryAdvisoryLock(key int64, fn func() error) (bool, error)
+}
+
+// gcAdvisoryLockKey serializes gc across replicas, any value unique among the advisory locks of the database does
+const gcAdvisoryLockKey int64 = 0x6e66742d6763 // "nft-gc"
+
+type GCServiceLogger struct{ *log.Logger }
+
+func NewGCServiceLogger(lf *log.Factory) GCServiceLogger {
+	return GCServiceLogger{lf.New("gc")}
+}
+
+type GCResult struct {
+	// Skipped is true if another replica was running gc
+	Skipped                           bool
+	OwnershipHistoryPartitionsCreated int
+	OwnershipHistoryPartitionsDropped int
+	OwnershipsDeleted                 int64
+	CollectionsDeleted                int64
+}
+
+type GCService struct {
+	Context                             context.Context
+	Clock                               clock.Clock
+	Config                              config.Config
+	Logger                              GCServiceLogger
+	NFTOwnershipMutator                 GCServiceNFTOwnershipMutator
+	NFTOwnershipHistoryPartitionQuery   GCServiceNFTOwnershipHistoryPartitionQuery
+	NFTOwnershipHistoryPartitionMutator GCServiceNFTOwnershipHistoryPartitionMutator
+	NFTCollectionMutator                GCServiceNFTCollectionMutator
+	NFTTrackedCollectionQuery           GCServiceNFTTrackedCollectionQuery
+	Lock                                GCServiceLock
+}
+
+// CreateOwnershipHistoryPartitions creates the daily ownership history partitions from today up to the configured days ahead,
+// so that rows do not land in the default partition. It is skipped if another replica is running gc.
+func (s *GCService) CreateOwnershipHistoryPartitions() (*GCResult, error) {
+	result := &GCResult{}
+	acquired, err := s.Lock.WithTryAdvisoryLock(gcAdvisoryLockKey, func() error {
+		created, err := s.createOwnershipHistoryPartitions()
+		result.OwnershipHistoryPartitionsCreated = created
+		return err
+	})
+	result.Skipped = !acquired && err == nil
+	return result, err
+}
+
+func (s *GCService) createOwnershipHistoryPartitions() (int, error) {
+	today := database.NFTOwnershipHistoryPartitionDay(s.Clock.NowUTC())
+
+	existing, err := s.NFTOwnershipHistoryPartitionQuery.ListNFTOwnershipHistoryPartitions()
+	if err != nil {
+		return 0, err
+	}
+	exists := make(map[string]struct{}, len(existing))
+	for _, partition := range existing {
+		exists[partition.Name] = struct{}{}
+	}
+
+	created := 0
+	for i := 0; i <= s.Config.GC.GetOwnershipHistoryPartitionsAheadDays(); i++ {
+		partition := database.NewNFTOwnershipHistoryPartition(today.AddDate(0, 0, i))
+		if _, ok := exists[partition.Name]; ok {
+			continue
+		}
+
+		err := s.NFTOwnershipHistoryPartitionMutator.CreateNFTOwnershipHistoryPartition(partition)
+		if err != nil {
+			return created, err
+		}
+		created++
+	}
+
+	return created, nil
+}
+
+// dropOwnershipHistoryPartitions drops the daily ownership history partitions whose rows are all past the retention
+func (s *GCService) dropOwnershipHistoryPartitions(now time.Time) (int, error) {
+	cutoff := now.Add(-s.Config.GC.GetOwnershipHistoryRetention())
+
+	partitions, err := s.NFTOwnershipHistoryPartitionQuery.ListNFTOwnershipHistoryPartitions()
+	if err != nil {
+		return 0, err
+	}
+
+	dropped := 0
+	for _, partition := range partitions {
+		if partition.End().After(cutoff) {
+			continue
+		}
+
+		err := s.NFTOwnershipHistoryPartitionMutator.DropNFTOwnershipHistoryPartition(partition)
+		if err != nil {
+			return dropped, err
+		}
+		dropped++
+	}
+
+	return dropped, nil
+}
+
+// Run creates upcoming ownership history partitions and drops the ones past retention,
+// deletes ownerships past their TTL and retention, and collections not queried within their retention.
+// Ownerships of tracked collections are kept, the worker keeps them current without refreshing every row.
+// Rows are deleted in batches with a pause in between, so that hot tables are not locked for long.
+// Every replica may call Run, only the one holding the advisory lock does the work.
+func (s *GCService) Run() (*GCResult, error) {
+	result := &GCResult{}
+	acquired, err := s.Lock.WithTryAdvisoryLock(gcAdvisoryLockKey, func() error {
+		return s.run(result)
+	})
+	if err == nil && !acquired {
+		result.Skipped = true
+		s.Logger.Info("gc skipped, another replica is running it")
+	}
+	return result, err
+}
+
+func (s *GCService) run(result *GCResult) error {
+	now := s.Clock.NowUTC()
+	gcConfig := s.Config.GC
+
+	created, err := s.createOwnershipHistoryPartitions()
+	result.OwnershipHistoryPartitionsCreated = created
+	if err != nil {
+		return err
+	}
+
+	dropped, err := s.dropOwnershipHistoryPartitions(now)
+	result.OwnershipHistoryPartitionsDropped = dropped
+	if err != nil {
+		return err
+	}
+
+	trackedCollections, err := s.NFTTrackedCollectionQuery.ListTrackedCollections()
+	if err != nil {
+		return err
+	}
+
+	// Rows of every collection are deleted by one cutoff, so the longest TTL decides
+	freshTTL, staleTTL := s.Config.Server.GetOwnershipCacheTTLs()
+	ownershipTTL := newCollectionTTLs(trackedCollections, freshTTL, staleTTL).Max()
+	indexedContracts := indexedContractIDs(trackedCollections)
+	ownershipsDeleted, err := s.deleteInBatches(func(limit int) (int64, error) {
+		return s.NFTOwnershipMutator.DeleteNFTOwnershipsRefreshedBefore(now.Add(-ownershipTTL-gcConfig.GetOwnershipRetention()), indexedContracts, limit)
+	})
+	result.OwnershipsDeleted = ownershipsDeleted
+	if err != nil {
+		return err
+	}
+
+	collectionsDeleted, err := s.deleteInBatches(func(limit int) (int64, error) {
+		return s.NFTCollectionMutator.DeleteNFTCollectionsQueriedBefore(now.Add(-gcConfig.GetCollectionRetention()), limit)
+	})
+	result.CollectionsDeleted = collectionsDeleted
+	if err != nil {
+		return err
+	}
+
+	s.Logger.WithFields(map[string]interface{}{
+		"ownership_history_partitions_created": result.OwnershipHistoryPartitionsCreated,
+		"ownership_history_partitions_dropped": result.OwnershipHistoryPartitionsDropped,
+		"ownerships_deleted":                   result.OwnershipsDeleted,
+		"collections_deleted":                  result.CollectionsDeleted,
+	}).Info("gc completed")
+
+	return nil
+}
+
+// indexedContractIDs are the contracts whose ownerships are maintained by the worker and never expire
+func indexedContractIDs(trackedCollections []database.NFTTrackedCollection) []authgearweb3.ContractID {
+	contracts := make([]authgearweb3.ContractID, 0, len(trackedCollections))
+	for _, collection := range trackedCollections {
+		if collection.IsIndexed() {
+			contracts = append(contracts, *collection.ContractID())
+		}
+	}
+	return contracts
+}
+
+func (s *GCService) deleteInBatches(deleteBatch func(limit int) (int64, error)) (int64, error) {
+	batchSize := s.Config.GC.GetBatchSize()
+	var total int64
+	for {
+		deleted, err := deleteBatch(batchSize)
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+		if deleted < int64(batchSize) {
+			return total, nil
+		}
+
+		timer := time.NewTimer(s.Config.GC.GetBatchPause())
+		select {
+		case <-s.Context.Done():
+			timer.Stop()
+			return total, s.Context.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-server/pkg/util/log"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+type testClock struct {
+	Now time.Time
+}
+
+func (c *testClock) NowUTC() time.Time {
+	return c.Now.UTC()
+}
+
+func (c *testClock) NowMonotonic() time.Time {
+	return c.Now
+}
+
+type fakeGCLock struct {
+	Held bool
+}
+
+func (l *fakeGCLock) WithTryAdvisoryLock(key int64, fn func() error) (bool, error) {
+	if l.Held {
+		return false, nil
+	}
+	return true, fn()
+}
+
+type fakeOwnershipHistoryPartitions struct {
+	Partitions map[string]database.NFTOwnershipHistoryPartition
+	Created    []string
+	Dropped    []string
+}
+
+func (p *fakeOwnershipHistoryPartitions) ListNFTOwnershipHistoryPartitions() ([]database.NFTOwnershipHistoryPartition, error) {
+	partitions := make([]database.NFTOwnershipHistoryPartition, 0, len(p.Partitions))
+	for _, partition := range p.Partitions {
+		partitions = append(partitions, partition)
+	}
+	return partitions, nil
+}
+
+func (p *fakeOwnershipHistoryPartitions) CreateNFTOwnershipHistoryPartition(partition database.NFTOwnershipHistoryPartition) error {
+	p.Partitions[partition.Name] = partition
+	p.Created = append(p.Created, partition.Name)
+	return nil
+}
+
+func (p *fakeOwnershipHistoryPartitions) DropNFTOwnershipHistoryPartition(partition database.NFTOwnershipHistoryPartition) error {
+	delete(p.Partitions, partition.Name)
+	p.Dropped = append(p.Dropped, partition.Name)
+	return nil
+}
+
+type fakeGCDeleter struct {
+	Cutoff            time.Time
+	ExcludedContracts []authgearweb3.ContractID
+}
+
+func (d *fakeGCDeleter) DeleteNFTOwnershipsRefreshedBefore(t time.Time, excludedContracts []authgearweb3.ContractID, limit int) (int64, error) {
+	d.Cutoff = t
+	d.ExcludedContracts = excludedContracts
+	return 0, nil
+}
+
+func (d *fakeGCDeleter) DeleteNFTCollectionsQueriedBefore(t time.Time, limit int) (int64, error) {
+	return 0, nil
+}
+
+type fakeTrackedCollections []database.NFTTrackedCollection
+
+func (c fakeTrackedCollections) ListTrackedCollections() ([]database.NFTTrackedCollection, error) {
+	return c, nil
+}
+
+func newTestGCService(now time.Time, partitions *fakeOwnershipHistoryPartitions, lock *fakeGCLock) *GCService {
+	return &GCService{
+		Context: context.Background(),
+		Clock:   &testClock{Now: now},
+		Config: config.Config{
+			GC: config.GCConfig{OwnershipHistoryRetentionDays: 2, OwnershipHistoryPartitionsAheadDays: 1},
+		},
+		Logger:                              NewGCServiceLogger(log.NewFactory(log.LevelInfo)),
+		NFTOwnershipMutator:                 &fakeGCDeleter{},
+		NFTOwnershipHistoryPartitionQuery:   partitions,
+		NFTOwnershipHistoryPartitionMutator: partitions,
+		NFTCollectionMutator:                &fakeGCDeleter{},
+		NFTTrackedCollectionQuery:           fakeTrackedCollections{},
+		Lock:                                lock,
+	}
+}
+
+func TestGCServiceOwnershipHistoryPartitions(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	partitions := &fakeOwnershipHistoryPartitions{Partitions: map[string]database.NFTOwnershipHistoryPartition{}}
+	for _, day := range []time.Time{now.AddDate(0, 0, -3), now.AddDate(0, 0, -2), now.AddDate(0, 0, -1), now} {
+		partition := database.NewNFTOwnershipHistoryPartition(day)
+		partitions.Partitions[partition.Name] = partition
+	}
+
+	result, err := newTestGCService(now, partitions, &fakeGCLock{}).Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Today and 1 day ahead exist, days ending 2 days ago or earlier are dropped
+	if fmt.Sprint(partitions.Created) != "[eth_nft_ownership_history_p20261019]" {
+		t.Errorf("unexpected created partitions %v", partitions.Created)
+	}
+	if fmt.Sprint(partitions.Dropped) != "[eth_nft_ownership_history_p20261015]" {
+		t.Errorf("unexpected dropped partitions %v", partitions.Dropped)
+	}
+	if result.OwnershipHistoryPartitionsCreated != 1 || result.OwnershipHistoryPartitionsDropped != 1 {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestGCServiceSkippedWithoutLock(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	partitions := &fakeOwnershipHistoryPartitions{Partitions: map[string]database.NFTOwnershipHistoryPartition{}}
+	s := newTestGCService(now, partitions, &fakeGCLock{Held: true})
+
+	result, err := s.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Skipped || len(partitions.Created) != 0 {
+		t.Errorf("expected gc to be skipped, got %+v", result)
+	}
+
+	result, err = s.CreateOwnershipHistoryPartitions()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Skipped || len(partitions.Created) != 0 {
+		t.Errorf("expected partition creation to be skipped, got %+v", result)
+	}
+}
+
+func TestGCServiceKeepsTrackedOwnerships(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	partitions := &fakeOwnershipHistoryPartitions{Partitions: map[string]database.NFTOwnershipHistoryPartition{}}
+	s := newTestGCService(now, partitions, &fakeGCLock{})
+	ttlSeconds := 86400
+	s.NFTTrackedCollectionQuery = fakeTrackedCollections{
+		{Blockchain: "ethereum", Network: "1", ContractAddress: "0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D", Mode: database.TrackedCollectionModeIndexed},
+		{Blockchain: "ethereum", Network: "1", ContractAddress: "0xb47e3cd837dDF8e4c57F05d70Ab865de6e193BBB", Mode: database.TrackedCollectionModeCached, TTLSeconds: &ttlSeconds},
+	}
+	deleter := &fakeGCDeleter{}
+	s.NFTOwnershipMutator = deleter
+
+	_, err := s.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(deleter.ExcludedContracts) != 1 || deleter.ExcludedContracts[0].Address != "0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D" {
+		t.Errorf("expected ownerships of the indexed collection to be kept, got %v", deleter.ExcludedContracts)
+	}
+	// The cached collection has the longest TTL
+	if expected := now.Add(-24*time.Hour - s.Config.GC.GetOwnershipRetention()); !deleter.Cutoff.Equal(expected) {
+		t.Errorf("expected cutoff %v, got %v", expected, deleter.Cutoff)
+	}
+}
@@ -0,0 +1,482 @@
+package service
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
+	"github.com/authgear/authgear-nft-indexer/pkg/query"
+	"github.com/authgear/authgear-server/pkg/util/clock"
+	"github.com/authgear/authgear-server/pkg/util/log"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun/extra/bunbig"
+)
+
+type IndexerServiceNFTDataProvider interface {
+	GetBlockNumber(ctx context.Context, blockchain string, network string) (*big.Int, error)
+	GetBlock(ctx context.Context, blockchain string, network string, blockNumber *big.Int) (*nft.Block, error)
+	GetTransfers(ctx context.Context, query nft.TransferQuery) (*nft.Transfers, error)
+}
+
+type IndexerServiceNFTIndexerCheckpointQuery interface {
+	QueryCheckpoints(contracts []authgearweb3.ContractID) ([]database.NFTIndexerCheckpoint, error)
+}
+
+type IndexerServiceNFTIndexerMutator interface {
+	ResetTrackedNFTOwnerships(contract authgearweb3.ContractID) error
+	ApplyNFTOwnershipChanges(checkpoint database.NFTIndexerCheckpoint, ownerships []database.NFTOwnership, removed []database.NFTOwnership, undos []database.NFTOwnershipUndo) error
+	RollbackNFTOwnerships(checkpoint database.NFTIndexerCheckpoint) (int, error)
+	PruneReorgHistory(contract authgearweb3.ContractID, finalized *big.Int) error
+}
+
+type IndexerServiceNFTIndexerBlockQuery interface {
+	QueryBlocksBefore(contract authgearweb3.ContractID, blockNumber *big.Int) ([]database.NFTIndexerBlock, error)
+}
+
+type IndexerServiceNFTTrackedCollectionQuery interface {
+	ListTrackedCollections() ([]database.NFTTrackedCollection, error)
+}
+
+type IndexerServiceMetadataService interface {
+	GetContractMetadata(ctx context.Context, contracts []authgearweb3.ContractID) (*ContractMetadataResult, error)
+}
+
+type IndexerServiceLogger struct{ *log.Logger }
+
+func NewIndexerServiceLogger(lf *log.Factory) IndexerServiceLogger {
+	return IndexerServiceLogger{lf.New("indexer")}
+}
+
+// IndexProgress is the block range of a collection applied in one step
+type IndexProgress struct {
+	FromBlock *big.Int
+	ToBlock   *big.Int
+	Head      *big.Int
+	Transfers int
+	CaughtUp  bool
+	// RolledBackTo is the block the collection was rolled back to after a reorganization, nil if there was none
+	RolledBackTo *big.Int
+}
+
+type IndexerService struct {
+	Context                   context.Context
+	Clock                     clock.Clock
+	Config                    config.Config
+	Logger                    IndexerServiceLogger
+	NFTDataProvider           IndexerServiceNFTDataProvider
+	NFTOwnershipQuery         query.NFTOwnershipQuery
+	NFTIndexerCheckpointQuery IndexerServiceNFTIndexerCheckpointQuery
+	NFTIndexerBlockQuery      IndexerServiceNFTIndexerBlockQuery
+	NFTIndexerMutator         IndexerServiceNFTIndexerMutator
+	NFTTrackedCollectionQuery IndexerServiceNFTTrackedCollectionQuery
+	MetadataService           IndexerServiceMetadataService
+}
+
+// IndexAll indexes the tracked collections which are not paused chain by chain, a failing chain is logged and skipped.
+// caughtUp is false if some indexed collection of a healthy chain has not reached the head yet.
+func (s *IndexerService) IndexAll() (caughtUp bool, err error) {
+	collections, err := s.NFTTrackedCollectionQuery.ListTrackedCollections()
+	if err != nil {
+		return false, err
+	}
+
+	type chain struct {
+		blockchain string
+		network    string
+	}
+	chains := make([]chain, 0)
+	chainToCollections := make(map[chain][]database.NFTTrackedCollection)
+	for _, collection := range collections {
+		if collection.IsPaused() {
+			continue
+		}
+
+		ch := chain{blockchain: collection.Blockchain, network: collection.Network}
+		if _, ok := chainToCollections[ch]; !ok {
+			chains = append(chains, ch)
+		}
+		chainToCollections[ch] = append(chainToCollections[ch], collection)
+	}
+
+	caughtUp = true
+	for _, ch := range chains {
+		chainCaughtUp, err := s.indexChain(ch.blockchain, ch.network, chainToCollections[ch])
+		if err != nil {
+			if s.Context.Err() != nil {
+				return false, s.Context.Err()
+			}
+			s.Logger.WithError(err).WithFields(map[string]interface{}{
+				"blockchain": ch.blockchain,
+				"network":    ch.network,
+			}).Error("failed to index chain")
+			continue
+		}
+		caughtUp = caughtUp && chainCaughtUp
+	}
+
+	return caughtUp, nil
+}
+
+// indexChain refreshes expired metadata of the tracked collections of a network,
+// and applies the next block range of the indexed ones up to the latest block
+func (s *IndexerService) indexChain(blockchain string, network string, collections []database.NFTTrackedCollection) (caughtUp bool, err error) {
+	contracts := make([]authgearweb3.ContractID, 0, len(collections))
+	indexedContracts := make([]authgearweb3.ContractID, 0)
+	contractIDToStartBlock := make(map[string]int64)
+	for _, collection := range collections {
+		contractID := collection.ContractID()
+		contracts = append(contracts, *contractID)
+		if collection.IsIndexed() {
+			indexedContracts = append(indexedContracts, *contractID)
+			contractIDToStartBlock[contractID.String()] = collection.StartBlock
+		}
+	}
+
+	// Metadata is best effort, it must not hold back the ownerships
+	_, err = s.MetadataService.GetContractMetadata(s.Context, contracts)
+	if err != nil {
+		s.Logger.WithError(err).WithFields(map[string]interface{}{
+			"blockchain": blockchain,
+			"network":    network,
+		}).Warn("failed to refresh metadata of tracked collections")
+	}
+
+	if len(indexedContracts) == 0 {
+		return true, nil
+	}
+
+	latest, finalized, err := s.getHeads(blockchain, network)
+	if err != nil {
+		return false, err
+	}
+
+	checkpoints, err := s.NFTIndexerCheckpointQuery.QueryCheckpoints(indexedContracts)
+	if err != nil {
+		return false, err
+	}
+	contractIDToCheckpoint := make(map[string]database.NFTIndexerCheckpoint)
+	for _, checkpoint := range checkpoints {
+		contractIDToCheckpoint[checkpoint.ContractID().String()] = checkpoint
+	}
+
+	caughtUp = true
+	for _, contract := range indexedContracts {
+		var checkpoint *database.NFTIndexerCheckpoint
+		if c, ok := contractIDToCheckpoint[contract.String()]; ok {
+			checkpoint = &c
+		}
+
+		progress, err := s.indexCollection(contract, contractIDToStartBlock[contract.String()], checkpoint, latest, finalized)
+		if err != nil {
+			return false, err
+		}
+		caughtUp = caughtUp && progress.CaughtUp
+	}
+
+	return caughtUp, nil
+}
+
+// DetectStartBlock returns the block of the first transfer of the contract, which mints its first token,
+// or the confirmed head if it has no transfers yet
+func (s *IndexerService) DetectStartBlock(contract authgearweb3.ContractID) (*big.Int, error) {
+	head, err := s.getConfirmedHead(contract.Blockchain, contract.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.NFTDataProvider.GetTransfers(s.Context, nft.TransferQuery{
+		ContractIDs: []authgearweb3.ContractID{contract},
+		FromBlock:   big.NewInt(0),
+		ToBlock:     head,
+		MaxCount:    1,
+		Order:       nft.TransferOrderAscending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(page.Transfers) == 0 {
+		return head, nil
+	}
+	return page.Transfers[0].BlockNumber, nil
+}
+
+// Backfill indexes the collection up to the latest block, resuming from its checkpoint.
+// onProgress is called after each block range.
+func (s *IndexerService) Backfill(collection database.NFTTrackedCollection, onProgress func(progress IndexProgress)) error {
+	contract := *collection.ContractID()
+	latest, finalized, err := s.getHeads(contract.Blockchain, contract.Network)
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := s.Context.Err(); err != nil {
+			return err
+		}
+
+		checkpoints, err := s.NFTIndexerCheckpointQuery.QueryCheckpoints([]authgearweb3.ContractID{contract})
+		if err != nil {
+			return err
+		}
+		var checkpoint *database.NFTIndexerCheckpoint
+		if len(checkpoints) != 0 {
+			checkpoint = &checkpoints[0]
+		}
+
+		progress, err := s.indexCollection(contract, collection.StartBlock, checkpoint, latest, finalized)
+		if err != nil {
+			return err
+		}
+
+		onProgress(*progress)
+		if progress.CaughtUp {
+			return nil
+		}
+	}
+}
+
+// getConfirmedHead is the latest block with the configured confirmations of the chain
+func (s *IndexerService) getConfirmedHead(blockchain string, network string) (*big.Int, error) {
+	_, finalized, err := s.getHeads(blockchain, network)
+	return finalized, err
+}
+
+// getHeads returns the latest block of the chain, and the finalized one below which a reorganization is not expected
+func (s *IndexerService) getHeads(blockchain string, network string) (latest *big.Int, finalized *big.Int, err error) {
+	latest, err = s.NFTDataProvider.GetBlockNumber(s.Context, blockchain, network)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	finalized = new(big.Int).Set(latest)
+	if chain := s.Config.GetChainConfig(blockchain, network); chain != nil {
+		finalized.Sub(finalized, big.NewInt(int64(chain.Confirmations)))
+	}
+	if finalized.Sign() < 0 {
+		finalized.SetInt64(0)
+	}
+
+	return latest, finalized, nil
+}
+
+// findCommonAncestor returns the latest recorded block of the contract still on the canonical chain if the checkpoint block was orphaned.
+// The checkpoint itself is returned if it was not, and nil if no recorded block is canonical.
+func (s *IndexerService) findCommonAncestor(contract authgearweb3.ContractID, checkpoint database.NFTIndexerCheckpoint) (*database.NFTIndexerCheckpoint, error) {
+	block, err := s.NFTDataProvider.GetBlock(s.Context, contract.Blockchain, contract.Network, checkpoint.BlockNumber.ToMathBig())
+	if err != nil {
+		return nil, err
+	}
+	if block.Hash == checkpoint.BlockHash {
+		return &checkpoint, nil
+	}
+
+	blocks, err := s.NFTIndexerBlockQuery.QueryBlocksBefore(contract, checkpoint.BlockNumber.ToMathBig())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, recorded := range blocks {
+		canonical, err := s.NFTDataProvider.GetBlock(s.Context, contract.Blockchain, contract.Network, recorded.BlockNumber.ToMathBig())
+		if err != nil {
+			return nil, err
+		}
+		if canonical.Hash == recorded.BlockHash {
+			ancestor := checkpoint
+			ancestor.BlockNumber = recorded.BlockNumber
+			ancestor.BlockHash = recorded.BlockHash
+			return &ancestor, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// rollbackReorg rolls back the ownerships of the contract derived from blocks orphaned by a reorganization.
+// The checkpoint to continue from is returned, nil if the collection has to be indexed from the start block again.
+func (s *IndexerService) rollbackReorg(contract authgearweb3.ContractID, checkpoint database.NFTIndexerCheckpoint, progress *IndexProgress) (*database.NFTIndexerCheckpoint, error) {
+	// Checkpoints saved before reorganizations were detected have no hash to compare
+	if checkpoint.BlockHash == "" {
+		return &checkpoint, nil
+	}
+
+	ancestor, err := s.findCommonAncestor(contract, checkpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if ancestor == nil {
+		s.Logger.WithFields(map[string]interface{}{
+			"contract_id":  contract.String(),
+			"block_number": checkpoint.BlockNumber.String(),
+		}).Error("reorganization deeper than the recorded blocks, indexing from the start block again")
+
+		err = s.NFTIndexerMutator.ResetTrackedNFTOwnerships(contract)
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if ancestor.BlockNumber.ToMathBig().Cmp(checkpoint.BlockNumber.ToMathBig()) == 0 {
+		return ancestor, nil
+	}
+
+	restored, err := s.NFTIndexerMutator.RollbackNFTOwnerships(*ancestor)
+	if err != nil {
+		return nil, err
+	}
+	progress.RolledBackTo = ancestor.BlockNumber.ToMathBig()
+
+	s.Logger.WithFields(map[string]interface{}{
+		"contract_id": contract.String(),
+		"from_block":  checkpoint.BlockNumber.String(),
+		"to_block":    ancestor.BlockNumber.String(),
+		"ownerships":  restored,
+	}).Warn("rolled back reorganized blocks")
+
+	return ancestor, nil
+}
+
+func (s *IndexerService) indexCollection(contract authgearweb3.ContractID, startBlock int64, checkpoint *database.NFTIndexerCheckpoint, head *big.Int, finalized *big.Int) (*IndexProgress, error) {
+	progress := &IndexProgress{Head: head}
+	if checkpoint != nil {
+		var err error
+		checkpoint, err = s.rollbackReorg(contract, *checkpoint, progress)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var fromBlock *big.Int
+	if checkpoint == nil {
+		if big.NewInt(startBlock).Cmp(head) > 0 {
+			return &IndexProgress{Head: head, CaughtUp: true}, nil
+		}
+
+		err := s.NFTIndexerMutator.ResetTrackedNFTOwnerships(contract)
+		if err != nil {
+			return nil, err
+		}
+		fromBlock = big.NewInt(startBlock)
+	} else {
+		fromBlock = new(big.Int).Add(checkpoint.BlockNumber.ToMathBig(), big.NewInt(1))
+	}
+
+	toBlock := new(big.Int).Add(fromBlock, big.NewInt(s.Config.Worker.GetBlockRange()-1))
+	if toBlock.Cmp(head) >= 0 {
+		toBlock = new(big.Int).Set(head)
+	}
+
+	var blockHash string
+	var ownerships, removed []database.NFTOwnership
+	var undos []database.NFTOwnershipUndo
+	progress.FromBlock = fromBlock
+	if fromBlock.Cmp(toBlock) <= 0 {
+		// The hash is fetched before the transfers, so that transfers of a block orphaned in between are rolled back by the next step
+		block, err := s.NFTDataProvider.GetBlock(s.Context, contract.Blockchain, contract.Network, toBlock)
+		if err != nil {
+			return nil, err
+		}
+		blockHash = block.Hash
+
+		transfers, err := s.fetchTransfers(contract, fromBlock, toBlock)
+		if err != nil {
+			return nil, err
+		}
+		progress.Transfers = len(transfers)
+
+		ownerships, removed, undos, err = s.applyTransfers(contract, transfers, finalized)
+		if err != nil {
+			return nil, err
+		}
+
+		s.Logger.WithFields(map[string]interface{}{
+			"contract_id": contract.String(),
+			"from_block":  fromBlock.String(),
+			"to_block":    toBlock.String(),
+			"transfers":   len(transfers),
+		}).Debug("indexed block range")
+	} else {
+		// Nothing new, the checkpoint is saved again to record the worker is alive
+		toBlock = checkpoint.BlockNumber.ToMathBig()
+		blockHash = checkpoint.BlockHash
+	}
+
+	progress.ToBlock = toBlock
+	progress.CaughtUp = toBlock.Cmp(head) >= 0
+	newCheckpoint := database.NFTIndexerCheckpoint{
+		Blockchain:      contract.Blockchain,
+		Network:         contract.Network,
+		ContractAddress: contract.Address,
+		BlockNumber:     bunbig.FromMathBig(toBlock),
+		BlockHash:       blockHash,
+	}
+	if progress.CaughtUp {
+		now := s.Clock.NowUTC()
+		newCheckpoint.SyncedAt = &now
+	}
+
+	err := s.NFTIndexerMutator.ApplyNFTOwnershipChanges(newCheckpoint, ownerships, removed, undos)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.NFTIndexerMutator.PruneReorgHistory(contract, finalized)
+	if err != nil {
+		return nil, err
+	}
+
+	return progress, nil
+}
+
+// fetchTransfers fetches all transfers of the contract between fromBlock and toBlock inclusively in ascending order
+func (s *IndexerService) fetchTransfers(contract authgearweb3.ContractID, fromBlock *big.Int, toBlock *big.Int) ([]nft.Transfer, error) {
+	pageKey := ""
+	transfers := make([]nft.Transfer, 0)
+	for ok := true; ok; ok = pageKey != "" {
+		page, err := s.NFTDataProvider.GetTransfers(s.Context, nft.TransferQuery{
+			ContractIDs: []authgearweb3.ContractID{contract},
+			FromBlock:   fromBlock,
+			ToBlock:     toBlock,
+			PageKey:     pageKey,
+			MaxCount:    s.Config.Server.GetTransferPageSize(),
+			Order:       nft.TransferOrderAscending,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		transfers = append(transfers, page.Transfers...)
+		pageKey = page.PageKey
+	}
+
+	return transfers, nil
+}
+
+// applyTransfers applies the transfers to the stored ownerships, undos are recorded for blocks after finalized
+func (s *IndexerService) applyTransfers(contract authgearweb3.ContractID, transfers []nft.Transfer, finalized *big.Int) ([]database.NFTOwnership, []database.NFTOwnership, []database.NFTOwnershipUndo, error) {
+	if len(transfers) == 0 {
+		return nil, nil, nil, nil
+	}
+
+	tokenIDSet := make(map[string]struct{})
+	tokenIDs := make([]string, 0)
+	for _, transfer := range transfers {
+		if _, ok := tokenIDSet[transfer.TokenID]; !ok {
+			tokenIDSet[transfer.TokenID] = struct{}{}
+			tokenIDs = append(tokenIDs, transfer.TokenID)
+		}
+	}
+
+	ownershipQb := s.NFTOwnershipQuery.NewQueryBuilder()
+	ownershipQb = ownershipQb.WithContracts([]authgearweb3.ContractID{contract}).WithTokenIDs(tokenIDs)
+	stored, err := s.NFTOwnershipQuery.ExecuteQuery(ownershipQb)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return nft.ApplyTransfersWithUndo(contract, stored, transfers, finalized)
+}
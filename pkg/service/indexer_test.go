@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
+	"github.com/authgear/authgear-server/pkg/util/log"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun/extra/bunbig"
+)
+
+// fakeChain serves the canonical block hashes of a chain without any transfer
+type fakeChain struct {
+	Hashes map[int64]string
+}
+
+func (c *fakeChain) GetBlockNumber(ctx context.Context, blockchain string, network string) (*big.Int, error) {
+	return nil, fmt.Errorf("unexpected call")
+}
+
+func (c *fakeChain) GetBlock(ctx context.Context, blockchain string, network string, blockNumber *big.Int) (*nft.Block, error) {
+	return &nft.Block{Number: blockNumber, Hash: c.Hashes[blockNumber.Int64()]}, nil
+}
+
+func (c *fakeChain) GetTransfers(ctx context.Context, query nft.TransferQuery) (*nft.Transfers, error) {
+	return &nft.Transfers{}, nil
+}
+
+type fakeIndexerBlocks []database.NFTIndexerBlock
+
+func (b fakeIndexerBlocks) QueryBlocksBefore(contract authgearweb3.ContractID, blockNumber *big.Int) ([]database.NFTIndexerBlock, error) {
+	blocks := make([]database.NFTIndexerBlock, 0)
+	for _, block := range b {
+		if block.BlockNumber.ToMathBig().Cmp(blockNumber) < 0 {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks, nil
+}
+
+type fakeIndexerMutator struct {
+	Reset      bool
+	RolledBack *database.NFTIndexerCheckpoint
+	Applied    *database.NFTIndexerCheckpoint
+}
+
+func (m *fakeIndexerMutator) ResetTrackedNFTOwnerships(contract authgearweb3.ContractID) error {
+	m.Reset = true
+	return nil
+}
+
+func (m *fakeIndexerMutator) ApplyNFTOwnershipChanges(checkpoint database.NFTIndexerCheckpoint, ownerships []database.NFTOwnership, removed []database.NFTOwnership, undos []database.NFTOwnershipUndo) error {
+	m.Applied = &checkpoint
+	return nil
+}
+
+func (m *fakeIndexerMutator) RollbackNFTOwnerships(checkpoint database.NFTIndexerCheckpoint) (int, error) {
+	m.RolledBack = &checkpoint
+	return 1, nil
+}
+
+func (m *fakeIndexerMutator) PruneReorgHistory(contract authgearweb3.ContractID, finalized *big.Int) error {
+	return nil
+}
+
+func newTestIndexerService(chain *fakeChain, blocks fakeIndexerBlocks, mutator *fakeIndexerMutator) *IndexerService {
+	return &IndexerService{
+		Context:              context.Background(),
+		Clock:                &testClock{Now: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)},
+		Config:               config.Config{},
+		Logger:               NewIndexerServiceLogger(log.NewFactory(log.LevelInfo)),
+		NFTDataProvider:      chain,
+		NFTIndexerBlockQuery: blocks,
+		NFTIndexerMutator:    mutator,
+	}
+}
+
+func newTestIndexerBlock(contract authgearweb3.ContractID, number int64, hash string) database.NFTIndexerBlock {
+	return database.NFTIndexerBlock{
+		Blockchain:      contract.Blockchain,
+		Network:         contract.Network,
+		ContractAddress: contract.Address,
+		BlockNumber:     bunbig.FromMathBig(big.NewInt(number)),
+		BlockHash:       hash,
+	}
+}
+
+func TestIndexerServiceReorgRollback(t *testing.T) {
+	contract := authgearweb3.ContractID{Blockchain: "ethereum", Network: "1", Address: "0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D"}
+	checkpoint := database.NFTIndexerCheckpoint{
+		Blockchain:      contract.Blockchain,
+		Network:         contract.Network,
+		ContractAddress: contract.Address,
+		BlockNumber:     bunbig.FromMathBig(big.NewInt(110)),
+		BlockHash:       "0x110",
+	}
+	blocks := fakeIndexerBlocks{
+		newTestIndexerBlock(contract, 108, "0x108"),
+		newTestIndexerBlock(contract, 105, "0x105"),
+	}
+
+	t.Run("Orphaned blocks are rolled back to the latest canonical recorded block", func(t *testing.T) {
+		// Blocks after 105 were reorganized
+		chain := &fakeChain{Hashes: map[int64]string{105: "0x105", 108: "0x108b", 110: "0x110b", 120: "0x120b"}}
+		mutator := &fakeIndexerMutator{}
+
+		progress, err := newTestIndexerService(chain, blocks, mutator).indexCollection(contract, 0, &checkpoint, big.NewInt(120), big.NewInt(100))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if mutator.RolledBack == nil || mutator.RolledBack.BlockNumber.ToMathBig().Int64() != 105 || mutator.RolledBack.BlockHash != "0x105" {
+			t.Fatalf("expected a rollback to block 105, got %+v", mutator.RolledBack)
+		}
+		if mutator.Reset {
+			t.Errorf("expected the ownerships not to be reset")
+		}
+		if progress.RolledBackTo.Int64() != 105 || progress.FromBlock.Int64() != 106 || progress.ToBlock.Int64() != 120 || !progress.CaughtUp {
+			t.Errorf("unexpected progress %+v", progress)
+		}
+		if mutator.Applied == nil || mutator.Applied.BlockNumber.ToMathBig().Int64() != 120 || mutator.Applied.BlockHash != "0x120b" {
+			t.Errorf("expected the checkpoint to move to the canonical block 120, got %+v", mutator.Applied)
+		}
+	})
+
+	t.Run("Canonical checkpoint is not rolled back", func(t *testing.T) {
+		chain := &fakeChain{Hashes: map[int64]string{110: "0x110", 120: "0x120"}}
+		mutator := &fakeIndexerMutator{}
+
+		progress, err := newTestIndexerService(chain, blocks, mutator).indexCollection(contract, 0, &checkpoint, big.NewInt(120), big.NewInt(100))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if mutator.RolledBack != nil || mutator.Reset || progress.RolledBackTo != nil {
+			t.Errorf("expected no rollback, got %+v", mutator.RolledBack)
+		}
+		if progress.FromBlock.Int64() != 111 {
+			t.Errorf("expected to continue from block 111, got %v", progress.FromBlock)
+		}
+	})
+
+	t.Run("Reorganization deeper than the recorded blocks indexes from the start block", func(t *testing.T) {
+		chain := &fakeChain{Hashes: map[int64]string{105: "0x105b", 108: "0x108b", 110: "0x110b", 120: "0x120b"}}
+		mutator := &fakeIndexerMutator{}
+
+		progress, err := newTestIndexerService(chain, blocks, mutator).indexCollection(contract, 90, &checkpoint, big.NewInt(120), big.NewInt(100))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !mutator.Reset || mutator.RolledBack != nil {
+			t.Errorf("expected the ownerships to be reset without a rollback")
+		}
+		if progress.FromBlock.Int64() != 90 {
+			t.Errorf("expected to index from the start block 90, got %v", progress.FromBlock)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-server/pkg/util/clock"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+type JobQueueServiceNFTJobMutator interface {
+	EnqueueNFTJob(job database.NFTJob) (bool, error)
+}
+
+// RefreshOwnershipsJob refetches the ownerships of the owner in contracts from the provider
+type RefreshOwnershipsJob struct {
+	OwnerID     authgearweb3.ContractID   `json:"owner_id"`
+	ContractIDs []authgearweb3.ContractID `json:"contract_ids"`
+}
+
+// RefreshMetadataJob refetches the metadata of contracts from the provider
+type RefreshMetadataJob struct {
+	ContractIDs []authgearweb3.ContractID `json:"contract_ids"`
+}
+
+// ProbeCollectionJob probes the contract again, replacing the stored probe
+type ProbeCollectionJob struct {
+	ContractID authgearweb3.ContractID `json:"contract_id"`
+}
+
+// JobQueueService enqueues refresh work for the worker, so that callers do not block on the upstream
+type JobQueueService struct {
+	Clock         clock.Clock
+	Config        config.Config
+	NFTJobMutator JobQueueServiceNFTJobMutator
+}
+
+// EnqueueRefreshOwnerships is a no-op if the same refresh is pending or running
+func (s *JobQueueService) EnqueueRefreshOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID) error {
+	return s.enqueue(database.NFTJobTypeRefreshOwnerships, ownershipFetchKey(ownerID, contracts), RefreshOwnershipsJob{
+		OwnerID:     ownerID,
+		ContractIDs: contracts,
+	})
+}
+
+// EnqueueRefreshMetadata is a no-op if the same refresh is pending or running
+func (s *JobQueueService) EnqueueRefreshMetadata(contracts []authgearweb3.ContractID) error {
+	return s.enqueue(database.NFTJobTypeRefreshMetadata, collectionsFetchKey(contracts), RefreshMetadataJob{
+		ContractIDs: contracts,
+	})
+}
+
+// EnqueueProbeCollection is a no-op if the same probe is pending or running
+func (s *JobQueueService) EnqueueProbeCollection(contract authgearweb3.ContractID) error {
+	return s.enqueue(database.NFTJobTypeProbeCollection, "probe:"+contract.StripQuery().String(), ProbeCollectionJob{
+		ContractID: contract.StripQuery(),
+	})
+}
+
+func (s *JobQueueService) enqueue(jobType database.NFTJobType, dedupKey string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.NFTJobMutator.EnqueueNFTJob(database.NFTJob{
+		Type:        jobType,
+		Payload:     data,
+		DedupKey:    dedupKey,
+		Status:      database.NFTJobStatusPending,
+		MaxAttempts: s.Config.Jobs.GetMaxAttempts(),
+		RunAt:       s.Clock.NowUTC(),
+	})
+	return err
+}
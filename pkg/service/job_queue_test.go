@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-server/pkg/util/log"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+// fakeJobQueue keeps the jobs in memory with the claim and dedup rules of eth_nft_job
+type fakeJobQueue struct {
+	Clock *testClock
+	Jobs  []*database.NFTJob
+}
+
+func (q *fakeJobQueue) EnqueueNFTJob(job database.NFTJob) (bool, error) {
+	for _, j := range q.Jobs {
+		if j.DedupKey == job.DedupKey && j.Status != database.NFTJobStatusDead {
+			return false, nil
+		}
+	}
+	job.ID = fmt.Sprintf("job-%d", len(q.Jobs))
+	q.Jobs = append(q.Jobs, &job)
+	return true, nil
+}
+
+func (q *fakeJobQueue) ClaimNFTJobs(limit int, lockedBefore time.Time) ([]database.NFTJob, error) {
+	now := q.Clock.NowUTC()
+	claimed := make([]database.NFTJob, 0)
+	for _, j := range q.Jobs {
+		abandoned := j.Status == database.NFTJobStatusRunning && j.LockedAt.Before(lockedBefore)
+		if abandoned && j.Attempts >= j.MaxAttempts {
+			j.Status = database.NFTJobStatusDead
+			j.LockedAt = nil
+			j.LastError = "worker stopped while running the job"
+			continue
+		}
+
+		due := j.Status == database.NFTJobStatusPending && !j.RunAt.After(now)
+		if (due || abandoned) && len(claimed) < limit {
+			j.Status = database.NFTJobStatusRunning
+			j.Attempts++
+			j.LockedAt = &now
+			claimed = append(claimed, *j)
+		}
+	}
+	return claimed, nil
+}
+
+func (q *fakeJobQueue) CompleteNFTJob(id string) error {
+	for i, j := range q.Jobs {
+		if j.ID == id {
+			q.Jobs = append(q.Jobs[:i], q.Jobs[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("job not found: %v", id)
+}
+
+func (q *fakeJobQueue) RetryNFTJob(id string, runAt time.Time, lastError string) error {
+	j := q.find(id)
+	j.Status = database.NFTJobStatusPending
+	j.RunAt = runAt
+	j.LockedAt = nil
+	j.LastError = lastError
+	return nil
+}
+
+func (q *fakeJobQueue) DeadLetterNFTJob(id string, lastError string) error {
+	j := q.find(id)
+	j.Status = database.NFTJobStatusDead
+	j.LockedAt = nil
+	j.LastError = lastError
+	return nil
+}
+
+func (q *fakeJobQueue) find(id string) *database.NFTJob {
+	for _, j := range q.Jobs {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+type fakeJobMetadataService struct {
+	Err       error
+	Refreshed [][]authgearweb3.ContractID
+}
+
+func (s *fakeJobMetadataService) RefreshContractMetadata(ctx context.Context, contracts []authgearweb3.ContractID) error {
+	s.Refreshed = append(s.Refreshed, contracts)
+	return s.Err
+}
+
+func newTestJobQueue(now time.Time, jobsConfig config.JobsConfig, metadataService *fakeJobMetadataService) (*JobQueueService, *JobRunnerService, *fakeJobQueue) {
+	clock := &testClock{Now: now}
+	cfg := config.Config{Jobs: jobsConfig}
+	queue := &fakeJobQueue{Clock: clock}
+	queueService := &JobQueueService{
+		Clock:         clock,
+		Config:        cfg,
+		NFTJobMutator: queue,
+	}
+	runnerService := &JobRunnerService{
+		Context:         context.Background(),
+		Clock:           clock,
+		Config:          cfg,
+		Logger:          NewJobRunnerServiceLogger(log.NewFactory(log.LevelInfo)),
+		NFTJobMutator:   queue,
+		MetadataService: metadataService,
+	}
+	return queueService, runnerService, queue
+}
+
+var testJobContracts = []authgearweb3.ContractID{
+	{Blockchain: "ethereum", Network: "1", Address: "0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D"},
+}
+
+func TestJobQueueDedup(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	queueService, runnerService, queue := newTestJobQueue(now, config.JobsConfig{}, &fakeJobMetadataService{})
+
+	for i := 0; i < 2; i++ {
+		if err := queueService.EnqueueRefreshMetadata(testJobContracts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(queue.Jobs) != 1 {
+		t.Fatalf("expected the pending refresh to be enqueued once, got %d jobs", len(queue.Jobs))
+	}
+
+	// The same work is not enqueued while it is running either
+	queue.Jobs[0].Status = database.NFTJobStatusRunning
+	if err := queueService.EnqueueRefreshMetadata(testJobContracts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(queue.Jobs) != 1 {
+		t.Fatalf("expected the running refresh to be enqueued once, got %d jobs", len(queue.Jobs))
+	}
+
+	queue.Jobs[0].Status = database.NFTJobStatusPending
+	if _, err := runnerService.RunNext(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := queueService.EnqueueRefreshMetadata(testJobContracts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(queue.Jobs) != 1 || queue.Jobs[0].Status != database.NFTJobStatusPending {
+		t.Errorf("expected the refresh to be enqueued again after it has completed, got %+v", queue.Jobs)
+	}
+}
+
+func TestJobRunnerClaim(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Due job is run and completed", func(t *testing.T) {
+		metadataService := &fakeJobMetadataService{}
+		queueService, runnerService, queue := newTestJobQueue(now, config.JobsConfig{}, metadataService)
+		if err := queueService.EnqueueRefreshMetadata(testJobContracts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		ran, err := runnerService.RunNext()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !ran || len(metadataService.Refreshed) != 1 || metadataService.Refreshed[0][0].Address != testJobContracts[0].Address {
+			t.Errorf("expected the metadata to be refreshed, got %v", metadataService.Refreshed)
+		}
+		if len(queue.Jobs) != 0 {
+			t.Errorf("expected the completed job to be deleted, got %+v", queue.Jobs)
+		}
+
+		ran, err = runnerService.RunNext()
+		if err != nil || ran {
+			t.Errorf("expected no job to run, got %v, %v", ran, err)
+		}
+	})
+
+	t.Run("Job retried later is not claimed before it is due", func(t *testing.T) {
+		metadataService := &fakeJobMetadataService{Err: fmt.Errorf("upstream unavailable")}
+		queueService, runnerService, queue := newTestJobQueue(now, config.JobsConfig{BackoffSeconds: 10}, metadataService)
+		if err := queueService.EnqueueRefreshMetadata(testJobContracts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := runnerService.RunNext(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		job := queue.Jobs[0]
+		if job.Status != database.NFTJobStatusPending || job.Attempts != 1 || !job.RunAt.Equal(now.Add(10*time.Second)) || job.LastError != "upstream unavailable" {
+			t.Fatalf("expected the job to be retried in 10s, got %+v", job)
+		}
+
+		ran, err := runnerService.RunNext()
+		if err != nil || ran {
+			t.Errorf("expected the job not to be claimed before it is due, got %v, %v", ran, err)
+		}
+
+		runnerService.Clock.(*testClock).Now = now.Add(10 * time.Second)
+		ran, err = runnerService.RunNext()
+		if err != nil || !ran || job.Attempts != 2 {
+			t.Errorf("expected the job to be claimed again once due, got %v, %v, %+v", ran, err, job)
+		}
+	})
+
+	t.Run("Job of a stopped worker is claimed again after the lock timeout", func(t *testing.T) {
+		metadataService := &fakeJobMetadataService{}
+		queueService, runnerService, queue := newTestJobQueue(now, config.JobsConfig{LockTimeoutSeconds: 60}, metadataService)
+		if err := queueService.EnqueueRefreshMetadata(testJobContracts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Another worker claimed the job and stopped
+		if _, err := queue.ClaimNFTJobs(1, now.Add(-time.Minute)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		ran, err := runnerService.RunNext()
+		if err != nil || ran {
+			t.Errorf("expected the locked job not to be claimed, got %v, %v", ran, err)
+		}
+
+		runnerService.Clock.(*testClock).Now = now.Add(61 * time.Second)
+		ran, err = runnerService.RunNext()
+		if err != nil || !ran || len(metadataService.Refreshed) != 1 || len(queue.Jobs) != 0 {
+			t.Errorf("expected the abandoned job to be run, got %v, %v, %+v", ran, err, queue.Jobs)
+		}
+	})
+}
+
+func TestJobRunnerDeadLetter(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Job failing its last attempt is dead-lettered", func(t *testing.T) {
+		metadataService := &fakeJobMetadataService{Err: fmt.Errorf("upstream unavailable")}
+		queueService, runnerService, queue := newTestJobQueue(now, config.JobsConfig{MaxAttempts: 2, BackoffSeconds: 10}, metadataService)
+		if err := queueService.EnqueueRefreshMetadata(testJobContracts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			runnerService.Clock.(*testClock).Now = now.Add(time.Duration(i) * time.Minute)
+			if _, err := runnerService.RunNext(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		job := queue.Jobs[0]
+		if job.Status != database.NFTJobStatusDead || job.Attempts != 2 || job.LastError != "upstream unavailable" {
+			t.Fatalf("expected the job to be dead-lettered, got %+v", job)
+		}
+
+		runnerService.Clock.(*testClock).Now = now.Add(time.Hour)
+		ran, err := runnerService.RunNext()
+		if err != nil || ran || len(metadataService.Refreshed) != 2 {
+			t.Errorf("expected the dead job never to run again, got %v, %v", ran, err)
+		}
+
+		// A dead job does not block the same work from being enqueued again
+		if err := queueService.EnqueueRefreshMetadata(testJobContracts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(queue.Jobs) != 2 {
+			t.Errorf("expected the refresh to be enqueued again, got %+v", queue.Jobs)
+		}
+	})
+
+	t.Run("Abandoned job without attempts left is dead-lettered instead of being claimed", func(t *testing.T) {
+		metadataService := &fakeJobMetadataService{}
+		queueService, runnerService, queue := newTestJobQueue(now, config.JobsConfig{MaxAttempts: 1, LockTimeoutSeconds: 60}, metadataService)
+		if err := queueService.EnqueueRefreshMetadata(testJobContracts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := queue.ClaimNFTJobs(1, now.Add(-time.Minute)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		runnerService.Clock.(*testClock).Now = now.Add(61 * time.Second)
+		ran, err := runnerService.RunNext()
+		if err != nil || ran || len(metadataService.Refreshed) != 0 {
+			t.Errorf("expected the abandoned job not to run, got %v, %v", ran, err)
+		}
+		if job := queue.Jobs[0]; job.Status != database.NFTJobStatusDead || job.LastError != "worker stopped while running the job" {
+			t.Errorf("expected the job to be dead-lettered, got %+v", job)
+		}
+	})
+}
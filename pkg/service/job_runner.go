@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-server/pkg/util/clock"
+	"github.com/authgear/authgear-server/pkg/util/log"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+type JobRunnerServiceNFTJobMutator interface {
+	ClaimNFTJobs(limit int, lockedBefore time.Time) ([]database.NFTJob, error)
+	CompleteNFTJob(id string) error
+	RetryNFTJob(id string, runAt time.Time, lastError string) error
+	DeadLetterNFTJob(id string, lastError string) error
+}
+
+type JobRunnerServiceOwnershipService interface {
+	FetchAndInsertNFTOwnerships(ctx context.Context, ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID) (*OwnershipsResult, error)
+}
+
+type JobRunnerServiceMetadataService interface {
+	RefreshContractMetadata(ctx context.Context, contracts []authgearweb3.ContractID) error
+}
+
+type JobRunnerServiceProbeService interface {
+	RefreshCollectionProbe(ctx context.Context, contractID authgearweb3.ContractID) (bool, error)
+}
+
+type JobRunnerServiceLogger struct{ *log.Logger }
+
+func NewJobRunnerServiceLogger(lf *log.Factory) JobRunnerServiceLogger {
+	return JobRunnerServiceLogger{lf.New("job-runner")}
+}
+
+// JobRunnerService runs the jobs in eth_nft_job, failed jobs are retried with backoff until they run out of attempts
+type JobRunnerService struct {
+	Context          context.Context
+	Clock            clock.Clock
+	Config           config.Config
+	Logger           JobRunnerServiceLogger
+	NFTJobMutator    JobRunnerServiceNFTJobMutator
+	OwnershipService JobRunnerServiceOwnershipService
+	MetadataService  JobRunnerServiceMetadataService
+	ProbeService     JobRunnerServiceProbeService
+}
+
+// RunNext claims and runs one job, ran is false if no job is due
+func (s *JobRunnerService) RunNext() (ran bool, err error) {
+	lockTimeout := s.Config.Jobs.GetLockTimeout()
+	jobs, err := s.NFTJobMutator.ClaimNFTJobs(1, s.Clock.NowUTC().Add(-lockTimeout))
+	if err != nil {
+		return false, err
+	}
+	if len(jobs) == 0 {
+		return false, nil
+	}
+	job := jobs[0]
+
+	// The job must not outlive its lock, or another worker would run it concurrently
+	ctx, cancel := context.WithTimeout(s.Context, lockTimeout)
+	defer cancel()
+
+	runErr := s.run(ctx, job)
+	if runErr == nil {
+		return true, s.NFTJobMutator.CompleteNFTJob(job.ID)
+	}
+
+	// A job interrupted by shutdown is claimed again once its lock times out
+	if s.Context.Err() != nil {
+		return true, s.Context.Err()
+	}
+
+	logger := s.Logger.WithError(runErr).WithFields(map[string]interface{}{
+		"job_id":   job.ID,
+		"job_type": job.Type,
+		"attempts": job.Attempts,
+	})
+	if job.IsLastAttempt() {
+		logger.Error("job ran out of attempts")
+		return true, s.NFTJobMutator.DeadLetterNFTJob(job.ID, runErr.Error())
+	}
+
+	runAt := s.Clock.NowUTC().Add(s.Config.Jobs.GetBackoff(job.Attempts))
+	logger.WithField("run_at", runAt).Warn("job failed, retrying")
+	return true, s.NFTJobMutator.RetryNFTJob(job.ID, runAt, runErr.Error())
+}
+
+func (s *JobRunnerService) run(ctx context.Context, job database.NFTJob) error {
+	switch job.Type {
+	case database.NFTJobTypeRefreshOwnerships:
+		var payload RefreshOwnershipsJob
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return err
+		}
+		_, err := s.OwnershipService.FetchAndInsertNFTOwnerships(ctx, payload.OwnerID, payload.ContractIDs)
+		return err
+	case database.NFTJobTypeRefreshMetadata:
+		var payload RefreshMetadataJob
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return err
+		}
+		return s.MetadataService.RefreshContractMetadata(ctx, payload.ContractIDs)
+	case database.NFTJobTypeProbeCollection:
+		var payload ProbeCollectionJob
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return err
+		}
+		_, err := s.ProbeService.RefreshCollectionProbe(ctx, payload.ContractID)
+		return err
+	default:
+		return fmt.Errorf("unknown job type: %v", job.Type)
+	}
+}
@@ -1,98 +1,260 @@
 package service
 
 import (
+	"context"
 	"math/big"
+	"strings"
 	"time"
 
 	"github.com/authgear/authgear-nft-indexer/pkg/config"
-	"github.com/authgear/authgear-nft-indexer/pkg/model/alchemy"
 	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
 	"github.com/authgear/authgear-nft-indexer/pkg/query"
+	"github.com/authgear/authgear-nft-indexer/pkg/web3"
 	"github.com/authgear/authgear-server/pkg/api/apierrors"
 	"github.com/authgear/authgear-server/pkg/util/clock"
 	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
 )
 
-type MetadataServiceAlchemyAPI interface {
-	GetContractMetadata(contractID authgearweb3.ContractID) (*alchemy.ContractMetadataResponse, error)
+type MetadataServiceNFTDataProvider interface {
+	GetContractsMetadata(ctx context.Context, contractIDs []authgearweb3.ContractID) ([]nft.ContractMetadata, error)
 }
 
 type MetadataServiceNFTCollectionMutator interface {
 	InsertNFTCollection(contractID authgearweb3.ContractID, contractName string, tokenType database.NFTCollectionType, totalSupply *big.Int) (*database.NFTCollection, error)
+	TouchNFTCollections(ids []string, queriedAt time.Time) error
+}
+
+type MetadataServiceNFTTrackedCollectionQuery interface {
+	QueryTrackedCollections(contracts []authgearweb3.ContractID) ([]database.NFTTrackedCollection, error)
+}
+
+type MetadataServiceJobQueue interface {
+	EnqueueRefreshMetadata(contracts []authgearweb3.ContractID) error
+}
+
+type ContractMetadataResult struct {
+	Collections []database.NFTCollection
+	// Stale is true if some collections are served from storage past their fresh TTL,
+	// while they are refreshed in the background or because the upstream is unavailable
+	Stale bool
+	// FetchedAt is when the least recently fetched collection was fetched from the upstream
+	FetchedAt *time.Time
 }
 
 type MetadataService struct {
 	Clock                clock.Clock
 	Config               config.Config
-	AlchemyAPI           MetadataServiceAlchemyAPI
+	NFTDataProvider      MetadataServiceNFTDataProvider
 	NFTCollectionQuery   query.NFTCollectionQuery
 	NFTCollectionMutator MetadataServiceNFTCollectionMutator
+	FetchCoalescer       *FetchCoalescer
+
+	NFTTrackedCollectionQuery MetadataServiceNFTTrackedCollectionQuery
+	JobQueue                  MetadataServiceJobQueue
 }
 
-func (m *MetadataService) GetContractMetadata(contracts []authgearweb3.ContractID) ([]database.NFTCollection, error) {
-	minimumFreshness := m.Clock.NowUTC()
-	minimumFreshness = minimumFreshness.Add(-time.Duration(m.Config.Server.CollectionCacheTTL) * time.Second)
+// fetchAndInsertNFTCollections resolves contracts of the same network in one provider call,
+// it is coalesced so that concurrent requests of the same contracts share one upstream call and one write
+func (m *MetadataService) fetchAndInsertNFTCollections(ctx context.Context, contracts []authgearweb3.ContractID) ([]database.NFTCollection, error) {
+	v, err := m.FetchCoalescer.Do(ctx, collectionsFetchKey(contracts), func(ctx context.Context) (interface{}, error) {
+		contractMetadatas, err := m.NFTDataProvider.GetContractsMetadata(ctx, contracts)
+		if err != nil {
+			return nil, err
+		}
 
+		addressToMetadata := make(map[string]nft.ContractMetadata)
+		for _, contractMetadata := range contractMetadatas {
+			addressToMetadata[strings.ToLower(contractMetadata.Address.String())] = contractMetadata
+		}
+
+		collections := make([]database.NFTCollection, 0, len(contracts))
+		for _, contract := range contracts {
+			contractMetadata, ok := addressToMetadata[strings.ToLower(contract.Address.String())]
+			if !ok || contractMetadata.Name == "" {
+				return nil, ErrBadNFTCollection.NewWithDetails("missing contract metadata", apierrors.Details{"contract": contract.String()})
+			}
+
+			tokenType, err := database.ParseNFTCollectionType(contractMetadata.TokenType)
+			if err != nil {
+				return nil, ErrBadNFTCollection.NewWithDetails("unable to parse token type", apierrors.Details{"tokenType": contractMetadata.TokenType})
+			}
+
+			totalSupply := new(big.Int)
+			if contractMetadata.TotalSupply != "" {
+				if _, ok := totalSupply.SetString(contractMetadata.TotalSupply, 10); !ok {
+					return nil, ErrBadNFTCollection.NewWithDetails("failed to parse total supply", apierrors.Details{"totalSupply": contractMetadata.TotalSupply})
+				}
+			}
+
+			collection, err := m.NFTCollectionMutator.InsertNFTCollection(
+				contract,
+				contractMetadata.Name,
+				tokenType,
+				totalSupply,
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			collections = append(collections, *collection)
+		}
+
+		return collections, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]database.NFTCollection), nil
+}
+
+// getCachedCollections returns the stored collections regardless of freshness,
+// upstreamErr is returned if any of them has not been stored yet
+func (m *MetadataService) getCachedCollections(contracts []authgearweb3.ContractID, upstreamErr error) ([]database.NFTCollection, error) {
 	qb := m.NFTCollectionQuery.NewQueryBuilder()
-	qb = qb.WithContracts(contracts).WithMinimumFreshness(minimumFreshness)
+	qb = qb.WithContracts(contracts)
 	collections, err := m.NFTCollectionQuery.ExecuteQuery(qb)
 	if err != nil {
 		return nil, err
 	}
 
-	contractIDToCollectionMap := make(map[string]*database.NFTCollection)
-	for i, collection := range collections {
-		contractID := collection.ContractID().String()
-
-		contractIDToCollectionMap[contractID] = &collections[i]
+	if len(collections) != len(contracts) {
+		return nil, upstreamErr
 	}
+	return collections, nil
+}
 
-	res := make([]database.NFTCollection, 0, len(contracts))
+func (m *MetadataService) GetContractMetadata(ctx context.Context, contracts []authgearweb3.ContractID) (*ContractMetadataResult, error) {
 	for _, contract := range contracts {
-		strippedContractID := contract.StripQuery().String()
-		// If exists, append to result, otherwise get from alchemy
-		collection := contractIDToCollectionMap[strippedContractID]
-		if collection != nil {
-			res = append(res, *collection)
+		err := web3.CheckNetwork(m.Config, contract.Blockchain, contract.Network)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Tracked collections may have their own TTL
+	trackedCollections, err := m.NFTTrackedCollectionQuery.QueryTrackedCollections(contracts)
+	if err != nil {
+		return nil, err
+	}
+	freshTTL, staleTTL := m.Config.Server.GetCollectionCacheTTLs()
+	ttls := newCollectionTTLs(trackedCollections, freshTTL, staleTTL)
+
+	now := m.Clock.NowUTC()
+	qb := m.NFTCollectionQuery.NewQueryBuilder()
+	qb = qb.WithContracts(contracts).WithMinimumFreshness(now.Add(-ttls.Max()))
+	collections, err := m.NFTCollectionQuery.ExecuteQuery(qb)
+	if err != nil {
+		return nil, err
+	}
+
+	contractIDToCollectionMap := make(map[string]*database.NFTCollection)
+	revalidate := make([]authgearweb3.ContractID, 0)
+	for i, collection := range collections {
+		contractID := collection.ContractID()
+		if !collection.UpdatedAt.After(now.Add(-ttls.GetStale(*contractID))) {
 			continue
 		}
+		// Past the fresh TTL it is served as is and refreshed in the background
+		if !collection.UpdatedAt.After(now.Add(-ttls.Get(*contractID))) {
+			revalidate = append(revalidate, *contractID)
+		}
+
+		contractIDToCollectionMap[contractID.String()] = &collections[i]
+	}
 
-		contractMetadata, err := m.AlchemyAPI.GetContractMetadata(contract)
+	stale := len(revalidate) > 0
+	if stale {
+		err = m.JobQueue.EnqueueRefreshMetadata(revalidate)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		tokenType, err := database.ParseNFTCollectionType(contractMetadata.ContractMetadata.TokenType)
-		if err != nil {
-			return nil, ErrBadNFTCollection.NewWithDetails("unable to parse token type", apierrors.Details{"tokenType": contractMetadata.ContractMetadata.TokenType})
+	// Group cache misses by network, so that each network is resolved in one batch
+	networks := make([]string, 0)
+	networkToMisses := make(map[string][]authgearweb3.ContractID)
+	for _, contract := range contracts {
+		strippedContract := contract.StripQuery()
+		strippedContractID := strippedContract.String()
+		if _, ok := contractIDToCollectionMap[strippedContractID]; ok {
+			continue
 		}
+		// Mark the contract as seen, it is filled in after fetching
+		contractIDToCollectionMap[strippedContractID] = nil
 
-		if contractMetadata.ContractMetadata.Name == "" {
-			return nil, ErrBadNFTCollection.New("missing contract metadata")
+		network := contract.Blockchain + "/" + contract.Network
+		if _, ok := networkToMisses[network]; !ok {
+			networks = append(networks, network)
 		}
+		networkToMisses[network] = append(networkToMisses[network], strippedContract)
+	}
 
-		totalSupply := new(big.Int)
-		if contractMetadata.ContractMetadata.TotalSupply != "" {
-			if _, ok := totalSupply.SetString(contractMetadata.ContractMetadata.TotalSupply, 10); !ok {
-				return nil, ErrBadNFTCollection.NewWithDetails("failed to parse total supply", apierrors.Details{"totalSupply": contractMetadata.ContractMetadata.TotalSupply})
+	for _, network := range networks {
+		misses := networkToMisses[network]
+
+		newCollections, err := m.fetchAndInsertNFTCollections(ctx, misses)
+		if web3.IsUpstreamUnavailable(err) {
+			newCollections, err = m.getCachedCollections(misses, err)
+			if err == nil {
+				stale = true
+				// The worker refreshes them once the upstream is back
+				err = m.JobQueue.EnqueueRefreshMetadata(misses)
 			}
 		}
+		if err != nil {
+			return nil, wrapContextError(ctx, err)
+		}
 
-		newCollection, err := m.NFTCollectionMutator.InsertNFTCollection(
-			contract,
-			contractMetadata.ContractMetadata.Name,
-			tokenType,
-			totalSupply,
-		)
+		for i, collection := range newCollections {
+			contractIDToCollectionMap[collection.ContractID().String()] = &newCollections[i]
+		}
+	}
 
-		if err != nil {
-			return nil, err
+	res := make([]database.NFTCollection, 0, len(contracts))
+	ids := make([]string, 0, len(contracts))
+	var fetchedAt *time.Time
+	for _, contract := range contracts {
+		collection := contractIDToCollectionMap[contract.StripQuery().String()]
+		if collection != nil {
+			res = append(res, *collection)
+			ids = append(ids, collection.ID)
+			fetchedAt = earliestFetchedAt(fetchedAt, collection.UpdatedAt)
 		}
+	}
 
-		res = append(res, *newCollection)
+	// Collections not queried for a while are garbage collected
+	err = m.NFTCollectionMutator.TouchNFTCollections(ids, m.Clock.NowUTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContractMetadataResult{
+		Collections: res,
+		Stale:       stale,
+		FetchedAt:   fetchedAt,
+	}, nil
+}
 
+// RefreshContractMetadata refetches the metadata of contracts regardless of their TTL
+func (m *MetadataService) RefreshContractMetadata(ctx context.Context, contracts []authgearweb3.ContractID) error {
+	networks := make([]string, 0)
+	networkToContracts := make(map[string][]authgearweb3.ContractID)
+	for _, contract := range contracts {
+		network := contract.Blockchain + "/" + contract.Network
+		if _, ok := networkToContracts[network]; !ok {
+			networks = append(networks, network)
+		}
+		networkToContracts[network] = append(networkToContracts[network], contract.StripQuery())
 	}
 
-	return res, nil
+	for _, network := range networks {
+		_, err := m.fetchAndInsertNFTCollections(ctx, networkToContracts[network])
+		if err != nil {
+			return err
+		}
+	}
 
+	return nil
 }
@@ -1,51 +1,129 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"math/big"
 	"net/url"
 	"time"
 
 	"github.com/authgear/authgear-nft-indexer/pkg/config"
-	"github.com/authgear/authgear-nft-indexer/pkg/model/alchemy"
 	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
-	"github.com/authgear/authgear-nft-indexer/pkg/query"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
 	"github.com/authgear/authgear-nft-indexer/pkg/web3"
 	"github.com/authgear/authgear-server/pkg/util/clock"
+	"github.com/authgear/authgear-server/pkg/util/log"
 	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
 )
 
 type OwnershipServiceNFTOwnershipMutator interface {
-	InsertNFTOwnerships(ownerships []database.NFTOwnership) error
+	UpsertNFTOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID, ownerships []database.NFTOwnership) error
 }
 
-type OwnershipServiceAlchemyAPI interface {
-	GetOwnerNFTs(ownerAddress string, contractIDs []authgearweb3.ContractID, pageKey string) (*alchemy.GetNFTsResponse, error)
-	GetAssetTransfers(params web3.GetAssetTransferParams) (*alchemy.AssetTransferResult, error)
+type OwnershipServiceNFTOwnershipQuery interface {
+	QueryOwnerOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID, minimumFreshness *time.Time) ([]database.NFTOwnership, error)
+}
+
+type OwnershipServiceNFTIndexerCheckpointQuery interface {
+	QueryCheckpoints(contracts []authgearweb3.ContractID) ([]database.NFTIndexerCheckpoint, error)
+}
+
+type OwnershipServiceNFTTrackedCollectionQuery interface {
+	QueryTrackedCollections(contracts []authgearweb3.ContractID) ([]database.NFTTrackedCollection, error)
+}
+
+type OwnershipServiceNFTOwnershipUndoQuery interface {
+	QueryUndosAfter(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID, blockNumber *big.Int) ([]database.NFTOwnershipUndo, error)
+}
+
+type OwnershipServiceNFTDataProvider interface {
+	GetOwnedTokens(ctx context.Context, ownerAddress authgearweb3.EIP55, contractIDs []authgearweb3.ContractID, pageKey string) (*nft.OwnedTokens, error)
+	GetTransfers(ctx context.Context, query nft.TransferQuery) (*nft.Transfers, error)
+	GetBlockNumber(ctx context.Context, blockchain string, network string) (*big.Int, error)
+}
+
+type OwnershipServiceJobQueue interface {
+	EnqueueRefreshOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID) error
+}
+
+type TruncatedReason string
+
+const (
+	TruncatedReasonTimeout           TruncatedReason = "timeout"
+	TruncatedReasonNFTPageLimit      TruncatedReason = "nft_page_limit"
+	TruncatedReasonTransferPageLimit TruncatedReason = "transfer_page_limit"
+)
+
+type OwnershipsResult struct {
+	Ownerships []database.NFTOwnership
+	// Stale is true if some ownerships are served from storage past their fresh TTL, while they are refreshed in the background,
+	// because the upstream is unavailable or because the worker has fallen behind
+	Stale bool
+	// FetchedAt is when the least recently fetched ownerships were fetched from the upstream, or confirmed by the worker
+	FetchedAt *time.Time
+	// Truncated is true if not all pages could be fetched
+	Truncated       bool
+	TruncatedReason TruncatedReason
+}
+
+type OwnershipServiceLogger struct{ *log.Logger }
+
+func NewOwnershipServiceLogger(lf *log.Factory) OwnershipServiceLogger {
+	return OwnershipServiceLogger{lf.New("ownership-service")}
 }
 
 type OwnershipService struct {
 	Clock               clock.Clock
+	Logger              OwnershipServiceLogger
 	Config              config.Config
-	AlchemyAPI          OwnershipServiceAlchemyAPI
-	NFTCollectionQuery  query.NFTCollectionQuery
-	NFTOwnershipQuery   query.NFTOwnershipQuery
+	NFTDataProvider     OwnershipServiceNFTDataProvider
+	NFTOwnershipQuery   OwnershipServiceNFTOwnershipQuery
 	NFTOwnershipMutator OwnershipServiceNFTOwnershipMutator
+	FetchCoalescer      *FetchCoalescer
+
+	NFTIndexerCheckpointQuery OwnershipServiceNFTIndexerCheckpointQuery
+	NFTTrackedCollectionQuery OwnershipServiceNFTTrackedCollectionQuery
+	NFTOwnershipUndoQuery     OwnershipServiceNFTOwnershipUndoQuery
+	JobQueue                  OwnershipServiceJobQueue
 }
 
-func (h *OwnershipService) FetchAndInsertNFTOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID) ([]database.NFTOwnership, error) {
+// FetchAndInsertNFTOwnerships fetches ownerships page by page within the time budget of ctx and the page limits,
+// if either runs out before the last page the result is truncated and not stored
+func (h *OwnershipService) FetchAndInsertNFTOwnerships(ctx context.Context, ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID) (*OwnershipsResult, error) {
+	trackedCollections, err := h.queryTrackedCollections(contracts)
+	if err != nil {
+		return nil, err
+	}
+
 	pageKey := ""
 	nftFetchCount := 0
-	ownedNFTs := make([]alchemy.OwnedNFT, 0)
+	var truncatedReason TruncatedReason
+	ownedTokens := make([]nft.OwnedToken, 0)
 	contractIDsToEnquire := make([]authgearweb3.ContractID, 0)
 
 	// Fetch user nfts until no extra page or has reached the page limit
-	for ok := true; ok; ok = pageKey != "" && nftFetchCount <= h.Config.Server.MaxNFTPages {
-		nfts, err := h.AlchemyAPI.GetOwnerNFTs(ownerID.Address.String(), contracts, pageKey)
+	for ok := true; ok; ok = pageKey != "" {
+		if nftFetchCount >= h.Config.Server.GetMaxNFTPages() {
+			truncatedReason = TruncatedReasonNFTPageLimit
+			break
+		}
+
+		pageCtx, cancel := pageContext(ctx)
+		tokens, err := h.NFTDataProvider.GetOwnedTokens(pageCtx, ownerID.Address, contracts, pageKey)
+		// Checked before cancel, which sets Err of pageCtx on every path
+		deadlineHit := errors.Is(pageCtx.Err(), context.DeadlineExceeded)
+		cancel()
 		if err != nil {
-			return nil, err
+			// Only the page budget running out truncates, upstream errors and cancelled requests still fail
+			if nftFetchCount > 0 && deadlineHit && ctx.Err() == nil {
+				truncatedReason = TruncatedReasonTimeout
+				break
+			}
+			return nil, wrapContextError(pageCtx, err)
 		}
 
-		for _, ownedNFT := range nfts.OwnedNFTs {
-			contractID, err := authgearweb3.NewContractID(ownerID.Blockchain, ownerID.Network, ownedNFT.Contract.Address, url.Values{})
+		for _, ownedToken := range tokens.Tokens {
+			contractID, err := authgearweb3.NewContractID(ownerID.Blockchain, ownerID.Network, ownedToken.ContractAddress.String(), url.Values{})
 			if err != nil {
 				return nil, err
 			}
@@ -53,63 +131,427 @@ func (h *OwnershipService) FetchAndInsertNFTOwnerships(ownerID authgearweb3.Cont
 			contractIDsToEnquire = append(contractIDsToEnquire, *contractID)
 		}
 
-		if nfts.PageKey != nil {
-			pageKey = *nfts.PageKey
-		}
+		pageKey = tokens.PageKey
 
-		ownedNFTs = append(ownedNFTs, nfts.OwnedNFTs...)
+		ownedTokens = append(ownedTokens, tokens.Tokens...)
 		nftFetchCount++
 	}
 
-	nftTransfers := make([]alchemy.TokenTransfer, 0)
-	if len(ownedNFTs) != 0 {
-		pageKey = ""
-		transferFetchCount := 0
-		// Fetch transfers until no extra page or has reached the page limit
-		for ok := true; ok; ok = pageKey != "" && transferFetchCount <= 5 {
-			transfers, err := h.AlchemyAPI.GetAssetTransfers(web3.GetAssetTransferParams{
-				ContractIDs: contractIDsToEnquire,
-				ToAddress:   ownerID.Address,
-				FromBlock:   "0x0",
-				ToBlock:     "latest",
-				PageKey:     pageKey,
-				MaxCount:    1000,
-				Order:       "desc",
-			})
+	var nftTransfers []nft.Transfer
+	var storedOwnerships []database.NFTOwnership
+	var fromBlock *big.Int
+	var transfersTruncatedReason TruncatedReason
+	if len(ownedTokens) != 0 {
+		// Rows of an indexed collection the worker is still catching up with are incomplete
+		if !trackedCollections.HasIndexed(contracts) {
+			fromBlock, storedOwnerships, err = h.getStoredOwnerships(ownerID, contracts)
 			if err != nil {
 				return nil, err
 			}
-			nftTransfers = append(nftTransfers, transfers.Transfers...)
-			transferFetchCount++
 		}
 
+		nftTransfers, transfersTruncatedReason, err = h.fetchOwnerTransfers(ctx, ownerID, contractIDsToEnquire, fromBlock)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := nft.MakeNFTOwnerships(ownerID, contracts, nftTransfers, ownedTokens, storedOwnerships)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stored state can miss tokens, e.g. when it was written by an older version
+	if fromBlock != nil && transfersTruncatedReason == "" && len(result.Unresolved) > 0 {
+		fromBlock = nil
+		nftTransfers, transfersTruncatedReason, err = h.fetchOwnerTransfers(ctx, ownerID, contractIDsToEnquire, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err = nft.MakeNFTOwnerships(ownerID, contracts, nftTransfers, ownedTokens, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if truncatedReason == "" {
+		truncatedReason = transfersTruncatedReason
+	}
+
+	// Only the complete history must add up to the provider balances
+	if truncatedReason == "" && fromBlock == nil {
+		for _, mismatch := range result.Mismatches {
+			h.Logger.WithFields(map[string]interface{}{
+				"owner":            ownerID.String(),
+				"contract_address": mismatch.ContractAddress.String(),
+				"token_id":         mismatch.TokenID,
+				"provider_balance": mismatch.ProviderBalance.String(),
+				"unaccounted":      mismatch.Unaccounted.String(),
+			}).Warn("provider balance does not match transfers")
+		}
+	}
+
+	ownerships := result.Ownerships
+
+	fetchedAt := h.Clock.NowUTC()
+
+	// A partial list must not be cached, or missing tokens would read as not owned
+	if truncatedReason != "" {
+		return &OwnershipsResult{
+			Ownerships:      ownerships,
+			FetchedAt:       &fetchedAt,
+			Truncated:       true,
+			TruncatedReason: truncatedReason,
+		}, nil
 	}
 
-	ownerships, err := alchemy.MakeNFTOwnerships(ownerID, contracts, nftTransfers, ownedNFTs)
+	// Ownerships of indexed collections are written by the worker only
+	storedContracts := make([]authgearweb3.ContractID, 0, len(contracts))
+	for _, contract := range contracts {
+		if !trackedCollections.IsIndexed(contract) {
+			storedContracts = append(storedContracts, contract)
+		}
+	}
+	storedOwnershipsOfContracts := make([]database.NFTOwnership, 0, len(ownerships))
+	for _, ownership := range ownerships {
+		if !trackedCollections.IsIndexed(*ownership.ContractID()) {
+			storedOwnershipsOfContracts = append(storedOwnershipsOfContracts, ownership)
+		}
+	}
+
+	err = h.NFTOwnershipMutator.UpsertNFTOwnerships(ownerID, storedContracts, storedOwnershipsOfContracts)
 	if err != nil {
 		return nil, err
 	}
+	return &OwnershipsResult{Ownerships: ownerships, FetchedAt: &fetchedAt}, nil
+}
 
-	// Insert ownerships
-	err = h.NFTOwnershipMutator.InsertNFTOwnerships(ownerships)
+func (h *OwnershipService) queryTrackedCollections(contracts []authgearweb3.ContractID) (trackedCollectionMap, error) {
+	collections, err := h.NFTTrackedCollectionQuery.QueryTrackedCollections(contracts)
 	if err != nil {
 		return nil, err
 	}
-	return ownerships, nil
+
+	return newTrackedCollectionMap(collections), nil
 }
 
-func (h *OwnershipService) GetOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID) ([]database.NFTOwnership, error) {
-	minimumFreshness := h.Clock.NowUTC()
-	minimumFreshness = minimumFreshness.Add(-time.Duration(h.Config.Server.OwnershipCacheTTL) * time.Second)
+// getCommitmentHead returns the highest block an answer of the commitment may include, nil means the latest block
+func (h *OwnershipService) getCommitmentHead(ctx context.Context, blockchain string, network string, commitment nft.Commitment) (*big.Int, error) {
+	chain := h.Config.GetChainConfig(blockchain, network)
+	if commitment == nft.CommitmentLatest || chain == nil {
+		return nil, nil
+	}
 
-	// Query ownership from database
-	ownershipQb := h.NFTOwnershipQuery.NewQueryBuilder()
-	ownershipQb = ownershipQb.WithContracts(contracts).WithOwner(&ownerID).WithMinimumFreshness(minimumFreshness)
-	ownerships, err := h.NFTOwnershipQuery.ExecuteQuery(ownershipQb)
+	latest, err := h.NFTDataProvider.GetBlockNumber(ctx, blockchain, network)
 	if err != nil {
 		return nil, err
 	}
 
+	confirmations := chain.Confirmations
+	if commitment == nft.CommitmentSafe {
+		confirmations = chain.GetSafeConfirmations()
+	}
+
+	head := new(big.Int).Sub(latest, big.NewInt(int64(confirmations)))
+	if head.Sign() < 0 {
+		head.SetInt64(0)
+	}
+	return head, nil
+}
+
+// getIndexedOwnerships returns the ownerships of indexed collections the worker has caught up with, from storage alone.
+// They are stale if the worker has not saved the checkpoint within the TTL of the collection.
+// Ownerships are rolled back to head with the undos of later blocks, nil head means the latest block.
+func (h *OwnershipService) getIndexedOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID, trackedCollections trackedCollectionMap, ttls collectionTTLs, head *big.Int) (indexed map[string]struct{}, result *OwnershipsResult, err error) {
+	trackedContracts := make([]authgearweb3.ContractID, 0)
+	for _, contract := range contracts {
+		if trackedCollections.IsIndexed(contract) {
+			trackedContracts = append(trackedContracts, contract)
+		}
+	}
+
+	indexed = make(map[string]struct{})
+	result = &OwnershipsResult{}
+	if len(trackedContracts) == 0 {
+		return indexed, result, nil
+	}
+
+	checkpoints, err := h.NFTIndexerCheckpointQuery.QueryCheckpoints(trackedContracts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := h.Clock.NowUTC()
+	for _, checkpoint := range checkpoints {
+		if !checkpoint.IsSynced() {
+			continue
+		}
+
+		contractID := checkpoint.ContractID()
+		indexed[contractID.String()] = struct{}{}
+		if checkpoint.UpdatedAt.Before(now.Add(-ttls.Get(*contractID))) {
+			result.Stale = true
+		}
+		result.FetchedAt = earliestFetchedAt(result.FetchedAt, checkpoint.UpdatedAt)
+	}
+
+	// The requested contracts keep their token_ids
+	indexedContracts := make([]authgearweb3.ContractID, 0)
+	for _, contract := range trackedContracts {
+		if _, ok := indexed[contract.StripQuery().String()]; ok {
+			indexedContracts = append(indexedContracts, contract)
+		}
+	}
+
+	if len(indexedContracts) == 0 {
+		return indexed, result, nil
+	}
+
+	ownerships, err := h.NFTOwnershipQuery.QueryOwnerOwnerships(ownerID, indexedContracts, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result.Ownerships = database.LatestNFTOwnerships(ownerships)
+	if head == nil {
+		return indexed, result, nil
+	}
+
+	undos, err := h.NFTOwnershipUndoQuery.QueryUndosAfter(ownerID, indexedContracts, head)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Undos may restore tokens which are not requested
+	contractIDToTokenIDs := make(map[string]map[string]struct{})
+	for _, contract := range indexedContracts {
+		tokenIDs := contract.Query["token_ids"]
+		if len(tokenIDs) == 0 {
+			continue
+		}
+		tokenIDSet := make(map[string]struct{})
+		for _, tokenID := range tokenIDs {
+			tokenIDSet[tokenID] = struct{}{}
+		}
+		contractIDToTokenIDs[contract.StripQuery().String()] = tokenIDSet
+	}
+	requestedUndos := make([]database.NFTOwnershipUndo, 0, len(undos))
+	for _, undo := range undos {
+		if tokenIDSet, ok := contractIDToTokenIDs[undo.ContractID().String()]; ok {
+			if _, ok := tokenIDSet[undo.TokenID]; !ok {
+				continue
+			}
+		}
+		requestedUndos = append(requestedUndos, undo)
+	}
+
+	result.Ownerships = database.NFTOwnershipsAsOf(result.Ownerships, requestedUndos)
+	return indexed, result, nil
+}
+
+// fetchOwnerTransfers fetches transfers from and to the owner since fromBlock, nil means from genesis
+func (h *OwnershipService) fetchOwnerTransfers(ctx context.Context, ownerID authgearweb3.ContractID, contractIDs []authgearweb3.ContractID, fromBlock *big.Int) ([]nft.Transfer, TruncatedReason, error) {
+	incoming, truncatedReason, err := h.fetchTransfers(ctx, nft.TransferQuery{
+		ContractIDs: contractIDs,
+		ToAddress:   ownerID.Address,
+		FromBlock:   fromBlock,
+	})
+	if err != nil || truncatedReason != "" {
+		return incoming, truncatedReason, err
+	}
+
+	outgoing, truncatedReason, err := h.fetchTransfers(ctx, nft.TransferQuery{
+		ContractIDs: contractIDs,
+		FromAddress: ownerID.Address,
+		FromBlock:   fromBlock,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return append(incoming, outgoing...), truncatedReason, nil
+}
+
+// fetchTransfers fetches transfers matching query in descending order
+func (h *OwnershipService) fetchTransfers(ctx context.Context, query nft.TransferQuery) ([]nft.Transfer, TruncatedReason, error) {
+	pageKey := ""
+	transferFetchCount := 0
+	var truncatedReason TruncatedReason
+	nftTransfers := make([]nft.Transfer, 0)
+
+	// Fetch transfers until no extra page or has reached the page limit
+	for ok := true; ok; ok = pageKey != "" {
+		if transferFetchCount >= h.Config.Server.GetMaxTransferPages() {
+			truncatedReason = TruncatedReasonTransferPageLimit
+			break
+		}
+
+		pageCtx, cancel := pageContext(ctx)
+		pageQuery := query
+		pageQuery.PageKey = pageKey
+		pageQuery.MaxCount = h.Config.Server.GetTransferPageSize()
+		pageQuery.Order = nft.TransferOrderDescending
+		transfers, err := h.NFTDataProvider.GetTransfers(pageCtx, pageQuery)
+		deadlineHit := errors.Is(pageCtx.Err(), context.DeadlineExceeded)
+		cancel()
+		if err != nil {
+			if transferFetchCount > 0 && deadlineHit && ctx.Err() == nil {
+				truncatedReason = TruncatedReasonTimeout
+				break
+			}
+			return nil, "", wrapContextError(pageCtx, err)
+		}
+
+		pageKey = transfers.PageKey
+
+		nftTransfers = append(nftTransfers, transfers.Transfers...)
+		transferFetchCount++
+	}
+
+	return nftTransfers, truncatedReason, nil
+}
+
+// getStoredOwnerships returns the latest stored ownerships, so that only transfers after them need to be fetched.
+// fromBlock is the highest stored block of the contract seen least recently, or nil if some contract has no stored ownership.
+func (h *OwnershipService) getStoredOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID) (*big.Int, []database.NFTOwnership, error) {
+	ownerships, err := h.NFTOwnershipQuery.QueryOwnerOwnerships(ownerID, contracts, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	contractIDToHighestBlock := make(map[string]*big.Int)
+	storedOwnerships := make([]database.NFTOwnership, 0)
+	for _, ownership := range database.LatestNFTOwnerships(ownerships) {
+		if ownership.IsEmpty() || ownership.BlockNumber == nil {
+			continue
+		}
+
+		blockNumber := ownership.BlockNumber.ToMathBig()
+		contractID := ownership.ContractID().String()
+		if highest, ok := contractIDToHighestBlock[contractID]; !ok || blockNumber.Cmp(highest) > 0 {
+			contractIDToHighestBlock[contractID] = blockNumber
+		}
+
+		storedOwnerships = append(storedOwnerships, ownership)
+	}
+
+	var fromBlock *big.Int
+	for _, contract := range contracts {
+		highest, ok := contractIDToHighestBlock[contract.StripQuery().String()]
+		if !ok {
+			return nil, nil, nil
+		}
+		// The highest block is refetched in case it had more transfers than stored
+		if fromBlock == nil || highest.Cmp(fromBlock) < 0 {
+			fromBlock = highest
+		}
+	}
+
+	return fromBlock, storedOwnerships, nil
+}
+
+// fetchAndInsertNFTOwnershipsCoalesced lets concurrent requests of the same owner and contracts share one fetch and one write
+func (h *OwnershipService) fetchAndInsertNFTOwnershipsCoalesced(ctx context.Context, ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID) (*OwnershipsResult, error) {
+	v, err := h.FetchCoalescer.Do(ctx, ownershipFetchKey(ownerID, contracts), func(ctx context.Context) (interface{}, error) {
+		return h.FetchAndInsertNFTOwnerships(ctx, ownerID, contracts)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*OwnershipsResult), nil
+}
+
+// getCachedOwnerships returns the latest stored ownerships regardless of freshness,
+// upstreamErr is returned if nothing has been stored yet
+func (h *OwnershipService) getCachedOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID, upstreamErr error) (*OwnershipsResult, error) {
+	ownerships, err := h.NFTOwnershipQuery.QueryOwnerOwnerships(ownerID, contracts, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ownerships) == 0 {
+		return nil, upstreamErr
+	}
+
+	latest := database.LatestNFTOwnerships(ownerships)
+	var fetchedAt *time.Time
+	for _, ownership := range latest {
+		fetchedAt = earliestFetchedAt(fetchedAt, ownership.RefreshedAt)
+	}
+
+	return &OwnershipsResult{
+		Ownerships: latest,
+		Stale:      true,
+		FetchedAt:  fetchedAt,
+	}, nil
+}
+
+// GetOwnerships returns the ownerships of the owner in contracts as of the head of the commitment
+func (h *OwnershipService) GetOwnerships(ctx context.Context, ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID, commitment nft.Commitment) (*OwnershipsResult, error) {
+	err := web3.CheckNetwork(h.Config, ownerID.Blockchain, ownerID.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := h.getCommitmentHead(ctx, ownerID.Blockchain, ownerID.Network, commitment)
+	if err != nil {
+		return nil, wrapContextError(ctx, err)
+	}
+
+	// Tracked collections may have their own TTL
+	trackedCollections, err := h.queryTrackedCollections(contracts)
+	if err != nil {
+		return nil, err
+	}
+	freshTTL, staleTTL := h.Config.Server.GetOwnershipCacheTTLs()
+	ttls := newCollectionTTLs(trackedCollections.Collections(), freshTTL, staleTTL)
+
+	// Indexed collections the worker has caught up with are answered from the database alone
+	indexed, indexedResult, err := h.getIndexedOwnerships(ownerID, contracts, trackedCollections, ttls, head)
+	if err != nil {
+		return nil, err
+	}
+
+	cachedContracts := make([]authgearweb3.ContractID, 0, len(contracts))
+	storedContracts := make([]authgearweb3.ContractID, 0, len(contracts))
+	for _, contract := range contracts {
+		if _, ok := indexed[contract.StripQuery().String()]; ok {
+			continue
+		}
+		cachedContracts = append(cachedContracts, contract)
+		// Rows of an indexed collection are incomplete until the worker has caught up
+		if !trackedCollections.IsIndexed(contract) {
+			storedContracts = append(storedContracts, contract)
+		}
+	}
+
+	// Query ownership from database
+	ownerships := indexedResult.Ownerships
+	storedOwnerships := make([]database.NFTOwnership, 0)
+	revalidateSet := make(map[string]struct{})
+	if len(storedContracts) != 0 {
+		now := h.Clock.NowUTC()
+		minimumFreshness := now.Add(-ttls.Max())
+		cachedOwnerships, err := h.NFTOwnershipQuery.QueryOwnerOwnerships(ownerID, storedContracts, &minimumFreshness)
+		if err != nil {
+			return nil, err
+		}
+		for _, ownership := range cachedOwnerships {
+			contractID := ownership.ContractID()
+			if !ownership.RefreshedAt.After(now.Add(-ttls.GetStale(*contractID))) {
+				continue
+			}
+			// Past the fresh TTL it is served as is and refreshed in the background
+			if !ownership.RefreshedAt.After(now.Add(-ttls.Get(*contractID))) {
+				revalidateSet[contractID.String()] = struct{}{}
+			}
+			storedOwnerships = append(storedOwnerships, ownership)
+		}
+		ownerships = append(ownerships, storedOwnerships...)
+	}
+
 	// Find out which contract to fetch
 	contractsToFetch := make([]authgearweb3.ContractID, 0)
 	contractIDToOwnerships := make(map[string][]database.NFTOwnership)
@@ -123,7 +565,7 @@ func (h *OwnershipService) GetOwnerships(ownerID authgearweb3.ContractID, contra
 		}
 	}
 
-	for _, contract := range contracts {
+	for _, contract := range cachedContracts {
 		tokenIDs := contract.Query["token_ids"]
 
 		strippedContractID := contract.StripQuery().String()
@@ -134,14 +576,54 @@ func (h *OwnershipService) GetOwnerships(ownerID authgearweb3.ContractID, contra
 		}
 	}
 
-	// Fetch missing data from alchemy
-	if len(contractsToFetch) != 0 {
-		updatedOwnerships, err := h.FetchAndInsertNFTOwnerships(ownerID, contractsToFetch)
+	fetchedContractSet := make(map[string]struct{})
+	for _, contract := range contractsToFetch {
+		fetchedContractSet[contract.StripQuery().String()] = struct{}{}
+	}
+
+	fetchedAt := indexedResult.FetchedAt
+	for _, ownership := range storedOwnerships {
+		if _, ok := fetchedContractSet[ownership.ContractID().String()]; !ok {
+			fetchedAt = earliestFetchedAt(fetchedAt, ownership.RefreshedAt)
+		}
+	}
+
+	// Contracts refetched now need no background refresh
+	contractsToRevalidate := make([]authgearweb3.ContractID, 0)
+	for _, contract := range storedContracts {
+		strippedContractID := contract.StripQuery().String()
+		_, revalidate := revalidateSet[strippedContractID]
+		_, fetch := fetchedContractSet[strippedContractID]
+		if revalidate && !fetch {
+			contractsToRevalidate = append(contractsToRevalidate, contract)
+		}
+	}
+	if len(contractsToRevalidate) != 0 {
+		err = h.JobQueue.EnqueueRefreshOwnerships(ownerID, contractsToRevalidate)
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	// Fetch missing data from provider
+	fetched := &OwnershipsResult{}
+	if len(contractsToFetch) != 0 {
+		fetched, err = h.fetchAndInsertNFTOwnershipsCoalesced(ctx, ownerID, contractsToFetch)
+		if web3.IsUpstreamUnavailable(err) {
+			fetched, err = h.getCachedOwnerships(ownerID, contractsToFetch, err)
+			if err == nil {
+				// The worker refreshes them once the upstream is back
+				err = h.JobQueue.EnqueueRefreshOwnerships(ownerID, contractsToFetch)
+			}
+		}
+		if err != nil {
+			return nil, wrapContextError(ctx, err)
+		}
+		if fetched.FetchedAt != nil {
+			fetchedAt = earliestFetchedAt(fetchedAt, *fetched.FetchedAt)
+		}
 
-		for _, ownership := range updatedOwnerships {
+		for _, ownership := range fetched.Ownerships {
 			contractID := ownership.ContractID().String()
 
 			if _, ok := contractIDToOwnerships[contractID]; ok {
@@ -155,15 +637,27 @@ func (h *OwnershipService) GetOwnerships(ownerID authgearweb3.ContractID, contra
 	result := make([]database.NFTOwnership, 0)
 	for _, contract := range contracts {
 		contractID := contract.StripQuery().String()
+		_, isIndexed := indexed[contractID]
 
 		ownerships := contractIDToOwnerships[contractID]
 		for _, ownership := range ownerships {
-			if !ownership.IsEmpty() {
-				result = append(result, ownership)
+			if ownership.IsEmpty() {
+				continue
+			}
+			// Without undos, ownerships of unsettled blocks are left out
+			if !isIndexed && head != nil && ownership.BlockNumber != nil && ownership.BlockNumber.ToMathBig().Cmp(head) > 0 {
+				continue
 			}
+			result = append(result, ownership)
 		}
 
 	}
 
-	return result, nil
+	return &OwnershipsResult{
+		Ownerships:      result,
+		Stale:           fetched.Stale || indexedResult.Stale || len(contractsToRevalidate) != 0,
+		FetchedAt:       fetchedAt,
+		Truncated:       fetched.Truncated,
+		TruncatedReason: fetched.TruncatedReason,
+	}, nil
 }
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
+	"github.com/authgear/authgear-nft-indexer/pkg/web3"
+	"github.com/authgear/authgear-server/pkg/util/clock"
+	"github.com/authgear/authgear-server/pkg/util/log"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+	"github.com/uptrace/bun/extra/bunbig"
+)
+
+// The fixtures are recorded from the fake provider serving testdata/world.yaml on its default listen address
+const (
+	testFakeProviderEndpoint = "http://localhost:8090/"
+	testFixturesDir          = "testdata/fixtures"
+
+	testAlice       = "0x1111111111111111111111111111111111111111"
+	testApes        = "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	testItems       = "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	testItemTokenID = "0x10"
+)
+
+type fakeOwnershipQuery struct {
+	Ownerships []database.NFTOwnership
+}
+
+func (q *fakeOwnershipQuery) QueryOwnerOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID, minimumFreshness *time.Time) ([]database.NFTOwnership, error) {
+	ownerships := make([]database.NFTOwnership, 0)
+	for _, ownership := range q.Ownerships {
+		if minimumFreshness == nil || ownership.RefreshedAt.After(*minimumFreshness) {
+			ownerships = append(ownerships, ownership)
+		}
+	}
+	return ownerships, nil
+}
+
+type fakeOwnershipMutator struct {
+	Upserted []database.NFTOwnership
+}
+
+func (m *fakeOwnershipMutator) UpsertNFTOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID, ownerships []database.NFTOwnership) error {
+	m.Upserted = append(m.Upserted, ownerships...)
+	return nil
+}
+
+type fakeCheckpointQuery struct{}
+
+func (fakeCheckpointQuery) QueryCheckpoints(contracts []authgearweb3.ContractID) ([]database.NFTIndexerCheckpoint, error) {
+	return nil, nil
+}
+
+type fakeTrackedCollectionQuery struct{}
+
+func (fakeTrackedCollectionQuery) QueryTrackedCollections(contracts []authgearweb3.ContractID) ([]database.NFTTrackedCollection, error) {
+	return nil, nil
+}
+
+type fakeUndoQuery struct{}
+
+func (fakeUndoQuery) QueryUndosAfter(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID, blockNumber *big.Int) ([]database.NFTOwnershipUndo, error) {
+	return nil, nil
+}
+
+type fakeOwnershipJobQueue struct {
+	Enqueued [][]authgearweb3.ContractID
+}
+
+func (q *fakeOwnershipJobQueue) EnqueueRefreshOwnerships(ownerID authgearweb3.ContractID, contracts []authgearweb3.ContractID) error {
+	q.Enqueued = append(q.Enqueued, contracts)
+	return nil
+}
+
+// failingPageProvider fails every page of owned tokens after the first one
+type failingPageProvider struct {
+	OwnershipServiceNFTDataProvider
+	Err error
+}
+
+func (p failingPageProvider) GetOwnedTokens(ctx context.Context, ownerAddress authgearweb3.EIP55, contractIDs []authgearweb3.ContractID, pageKey string) (*nft.OwnedTokens, error) {
+	if pageKey != "" {
+		return nil, p.Err
+	}
+	return p.OwnershipServiceNFTDataProvider.GetOwnedTokens(ctx, ownerAddress, contractIDs, pageKey)
+}
+
+func newTestConfig() config.Config {
+	fixturesMode := config.FixturesModeReplay
+	if os.Getenv("FIXTURES_MODE") == string(config.FixturesModeRecord) {
+		fixturesMode = config.FixturesModeRecord
+	}
+
+	chain := config.DefaultChains[0]
+	chain.Endpoints.Alchemy = testFakeProviderEndpoint
+
+	return config.Config{
+		Server: config.ServerConfig{
+			MaxNFTPages:    5,
+			RequestTimeout: 10,
+		},
+		Alchemy: []config.AlchemyConfig{{Blockchain: "ethereum", Network: "1", APIKey: "test-key"}},
+		Chains:  []config.ChainConfig{chain},
+		Upstream: config.UpstreamConfig{
+			Fixtures: config.FixturesConfig{Mode: fixturesMode, Dir: testFixturesDir},
+		},
+	}
+}
+
+func newTestOwnershipService(cfg config.Config) *OwnershipService {
+	lf := log.NewFactory(log.LevelInfo)
+	return &OwnershipService{
+		Clock:  clock.NewSystemClock(),
+		Logger: NewOwnershipServiceLogger(lf),
+		Config: cfg,
+		NFTDataProvider: &web3.AlchemyAPI{
+			Config:     cfg,
+			APIKeyPool: web3.NewAPIKeyPool(clock.NewSystemClock(), lf),
+		},
+		NFTOwnershipQuery:         &fakeOwnershipQuery{},
+		NFTOwnershipMutator:       &fakeOwnershipMutator{},
+		FetchCoalescer:            NewFetchCoalescer(cfg),
+		NFTIndexerCheckpointQuery: fakeCheckpointQuery{},
+		NFTTrackedCollectionQuery: fakeTrackedCollectionQuery{},
+		NFTOwnershipUndoQuery:     fakeUndoQuery{},
+		JobQueue:                  &fakeOwnershipJobQueue{},
+	}
+}
+
+func testContractID(t *testing.T, address string, tokenIDs ...string) authgearweb3.ContractID {
+	query := url.Values{}
+	if len(tokenIDs) > 0 {
+		query["token_ids"] = tokenIDs
+	}
+	contractID, err := authgearweb3.NewContractID("ethereum", "1", address, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *contractID
+}
+
+// describeOwnerships formats ownerships as contract/token@block=balance, sorted
+func describeOwnerships(ownerships []database.NFTOwnership) string {
+	descriptions := make([]string, 0, len(ownerships))
+	for _, ownership := range ownerships {
+		address := strings.ToLower(ownership.ContractAddress.String())
+		if ownership.IsEmpty() {
+			descriptions = append(descriptions, fmt.Sprintf("%v/%v:empty", address[:4], ownership.TokenID))
+			continue
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%v/%v@%v=%v", address[:4], ownership.TokenID, ownership.BlockNumber.ToMathBig(), ownership.Balance))
+	}
+	sort.Strings(descriptions)
+	return strings.Join(descriptions, ",")
+}
+
+func testRequestContext(t *testing.T, cfg config.Config) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.GetRequestTimeout())
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestOwnershipServiceFetchAndInsertNFTOwnerships(t *testing.T) {
+	cfg := newTestConfig()
+	s := newTestOwnershipService(cfg)
+	ownerID := testContractID(t, testAlice)
+	contracts := []authgearweb3.ContractID{testContractID(t, testApes), testContractID(t, testItems, testItemTokenID)}
+
+	result, err := s.FetchAndInsertNFTOwnerships(testRequestContext(t, cfg), ownerID, contracts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Token 2 was transferred out, token 3 was burnt, 2 of the 5 items were transferred out
+	expected := "0xaa/0x1@100=1,0xbb/0x10@120=3"
+	if actual := describeOwnerships(result.Ownerships); actual != expected {
+		t.Errorf("expected ownerships %v, got %v", expected, actual)
+	}
+	if result.Truncated || result.FetchedAt == nil {
+		t.Errorf("expected a complete result, got %+v", result)
+	}
+	if actual := describeOwnerships(s.NFTOwnershipMutator.(*fakeOwnershipMutator).Upserted); actual != expected {
+		t.Errorf("expected stored ownerships %v, got %v", expected, actual)
+	}
+}
+
+func TestOwnershipServiceTruncation(t *testing.T) {
+	t.Run("NFT page limit", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.Server.MaxNFTPages = 1
+		s := newTestOwnershipService(cfg)
+		ownerID := testContractID(t, testAlice)
+		contracts := []authgearweb3.ContractID{testContractID(t, testApes), testContractID(t, testItems, testItemTokenID)}
+
+		result, err := s.FetchAndInsertNFTOwnerships(testRequestContext(t, cfg), ownerID, contracts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !result.Truncated || result.TruncatedReason != TruncatedReasonNFTPageLimit {
+			t.Errorf("expected truncation by the NFT page limit, got %+v", result)
+		}
+		if upserted := s.NFTOwnershipMutator.(*fakeOwnershipMutator).Upserted; len(upserted) != 0 {
+			t.Errorf("expected a truncated result not to be stored, got %v", describeOwnerships(upserted))
+		}
+	})
+
+	t.Run("Upstream error after the first page", func(t *testing.T) {
+		cfg := newTestConfig()
+		s := newTestOwnershipService(cfg)
+		upstreamErr := web3.ErrAlchemyProtocol.New("getNFTs: broken page")
+		s.NFTDataProvider = failingPageProvider{OwnershipServiceNFTDataProvider: s.NFTDataProvider, Err: upstreamErr}
+		ownerID := testContractID(t, testAlice)
+		contracts := []authgearweb3.ContractID{testContractID(t, testApes), testContractID(t, testItems, testItemTokenID)}
+
+		result, err := s.FetchAndInsertNFTOwnerships(testRequestContext(t, cfg), ownerID, contracts)
+		if err != upstreamErr {
+			t.Fatalf("expected the upstream error instead of a truncated result, got %+v %v", result, err)
+		}
+	})
+}
+
+func TestOwnershipServiceGetOwnerships(t *testing.T) {
+	ownerID := testContractID(t, testAlice)
+	contracts := []authgearweb3.ContractID{testContractID(t, testApes)}
+	cachedOwnership := func(refreshedAt time.Time) database.NFTOwnership {
+		return database.NFTOwnership{
+			Blockchain:      "ethereum",
+			Network:         "1",
+			ContractAddress: contracts[0].Address,
+			TokenID:         "0x1",
+			OwnerAddress:    ownerID.Address,
+			BlockNumber:     bunbig.FromInt64(100),
+			TransactionHash: "0xcached",
+			Balance:         "1",
+			RefreshedAt:     refreshedAt,
+		}
+	}
+
+	t.Run("Fresh cache", func(t *testing.T) {
+		cfg := newTestConfig()
+		s := newTestOwnershipService(cfg)
+		s.NFTDataProvider = nil
+		s.NFTOwnershipQuery = &fakeOwnershipQuery{Ownerships: []database.NFTOwnership{cachedOwnership(time.Now().UTC())}}
+
+		result, err := s.GetOwnerships(testRequestContext(t, cfg), ownerID, contracts, nft.CommitmentLatest)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if actual := describeOwnerships(result.Ownerships); actual != "0xaa/0x1@100=1" {
+			t.Errorf("unexpected ownerships %v", actual)
+		}
+		if result.Stale || len(s.JobQueue.(*fakeOwnershipJobQueue).Enqueued) != 0 {
+			t.Errorf("expected a fresh result without revalidation, got %+v", result)
+		}
+	})
+
+	t.Run("Stale cache is served and revalidated", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.Server.OwnershipCache = config.CacheConfig{FreshTTL: 60, StaleTTL: 3600}
+		s := newTestOwnershipService(cfg)
+		s.NFTDataProvider = nil
+		s.NFTOwnershipQuery = &fakeOwnershipQuery{Ownerships: []database.NFTOwnership{cachedOwnership(time.Now().UTC().Add(-10 * time.Minute))}}
+
+		result, err := s.GetOwnerships(testRequestContext(t, cfg), ownerID, contracts, nft.CommitmentLatest)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(result.Ownerships) != 1 {
+			t.Errorf("expected the cached ownership, got %v", describeOwnerships(result.Ownerships))
+		}
+		if enqueued := s.JobQueue.(*fakeOwnershipJobQueue).Enqueued; len(enqueued) != 1 {
+			t.Errorf("expected one revalidation, got %v", enqueued)
+		}
+	})
+
+	t.Run("Expired cache is refetched", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.Server.OwnershipCache = config.CacheConfig{FreshTTL: 60, StaleTTL: 120}
+		s := newTestOwnershipService(cfg)
+		s.NFTOwnershipQuery = &fakeOwnershipQuery{Ownerships: []database.NFTOwnership{cachedOwnership(time.Now().UTC().Add(-10 * time.Minute))}}
+
+		result, err := s.GetOwnerships(testRequestContext(t, cfg), ownerID, contracts, nft.CommitmentLatest)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if actual := describeOwnerships(result.Ownerships); actual != "0xaa/0x1@100=1" {
+			t.Errorf("expected the fetched ownerships, got %v", actual)
+		}
+		if result.Stale {
+			t.Errorf("expected a fresh result, got %+v", result)
+		}
+	})
+}
@@ -1,13 +1,16 @@
 package service
 
 import (
-	"github.com/authgear/authgear-nft-indexer/pkg/model/alchemy"
+	"context"
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
 	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
+	"github.com/authgear/authgear-nft-indexer/pkg/web3"
 	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
 )
 
-type ProbeServiceAlchemyAPI interface {
-	GetOwnersForCollection(contractID authgearweb3.ContractID) (*alchemy.GetOwnersForCollectionResponse, error)
+type ProbeServiceNFTDataProvider interface {
+	GetContractHolders(ctx context.Context, contractID authgearweb3.ContractID, pageKey string) (*nft.Holders, error)
 }
 
 type ProbeServiceNFTCollectionProbeQuery interface {
@@ -16,26 +19,59 @@ type ProbeServiceNFTCollectionProbeQuery interface {
 
 type ProbeServiceNFTCollectionProbeMutator interface {
 	InsertNFTCollectionProbe(contractID authgearweb3.ContractID, isLargeCollection bool) (*database.NFTCollectionProbe, error)
+	UpsertNFTCollectionProbe(contractID authgearweb3.ContractID, isLargeCollection bool) (*database.NFTCollectionProbe, error)
+}
+
+type ProbeServiceJobQueue interface {
+	EnqueueProbeCollection(contract authgearweb3.ContractID) error
 }
 
 type ProbeService struct {
-	AlchemyAPI                ProbeServiceAlchemyAPI
+	Config                    config.Config
+	NFTDataProvider           ProbeServiceNFTDataProvider
 	NFTCollectionProbeQuery   ProbeServiceNFTCollectionProbeQuery
 	NFTCollectionProbeMutator ProbeServiceNFTCollectionProbeMutator
+	JobQueue                  ProbeServiceJobQueue
 }
 
-func (m *ProbeService) ProbeCollection(contractID authgearweb3.ContractID) (bool, error) {
+func (m *ProbeService) ProbeCollection(ctx context.Context, contractID authgearweb3.ContractID) (bool, error) {
+	err := web3.CheckNetwork(m.Config, contractID.Blockchain, contractID.Network)
+	if err != nil {
+		return false, err
+	}
+
 	collectionProbe, err := m.NFTCollectionProbeQuery.QueryCollectionProbeByContractID(contractID)
 	if err == nil && collectionProbe != nil {
 		return collectionProbe.IsLargeCollection, nil
 	}
 
-	res, err := m.AlchemyAPI.GetOwnersForCollection(contractID)
+	res, err := m.NFTDataProvider.GetContractHolders(ctx, contractID, "")
+	if web3.IsUpstreamUnavailable(err) {
+		// The worker probes it once the upstream is back, so that the next call is answered from storage
+		if enqueueErr := m.JobQueue.EnqueueProbeCollection(contractID); enqueueErr != nil {
+			return false, enqueueErr
+		}
+	}
+	if err != nil {
+		return false, wrapContextError(ctx, err)
+	}
+
+	dbProbe, err := m.NFTCollectionProbeMutator.InsertNFTCollectionProbe(contractID, res.PageKey != "")
+	if err != nil {
+		return false, err
+	}
+
+	return dbProbe.IsLargeCollection, nil
+}
+
+// RefreshCollectionProbe probes the contract again regardless of the stored probe
+func (m *ProbeService) RefreshCollectionProbe(ctx context.Context, contractID authgearweb3.ContractID) (bool, error) {
+	res, err := m.NFTDataProvider.GetContractHolders(ctx, contractID, "")
 	if err != nil {
 		return false, err
 	}
 
-	dbProbe, err := m.NFTCollectionProbeMutator.InsertNFTCollectionProbe(contractID, res.PageKey != nil)
+	dbProbe, err := m.NFTCollectionProbeMutator.UpsertNFTCollectionProbe(contractID, res.PageKey != "")
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-server/pkg/api/apierrors"
+	"github.com/authgear/authgear-server/pkg/util/clock"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+type TrackedCollectionServiceNFTTrackedCollectionQuery interface {
+	ListTrackedCollections() ([]database.NFTTrackedCollection, error)
+}
+
+type TrackedCollectionServiceNFTTrackedCollectionMutator interface {
+	UpsertTrackedCollection(collection database.NFTTrackedCollection) (*database.NFTTrackedCollection, error)
+	SetTrackedCollectionPausedAt(contract authgearweb3.ContractID, pausedAt *time.Time) (*database.NFTTrackedCollection, error)
+	DeleteTrackedCollection(contract authgearweb3.ContractID) (bool, error)
+}
+
+type TrackedCollectionService struct {
+	Clock                       clock.Clock
+	NFTTrackedCollectionQuery   TrackedCollectionServiceNFTTrackedCollectionQuery
+	NFTTrackedCollectionMutator TrackedCollectionServiceNFTTrackedCollectionMutator
+}
+
+func (s *TrackedCollectionService) Register(contract authgearweb3.ContractID, mode database.TrackedCollectionMode, startBlock int64, ttlSeconds *int) (*database.NFTTrackedCollection, error) {
+	return s.NFTTrackedCollectionMutator.UpsertTrackedCollection(database.NFTTrackedCollection{
+		Blockchain:      contract.Blockchain,
+		Network:         contract.Network,
+		ContractAddress: contract.Address,
+		Mode:            mode,
+		StartBlock:      startBlock,
+		TTLSeconds:      ttlSeconds,
+	})
+}
+
+func (s *TrackedCollectionService) List() ([]database.NFTTrackedCollection, error) {
+	return s.NFTTrackedCollectionQuery.ListTrackedCollections()
+}
+
+// SetPaused stops the worker from indexing the collection, ownerships indexed so far are still served but become stale
+func (s *TrackedCollectionService) SetPaused(contract authgearweb3.ContractID, paused bool) (*database.NFTTrackedCollection, error) {
+	var pausedAt *time.Time
+	if paused {
+		now := s.Clock.NowUTC()
+		pausedAt = &now
+	}
+
+	collection, err := s.NFTTrackedCollectionMutator.SetTrackedCollectionPausedAt(contract, pausedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTrackedCollectionNotFound.NewWithDetails("collection is not tracked", apierrors.Details{"contract": contract.String()})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return collection, nil
+}
+
+func (s *TrackedCollectionService) Remove(contract authgearweb3.ContractID) error {
+	deleted, err := s.NFTTrackedCollectionMutator.DeleteTrackedCollection(contract)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrTrackedCollectionNotFound.NewWithDetails("collection is not tracked", apierrors.Details{"contract": contract.String()})
+	}
+
+	return nil
+}
+
+// collectionTTLs resolves the cache TTLs of contracts, tracked collections may override the global fresh TTL
+type collectionTTLs struct {
+	defaultTTL      time.Duration
+	defaultStaleTTL time.Duration
+	contractIDToTTL map[string]time.Duration
+}
+
+func newCollectionTTLs(trackedCollections []database.NFTTrackedCollection, defaultTTL time.Duration, defaultStaleTTL time.Duration) collectionTTLs {
+	contractIDToTTL := make(map[string]time.Duration)
+	for _, collection := range trackedCollections {
+		contractIDToTTL[collection.ContractID().String()] = collection.GetTTL(defaultTTL)
+	}
+
+	return collectionTTLs{
+		defaultTTL:      defaultTTL,
+		defaultStaleTTL: defaultStaleTTL,
+		contractIDToTTL: contractIDToTTL,
+	}
+}
+
+// Get returns the fresh TTL of the contract
+func (t collectionTTLs) Get(contract authgearweb3.ContractID) time.Duration {
+	if ttl, ok := t.contractIDToTTL[contract.StripQuery().String()]; ok {
+		return ttl
+	}
+	return t.defaultTTL
+}
+
+// GetStale returns the stale TTL of the contract, which is never shorter than its fresh TTL
+func (t collectionTTLs) GetStale(contract authgearweb3.ContractID) time.Duration {
+	if ttl := t.Get(contract); ttl > t.defaultStaleTTL {
+		return ttl
+	}
+	return t.defaultStaleTTL
+}
+
+// Max is the longest stale TTL of all contracts, records older than it are refetched for every contract
+func (t collectionTTLs) Max() time.Duration {
+	max := t.defaultStaleTTL
+	for _, ttl := range t.contractIDToTTL {
+		if ttl > max {
+			max = ttl
+		}
+	}
+	return max
+}
+
+// trackedCollectionMap is tracked collections by contract ID
+type trackedCollectionMap map[string]database.NFTTrackedCollection
+
+func newTrackedCollectionMap(collections []database.NFTTrackedCollection) trackedCollectionMap {
+	m := make(trackedCollectionMap)
+	for _, collection := range collections {
+		m[collection.ContractID().String()] = collection
+	}
+	return m
+}
+
+func (m trackedCollectionMap) IsIndexed(contract authgearweb3.ContractID) bool {
+	collection, ok := m[contract.StripQuery().String()]
+	return ok && collection.IsIndexed()
+}
+
+func (m trackedCollectionMap) HasIndexed(contracts []authgearweb3.ContractID) bool {
+	for _, contract := range contracts {
+		if m.IsIndexed(contract) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m trackedCollectionMap) Collections() []database.NFTTrackedCollection {
+	collections := make([]database.NFTTrackedCollection, 0, len(m))
+	for _, collection := range m {
+		collections = append(collections, collection)
+	}
+	return collections
+}
+
+// earliestFetchedAt returns the earlier of fetchedAt and t, nil fetchedAt means none yet
+func earliestFetchedAt(fetchedAt *time.Time, t time.Time) *time.Time {
+	if fetchedAt == nil || t.Before(*fetchedAt) {
+		return &t
+	}
+	return fetchedAt
+}
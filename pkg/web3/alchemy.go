@@ -2,24 +2,23 @@ package web3
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/big"
 	"net/http"
 	"os"
 	"path"
-	"time"
 
 	"github.com/authgear/authgear-nft-indexer/pkg/config"
 	"github.com/authgear/authgear-nft-indexer/pkg/model/alchemy"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/jsonrpc"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
 	"github.com/authgear/authgear-server/pkg/util/hexstring"
 	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
 )
 
-var alchemyClient = &http.Client{
-	Timeout: 5 * time.Second,
-}
-
 func wrapAlchemyTimeout(err error) error {
 	if os.IsTimeout(err) {
 		return ErrAlchemyProtocol.Wrap(err, "timeout")
@@ -28,11 +27,39 @@ func wrapAlchemyTimeout(err error) error {
 	return err
 }
 
+// checkAlchemyResponse classifies non-2xx responses that are left after retrying
+func checkAlchemyResponse(res *http.Response, tag string) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	message := fmt.Sprintf("%v: %v %v", tag, res.StatusCode, string(body))
+
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests:
+		return ErrAlchemyRateLimited.New(message)
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return ErrAlchemyUnauthorized.New(message)
+	case res.StatusCode >= 500:
+		return ErrAlchemyUnavailable.New(message)
+	case res.StatusCode >= 400:
+		return ErrAlchemyBadRequest.New(message)
+	}
+
+	return ErrAlchemyProtocol.New(message)
+}
+
 func decodeAlchemyJSON[T any](res *http.Response, tag string, t *T) error {
+	err := checkAlchemyResponse(res, tag)
+	if err != nil {
+		return err
+	}
+
 	var buf bytes.Buffer
 	reader := io.TeeReader(res.Body, &buf)
 
-	err := json.NewDecoder(reader).Decode(t)
+	err = json.NewDecoder(reader).Decode(t)
 	if err != nil {
 		return ErrAlchemyProtocol.Wrap(err, fmt.Sprintf("%v: %v", tag, buf.String()))
 	}
@@ -41,39 +68,95 @@ func decodeAlchemyJSON[T any](res *http.Response, tag string, t *T) error {
 }
 
 type AlchemyAPI struct {
-	Config config.Config
+	Config          config.Config
+	RateLimiter     *RateLimiter
+	APIKeyPool      *APIKeyPool
+	CircuitBreakers *CircuitBreakers
+}
+
+// withEndpoints calls fn with the endpoints of a key from the pool,
+// on auth or quota errors the call is retried with the other keys of the network
+func (a *AlchemyAPI) withEndpoints(ctx context.Context, blockchain string, network string, method string, fn func(endpoints *AlchemyEndpoint) error) error {
+	_, err := GetAlchemyEndpoint(a.Config, blockchain, network)
+	if err != nil {
+		return err
+	}
+
+	alchemyConfig := a.Config.GetAlchemyConfig(blockchain, network)
+	if alchemyConfig == nil || len(alchemyConfig.GetAPIKeys()) == 0 {
+		return NewNetworkNotConfiguredError(a.Config, blockchain, network)
+	}
+
+	var lastErr error
+	triedKeys := make(map[string]struct{})
+	for {
+		apiKey, err := a.APIKeyPool.Select(alchemyConfig, triedKeys)
+		if err != nil {
+			if lastErr != nil {
+				return lastErr
+			}
+			return err
+		}
+		triedKeys[apiKey] = struct{}{}
+
+		endpoints, err := GetRequestEndpoints(a.Config, blockchain, network, apiKey)
+		if err != nil {
+			return err
+		}
+
+		// The breaker only sees the upstream call, waiting for or being denied compute units says nothing about the endpoint
+		err = a.RateLimiter.Acquire(ctx, blockchain, network, apiKey, method)
+		if isAPIKeyError(err) {
+			// Compute units are limited per key, another key may still have some left
+			lastErr = err
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		err = a.CircuitBreakers.Do(ctx, circuitEndpoint(config.ProviderTypeAlchemy, blockchain, network), func() error {
+			err := fn(endpoints)
+			a.APIKeyPool.Report(alchemyConfig, apiKey, err)
+			return err
+		})
+
+		if err == nil || !isAPIKeyError(err) {
+			return err
+		}
+		lastErr = err
+	}
+}
+
+func (a *AlchemyAPI) client() *http.Client {
+	return newUpstreamClient(a.Config.Upstream)
 }
 
-type GetAssetTransferParams struct {
-	ContractIDs []authgearweb3.ContractID
-	FromAddress authgearweb3.EIP55
-	ToAddress   authgearweb3.EIP55
-	FromBlock   string
-	ToBlock     string
-	PageKey     string
-	MaxCount    int64
-	Order       string
+func toBlockTag(blockNumber *big.Int, defaultTag string) string {
+	if blockNumber == nil {
+		return defaultTag
+	}
+	return "0x" + blockNumber.Text(16)
 }
 
-func (p *GetAssetTransferParams) ToRequestParams() (*alchemy.AssetTransferRequestParams, error) {
-	contractAddresses := make([]authgearweb3.EIP55, 0, len(p.ContractIDs))
-	for _, contractID := range p.ContractIDs {
+func newAssetTransferRequestParams(query nft.TransferQuery) (*alchemy.AssetTransferRequestParams, error) {
+	contractAddresses := make([]authgearweb3.EIP55, 0, len(query.ContractIDs))
+	for _, contractID := range query.ContractIDs {
 		contractAddresses = append(contractAddresses, contractID.Address)
 	}
 
-	maxCountHex, err := hexstring.NewFromInt64(p.MaxCount)
+	maxCountHex, err := hexstring.NewFromInt64(query.MaxCount)
 	if err != nil {
 		return nil, fmt.Errorf("invalid maxCount: %w", err)
 	}
 
 	return &alchemy.AssetTransferRequestParams{
 		ContractAddresses: contractAddresses,
-		FromBlock:         p.FromBlock,
-		ToBlock:           p.ToBlock,
-		FromAddress:       p.FromAddress,
-		ToAddress:         p.ToAddress,
-		PageKey:           p.PageKey,
-		Order:             p.Order,
+		FromBlock:         toBlockTag(query.FromBlock, "0x0"),
+		ToBlock:           toBlockTag(query.ToBlock, "latest"),
+		FromAddress:       query.FromAddress,
+		ToAddress:         query.ToAddress,
+		PageKey:           query.PageKey,
+		Order:             string(query.Order),
 		MaxCount:          maxCountHex.String(),
 		Category:          []string{"erc1155", "erc721"},
 		ExcludeZeroValue:  true,
@@ -81,74 +164,59 @@ func (p *GetAssetTransferParams) ToRequestParams() (*alchemy.AssetTransferReques
 	}, nil
 }
 
-func (a *AlchemyAPI) GetOwnerNFTs(ownerAddress string, contractIDs []authgearweb3.ContractID, pageKey string) (*alchemy.GetNFTsResponse, error) {
-	blockchain := ""
-	network := ""
-	contractAddresses := make([]string, 0, len(contractIDs))
+func (a *AlchemyAPI) GetOwnedTokens(ctx context.Context, ownerAddress authgearweb3.EIP55, contractIDs []authgearweb3.ContractID, pageKey string) (*nft.OwnedTokens, error) {
+	blockchain, network, err := getContractsNetwork(contractIDs)
+	if err != nil {
+		return nil, err
+	}
 
+	contractAddresses := make([]string, 0, len(contractIDs))
 	for _, contractID := range contractIDs {
-		if blockchain == "" && network == "" {
-			blockchain = contractID.Blockchain
-			network = contractID.Network
-		} else if blockchain != contractID.Blockchain || network != contractID.Network {
-			return nil, fmt.Errorf("Invalid contract IDs, blockchain networks are not the same")
-		}
-
 		contractAddresses = append(contractAddresses, contractID.Address.String())
 	}
 
-	alchemyEndpoints, err := GetRequestEndpoints(a.Config.Alchemy, blockchain, network)
-	if err != nil {
-		return nil, err
+	if a.apiVersion(blockchain, network) == config.AlchemyAPIVersionV3 {
+		return a.getNFTsForOwner(ctx, blockchain, network, ownerAddress, contractAddresses, pageKey)
 	}
 
-	requestURL := alchemyEndpoints.NFTEndpoint
-	requestURL.Path = path.Join(requestURL.Path, "getNFTs")
+	var response alchemy.GetNFTsResponse
+	err = a.withEndpoints(ctx, blockchain, network, "getNFTs", func(alchemyEndpoints *AlchemyEndpoint) error {
+		requestURL := alchemyEndpoints.NFTEndpoint
+		requestURL.Path = path.Join(requestURL.Path, "getNFTs")
 
-	requestQuery := requestURL.Query()
-	requestQuery.Set("owner", ownerAddress)
-	requestQuery.Set("withMetadata", "true")
-	requestQuery[`contractAddresses[]`] = contractAddresses
+		requestQuery := requestURL.Query()
+		requestQuery.Set("owner", ownerAddress.String())
+		requestQuery.Set("withMetadata", "true")
+		requestQuery[`contractAddresses[]`] = contractAddresses
 
-	if pageKey != "" {
-		requestQuery.Set("pageKey", pageKey)
-	}
+		if pageKey != "" {
+			requestQuery.Set("pageKey", pageKey)
+		}
 
-	requestURL.RawQuery = requestQuery.Encode()
+		requestURL.RawQuery = requestQuery.Encode()
 
-	res, err := alchemyClient.Get(requestURL.String())
-	if err != nil {
-		return nil, wrapAlchemyTimeout(err)
-	}
-	defer res.Body.Close()
+		res, err := upstreamGet(ctx, a.client(), requestURL.String())
+		if err != nil {
+			return wrapAlchemyTimeout(err)
+		}
+		defer res.Body.Close()
 
-	var response alchemy.GetNFTsResponse
-	err = decodeAlchemyJSON(res, "getNFTs", &response)
+		return decodeAlchemyJSON(res, "getNFTs", &response)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &response, nil
+	return response.ToOwnedTokens()
 }
 
-func (a *AlchemyAPI) GetAssetTransfers(params GetAssetTransferParams) (*alchemy.AssetTransferResult, error) {
-	blockchain := ""
-	network := ""
-	for _, contractID := range params.ContractIDs {
-		if blockchain == "" && network == "" {
-			blockchain = contractID.Blockchain
-			network = contractID.Network
-		} else if blockchain != contractID.Blockchain || network != contractID.Network {
-			return nil, fmt.Errorf("Invalid contract IDs, blockchain networks are not the same")
-		}
-	}
-
-	alchemyEndpoints, err := GetRequestEndpoints(a.Config.Alchemy, blockchain, network)
+func (a *AlchemyAPI) GetTransfers(ctx context.Context, query nft.TransferQuery) (*nft.Transfers, error) {
+	blockchain, network, err := getContractsNetwork(query.ContractIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	requestParams, err := params.ToRequestParams()
+	requestParams, err := newAssetTransferRequestParams(query)
 	if err != nil {
 		return nil, err
 	}
@@ -164,94 +232,219 @@ func (a *AlchemyAPI) GetAssetTransfers(params GetAssetTransferParams) (*alchemy.
 		return nil, fmt.Errorf("failed to marshal json: %w", err)
 	}
 
-	requestURL := alchemyEndpoints.TransferEndpoint
+	var response alchemy.AssetTransferResponse
+	err = a.withEndpoints(ctx, blockchain, network, "alchemy_getAssetTransfers", func(alchemyEndpoints *AlchemyEndpoint) error {
+		requestURL := alchemyEndpoints.TransferEndpoint
+
+		res, err := upstreamPostJSON(ctx, a.client(), requestURL.String(), jsonBody)
+		if err != nil {
+			return wrapAlchemyTimeout(err)
+		}
+		defer res.Body.Close()
+
+		err = decodeAlchemyJSON(res, "alchemy_getAssetTransfers", &response)
+		if err != nil {
+			return err
+		}
+
+		if response.Error != nil {
+			message := fmt.Sprintf(
+				"alchemy_getAssetTransfers: %v %v",
+				response.Error.Code,
+				response.Error.Message,
+			)
+			// Alchemy reports throttling in the JSON-RPC error code as well
+			if response.Error.Code == http.StatusTooManyRequests {
+				return ErrAlchemyRateLimited.New(message)
+			}
+			return ErrAlchemyProtocol.New(message)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Result.ToTransfers()
+}
 
-	res, err := alchemyClient.Post(requestURL.String(), "application/json", bytes.NewBuffer(jsonBody))
+// callJSONRPC calls a method of the node API of Alchemy
+func (a *AlchemyAPI) callJSONRPC(ctx context.Context, blockchain string, network string, method string, params []interface{}, result interface{}) error {
+	jsonBody, err := json.Marshal(jsonrpc.Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  method,
+		Params:  params,
+	})
 	if err != nil {
-		return nil, wrapAlchemyTimeout(err)
+		return fmt.Errorf("failed to marshal json: %w", err)
 	}
-	defer res.Body.Close()
 
-	var response alchemy.AssetTransferResponse
-	err = decodeAlchemyJSON(res, "alchemy_getAssetTransfers", &response)
+	var response jsonrpc.Response
+	err = a.withEndpoints(ctx, blockchain, network, method, func(alchemyEndpoints *AlchemyEndpoint) error {
+		requestURL := alchemyEndpoints.TransferEndpoint
+
+		res, err := upstreamPostJSON(ctx, a.client(), requestURL.String(), jsonBody)
+		if err != nil {
+			return wrapAlchemyTimeout(err)
+		}
+		defer res.Body.Close()
+
+		err = decodeAlchemyJSON(res, method, &response)
+		if err != nil {
+			return err
+		}
+
+		if response.Error != nil {
+			message := fmt.Sprintf("%v: %v %v", method, response.Error.Code, response.Error.Message)
+			if response.Error.Code == http.StatusTooManyRequests {
+				return ErrAlchemyRateLimited.New(message)
+			}
+			return ErrAlchemyProtocol.New(message)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if response.Error != nil {
-		return nil, ErrAlchemyProtocol.New(fmt.Sprintf(
-			"alchemy_getAssetTransfers: %v %v",
-			response.Error.Code,
-			response.Error.Message,
-		))
+	err = json.Unmarshal(response.Result, result)
+	if err != nil {
+		return ErrAlchemyProtocol.Wrap(err, fmt.Sprintf("%v: %v", method, string(response.Result)))
 	}
 
-	return &response.Result, nil
+	return nil
 }
 
-func (a *AlchemyAPI) GetContractMetadata(contractID authgearweb3.ContractID) (*alchemy.ContractMetadataResponse, error) {
-	alchemyEndpoints, err := GetRequestEndpoints(a.Config.Alchemy, contractID.Blockchain, contractID.Network)
+func (a *AlchemyAPI) GetBlockNumber(ctx context.Context, blockchain string, network string) (*big.Int, error) {
+	var result string
+	err := a.callJSONRPC(ctx, blockchain, network, "eth_blockNumber", []interface{}{}, &result)
+	if err != nil {
+		return nil, err
+	}
 
+	blockNumber, err := hexstring.Parse(result)
 	if err != nil {
 		return nil, err
 	}
 
-	if contractID.Address == "" {
-		return nil, fmt.Errorf("contractAddress is empty")
+	return blockNumber.ToBigInt(), nil
+}
+
+func (a *AlchemyAPI) GetBlock(ctx context.Context, blockchain string, network string, blockNumber *big.Int) (*nft.Block, error) {
+	var block *jsonrpc.Block
+	err := a.callJSONRPC(ctx, blockchain, network, "eth_getBlockByNumber", []interface{}{toBlockTag(blockNumber, "latest"), false}, &block)
+	if err != nil {
+		return nil, err
 	}
 
-	requestURL := alchemyEndpoints.TransferEndpoint
-	requestURL.Path = path.Join(requestURL.Path, "getContractMetadata")
+	if block == nil {
+		return nil, ErrAlchemyProtocol.New(fmt.Sprintf("eth_getBlockByNumber: block %v not found", blockNumber))
+	}
 
-	requestQuery := requestURL.Query()
-	requestQuery.Set("contractAddress", contractID.Address.String())
+	return block.ToBlock()
+}
 
-	requestURL.RawQuery = requestQuery.Encode()
+func (a *AlchemyAPI) GetContractMetadata(ctx context.Context, contractID authgearweb3.ContractID) (*nft.ContractMetadata, error) {
+	if contractID.Address == "" {
+		return nil, fmt.Errorf("contractAddress is empty")
+	}
 
-	res, err := alchemyClient.Get(requestURL.String())
-	if err != nil {
-		return nil, wrapAlchemyTimeout(err)
+	if a.apiVersion(contractID.Blockchain, contractID.Network) == config.AlchemyAPIVersionV3 {
+		metadatas, err := a.getContractMetadataBatch(ctx, contractID.Blockchain, contractID.Network, []authgearweb3.ContractID{contractID})
+		if err != nil {
+			return nil, err
+		}
+		if len(metadatas) == 0 {
+			return &nft.ContractMetadata{Address: contractID.Address}, nil
+		}
+		return &metadatas[0], nil
 	}
-	defer res.Body.Close()
 
 	var response alchemy.ContractMetadataResponse
-	err = decodeAlchemyJSON(res, "GetContractMetadata", &response)
+	err := a.withEndpoints(ctx, contractID.Blockchain, contractID.Network, "getContractMetadata", func(alchemyEndpoints *AlchemyEndpoint) error {
+		requestURL := alchemyEndpoints.TransferEndpoint
+		requestURL.Path = path.Join(requestURL.Path, "getContractMetadata")
+
+		requestQuery := requestURL.Query()
+		requestQuery.Set("contractAddress", contractID.Address.String())
+
+		requestURL.RawQuery = requestQuery.Encode()
+
+		res, err := upstreamGet(ctx, a.client(), requestURL.String())
+		if err != nil {
+			return wrapAlchemyTimeout(err)
+		}
+		defer res.Body.Close()
+
+		return decodeAlchemyJSON(res, "GetContractMetadata", &response)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &response, nil
+	return response.ToContractMetadata(), nil
 }
 
-func (a *AlchemyAPI) GetOwnersForCollection(contractID authgearweb3.ContractID) (*alchemy.GetOwnersForCollectionResponse, error) {
-	alchemyEndpoints, err := GetRequestEndpoints(a.Config.Alchemy, contractID.Blockchain, contractID.Network)
+// GetContractsMetadata resolves all contracts in one call with NFT API v3, and one call per contract with v2
+func (a *AlchemyAPI) GetContractsMetadata(ctx context.Context, contractIDs []authgearweb3.ContractID) ([]nft.ContractMetadata, error) {
+	blockchain, network, err := getContractsNetwork(contractIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	if contractID.Address == "" {
-		return nil, fmt.Errorf("contractAddress is empty")
+	if a.apiVersion(blockchain, network) == config.AlchemyAPIVersionV3 {
+		return a.getContractMetadataBatch(ctx, blockchain, network, contractIDs)
 	}
 
-	requestURL := alchemyEndpoints.NFTEndpoint
-	requestURL.Path = path.Join(requestURL.Path, "getOwnersForCollection")
+	metadatas := make([]nft.ContractMetadata, 0, len(contractIDs))
+	for _, contractID := range contractIDs {
+		metadata, err := a.GetContractMetadata(ctx, contractID)
+		if err != nil {
+			return nil, err
+		}
+		metadatas = append(metadatas, *metadata)
+	}
 
-	requestQuery := requestURL.Query()
-	requestQuery.Set("contractAddress", contractID.Address.String())
+	return metadatas, nil
+}
 
-	requestURL.RawQuery = requestQuery.Encode()
+func (a *AlchemyAPI) GetContractHolders(ctx context.Context, contractID authgearweb3.ContractID, pageKey string) (*nft.Holders, error) {
+	if contractID.Address == "" {
+		return nil, fmt.Errorf("contractAddress is empty")
+	}
 
-	res, err := alchemyClient.Get(requestURL.String())
-	if err != nil {
-		return nil, wrapAlchemyTimeout(err)
+	if a.apiVersion(contractID.Blockchain, contractID.Network) == config.AlchemyAPIVersionV3 {
+		return a.getOwnersForContract(ctx, contractID, pageKey)
 	}
-	defer res.Body.Close()
 
 	var response alchemy.GetOwnersForCollectionResponse
-	err = decodeAlchemyJSON(res, "getOwnersForCollection", &response)
+	err := a.withEndpoints(ctx, contractID.Blockchain, contractID.Network, "getOwnersForCollection", func(alchemyEndpoints *AlchemyEndpoint) error {
+		requestURL := alchemyEndpoints.NFTEndpoint
+		requestURL.Path = path.Join(requestURL.Path, "getOwnersForCollection")
+
+		requestQuery := requestURL.Query()
+		requestQuery.Set("contractAddress", contractID.Address.String())
+
+		if pageKey != "" {
+			requestQuery.Set("pageKey", pageKey)
+		}
+
+		requestURL.RawQuery = requestQuery.Encode()
+
+		res, err := upstreamGet(ctx, a.client(), requestURL.String())
+		if err != nil {
+			return wrapAlchemyTimeout(err)
+		}
+		defer res.Body.Close()
+
+		return decodeAlchemyJSON(res, "getOwnersForCollection", &response)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &response, nil
+	return response.ToHolders(), nil
 }
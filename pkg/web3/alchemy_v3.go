@@ -0,0 +1,193 @@
+package web3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/alchemy"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+// Batch endpoints of NFT API v3 accept at most 100 items
+const alchemyV3BatchSize = 100
+
+func (a *AlchemyAPI) apiVersion(blockchain string, network string) config.AlchemyAPIVersion {
+	alchemyConfig := a.Config.GetAlchemyConfig(blockchain, network)
+	if alchemyConfig == nil {
+		return config.AlchemyAPIVersionV2
+	}
+	return alchemyConfig.GetAPIVersion()
+}
+
+func postAlchemyNFTJSON[T any](ctx context.Context, client *http.Client, alchemyEndpoints *AlchemyEndpoint, method string, body interface{}, response *T) error {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal json: %w", err)
+	}
+
+	requestURL := alchemyEndpoints.NFTEndpoint
+	requestURL.Path = path.Join(requestURL.Path, method)
+
+	res, err := upstreamPostJSON(ctx, client, requestURL.String(), jsonBody)
+	if err != nil {
+		return wrapAlchemyTimeout(err)
+	}
+	defer res.Body.Close()
+
+	return decodeAlchemyJSON(res, method, response)
+}
+
+func (a *AlchemyAPI) getNFTsForOwner(ctx context.Context, blockchain string, network string, ownerAddress authgearweb3.EIP55, contractAddresses []string, pageKey string) (*nft.OwnedTokens, error) {
+	var response alchemy.GetNFTsForOwnerResponse
+	err := a.withEndpoints(ctx, blockchain, network, "getNFTsForOwner", func(alchemyEndpoints *AlchemyEndpoint) error {
+		requestURL := alchemyEndpoints.NFTEndpoint
+		requestURL.Path = path.Join(requestURL.Path, "getNFTsForOwner")
+
+		requestQuery := requestURL.Query()
+		requestQuery.Set("owner", ownerAddress.String())
+		requestQuery.Set("withMetadata", "false")
+		requestQuery[`contractAddresses[]`] = contractAddresses
+
+		if pageKey != "" {
+			requestQuery.Set("pageKey", pageKey)
+		}
+
+		requestURL.RawQuery = requestQuery.Encode()
+
+		res, err := upstreamGet(ctx, a.client(), requestURL.String())
+		if err != nil {
+			return wrapAlchemyTimeout(err)
+		}
+		defer res.Body.Close()
+
+		return decodeAlchemyJSON(res, "getNFTsForOwner", &response)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.ToOwnedTokens()
+}
+
+// getContractMetadataBatch returns metadata in the order of contractIDs, contracts unknown to Alchemy are left out
+func (a *AlchemyAPI) getContractMetadataBatch(ctx context.Context, blockchain string, network string, contractIDs []authgearweb3.ContractID) ([]nft.ContractMetadata, error) {
+	metadatas := make([]nft.ContractMetadata, 0, len(contractIDs))
+	for start := 0; start < len(contractIDs); start += alchemyV3BatchSize {
+		end := min(start+alchemyV3BatchSize, len(contractIDs))
+		batch := contractIDs[start:end]
+
+		request := alchemy.GetContractMetadataBatchRequest{
+			ContractAddresses: make([]authgearweb3.EIP55, 0, len(batch)),
+		}
+		for _, contractID := range batch {
+			request.ContractAddresses = append(request.ContractAddresses, contractID.Address)
+		}
+
+		var response alchemy.GetContractMetadataBatchResponse
+		err := a.withEndpoints(ctx, blockchain, network, "getContractMetadataBatch", func(alchemyEndpoints *AlchemyEndpoint) error {
+			return postAlchemyNFTJSON(ctx, a.client(), alchemyEndpoints, "getContractMetadataBatch", request, &response)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Alchemy returns lowercase addresses
+		for _, contractID := range batch {
+			for _, contract := range response.Contracts {
+				if strings.EqualFold(contract.Address, contractID.Address.String()) {
+					metadata := contract.ToContractMetadata()
+					metadata.Address = contractID.Address
+					metadatas = append(metadatas, metadata)
+					break
+				}
+			}
+		}
+	}
+
+	return metadatas, nil
+}
+
+func (a *AlchemyAPI) getOwnersForContract(ctx context.Context, contractID authgearweb3.ContractID, pageKey string) (*nft.Holders, error) {
+	var response alchemy.GetOwnersForContractResponse
+	err := a.withEndpoints(ctx, contractID.Blockchain, contractID.Network, "getOwnersForContract", func(alchemyEndpoints *AlchemyEndpoint) error {
+		requestURL := alchemyEndpoints.NFTEndpoint
+		requestURL.Path = path.Join(requestURL.Path, "getOwnersForContract")
+
+		requestQuery := requestURL.Query()
+		requestQuery.Set("contractAddress", contractID.Address.String())
+
+		if pageKey != "" {
+			requestQuery.Set("pageKey", pageKey)
+		}
+
+		requestURL.RawQuery = requestQuery.Encode()
+
+		res, err := upstreamGet(ctx, a.client(), requestURL.String())
+		if err != nil {
+			return wrapAlchemyTimeout(err)
+		}
+		defer res.Body.Close()
+
+		return decodeAlchemyJSON(res, "getOwnersForContract", &response)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.ToHolders(), nil
+}
+
+// GetNFTMetadataBatch returns the metadata of the tokens listed in token_ids of each contract, it requires NFT API v3
+func (a *AlchemyAPI) GetNFTMetadataBatch(ctx context.Context, contractIDs []authgearweb3.ContractID) ([]nft.TokenMetadata, error) {
+	blockchain, network, err := getContractsNetwork(contractIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.apiVersion(blockchain, network) != config.AlchemyAPIVersionV3 {
+		return nil, ErrAlchemyBadRequest.New("getNFTMetadataBatch requires api_version v3")
+	}
+
+	tokens := make([]alchemy.NFTMetadataToken, 0)
+	for _, contractID := range contractIDs {
+		for _, tokenID := range contractID.Query["token_ids"] {
+			decimalTokenID, err := alchemy.TrimmedHexToDecimal(tokenID)
+			if err != nil {
+				return nil, err
+			}
+
+			tokens = append(tokens, alchemy.NFTMetadataToken{
+				ContractAddress: contractID.Address,
+				TokenID:         decimalTokenID,
+			})
+		}
+	}
+
+	metadatas := make([]nft.TokenMetadata, 0, len(tokens))
+	for start := 0; start < len(tokens); start += alchemyV3BatchSize {
+		end := min(start+alchemyV3BatchSize, len(tokens))
+		request := alchemy.GetNFTMetadataBatchRequest{Tokens: tokens[start:end]}
+
+		var response alchemy.GetNFTMetadataBatchResponse
+		err := a.withEndpoints(ctx, blockchain, network, "getNFTMetadataBatch", func(alchemyEndpoints *AlchemyEndpoint) error {
+			return postAlchemyNFTJSON(ctx, a.client(), alchemyEndpoints, "getNFTMetadataBatch", request, &response)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		batch, err := response.ToTokenMetadata()
+		if err != nil {
+			return nil, err
+		}
+		metadatas = append(metadatas, batch...)
+	}
+
+	return metadatas, nil
+}
@@ -0,0 +1,163 @@
+package web3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/alchemy"
+	"github.com/authgear/authgear-server/pkg/api/apierrors"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+// alchemyV3Stub serves getContractMetadataBatch and getNFTsForOwner of NFT API v3
+type alchemyV3Stub struct {
+	// UnknownAddress is left out of getContractMetadataBatch responses
+	UnknownAddress string
+
+	mutex sync.Mutex
+	paths []string
+}
+
+func (s *alchemyV3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.paths = append(s.paths, r.URL.Path)
+	s.mutex.Unlock()
+
+	var response interface{}
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/getContractMetadataBatch"):
+		var request alchemy.GetContractMetadataBatchRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Alchemy returns the contracts in lowercase and in any order
+		contracts := make([]alchemy.ContractV3, 0, len(request.ContractAddresses))
+		for i := len(request.ContractAddresses) - 1; i >= 0; i-- {
+			address := strings.ToLower(request.ContractAddresses[i].String())
+			if address == strings.ToLower(s.UnknownAddress) {
+				continue
+			}
+			contracts = append(contracts, alchemy.ContractV3{Address: address, Name: "Name " + address, TokenType: "ERC721"})
+		}
+		response = alchemy.GetContractMetadataBatchResponse{Contracts: contracts}
+	case strings.HasSuffix(r.URL.Path, "/getNFTsForOwner"):
+		pageKey := "next"
+		response = alchemy.GetNFTsForOwnerResponse{
+			OwnedNFTs: []alchemy.OwnedNFTV3{
+				{ContractAddress: r.URL.Query().Get("contractAddresses[]"), TokenID: "255", Balance: "1"},
+			},
+			PageKey: &pageKey,
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (s *alchemyV3Stub) takePaths() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	paths := s.paths
+	s.paths = nil
+	return paths
+}
+
+func newTestAlchemyV3API(t *testing.T, stub *alchemyV3Stub, apiVersion config.AlchemyAPIVersion) *AlchemyAPI {
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	cfg := newTestAlchemyConfig("key-a")
+	cfg.Chains[0].Endpoints.Alchemy = server.URL
+	cfg.Alchemy[0].APIVersion = apiVersion
+	return &AlchemyAPI{Config: cfg}
+}
+
+func testAddress(i int) string {
+	return fmt.Sprintf("0x%040x", i+1)
+}
+
+func TestAlchemyV3GetContractsMetadata(t *testing.T) {
+	stub := &alchemyV3Stub{UnknownAddress: testAddress(3)}
+	api := newTestAlchemyV3API(t, stub, config.AlchemyAPIVersionV3)
+
+	contractIDs := make([]authgearweb3.ContractID, 0, 150)
+	for i := 0; i < 150; i++ {
+		contractIDs = append(contractIDs, authgearweb3.ContractID{
+			Blockchain: "ethereum",
+			Network:    "1",
+			Address:    authgearweb3.EIP55(testAddress(i)),
+		})
+	}
+
+	metadatas, err := api.GetContractsMetadata(context.Background(), contractIDs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedPaths := []string{
+		"/nft/v3/key-a/getContractMetadataBatch",
+		"/nft/v3/key-a/getContractMetadataBatch",
+	}
+	if paths := stub.takePaths(); fmt.Sprint(paths) != fmt.Sprint(expectedPaths) {
+		t.Errorf("expected requests %v, got %v", expectedPaths, paths)
+	}
+
+	// Contracts unknown to Alchemy are left out, the others keep the order and the address of the request
+	if len(metadatas) != 149 {
+		t.Fatalf("expected 149 contracts, got %v", len(metadatas))
+	}
+	for i, metadata := range metadatas {
+		contractIndex := i
+		if i >= 3 {
+			contractIndex++
+		}
+		if metadata.Address != contractIDs[contractIndex].Address {
+			t.Fatalf("contract %v: expected address %v, got %v", i, contractIDs[contractIndex].Address, metadata.Address)
+		}
+		if metadata.TokenType != "ERC721" {
+			t.Errorf("contract %v: unexpected token type %v", i, metadata.TokenType)
+		}
+	}
+}
+
+func TestAlchemyV3GetOwnedTokens(t *testing.T) {
+	stub := &alchemyV3Stub{}
+	api := newTestAlchemyV3API(t, stub, config.AlchemyAPIVersionV3)
+
+	contractID := authgearweb3.ContractID{Blockchain: "ethereum", Network: "1", Address: authgearweb3.EIP55(testAddress(0))}
+	tokens, err := api.GetOwnedTokens(context.Background(), authgearweb3.EIP55(testAddress(1)), []authgearweb3.ContractID{contractID}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if paths := stub.takePaths(); len(paths) != 1 || paths[0] != "/nft/v3/key-a/getNFTsForOwner" {
+		t.Errorf("unexpected requests %v", paths)
+	}
+
+	// Token IDs of v3 are decimal
+	if len(tokens.Tokens) != 1 || tokens.Tokens[0].TokenID != "0xff" || tokens.PageKey != "next" {
+		t.Errorf("unexpected tokens %+v", tokens)
+	}
+}
+
+func TestAlchemyGetNFTMetadataBatchRequiresV3(t *testing.T) {
+	api := newTestAlchemyV3API(t, &alchemyV3Stub{}, config.AlchemyAPIVersionV2)
+
+	contractID := authgearweb3.ContractID{Blockchain: "ethereum", Network: "1", Address: authgearweb3.EIP55(testAddress(0))}
+	_, err := api.GetNFTMetadataBatch(context.Background(), []authgearweb3.ContractID{contractID})
+	if !apierrors.IsKind(err, ErrAlchemyBadRequest) {
+		t.Fatalf("expected bad request, got %v", err)
+	}
+}
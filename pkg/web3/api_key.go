@@ -0,0 +1,217 @@
+package web3
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-server/pkg/api/apierrors"
+	"github.com/authgear/authgear-server/pkg/util/clock"
+	"github.com/authgear/authgear-server/pkg/util/log"
+)
+
+// isAPIKeyError reports errors caused by the key itself, so the call is worth retrying with another key
+func isAPIKeyError(err error) bool {
+	return apierrors.IsKind(err, ErrAlchemyUnauthorized) ||
+		apierrors.IsKind(err, ErrAlchemyRateLimited) ||
+		apierrors.IsKind(err, ErrUpstreamRateLimited) ||
+		apierrors.IsKind(err, ErrComputeUnitBudgetExceeded)
+}
+
+// shouldCoolDown reports errors returned by the upstream that take the key out of rotation
+func shouldCoolDown(err error) bool {
+	return apierrors.IsKind(err, ErrAlchemyUnauthorized) ||
+		apierrors.IsKind(err, ErrAlchemyRateLimited)
+}
+
+// MaskAPIKey keeps the last 4 characters so that keys can be told apart in logs and usage
+func MaskAPIKey(apiKey string) string {
+	if len(apiKey) <= 4 {
+		return "****"
+	}
+	return "****" + apiKey[len(apiKey)-4:]
+}
+
+type apiKeyState struct {
+	Requests      int64
+	Failures      int64
+	LastFailure   string
+	CooldownUntil time.Time
+}
+
+type APIKeyUsage struct {
+	apiKey string
+
+	Blockchain    string
+	Network       string
+	MaskedKey     string
+	Requests      int64
+	Failures      int64
+	LastFailure   string
+	CooldownUntil *time.Time
+	// ComputeUnitsToday is only tracked for networks with rate_limits
+	ComputeUnitsToday int64
+}
+
+// APIKeyPool rotates the API keys of each network and takes failing keys out of rotation
+type APIKeyPool struct {
+	Clock  clock.Clock
+	Logger *log.Logger
+
+	mutex   sync.Mutex
+	states  map[networkAPIKey]*apiKeyState
+	cursors map[string]int
+}
+
+func NewAPIKeyPool(clock clock.Clock, lf *log.Factory) *APIKeyPool {
+	return &APIKeyPool{
+		Clock:   clock,
+		Logger:  lf.New("api-key-pool"),
+		states:  make(map[networkAPIKey]*apiKeyState),
+		cursors: make(map[string]int),
+	}
+}
+
+func (p *APIKeyPool) getState(key networkAPIKey) *apiKeyState {
+	state, ok := p.states[key]
+	if !ok {
+		state = &apiKeyState{}
+		p.states[key] = state
+	}
+	return state
+}
+
+// Select picks a key that is not cooling down and not excluded
+func (p *APIKeyPool) Select(cfg *config.AlchemyConfig, exclude map[string]struct{}) (string, error) {
+	keys := cfg.GetAPIKeys()
+	if p == nil {
+		if len(keys) == 0 {
+			return "", ErrNoAvailableAPIKey.New("no api key is configured")
+		}
+		return keys[0].Key, nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.Clock.NowUTC()
+	candidates := make([]config.AlchemyAPIKeyConfig, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := exclude[key.Key]; ok {
+			continue
+		}
+
+		state := p.getState(networkAPIKey{Blockchain: cfg.Blockchain, Network: cfg.Network, APIKey: key.Key})
+		if now.Before(state.CooldownUntil) {
+			continue
+		}
+		candidates = append(candidates, key)
+	}
+
+	if len(candidates) == 0 {
+		return "", ErrNoAvailableAPIKey.NewWithDetails("all api keys are cooling down", apierrors.Details{
+			"blockchain": cfg.Blockchain,
+			"network":    cfg.Network,
+		})
+	}
+
+	switch cfg.GetKeySelection() {
+	case config.KeySelectionWeighted:
+		totalWeight := 0
+		for _, key := range candidates {
+			totalWeight += key.GetWeight()
+		}
+
+		n := rand.IntN(totalWeight)
+		for _, key := range candidates {
+			n -= key.GetWeight()
+			if n < 0 {
+				return key.Key, nil
+			}
+		}
+		return candidates[len(candidates)-1].Key, nil
+	default:
+		cursorKey := cfg.Blockchain + "/" + cfg.Network
+		cursor := p.cursors[cursorKey]
+		p.cursors[cursorKey] = cursor + 1
+		return candidates[cursor%len(candidates)].Key, nil
+	}
+}
+
+// Report records the outcome of a call made with the key
+func (p *APIKeyPool) Report(cfg *config.AlchemyConfig, apiKey string, err error) {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	state := p.getState(networkAPIKey{Blockchain: cfg.Blockchain, Network: cfg.Network, APIKey: apiKey})
+	state.Requests++
+
+	if err == nil || !shouldCoolDown(err) {
+		return
+	}
+
+	state.Failures++
+	state.LastFailure = apierrors.AsAPIError(err).Reason
+	state.CooldownUntil = p.Clock.NowUTC().Add(cfg.GetKeyCooldown())
+
+	p.Logger.WithError(err).WithFields(map[string]interface{}{
+		"blockchain": cfg.Blockchain,
+		"network":    cfg.Network,
+		"key":        MaskAPIKey(apiKey),
+		"until":      state.CooldownUntil,
+	}).Warn("api key is taken out of rotation")
+}
+
+// usage returns the usage of every configured key
+func (p *APIKeyPool) usage(cfg config.Config) []APIKeyUsage {
+	usages := make([]APIKeyUsage, 0)
+	if p == nil {
+		return usages
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.Clock.NowUTC()
+	for _, alchemyConfig := range cfg.Alchemy {
+		for _, key := range alchemyConfig.GetAPIKeys() {
+			state := p.getState(networkAPIKey{Blockchain: alchemyConfig.Blockchain, Network: alchemyConfig.Network, APIKey: key.Key})
+
+			usage := APIKeyUsage{
+				apiKey:      key.Key,
+				Blockchain:  alchemyConfig.Blockchain,
+				Network:     alchemyConfig.Network,
+				MaskedKey:   MaskAPIKey(key.Key),
+				Requests:    state.Requests,
+				Failures:    state.Failures,
+				LastFailure: state.LastFailure,
+			}
+			if now.Before(state.CooldownUntil) {
+				cooldownUntil := state.CooldownUntil
+				usage.CooldownUntil = &cooldownUntil
+			}
+			usages = append(usages, usage)
+		}
+	}
+
+	return usages
+}
+
+type UsageReporter struct {
+	Config      config.Config
+	RateLimiter *RateLimiter
+	APIKeyPool  *APIKeyPool
+}
+
+func (r *UsageReporter) GetAPIKeyUsage() []APIKeyUsage {
+	usages := r.APIKeyPool.usage(r.Config)
+	for i, usage := range usages {
+		usages[i].ComputeUnitsToday = r.RateLimiter.ComputeUnitsUsedToday(usage.Blockchain, usage.Network, usage.apiKey)
+	}
+	return usages
+}
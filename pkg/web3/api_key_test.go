@@ -0,0 +1,178 @@
+package web3
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-server/pkg/api/apierrors"
+	"github.com/authgear/authgear-server/pkg/util/log"
+)
+
+func newTestAlchemyConfig(keys ...string) config.Config {
+	apiKeys := make([]config.AlchemyAPIKeyConfig, 0, len(keys))
+	for _, key := range keys {
+		apiKeys = append(apiKeys, config.AlchemyAPIKeyConfig{Key: key})
+	}
+
+	return config.Config{
+		Chains: []config.ChainConfig{{
+			Blockchain: "ethereum",
+			ChainID:    1,
+			Name:       "Ethereum",
+			Endpoints:  config.ChainEndpointsConfig{Alchemy: "https://eth-mainnet.g.alchemy.com"},
+		}},
+		Alchemy: []config.AlchemyConfig{{
+			Blockchain: "ethereum",
+			Network:    "1",
+			APIKeys:    apiKeys,
+		}},
+	}
+}
+
+func TestAPIKeyPoolCooldown(t *testing.T) {
+	cfg := newTestAlchemyConfig("key-a", "key-b")
+	alchemyConfig := cfg.GetAlchemyConfig("ethereum", "1")
+	clock := &fixedClock{Now: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)}
+	pool := NewAPIKeyPool(clock, log.NewFactory(log.LevelInfo))
+
+	type step struct {
+		Advance     time.Duration
+		Report      string
+		ReportErr   error
+		ExpectedKey string
+		ExpectedErr *apierrors.Kind
+	}
+
+	steps := []step{
+		{ExpectedKey: "key-a"},
+		{ExpectedKey: "key-b"},
+		// Errors not caused by the key keep it in rotation
+		{Report: "key-a", ReportErr: ErrAlchemyProtocol.New("bad response"), ExpectedKey: "key-a"},
+		{Report: "key-a", ReportErr: ErrAlchemyUnauthorized.New("unauthorized"), ExpectedKey: "key-b"},
+		{Advance: 10 * time.Second, ExpectedKey: "key-b"},
+		{Report: "key-b", ReportErr: ErrAlchemyRateLimited.New("rate limited"), ExpectedErr: &ErrNoAvailableAPIKey},
+		{Advance: 49 * time.Second, ExpectedErr: &ErrNoAvailableAPIKey},
+		{Advance: time.Second, ExpectedKey: "key-a"},
+	}
+
+	for i, s := range steps {
+		clock.Advance(s.Advance)
+		if s.Report != "" {
+			pool.Report(alchemyConfig, s.Report, s.ReportErr)
+		}
+
+		key, err := pool.Select(alchemyConfig, nil)
+		if s.ExpectedErr != nil {
+			if !apierrors.IsKind(err, *s.ExpectedErr) {
+				t.Fatalf("step %v: expected %v, got %v", i, s.ExpectedErr.Reason, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("step %v: unexpected error: %v", i, err)
+		}
+		if key != s.ExpectedKey {
+			t.Errorf("step %v: expected %v, got %v", i, s.ExpectedKey, key)
+		}
+	}
+
+	usages := pool.usage(cfg)
+	if len(usages) != 2 || usages[0].Requests != 2 || usages[0].Failures != 1 || usages[0].LastFailure != "AlchemyUnauthorized" {
+		t.Errorf("unexpected usage %+v", usages)
+	}
+}
+
+func TestAlchemyAPIKeyFailover(t *testing.T) {
+	cases := []struct {
+		Name          string
+		ExhaustedKeys []string
+		Errors        map[string]error
+		ExpectedTried []string
+		ExpectedErr   *apierrors.Kind
+	}{
+		{
+			Name:          "First key succeeds",
+			Errors:        map[string]error{},
+			ExpectedTried: []string{"key-a"},
+		},
+		{
+			Name:          "Key errors fail over to the next key",
+			Errors:        map[string]error{"key-a": ErrAlchemyUnauthorized.New("unauthorized")},
+			ExpectedTried: []string{"key-a", "key-b"},
+		},
+		{
+			Name:          "Other errors are returned without failing over",
+			Errors:        map[string]error{"key-a": ErrAlchemyBadRequest.New("bad request")},
+			ExpectedTried: []string{"key-a"},
+			ExpectedErr:   &ErrAlchemyBadRequest,
+		},
+		{
+			Name: "Last key error is returned if every key fails",
+			Errors: map[string]error{
+				"key-a": ErrAlchemyUnauthorized.New("unauthorized"),
+				"key-b": ErrAlchemyRateLimited.New("rate limited"),
+			},
+			ExpectedTried: []string{"key-a", "key-b"},
+			ExpectedErr:   &ErrAlchemyRateLimited,
+		},
+		{
+			Name:          "Key with its daily budget used up fails over without calling the upstream",
+			ExhaustedKeys: []string{"key-a"},
+			ExpectedTried: []string{"key-b"},
+		},
+		{
+			Name:          "Budget error is returned if every key is used up",
+			ExhaustedKeys: []string{"key-a", "key-b"},
+			ExpectedTried: []string{},
+			ExpectedErr:   &ErrComputeUnitBudgetExceeded,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			cfg := newTestAlchemyConfig("key-a", "key-b")
+			cfg.RateLimits = []config.RateLimitConfig{{
+				Blockchain:            "ethereum",
+				Network:               "1",
+				ComputeUnitsPerSecond: 1000,
+				DailyComputeUnits:     100,
+			}}
+			clock := &fixedClock{Now: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)}
+			api := &AlchemyAPI{
+				Config:      cfg,
+				RateLimiter: NewRateLimiter(cfg, clock, log.NewFactory(log.LevelInfo)),
+				APIKeyPool:  NewAPIKeyPool(clock, log.NewFactory(log.LevelInfo)),
+			}
+			for _, key := range c.ExhaustedKeys {
+				if err := api.RateLimiter.Acquire(context.Background(), "ethereum", "1", key, "getNFTs"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var tried []string
+			err := api.withEndpoints(context.Background(), "ethereum", "1", "getNFTs", func(endpoints *AlchemyEndpoint) error {
+				tried = append(tried, endpoints.APIKey)
+				return c.Errors[endpoints.APIKey]
+			})
+
+			if c.ExpectedErr != nil {
+				if !apierrors.IsKind(err, *c.ExpectedErr) {
+					t.Fatalf("expected %v, got %v", c.ExpectedErr.Reason, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(tried) != len(c.ExpectedTried) {
+				t.Fatalf("expected keys %v, got %v", c.ExpectedTried, tried)
+			}
+			for i := range tried {
+				if tried[i] != c.ExpectedTried[i] {
+					t.Errorf("expected keys %v, got %v", c.ExpectedTried, tried)
+				}
+			}
+		})
+	}
+}
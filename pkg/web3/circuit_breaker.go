@@ -0,0 +1,205 @@
+package web3
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-server/pkg/api/apierrors"
+	"github.com/authgear/authgear-server/pkg/util/clock"
+	"github.com/authgear/authgear-server/pkg/util/log"
+)
+
+type circuitState string
+
+const (
+	circuitClosed   circuitState = "closed"
+	circuitOpen     circuitState = "open"
+	circuitHalfOpen circuitState = "half_open"
+)
+
+// isUpstreamFailure reports errors that indicate the endpoint is unhealthy,
+// errors caused by the request, the API key or local limits are not counted
+func isUpstreamFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// Transport errors are not wrapped into API errors
+	if !apierrors.IsAPIError(err) {
+		return true
+	}
+
+	return apierrors.IsKind(err, ErrAlchemyUnavailable) ||
+		apierrors.IsKind(err, ErrAlchemyProtocol) ||
+		apierrors.IsKind(err, ErrJSONRPCProtocol)
+}
+
+func circuitEndpoint(providerType config.ProviderType, blockchain string, network string) string {
+	return string(providerType) + ":" + blockchain + "/" + network
+}
+
+type circuitBreaker struct {
+	mutex sync.Mutex
+	state circuitState
+
+	windowStart time.Time
+	requests    int
+	failures    int
+	slowCalls   int
+
+	openedAt          time.Time
+	halfOpenInFlight  int
+	halfOpenSuccesses int
+}
+
+// CircuitBreakers keeps a circuit breaker per upstream endpoint
+type CircuitBreakers struct {
+	Config config.Config
+	Clock  clock.Clock
+	Logger *log.Logger
+
+	mutex    sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func NewCircuitBreakers(cfg config.Config, clock clock.Clock, lf *log.Factory) *CircuitBreakers {
+	return &CircuitBreakers{
+		Config:   cfg,
+		Clock:    clock,
+		Logger:   lf.New("circuit-breaker"),
+		breakers: make(map[string]*circuitBreaker),
+	}
+}
+
+func (c *CircuitBreakers) getBreaker(endpoint string) *circuitBreaker {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	breaker, ok := c.breakers[endpoint]
+	if !ok {
+		breaker = &circuitBreaker{
+			state:       circuitClosed,
+			windowStart: c.Clock.NowMonotonic(),
+		}
+		c.breakers[endpoint] = breaker
+	}
+	return breaker
+}
+
+// Do calls fn unless the breaker of the endpoint is open,
+// calls ended by the cancellation of ctx say nothing about the endpoint and are not counted
+func (c *CircuitBreakers) Do(ctx context.Context, endpoint string, fn func() error) error {
+	if c == nil || c.Config.Upstream.CircuitBreaker.Disabled {
+		return fn()
+	}
+
+	breaker := c.getBreaker(endpoint)
+	err := c.allow(endpoint, breaker)
+	if err != nil {
+		return err
+	}
+
+	start := c.Clock.NowMonotonic()
+	err = fn()
+	c.record(endpoint, breaker, err, c.Clock.NowMonotonic().Sub(start), ctx.Err() != nil)
+	return err
+}
+
+func (c *CircuitBreakers) allow(endpoint string, breaker *circuitBreaker) error {
+	cfg := c.Config.Upstream.CircuitBreaker
+
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	now := c.Clock.NowMonotonic()
+	if breaker.state == circuitOpen && now.Sub(breaker.openedAt) >= cfg.GetOpenDuration() {
+		breaker.state = circuitHalfOpen
+		breaker.halfOpenInFlight = 0
+		breaker.halfOpenSuccesses = 0
+	}
+
+	switch breaker.state {
+	case circuitOpen:
+		return ErrUpstreamCircuitOpen.NewWithDetails("upstream circuit is open", apierrors.Details{"endpoint": endpoint})
+	case circuitHalfOpen:
+		if breaker.halfOpenInFlight+breaker.halfOpenSuccesses >= cfg.GetHalfOpenRequests() {
+			return ErrUpstreamCircuitOpen.NewWithDetails("upstream circuit is half open", apierrors.Details{"endpoint": endpoint})
+		}
+		breaker.halfOpenInFlight++
+	}
+
+	return nil
+}
+
+func (c *CircuitBreakers) record(endpoint string, breaker *circuitBreaker, err error, latency time.Duration, canceled bool) {
+	cfg := c.Config.Upstream.CircuitBreaker
+	failed := isUpstreamFailure(err)
+	slow := latency >= cfg.GetSlowCall()
+
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	now := c.Clock.NowMonotonic()
+	switch breaker.state {
+	case circuitHalfOpen:
+		breaker.halfOpenInFlight--
+		if canceled {
+			return
+		}
+		if failed || slow {
+			c.trip(endpoint, breaker, now)
+			return
+		}
+
+		breaker.halfOpenSuccesses++
+		if breaker.halfOpenSuccesses >= cfg.GetHalfOpenRequests() {
+			breaker.state = circuitClosed
+			breaker.windowStart = now
+			breaker.requests = 0
+			breaker.failures = 0
+			breaker.slowCalls = 0
+			c.Logger.WithField("endpoint", endpoint).Info("upstream circuit is closed")
+		}
+	case circuitClosed:
+		if canceled {
+			return
+		}
+		if now.Sub(breaker.windowStart) >= cfg.GetWindow() {
+			breaker.windowStart = now
+			breaker.requests = 0
+			breaker.failures = 0
+			breaker.slowCalls = 0
+		}
+
+		breaker.requests++
+		if failed {
+			breaker.failures++
+		}
+		if slow {
+			breaker.slowCalls++
+		}
+
+		if breaker.requests < cfg.GetMinRequests() {
+			return
+		}
+
+		errorRate := float64(breaker.failures) / float64(breaker.requests)
+		slowCallRate := float64(breaker.slowCalls) / float64(breaker.requests)
+		if errorRate >= cfg.GetErrorRateThreshold() || slowCallRate >= cfg.GetSlowCallRateThreshold() {
+			c.trip(endpoint, breaker, now)
+		}
+	}
+}
+
+func (c *CircuitBreakers) trip(endpoint string, breaker *circuitBreaker, now time.Time) {
+	breaker.state = circuitOpen
+	breaker.openedAt = now
+	c.Logger.WithFields(map[string]interface{}{
+		"endpoint":   endpoint,
+		"requests":   breaker.requests,
+		"failures":   breaker.failures,
+		"slow_calls": breaker.slowCalls,
+	}).Warn("upstream circuit is open")
+}
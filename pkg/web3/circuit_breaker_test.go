@@ -0,0 +1,130 @@
+package web3
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-server/pkg/util/log"
+)
+
+func TestCircuitBreakers(t *testing.T) {
+	networkErr := errors.New("connection refused")
+	badRequestErr := ErrAlchemyBadRequest.New("bad request")
+
+	type step struct {
+		Advance time.Duration
+		// Latency is how long the call takes
+		Latency       time.Duration
+		Err           error
+		ExpectedOpen  bool
+		ExpectedState circuitState
+	}
+
+	cases := []struct {
+		Name  string
+		Steps []step
+	}{
+		{
+			Name: "Closed breaker trips on the error rate after the minimum requests",
+			Steps: []step{
+				{Err: networkErr, ExpectedState: circuitClosed},
+				{ExpectedState: circuitClosed},
+				{Err: networkErr, ExpectedState: circuitOpen},
+				{ExpectedOpen: true, ExpectedState: circuitOpen},
+			},
+		},
+		{
+			Name: "Errors caused by the request are not counted",
+			Steps: []step{
+				{Err: badRequestErr, ExpectedState: circuitClosed},
+				{Err: badRequestErr, ExpectedState: circuitClosed},
+				{Err: badRequestErr, ExpectedState: circuitClosed},
+			},
+		},
+		{
+			Name: "Slow calls trip the breaker",
+			Steps: []step{
+				{Latency: 2 * time.Second, ExpectedState: circuitClosed},
+				{Latency: 2 * time.Second, ExpectedState: circuitClosed},
+				{ExpectedState: circuitOpen},
+			},
+		},
+		{
+			Name: "Counts reset with the window",
+			Steps: []step{
+				{Err: networkErr, ExpectedState: circuitClosed},
+				{Err: networkErr, ExpectedState: circuitClosed},
+				{Advance: 10 * time.Second, ExpectedState: circuitClosed},
+				{ExpectedState: circuitClosed},
+				{Err: networkErr, ExpectedState: circuitClosed},
+			},
+		},
+		{
+			Name: "Half-open breaker closes after the probe calls succeed",
+			Steps: []step{
+				{Err: networkErr},
+				{Err: networkErr},
+				{Err: networkErr, ExpectedState: circuitOpen},
+				{Advance: 29 * time.Second, ExpectedOpen: true, ExpectedState: circuitOpen},
+				{Advance: time.Second, ExpectedState: circuitHalfOpen},
+				{ExpectedState: circuitClosed},
+				{Err: networkErr, ExpectedState: circuitClosed},
+			},
+		},
+		{
+			Name: "Half-open breaker opens again on a failed probe",
+			Steps: []step{
+				{Err: networkErr},
+				{Err: networkErr},
+				{Err: networkErr, ExpectedState: circuitOpen},
+				{Advance: 30 * time.Second, Err: networkErr, ExpectedState: circuitOpen},
+				{ExpectedOpen: true, ExpectedState: circuitOpen},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			clock := &fixedClock{Now: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)}
+			breakers := NewCircuitBreakers(config.Config{
+				Upstream: config.UpstreamConfig{
+					CircuitBreaker: config.CircuitBreakerConfig{
+						WindowSeconds:    10,
+						MinRequests:      3,
+						SlowCallMs:       1000,
+						OpenSeconds:      30,
+						HalfOpenRequests: 2,
+					},
+				},
+			}, clock, log.NewFactory(log.LevelInfo))
+
+			for i, s := range c.Steps {
+				clock.Advance(s.Advance)
+
+				called := false
+				err := breakers.Do(context.Background(), "alchemy:ethereum/1", func() error {
+					called = true
+					clock.Advance(s.Latency)
+					return s.Err
+				})
+
+				if s.ExpectedOpen {
+					if called || !IsUpstreamUnavailable(err) {
+						t.Fatalf("step %v: expected the call to fail fast, got %v", i, err)
+					}
+				} else if !called || !errors.Is(err, s.Err) {
+					t.Fatalf("step %v: expected the call to be made, got %v", i, err)
+				}
+
+				if s.ExpectedState != "" {
+					if state := breakers.getBreaker("alchemy:ethereum/1").state; state != s.ExpectedState {
+						t.Errorf("step %v: expected %v, got %v", i, s.ExpectedState, state)
+					}
+				}
+			}
+		})
+	}
+}
@@ -6,4 +6,7 @@ import (
 
 var DependencySet = wire.NewSet(
 	wire.Struct(new(AlchemyAPI), "*"),
+	wire.Struct(new(JSONRPCAPI), "*"),
+	wire.Struct(new(NFTDataProviderRouter), "*"),
+	wire.Struct(new(UsageReporter), "*"),
 )
@@ -3,57 +3,40 @@ package web3
 import (
 	"net/url"
 	"path"
-	"strconv"
 
 	"github.com/authgear/authgear-nft-indexer/pkg/config"
 )
 
-const (
-	EthereumMainnetAlchemyEndpoint = "https://eth-mainnet.alchemyapi.io/"
-	EthereumGoerliAlchemyEndpoint  = "https://eth-goerli.g.alchemy.com/"
-	PolygonMainnetAlchemyEndpoint  = "https://polygon-mainnet.g.alchemy.com/"
-	PolygonMumbaiAlchemyEndpoint   = "https://polygon-mumbai.g.alchemy.com/"
-)
-
 type AlchemyEndpoint struct {
+	APIKey           string
+	APIVersion       config.AlchemyAPIVersion
 	TransferEndpoint *url.URL
 	NFTEndpoint      *url.URL
 }
 
-func GetAlchemyEndpoint(blockchain string, network string) string {
-	switch blockchain {
-	case "ethereum":
-		chainID, err := strconv.Atoi(network)
-		if err != nil || chainID < 0 {
-			panic("Ethereum network should have a positive numeric chain ID")
-		}
+func GetAlchemyEndpoint(cfg config.Config, blockchain string, network string) (string, error) {
+	chain := cfg.GetChainConfig(blockchain, network)
+	if chain == nil {
+		return "", NewUnsupportedNetworkError(cfg, blockchain, network)
+	}
 
-		switch chainID {
-		case 1:
-			return EthereumMainnetAlchemyEndpoint
-		case 5:
-			return EthereumGoerliAlchemyEndpoint
-		case 137:
-			return PolygonMainnetAlchemyEndpoint
-		case 80001:
-			return PolygonMumbaiAlchemyEndpoint
-		default:
-			panic("unsupported chain ID")
-		}
+	if chain.Endpoints.Alchemy == "" {
+		return "", NewNetworkNotConfiguredError(cfg, blockchain, network)
 	}
 
-	panic("unsupported blockchain")
+	return chain.Endpoints.Alchemy, nil
 }
 
-func GetRequestEndpoints(alchemyConfigs []config.AlchemyConfig, blockchain string, network string) (*AlchemyEndpoint, error) {
-	endpoint := GetAlchemyEndpoint(blockchain, network)
+// GetRequestEndpoints builds the endpoints of the network with the given API key
+func GetRequestEndpoints(cfg config.Config, blockchain string, network string, apiKey string) (*AlchemyEndpoint, error) {
+	endpoint, err := GetAlchemyEndpoint(cfg, blockchain, network)
+	if err != nil {
+		return nil, err
+	}
 
-	apiKey := ""
-	for _, alchemyConfig := range alchemyConfigs {
-		if alchemyConfig.Blockchain == blockchain && alchemyConfig.Network == network {
-			apiKey = alchemyConfig.APIKey
-			break
-		}
+	apiVersion := config.AlchemyAPIVersionV2
+	if alchemyConfig := cfg.GetAlchemyConfig(blockchain, network); alchemyConfig != nil {
+		apiVersion = alchemyConfig.GetAPIVersion()
 	}
 
 	url, err := url.Parse(endpoint)
@@ -61,12 +44,14 @@ func GetRequestEndpoints(alchemyConfigs []config.AlchemyConfig, blockchain strin
 		return nil, err
 	}
 	transferEndpoint := *url
-	transferEndpoint.Path = path.Join("v2", apiKey)
+	transferEndpoint.Path = path.Join(url.Path, "v2", apiKey)
 
 	nftEndpoint := *url
-	nftEndpoint.Path = path.Join("nft", "v2", apiKey)
+	nftEndpoint.Path = path.Join(url.Path, "nft", string(apiVersion), apiKey)
 
 	return &AlchemyEndpoint{
+		APIKey:           apiKey,
+		APIVersion:       apiVersion,
 		TransferEndpoint: &transferEndpoint,
 		NFTEndpoint:      &nftEndpoint,
 	}, nil
@@ -5,3 +5,26 @@ import (
 )
 
 var ErrAlchemyProtocol = apierrors.InternalError.WithReason("AlchemyProtocol")
+var ErrAlchemyRateLimited = apierrors.TooManyRequest.WithReason("AlchemyRateLimited")
+var ErrAlchemyUnauthorized = apierrors.InternalError.WithReason("AlchemyUnauthorized")
+var ErrAlchemyUnavailable = apierrors.ServiceUnavailable.WithReason("AlchemyUnavailable")
+var ErrAlchemyBadRequest = apierrors.BadRequest.WithReason("AlchemyBadRequest")
+
+var ErrJSONRPCProtocol = apierrors.InternalError.WithReason("JSONRPCProtocol")
+var ErrJSONRPCCallFailed = apierrors.InternalError.WithReason("JSONRPCCallFailed")
+var ErrJSONRPCReplayLimitExceeded = apierrors.InternalError.WithReason("JSONRPCReplayLimitExceeded")
+
+var ErrUnsupportedNetwork = apierrors.BadRequest.WithReason("UnsupportedNetwork")
+var ErrNetworkNotConfigured = apierrors.BadRequest.WithReason("NetworkNotConfigured")
+
+var ErrUpstreamRateLimited = apierrors.TooManyRequest.WithReason("UpstreamRateLimited")
+var ErrComputeUnitBudgetExceeded = apierrors.TooManyRequest.WithReason("ComputeUnitBudgetExceeded")
+var ErrNoAvailableAPIKey = apierrors.ServiceUnavailable.WithReason("NoAvailableAPIKey")
+var ErrUpstreamCircuitOpen = apierrors.ServiceUnavailable.WithReason("UpstreamCircuitOpen")
+
+// IsUpstreamUnavailable reports errors after which stored data is served regardless of freshness
+func IsUpstreamUnavailable(err error) bool {
+	return apierrors.IsKind(err, ErrComputeUnitBudgetExceeded) ||
+		apierrors.IsKind(err, ErrNoAvailableAPIKey) ||
+		apierrors.IsKind(err, ErrUpstreamCircuitOpen)
+}
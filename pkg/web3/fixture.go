@@ -0,0 +1,181 @@
+package web3
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+)
+
+const scrubbedAPIKey = "REDACTED"
+
+// Alchemy and most hosted nodes put the API key in the path segment after the version
+var apiKeyPathRegex = regexp.MustCompile(`(/(?:nft/)?v[0-9]+/)[^/?]+`)
+
+var apiKeyQueryParams = []string{"key", "apikey", "api_key", "token", "access_token"}
+
+// ScrubURL removes API keys from an upstream URL so it can be committed alongside fixtures
+func ScrubURL(u *url.URL) string {
+	scrubbed := *u
+	scrubbed.User = nil
+	scrubbed.Path = apiKeyPathRegex.ReplaceAllString(u.Path, "${1}"+scrubbedAPIKey)
+	scrubbed.RawPath = ""
+
+	query := u.Query()
+	for name := range query {
+		for _, p := range apiKeyQueryParams {
+			if strings.EqualFold(name, p) {
+				query.Set(name, scrubbedAPIKey)
+			}
+		}
+	}
+	scrubbed.RawQuery = query.Encode()
+
+	return scrubbed.String()
+}
+
+type fixture struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	RequestBody string      `json:"request_body,omitempty"`
+	StatusCode  int         `json:"status_code"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        string      `json:"body"`
+}
+
+// FixtureTransport records upstream responses to Dir, or replays them without touching the network.
+// Requests are matched by method, scrubbed URL and body.
+type FixtureTransport struct {
+	Base http.RoundTripper
+	Mode config.FixturesMode
+	Dir  string
+}
+
+func (t *FixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	scrubbedURL := ScrubURL(req.URL)
+	path := filepath.Join(t.Dir, fixtureKey(req.Method, scrubbedURL, reqBody)+".json")
+
+	switch t.Mode {
+	case config.FixturesModeReplay:
+		return t.replay(req, path, scrubbedURL)
+	case config.FixturesModeRecord:
+		return t.record(req, path, scrubbedURL, reqBody)
+	default:
+		return t.Base.RoundTrip(req)
+	}
+}
+
+func (t *FixtureTransport) replay(req *http.Request, path string, scrubbedURL string) (*http.Response, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("web3: no fixture for %v %v: %w", req.Method, scrubbedURL, err)
+	}
+
+	var f fixture
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, fmt.Errorf("web3: invalid fixture %v: %w", path, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.StatusCode, http.StatusText(f.StatusCode)),
+		StatusCode:    f.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.Header,
+		Body:          io.NopCloser(strings.NewReader(f.Body)),
+		ContentLength: int64(len(f.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *FixtureTransport) record(req *http.Request, path string, scrubbedURL string, reqBody []byte) (*http.Response, error) {
+	res, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := res.Header.Clone()
+	header.Del("Set-Cookie")
+
+	data, err := json.MarshalIndent(fixture{
+		Method:      req.Method,
+		URL:         scrubbedURL,
+		RequestBody: string(reqBody),
+		StatusCode:  res.StatusCode,
+		Header:      header,
+		Body:        string(body),
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeFileAtomic(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("web3: failed to record fixture: %w", err)
+	}
+
+	return res, nil
+}
+
+func fixtureKey(method string, scrubbedURL string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte("\n"))
+	h.Write([]byte(scrubbedURL))
+	h.Write([]byte("\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".fixture-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,574 @@
+package web3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/database"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/jsonrpc"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
+	"github.com/authgear/authgear-server/pkg/api/apierrors"
+	"github.com/authgear/authgear-server/pkg/util/hexstring"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+// Holders are paginated with the same page size as alchemy getOwnersForCollection
+const jsonRPCHoldersPageSize = 50000
+
+// Replays stop after this many pages of max_block_range blocks instead of scanning the chain without bound
+const jsonRPCMaxReplayPages = 1000
+
+func wrapJSONRPCTimeout(err error) error {
+	if os.IsTimeout(err) {
+		return ErrJSONRPCProtocol.Wrap(err, "timeout")
+	}
+
+	return err
+}
+
+// JSONRPCAPI derives NFT data from plain Ethereum JSON-RPC, so it works with any node
+type JSONRPCAPI struct {
+	Config          config.Config
+	RateLimiter     *RateLimiter
+	CircuitBreakers *CircuitBreakers
+}
+
+func (a *JSONRPCAPI) client() *http.Client {
+	return newUpstreamClient(a.Config.Upstream)
+}
+
+type jsonRPCEndpoint struct {
+	Blockchain    string
+	Network       string
+	URL           string
+	MaxBlockRange int64
+}
+
+func (a *JSONRPCAPI) getEndpoint(blockchain string, network string) (*jsonRPCEndpoint, error) {
+	providerConfig := a.Config.GetProviderConfig(blockchain, network)
+	if providerConfig == nil || providerConfig.Type != config.ProviderTypeJSONRPC {
+		return nil, NewNetworkNotConfiguredError(a.Config, blockchain, network)
+	}
+
+	url := a.Config.GetJSONRPCURL(blockchain, network)
+	if url == "" {
+		return nil, NewNetworkNotConfiguredError(a.Config, blockchain, network)
+	}
+
+	return &jsonRPCEndpoint{
+		Blockchain:    blockchain,
+		Network:       network,
+		URL:           url,
+		MaxBlockRange: providerConfig.MaxBlockRange,
+	}, nil
+}
+
+func (a *JSONRPCAPI) post(ctx context.Context, endpoint *jsonRPCEndpoint, method string, jsonBody []byte) (*jsonrpc.Response, error) {
+	res, err := upstreamPostJSON(ctx, a.client(), endpoint.URL, jsonBody)
+	if err != nil {
+		return nil, wrapJSONRPCTimeout(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, ErrJSONRPCProtocol.New(fmt.Sprintf("%v: %v %v", method, res.StatusCode, string(body)))
+	}
+
+	var buf bytes.Buffer
+	reader := io.TeeReader(res.Body, &buf)
+
+	var response jsonrpc.Response
+	err = json.NewDecoder(reader).Decode(&response)
+	if err != nil {
+		return nil, ErrJSONRPCProtocol.Wrap(err, fmt.Sprintf("%v: %v", method, buf.String()))
+	}
+
+	return &response, nil
+}
+
+func (a *JSONRPCAPI) call(ctx context.Context, endpoint *jsonRPCEndpoint, method string, params []interface{}, result interface{}) error {
+	jsonBody, err := json.Marshal(jsonrpc.Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal json: %w", err)
+	}
+
+	// Acquired outside of the breaker, which only sees the upstream call
+	err = a.RateLimiter.Acquire(ctx, endpoint.Blockchain, endpoint.Network, "", method)
+	if err != nil {
+		return err
+	}
+
+	var response *jsonrpc.Response
+	err = a.CircuitBreakers.Do(ctx, circuitEndpoint(config.ProviderTypeJSONRPC, endpoint.Blockchain, endpoint.Network), func() error {
+		var err error
+		response, err = a.post(ctx, endpoint, method, jsonBody)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Errors returned by the node are caused by the call, e.g. a log range too large
+	if response.Error != nil {
+		return ErrJSONRPCCallFailed.New(fmt.Sprintf("%v: %v %v", method, response.Error.Code, response.Error.Message))
+	}
+
+	err = json.Unmarshal(response.Result, result)
+	if err != nil {
+		return ErrJSONRPCProtocol.Wrap(err, fmt.Sprintf("%v: %v", method, string(response.Result)))
+	}
+
+	return nil
+}
+
+func (a *JSONRPCAPI) getBlockNumber(ctx context.Context, endpoint *jsonRPCEndpoint) (*big.Int, error) {
+	var result string
+	err := a.call(ctx, endpoint, "eth_blockNumber", []interface{}{}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	blockNumber, err := hexstring.Parse(result)
+	if err != nil {
+		return nil, err
+	}
+
+	return blockNumber.ToBigInt(), nil
+}
+
+func (a *JSONRPCAPI) getBlockByNumber(ctx context.Context, endpoint *jsonRPCEndpoint, blockNumber *big.Int) (*jsonrpc.Block, error) {
+	var block *jsonrpc.Block
+	err := a.call(ctx, endpoint, "eth_getBlockByNumber", []interface{}{toBlockTag(blockNumber, "latest"), false}, &block)
+	if err != nil {
+		return nil, err
+	}
+
+	if block == nil {
+		return nil, ErrJSONRPCProtocol.New(fmt.Sprintf("eth_getBlockByNumber: block %v not found", blockNumber))
+	}
+
+	return block, nil
+}
+
+func (a *JSONRPCAPI) getLogs(ctx context.Context, endpoint *jsonRPCEndpoint, filter jsonrpc.LogFilter) ([]jsonrpc.Log, error) {
+	logs := make([]jsonrpc.Log, 0)
+	err := a.call(ctx, endpoint, "eth_getLogs", []interface{}{filter}, &logs)
+	if err != nil {
+		return nil, err
+	}
+
+	return logs, nil
+}
+
+// getTransfersInRange decodes all ERC-721 and ERC-1155 transfers between fromBlock and toBlock inclusively
+func (a *JSONRPCAPI) getTransfersInRange(ctx context.Context, endpoint *jsonRPCEndpoint, query nft.TransferQuery, fromBlock *big.Int, toBlock *big.Int) ([]nft.Transfer, error) {
+	contractAddresses := make([]authgearweb3.EIP55, 0, len(query.ContractIDs))
+	for _, contractID := range query.ContractIDs {
+		contractAddresses = append(contractAddresses, contractID.Address)
+	}
+
+	filters := []jsonrpc.LogFilter{
+		jsonrpc.NewERC721TransferFilter(contractAddresses, query.FromAddress, query.ToAddress),
+		jsonrpc.NewERC1155TransferFilter(contractAddresses, query.FromAddress, query.ToAddress),
+	}
+
+	blockTimestamps := make(map[string]*time.Time)
+	transfers := make([]nft.Transfer, 0)
+	for _, filter := range filters {
+		filter.FromBlock = toBlockTag(fromBlock, "0x0")
+		filter.ToBlock = toBlockTag(toBlock, "latest")
+
+		logs, err := a.getLogs(ctx, endpoint, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, log := range logs {
+			if log.Removed {
+				continue
+			}
+
+			blockTimestamp, ok := blockTimestamps[log.BlockNumber]
+			if !ok {
+				blockNumber, err := hexstring.Parse(log.BlockNumber)
+				if err != nil {
+					return nil, err
+				}
+
+				block, err := a.getBlockByNumber(ctx, endpoint, blockNumber.ToBigInt())
+				if err != nil {
+					return nil, err
+				}
+
+				blockTimestamp, err = block.Time()
+				if err != nil {
+					return nil, err
+				}
+				blockTimestamps[log.BlockNumber] = blockTimestamp
+			}
+
+			logTransfers, err := log.ToTransfers(blockTimestamp)
+			if err != nil {
+				return nil, err
+			}
+			transfers = append(transfers, logTransfers...)
+		}
+	}
+
+	sortTransfers(transfers, query.Order)
+
+	return transfers, nil
+}
+
+func sortTransfers(transfers []nft.Transfer, order nft.TransferOrder) {
+	sort.SliceStable(transfers, func(i, j int) bool {
+		c := transfers[i].BlockNumber.Cmp(transfers[j].BlockNumber)
+		if c == 0 {
+			c = transfers[i].LogIndex - transfers[j].LogIndex
+		}
+
+		if order == nft.TransferOrderDescending {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+func (a *JSONRPCAPI) GetBlockNumber(ctx context.Context, blockchain string, network string) (*big.Int, error) {
+	endpoint, err := a.getEndpoint(blockchain, network)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.getBlockNumber(ctx, endpoint)
+}
+
+func (a *JSONRPCAPI) GetBlock(ctx context.Context, blockchain string, network string, blockNumber *big.Int) (*nft.Block, error) {
+	endpoint, err := a.getEndpoint(blockchain, network)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := a.getBlockByNumber(ctx, endpoint, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return block.ToBlock()
+}
+
+// GetTransfers pages through the block range in chunks of max_block_range blocks,
+// the page key is the block number where the next page starts
+func (a *JSONRPCAPI) GetTransfers(ctx context.Context, query nft.TransferQuery) (*nft.Transfers, error) {
+	blockchain, network, err := getContractsNetwork(query.ContractIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, err := a.getEndpoint(blockchain, network)
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint.MaxBlockRange <= 0 {
+		if query.PageKey != "" {
+			return nil, fmt.Errorf("unexpected page key: %v", query.PageKey)
+		}
+
+		transfers, err := a.getTransfersInRange(ctx, endpoint, query, query.FromBlock, query.ToBlock)
+		if err != nil {
+			return nil, err
+		}
+
+		return &nft.Transfers{Transfers: transfers}, nil
+	}
+
+	fromBlock := query.FromBlock
+	if fromBlock == nil {
+		fromBlock = big.NewInt(0)
+	}
+
+	toBlock := query.ToBlock
+	if toBlock == nil {
+		toBlock, err = a.getBlockNumber(ctx, endpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var cursor *big.Int
+	if query.PageKey != "" {
+		pageKey, err := hexstring.Parse(query.PageKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid page key: %w", err)
+		}
+		cursor = pageKey.ToBigInt()
+	}
+
+	blockRange := big.NewInt(endpoint.MaxBlockRange)
+	var pageFrom, pageTo, nextCursor *big.Int
+	if query.Order == nft.TransferOrderDescending {
+		pageTo = toBlock
+		if cursor != nil {
+			pageTo = cursor
+		}
+		pageFrom = new(big.Int).Sub(pageTo, blockRange)
+		pageFrom.Add(pageFrom, big.NewInt(1))
+		if pageFrom.Cmp(fromBlock) <= 0 {
+			pageFrom = fromBlock
+		} else {
+			nextCursor = new(big.Int).Sub(pageFrom, big.NewInt(1))
+		}
+	} else {
+		pageFrom = fromBlock
+		if cursor != nil {
+			pageFrom = cursor
+		}
+		pageTo = new(big.Int).Add(pageFrom, blockRange)
+		pageTo.Sub(pageTo, big.NewInt(1))
+		if pageTo.Cmp(toBlock) >= 0 {
+			pageTo = toBlock
+		} else {
+			nextCursor = new(big.Int).Add(pageTo, big.NewInt(1))
+		}
+	}
+
+	transfers, err := a.getTransfersInRange(ctx, endpoint, query, pageFrom, pageTo)
+	if err != nil {
+		return nil, err
+	}
+
+	pageKey := ""
+	if nextCursor != nil {
+		pageKey = toBlockTag(nextCursor, "")
+	}
+
+	return &nft.Transfers{
+		Transfers: transfers,
+		PageKey:   pageKey,
+	}, nil
+}
+
+func (a *JSONRPCAPI) replayTransfers(ctx context.Context, query nft.TransferQuery, balances *nft.Balances) error {
+	for page := 0; page == 0 || query.PageKey != ""; page++ {
+		if page >= jsonRPCMaxReplayPages {
+			return ErrJSONRPCReplayLimitExceeded.New(fmt.Sprintf("transfer replay exceeds %v pages, use a node without max_block_range", jsonRPCMaxReplayPages))
+		}
+
+		transfers, err := a.GetTransfers(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		for _, transfer := range transfers.Transfers {
+			balances.Apply(transfer)
+		}
+
+		query.PageKey = transfers.PageKey
+	}
+
+	return nil
+}
+
+// GetOwnedTokens replays every transfer from and to the owner from block 0, so there is always a single page.
+// With max_block_range the replay is capped at jsonRPCMaxReplayPages pages per direction,
+// owners of chains longer than that need a node without max_block_range or an indexed collection
+func (a *JSONRPCAPI) GetOwnedTokens(ctx context.Context, ownerAddress authgearweb3.EIP55, contractIDs []authgearweb3.ContractID, pageKey string) (*nft.OwnedTokens, error) {
+	balances := nft.NewBalances()
+
+	err := a.replayTransfers(ctx, nft.TransferQuery{
+		ContractIDs: contractIDs,
+		FromAddress: ownerAddress,
+		Order:       nft.TransferOrderAscending,
+	}, balances)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.replayTransfers(ctx, nft.TransferQuery{
+		ContractIDs: contractIDs,
+		ToAddress:   ownerAddress,
+		Order:       nft.TransferOrderAscending,
+	}, balances)
+	if err != nil {
+		return nil, err
+	}
+
+	return &nft.OwnedTokens{
+		Tokens: balances.Holdings(ownerAddress),
+	}, nil
+}
+
+// GetContractHolders replays the full transfer history of the contract, the page key is the holder offset
+func (a *JSONRPCAPI) GetContractHolders(ctx context.Context, contractID authgearweb3.ContractID, pageKey string) (*nft.Holders, error) {
+	if contractID.Address == "" {
+		return nil, fmt.Errorf("contractAddress is empty")
+	}
+
+	offset := 0
+	if pageKey != "" {
+		var err error
+		offset, err = strconv.Atoi(pageKey)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid page key: %v", pageKey)
+		}
+	}
+
+	balances := nft.NewBalances()
+	err := a.replayTransfers(ctx, nft.TransferQuery{
+		ContractIDs: []authgearweb3.ContractID{contractID},
+		Order:       nft.TransferOrderAscending,
+	}, balances)
+	if err != nil {
+		return nil, err
+	}
+
+	holders := balances.Holders()
+	ownerAddresses := make([]string, 0)
+	for i := offset; i < len(holders) && i < offset+jsonRPCHoldersPageSize; i++ {
+		ownerAddresses = append(ownerAddresses, holders[i].String())
+	}
+
+	nextPageKey := ""
+	if offset+jsonRPCHoldersPageSize < len(holders) {
+		nextPageKey = strconv.Itoa(offset + jsonRPCHoldersPageSize)
+	}
+
+	return &nft.Holders{
+		OwnerAddresses: ownerAddresses,
+		PageKey:        nextPageKey,
+	}, nil
+}
+
+func (a *JSONRPCAPI) ethCall(ctx context.Context, endpoint *jsonRPCEndpoint, message jsonrpc.CallMessage) (string, error) {
+	var result string
+	err := a.call(ctx, endpoint, "eth_call", []interface{}{message, "latest"}, &result)
+	if err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
+
+// ethCallOptional treats a failed call as an unimplemented optional function,
+// other errors such as an unreachable node are returned
+func (a *JSONRPCAPI) ethCallOptional(ctx context.Context, endpoint *jsonRPCEndpoint, message jsonrpc.CallMessage) (result string, ok bool, err error) {
+	result, err = a.ethCall(ctx, endpoint, message)
+	if apierrors.IsKind(err, ErrJSONRPCCallFailed) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	return result, true, nil
+}
+
+func (a *JSONRPCAPI) supportsInterface(ctx context.Context, endpoint *jsonRPCEndpoint, contractAddress authgearweb3.EIP55, interfaceID string) (bool, error) {
+	// Contracts without ERC-165 revert
+	result, ok, err := a.ethCallOptional(ctx, endpoint, jsonrpc.NewSupportsInterfaceCall(contractAddress, interfaceID))
+	if err != nil || !ok {
+		return false, err
+	}
+
+	supported, err := jsonrpc.DecodeBool(result)
+	if err != nil {
+		return false, nil
+	}
+
+	return supported, nil
+}
+
+// GetContractMetadata reads the optional name, symbol and totalSupply functions and detects the token type with ERC-165
+func (a *JSONRPCAPI) GetContractMetadata(ctx context.Context, contractID authgearweb3.ContractID) (*nft.ContractMetadata, error) {
+	endpoint, err := a.getEndpoint(contractID.Blockchain, contractID.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	if contractID.Address == "" {
+		return nil, fmt.Errorf("contractAddress is empty")
+	}
+
+	tokenType := ""
+	isERC721, err := a.supportsInterface(ctx, endpoint, contractID.Address, jsonrpc.ERC721InterfaceID)
+	if err != nil {
+		return nil, err
+	}
+	if isERC721 {
+		tokenType = string(database.NFTCollectionTypeERC721)
+	} else {
+		isERC1155, err := a.supportsInterface(ctx, endpoint, contractID.Address, jsonrpc.ERC1155InterfaceID)
+		if err != nil {
+			return nil, err
+		}
+		if isERC1155 {
+			tokenType = string(database.NFTCollectionTypeERC1155)
+		}
+	}
+
+	metadata := &nft.ContractMetadata{
+		Address:   contractID.Address,
+		TokenType: tokenType,
+	}
+
+	result, ok, err := a.ethCallOptional(ctx, endpoint, jsonrpc.CallMessage{To: contractID.Address, Data: jsonrpc.NameSelector})
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if name, err := jsonrpc.DecodeString(result); err == nil {
+			metadata.Name = name
+		}
+	}
+
+	result, ok, err = a.ethCallOptional(ctx, endpoint, jsonrpc.CallMessage{To: contractID.Address, Data: jsonrpc.SymbolSelector})
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if symbol, err := jsonrpc.DecodeString(result); err == nil {
+			metadata.Symbol = symbol
+		}
+	}
+
+	result, ok, err = a.ethCallOptional(ctx, endpoint, jsonrpc.CallMessage{To: contractID.Address, Data: jsonrpc.TotalSupplySelector})
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if totalSupply, err := jsonrpc.DecodeUint256(result); err == nil {
+			metadata.TotalSupply = totalSupply.String()
+		}
+	}
+
+	return metadata, nil
+}
+
+func (a *JSONRPCAPI) GetContractsMetadata(ctx context.Context, contractIDs []authgearweb3.ContractID) ([]nft.ContractMetadata, error) {
+	metadatas := make([]nft.ContractMetadata, 0, len(contractIDs))
+	for _, contractID := range contractIDs {
+		metadata, err := a.GetContractMetadata(ctx, contractID)
+		if err != nil {
+			return nil, err
+		}
+		metadatas = append(metadatas, *metadata)
+	}
+
+	return metadatas, nil
+}
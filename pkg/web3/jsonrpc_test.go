@@ -0,0 +1,349 @@
+package web3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/jsonrpc"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
+	"github.com/authgear/authgear-server/pkg/api/apierrors"
+	"github.com/authgear/authgear-server/pkg/util/hexstring"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+const (
+	testContractAddress = "0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D"
+	testOwnerAddress    = "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+	testOtherAddress    = "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+)
+
+type blockRange struct {
+	From int64
+	To   int64
+}
+
+// jsonRPCStub serves eth_blockNumber, eth_getBlockByNumber and eth_getLogs of a chain with the given logs
+type jsonRPCStub struct {
+	Head int64
+	Logs []jsonrpc.Log
+
+	mutex        sync.Mutex
+	erc721Ranges []blockRange
+}
+
+func (s *jsonRPCStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result interface{}
+	switch req.Method {
+	case "eth_blockNumber":
+		result = fmt.Sprintf("0x%x", s.Head)
+	case "eth_getBlockByNumber":
+		var number string
+		_ = json.Unmarshal(req.Params[0], &number)
+		result = jsonrpc.Block{Number: number, Hash: "0xhash" + number, Timestamp: "0x6530f100"}
+	case "eth_getLogs":
+		var filter struct {
+			FromBlock string        `json:"fromBlock"`
+			ToBlock   string        `json:"toBlock"`
+			Topics    []interface{} `json:"topics"`
+		}
+		_ = json.Unmarshal(req.Params[0], &filter)
+		from := mustParseHex(filter.FromBlock)
+		to := mustParseHex(filter.ToBlock)
+
+		// ERC-721 filters have a single topic0, ERC-1155 filters match both transfer events
+		_, isERC721 := filter.Topics[0].(string)
+		if isERC721 {
+			s.mutex.Lock()
+			s.erc721Ranges = append(s.erc721Ranges, blockRange{From: from, To: to})
+			s.mutex.Unlock()
+		}
+
+		logs := make([]jsonrpc.Log, 0)
+		for _, log := range s.Logs {
+			blockNumber := mustParseHex(log.BlockNumber)
+			if blockNumber >= from && blockNumber <= to && matchTopics(filter.Topics, log.Topics) {
+				logs = append(logs, log)
+			}
+		}
+		result = logs
+	default:
+		_ = json.NewEncoder(w).Encode(jsonrpc.Response{JSONRPC: "2.0", ID: 1, Error: &jsonrpc.Error{Code: -32601, Message: "method not found"}})
+		return
+	}
+
+	raw, _ := json.Marshal(result)
+	_ = json.NewEncoder(w).Encode(jsonrpc.Response{JSONRPC: "2.0", ID: 1, Result: raw})
+}
+
+func (s *jsonRPCStub) takeERC721Ranges() []blockRange {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ranges := s.erc721Ranges
+	s.erc721Ranges = nil
+	return ranges
+}
+
+// matchTopics follows eth_getLogs, a nil topic matches anything and a list matches any of its values
+func matchTopics(filterTopics []interface{}, logTopics []string) bool {
+	for i, filterTopic := range filterTopics {
+		if filterTopic == nil {
+			continue
+		}
+		if i >= len(logTopics) {
+			return false
+		}
+
+		matched := false
+		switch filterTopic := filterTopic.(type) {
+		case string:
+			matched = filterTopic == logTopics[i]
+		case []interface{}:
+			for _, topic := range filterTopic {
+				matched = matched || topic == logTopics[i]
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseHex(s string) int64 {
+	h, err := hexstring.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return h.ToBigInt().Int64()
+}
+
+func newTestJSONRPCAPI(t *testing.T, stub *jsonRPCStub, maxBlockRange int64) *JSONRPCAPI {
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	return &JSONRPCAPI{
+		Config: config.Config{
+			Chains: []config.ChainConfig{{Blockchain: "ethereum", ChainID: 1, Name: "Ethereum"}},
+			Providers: []config.ProviderConfig{{
+				Blockchain:    "ethereum",
+				Network:       "1",
+				Type:          config.ProviderTypeJSONRPC,
+				URL:           server.URL,
+				MaxBlockRange: maxBlockRange,
+			}},
+		},
+	}
+}
+
+func testContractID(t *testing.T) authgearweb3.ContractID {
+	contractID, err := authgearweb3.NewContractID("ethereum", "1", testContractAddress, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *contractID
+}
+
+func addressTopic(address string) string {
+	return jsonrpc.AddressTopic(authgearweb3.EIP55(address))
+}
+
+func erc721TransferLog(blockNumber int64, logIndex int64, from string, to string, tokenID int64) jsonrpc.Log {
+	return jsonrpc.Log{
+		Address:         testContractAddress,
+		Topics:          []string{jsonrpc.ERC721TransferTopic, addressTopic(from), addressTopic(to), fmt.Sprintf("0x%064x", tokenID)},
+		Data:            "0x",
+		BlockNumber:     fmt.Sprintf("0x%x", blockNumber),
+		TransactionHash: fmt.Sprintf("0xtx%v", blockNumber),
+		LogIndex:        fmt.Sprintf("0x%x", logIndex),
+	}
+}
+
+func erc1155TransferSingleLog(blockNumber int64, logIndex int64, from string, to string, tokenID int64, value int64) jsonrpc.Log {
+	return jsonrpc.Log{
+		Address:         testContractAddress,
+		Topics:          []string{jsonrpc.ERC1155TransferSingleTopic, addressTopic(from), addressTopic(from), addressTopic(to)},
+		Data:            fmt.Sprintf("0x%064x%064x", tokenID, value),
+		BlockNumber:     fmt.Sprintf("0x%x", blockNumber),
+		TransactionHash: fmt.Sprintf("0xtx%v", blockNumber),
+		LogIndex:        fmt.Sprintf("0x%x", logIndex),
+	}
+}
+
+func TestJSONRPCGetTransfersPaging(t *testing.T) {
+	zero := "0x0000000000000000000000000000000000000000"
+	stub := &jsonRPCStub{
+		Head: 250,
+		Logs: []jsonrpc.Log{
+			erc721TransferLog(10, 0, zero, testOwnerAddress, 1),
+			erc1155TransferSingleLog(120, 3, zero, testOwnerAddress, 2, 5),
+			erc721TransferLog(120, 1, testOwnerAddress, testOtherAddress, 1),
+			erc721TransferLog(240, 0, testOtherAddress, testOwnerAddress, 1),
+		},
+	}
+	api := newTestJSONRPCAPI(t, stub, 100)
+
+	cases := []struct {
+		Order          nft.TransferOrder
+		ExpectedRanges []blockRange
+		ExpectedKeys   []string
+		ExpectedBlocks []int64
+	}{
+		{
+			Order:          nft.TransferOrderAscending,
+			ExpectedRanges: []blockRange{{0, 99}, {100, 199}, {200, 250}},
+			ExpectedKeys:   []string{"0x64", "0xc8", ""},
+			ExpectedBlocks: []int64{10, 120, 120, 240},
+		},
+		{
+			Order:          nft.TransferOrderDescending,
+			ExpectedRanges: []blockRange{{151, 250}, {51, 150}, {0, 50}},
+			ExpectedKeys:   []string{"0x96", "0x32", ""},
+			ExpectedBlocks: []int64{240, 120, 120, 10},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.Order), func(t *testing.T) {
+			query := nft.TransferQuery{
+				ContractIDs: []authgearweb3.ContractID{testContractID(t)},
+				Order:       c.Order,
+			}
+
+			var keys []string
+			var transfers []nft.Transfer
+			for ok := true; ok; ok = query.PageKey != "" {
+				page, err := api.GetTransfers(context.Background(), query)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				keys = append(keys, page.PageKey)
+				transfers = append(transfers, page.Transfers...)
+				query.PageKey = page.PageKey
+			}
+
+			ranges := stub.takeERC721Ranges()
+			if fmt.Sprint(ranges) != fmt.Sprint(c.ExpectedRanges) {
+				t.Errorf("expected ranges %v, got %v", c.ExpectedRanges, ranges)
+			}
+			if fmt.Sprint(keys) != fmt.Sprint(c.ExpectedKeys) {
+				t.Errorf("expected page keys %q, got %q", c.ExpectedKeys, keys)
+			}
+
+			blocks := make([]int64, 0, len(transfers))
+			for _, transfer := range transfers {
+				blocks = append(blocks, transfer.BlockNumber.Int64())
+			}
+			if fmt.Sprint(blocks) != fmt.Sprint(c.ExpectedBlocks) {
+				t.Errorf("expected transfers at blocks %v, got %v", c.ExpectedBlocks, blocks)
+			}
+
+			// Transfers in the same block are ordered by log index
+			if transfers[1].LogIndex+transfers[2].LogIndex != 4 || (transfers[1].LogIndex < transfers[2].LogIndex) != (c.Order == nft.TransferOrderAscending) {
+				t.Errorf("unexpected log order %v, %v", transfers[1].LogIndex, transfers[2].LogIndex)
+			}
+		})
+	}
+}
+
+func TestJSONRPCGetTransfersBoundedRange(t *testing.T) {
+	stub := &jsonRPCStub{Head: 1000}
+	api := newTestJSONRPCAPI(t, stub, 100)
+
+	page, err := api.GetTransfers(context.Background(), nft.TransferQuery{
+		ContractIDs: []authgearweb3.ContractID{testContractID(t)},
+		FromBlock:   big.NewInt(150),
+		ToBlock:     big.NewInt(180),
+		Order:       nft.TransferOrderDescending,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if page.PageKey != "" {
+		t.Errorf("expected the last page, got page key %v", page.PageKey)
+	}
+	if ranges := stub.takeERC721Ranges(); fmt.Sprint(ranges) != fmt.Sprint([]blockRange{{150, 180}}) {
+		t.Errorf("unexpected ranges %v", ranges)
+	}
+}
+
+func TestJSONRPCGetOwnedTokens(t *testing.T) {
+	zero := "0x0000000000000000000000000000000000000000"
+	stub := &jsonRPCStub{
+		Head: 250,
+		Logs: []jsonrpc.Log{
+			erc721TransferLog(10, 0, zero, testOwnerAddress, 1),
+			erc721TransferLog(20, 0, zero, testOwnerAddress, 2),
+			erc721TransferLog(120, 1, testOwnerAddress, testOtherAddress, 1),
+			erc1155TransferSingleLog(130, 0, zero, testOwnerAddress, 3, 5),
+			erc1155TransferSingleLog(140, 0, testOwnerAddress, testOtherAddress, 3, 2),
+		},
+	}
+	api := newTestJSONRPCAPI(t, stub, 100)
+
+	tokens, err := api.GetOwnedTokens(context.Background(), testOwnerAddress, []authgearweb3.ContractID{testContractID(t)}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	balances := make([]string, 0, len(tokens.Tokens))
+	for _, token := range tokens.Tokens {
+		balances = append(balances, token.TokenID+"="+token.Balance)
+	}
+	if strings.Join(balances, ",") != "0x2=1,0x3=3" {
+		t.Errorf("unexpected balances %v", balances)
+	}
+}
+
+func TestJSONRPCGetOwnedTokensReplayLimit(t *testing.T) {
+	stub := &jsonRPCStub{Head: jsonRPCMaxReplayPages * 10}
+	api := newTestJSONRPCAPI(t, stub, 5)
+
+	_, err := api.GetOwnedTokens(context.Background(), testOwnerAddress, []authgearweb3.ContractID{testContractID(t)}, "")
+	if !apierrors.IsKind(err, ErrJSONRPCReplayLimitExceeded) {
+		t.Fatalf("expected replay limit error, got %v", err)
+	}
+}
+
+func TestJSONRPCGetContractMetadata(t *testing.T) {
+	// The stub fails eth_call like a contract without the optional functions
+	api := newTestJSONRPCAPI(t, &jsonRPCStub{}, 0)
+
+	metadata, err := api.GetContractMetadata(context.Background(), testContractID(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if metadata.TokenType != "" || metadata.Name != "" || metadata.TotalSupply != "" {
+		t.Errorf("unexpected metadata %+v", metadata)
+	}
+
+	// Errors other than failed calls are not mistaken for missing functions
+	unreachable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	t.Cleanup(unreachable.Close)
+	api.Config.Providers[0].URL = unreachable.URL
+
+	_, err = api.GetContractMetadata(context.Background(), testContractID(t))
+	if !apierrors.IsKind(err, ErrJSONRPCProtocol) {
+		t.Fatalf("expected protocol error, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package web3
+
+import (
+	apimodel "github.com/authgear/authgear-nft-indexer/pkg/api/model"
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-server/pkg/api/apierrors"
+)
+
+func supportedNetworksDetails(cfg config.Config, blockchain string, network string) apierrors.Details {
+	supportedNetworks := make([]apimodel.NetworkIdentifier, 0)
+	for _, chain := range cfg.ConfiguredChains() {
+		supportedNetworks = append(supportedNetworks, apimodel.NetworkIdentifier{
+			Blockchain: chain.Blockchain,
+			Network:    chain.Network(),
+		})
+	}
+
+	return apierrors.Details{
+		"blockchain":         blockchain,
+		"network":            network,
+		"supported_networks": supportedNetworks,
+	}
+}
+
+func NewUnsupportedNetworkError(cfg config.Config, blockchain string, network string) error {
+	return ErrUnsupportedNetwork.NewWithDetails("unsupported network", supportedNetworksDetails(cfg, blockchain, network))
+}
+
+func NewNetworkNotConfiguredError(cfg config.Config, blockchain string, network string) error {
+	return ErrNetworkNotConfigured.NewWithDetails("network is not configured", supportedNetworksDetails(cfg, blockchain, network))
+}
+
+// CheckNetwork returns UnsupportedNetwork if the network is not in the chain registry,
+// or NetworkNotConfigured if its provider is missing credentials
+func CheckNetwork(cfg config.Config, blockchain string, network string) error {
+	if cfg.GetChainConfig(blockchain, network) == nil {
+		return NewUnsupportedNetworkError(cfg, blockchain, network)
+	}
+
+	if !cfg.IsNetworkConfigured(blockchain, network) {
+		return NewNetworkNotConfiguredError(cfg, blockchain, network)
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package web3
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-nft-indexer/pkg/model/nft"
+	authgearweb3 "github.com/authgear/authgear-server/pkg/util/web3"
+)
+
+type NFTDataProvider interface {
+	GetOwnedTokens(ctx context.Context, ownerAddress authgearweb3.EIP55, contractIDs []authgearweb3.ContractID, pageKey string) (*nft.OwnedTokens, error)
+	GetTransfers(ctx context.Context, query nft.TransferQuery) (*nft.Transfers, error)
+	GetContractMetadata(ctx context.Context, contractID authgearweb3.ContractID) (*nft.ContractMetadata, error)
+	// GetContractsMetadata resolves contracts of the same network, contracts without metadata may be left out
+	GetContractsMetadata(ctx context.Context, contractIDs []authgearweb3.ContractID) ([]nft.ContractMetadata, error)
+	GetContractHolders(ctx context.Context, contractID authgearweb3.ContractID, pageKey string) (*nft.Holders, error)
+	GetBlockNumber(ctx context.Context, blockchain string, network string) (*big.Int, error)
+	// GetBlock returns the canonical block of the number, nil means the latest block
+	GetBlock(ctx context.Context, blockchain string, network string, blockNumber *big.Int) (*nft.Block, error)
+}
+
+var _ NFTDataProvider = &AlchemyAPI{}
+var _ NFTDataProvider = &JSONRPCAPI{}
+var _ NFTDataProvider = &NFTDataProviderRouter{}
+
+// NFTDataProviderRouter dispatches each call to the provider configured for the network
+type NFTDataProviderRouter struct {
+	Config     config.Config
+	AlchemyAPI *AlchemyAPI
+	JSONRPCAPI *JSONRPCAPI
+}
+
+func (r *NFTDataProviderRouter) Provider(blockchain string, network string) (NFTDataProvider, error) {
+	err := CheckNetwork(r.Config, blockchain, network)
+	if err != nil {
+		return nil, err
+	}
+
+	providerType := r.Config.GetProviderType(blockchain, network)
+	switch providerType {
+	case config.ProviderTypeAlchemy:
+		return r.AlchemyAPI, nil
+	case config.ProviderTypeJSONRPC:
+		return r.JSONRPCAPI, nil
+	}
+
+	return nil, fmt.Errorf("unknown provider type: %v", providerType)
+}
+
+func (r *NFTDataProviderRouter) GetOwnedTokens(ctx context.Context, ownerAddress authgearweb3.EIP55, contractIDs []authgearweb3.ContractID, pageKey string) (*nft.OwnedTokens, error) {
+	blockchain, network, err := getContractsNetwork(contractIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := r.Provider(blockchain, network)
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.GetOwnedTokens(ctx, ownerAddress, contractIDs, pageKey)
+}
+
+func (r *NFTDataProviderRouter) GetTransfers(ctx context.Context, query nft.TransferQuery) (*nft.Transfers, error) {
+	blockchain, network, err := getContractsNetwork(query.ContractIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := r.Provider(blockchain, network)
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.GetTransfers(ctx, query)
+}
+
+func (r *NFTDataProviderRouter) GetContractMetadata(ctx context.Context, contractID authgearweb3.ContractID) (*nft.ContractMetadata, error) {
+	provider, err := r.Provider(contractID.Blockchain, contractID.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.GetContractMetadata(ctx, contractID)
+}
+
+func (r *NFTDataProviderRouter) GetContractsMetadata(ctx context.Context, contractIDs []authgearweb3.ContractID) ([]nft.ContractMetadata, error) {
+	blockchain, network, err := getContractsNetwork(contractIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := r.Provider(blockchain, network)
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.GetContractsMetadata(ctx, contractIDs)
+}
+
+func (r *NFTDataProviderRouter) GetContractHolders(ctx context.Context, contractID authgearweb3.ContractID, pageKey string) (*nft.Holders, error) {
+	provider, err := r.Provider(contractID.Blockchain, contractID.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.GetContractHolders(ctx, contractID, pageKey)
+}
+
+func (r *NFTDataProviderRouter) GetBlockNumber(ctx context.Context, blockchain string, network string) (*big.Int, error) {
+	provider, err := r.Provider(blockchain, network)
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.GetBlockNumber(ctx, blockchain, network)
+}
+
+func (r *NFTDataProviderRouter) GetBlock(ctx context.Context, blockchain string, network string, blockNumber *big.Int) (*nft.Block, error) {
+	provider, err := r.Provider(blockchain, network)
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.GetBlock(ctx, blockchain, network, blockNumber)
+}
+
+func getContractsNetwork(contractIDs []authgearweb3.ContractID) (blockchain string, network string, err error) {
+	for _, contractID := range contractIDs {
+		if blockchain == "" && network == "" {
+			blockchain = contractID.Blockchain
+			network = contractID.Network
+		} else if blockchain != contractID.Blockchain || network != contractID.Network {
+			return "", "", fmt.Errorf("Invalid contract IDs, blockchain networks are not the same")
+		}
+	}
+
+	return blockchain, network, nil
+}
@@ -0,0 +1,213 @@
+package web3
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-server/pkg/api/apierrors"
+	"github.com/authgear/authgear-server/pkg/util/clock"
+	"github.com/authgear/authgear-server/pkg/util/log"
+)
+
+// Methods not listed here cost defaultComputeUnitCost
+const defaultComputeUnitCost = 10
+
+// DefaultComputeUnitCosts follows the alchemy compute unit pricing
+var DefaultComputeUnitCosts = map[string]int{
+	"getNFTs":                   100,
+	"getContractMetadata":       10,
+	"getOwnersForCollection":    100,
+	"alchemy_getAssetTransfers": 150,
+	"getNFTsForOwner":           100,
+	"getContractMetadataBatch":  50,
+	"getOwnersForContract":      350,
+	"getNFTMetadataBatch":       100,
+	"eth_blockNumber":           10,
+	"eth_getBlockByNumber":      16,
+	"eth_getLogs":               75,
+	"eth_call":                  26,
+}
+
+// networkAPIKey identifies an API key of a network, APIKey is empty for providers without keys
+type networkAPIKey struct {
+	Blockchain string
+	Network    string
+	APIKey     string
+}
+
+type networkLimiter struct {
+	mutex sync.Mutex
+
+	tokens     float64
+	lastRefill time.Time
+
+	day    string
+	used   int64
+	warned bool
+}
+
+// RateLimiter shapes upstream calls with a token bucket of compute units per network and API key,
+// and enforces the daily compute unit budget. The buckets and the budget are kept in memory,
+// so each replica enforces them on its own
+type RateLimiter struct {
+	Config config.Config
+	Clock  clock.Clock
+	Logger *log.Logger
+
+	mutex    sync.Mutex
+	limiters map[networkAPIKey]*networkLimiter
+}
+
+func NewRateLimiter(cfg config.Config, clock clock.Clock, lf *log.Factory) *RateLimiter {
+	return &RateLimiter{
+		Config:   cfg,
+		Clock:    clock,
+		Logger:   lf.New("rate-limiter"),
+		limiters: make(map[networkAPIKey]*networkLimiter),
+	}
+}
+
+func (l *RateLimiter) getLimiter(key networkAPIKey, burst int) *networkLimiter {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	limiter, ok := l.limiters[key]
+	if !ok {
+		limiter = &networkLimiter{
+			tokens:     float64(burst),
+			lastRefill: l.Clock.NowMonotonic(),
+		}
+		l.limiters[key] = limiter
+	}
+	return limiter
+}
+
+func computeUnitCost(cfg *config.RateLimitConfig, method string) int {
+	if cost, ok := cfg.ComputeUnitCosts[method]; ok {
+		return cost
+	}
+	if cost, ok := DefaultComputeUnitCosts[method]; ok {
+		return cost
+	}
+	return defaultComputeUnitCost
+}
+
+// burstSize raises the burst to the largest method cost, a method costing more than the burst could never be called
+func burstSize(cfg *config.RateLimitConfig) int {
+	burst := cfg.GetBurst()
+	for method := range DefaultComputeUnitCosts {
+		burst = max(burst, computeUnitCost(cfg, method))
+	}
+	for _, cost := range cfg.ComputeUnitCosts {
+		burst = max(burst, cost)
+	}
+	return burst
+}
+
+// Acquire blocks until the method can be called, or fails if the wait is too long or the daily budget is used up
+func (l *RateLimiter) Acquire(ctx context.Context, blockchain string, network string, apiKey string, method string) error {
+	if l == nil {
+		return nil
+	}
+
+	cfg := l.Config.GetRateLimitConfig(blockchain, network)
+	if cfg == nil {
+		return nil
+	}
+
+	cost := computeUnitCost(cfg, method)
+	limiter := l.getLimiter(networkAPIKey{Blockchain: blockchain, Network: network, APIKey: apiKey}, burstSize(cfg))
+
+	wait, err := l.reserve(limiter, cfg, blockchain, network, method, cost)
+	if err != nil {
+		return err
+	}
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil
+}
+
+func (l *RateLimiter) reserve(limiter *networkLimiter, cfg *config.RateLimitConfig, blockchain string, network string, method string, cost int) (time.Duration, error) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	// Daily budget resets at UTC midnight
+	day := l.Clock.NowUTC().Format(time.DateOnly)
+	if limiter.day != day {
+		limiter.day = day
+		limiter.used = 0
+		limiter.warned = false
+	}
+
+	if cfg.DailyComputeUnits > 0 && limiter.used+int64(cost) > cfg.DailyComputeUnits {
+		return 0, ErrComputeUnitBudgetExceeded.NewWithDetails("daily compute unit budget exceeded", apierrors.Details{
+			"blockchain": blockchain,
+			"network":    network,
+			"method":     method,
+		})
+	}
+
+	now := l.Clock.NowMonotonic()
+	rate := float64(cfg.ComputeUnitsPerSecond)
+	limiter.tokens = math.Min(float64(burstSize(cfg)), limiter.tokens+now.Sub(limiter.lastRefill).Seconds()*rate)
+	limiter.lastRefill = now
+
+	var wait time.Duration
+	if tokens := limiter.tokens - float64(cost); tokens < 0 {
+		wait = time.Duration(-tokens / rate * float64(time.Second))
+	}
+	if wait > cfg.GetMaxWait() {
+		return 0, ErrUpstreamRateLimited.NewWithDetails("upstream rate limit exceeded", apierrors.Details{
+			"blockchain": blockchain,
+			"network":    network,
+			"method":     method,
+		})
+	}
+
+	limiter.tokens -= float64(cost)
+	limiter.used += int64(cost)
+
+	if cfg.DailyComputeUnits > 0 && !limiter.warned && float64(limiter.used) >= float64(cfg.DailyComputeUnits)*cfg.GetDailyWarningRatio() {
+		limiter.warned = true
+		l.Logger.WithFields(map[string]interface{}{
+			"blockchain": blockchain,
+			"network":    network,
+			"used":       limiter.used,
+			"budget":     cfg.DailyComputeUnits,
+		}).Warn("daily compute unit budget is running low")
+	}
+
+	return wait, nil
+}
+
+// ComputeUnitsUsedToday returns the compute units spent today with the API key of the network
+func (l *RateLimiter) ComputeUnitsUsedToday(blockchain string, network string, apiKey string) int64 {
+	if l == nil {
+		return 0
+	}
+
+	l.mutex.Lock()
+	limiter, ok := l.limiters[networkAPIKey{Blockchain: blockchain, Network: network, APIKey: apiKey}]
+	l.mutex.Unlock()
+	if !ok {
+		return 0
+	}
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	if limiter.day != l.Clock.NowUTC().Format(time.DateOnly) {
+		return 0
+	}
+	return limiter.used
+}
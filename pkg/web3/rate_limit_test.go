@@ -0,0 +1,177 @@
+package web3
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+	"github.com/authgear/authgear-server/pkg/api/apierrors"
+	"github.com/authgear/authgear-server/pkg/util/log"
+)
+
+type fixedClock struct {
+	Now time.Time
+}
+
+func (c *fixedClock) NowUTC() time.Time {
+	return c.Now.UTC()
+}
+
+func (c *fixedClock) NowMonotonic() time.Time {
+	return c.Now
+}
+
+func (c *fixedClock) Advance(d time.Duration) {
+	c.Now = c.Now.Add(d)
+}
+
+func newTestRateLimiter(rateLimit config.RateLimitConfig, clock *fixedClock) *RateLimiter {
+	rateLimit.Blockchain = "ethereum"
+	rateLimit.Network = "1"
+	return NewRateLimiter(config.Config{
+		RateLimits: []config.RateLimitConfig{rateLimit},
+	}, clock, log.NewFactory(log.LevelInfo))
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	maxWaitMs := 1000
+
+	type step struct {
+		Advance      time.Duration
+		Method       string
+		ExpectedWait time.Duration
+		ExpectedErr  *apierrors.Kind
+	}
+
+	cases := []struct {
+		Name      string
+		RateLimit config.RateLimitConfig
+		Steps     []step
+	}{
+		{
+			Name:      "Calls within the burst do not wait",
+			RateLimit: config.RateLimitConfig{ComputeUnitsPerSecond: 100, Burst: 400, MaxWaitMs: &maxWaitMs},
+			Steps: []step{
+				{Method: "getNFTs"},
+				{Method: "getNFTs"},
+			},
+		},
+		{
+			Name:      "Calls past the burst wait for the refill",
+			RateLimit: config.RateLimitConfig{ComputeUnitsPerSecond: 100, Burst: 400, MaxWaitMs: &maxWaitMs},
+			Steps: []step{
+				{Method: "getNFTs"},
+				{Method: "getNFTs"},
+				{Method: "getNFTs"},
+				{Method: "getNFTs"},
+				{Method: "eth_blockNumber", ExpectedWait: 100 * time.Millisecond},
+				{Advance: time.Second, Method: "getNFTs", ExpectedWait: 100 * time.Millisecond},
+			},
+		},
+		{
+			Name:      "Calls waiting longer than max wait are denied",
+			RateLimit: config.RateLimitConfig{ComputeUnitsPerSecond: 100, Burst: 400, MaxWaitMs: &maxWaitMs},
+			Steps: []step{
+				{Method: "getNFTs"},
+				{Method: "getNFTs"},
+				{Method: "getNFTs"},
+				{Method: "getNFTs"},
+				{Method: "getNFTs", ExpectedWait: time.Second},
+				{Method: "getNFTs", ExpectedErr: &ErrUpstreamRateLimited},
+			},
+		},
+		{
+			Name:      "Burst below a method cost is raised to it",
+			RateLimit: config.RateLimitConfig{ComputeUnitsPerSecond: 100, MaxWaitMs: &maxWaitMs},
+			Steps: []step{
+				{Method: "getOwnersForContract"},
+			},
+		},
+		{
+			Name: "Daily budget is enforced and resets at UTC midnight",
+			RateLimit: config.RateLimitConfig{
+				ComputeUnitsPerSecond: 1000,
+				MaxWaitMs:             &maxWaitMs,
+				DailyComputeUnits:     250,
+			},
+			Steps: []step{
+				{Method: "getNFTs"},
+				{Method: "getNFTs"},
+				{Method: "getNFTs", ExpectedErr: &ErrComputeUnitBudgetExceeded},
+				{Method: "eth_blockNumber"},
+				{Advance: 12 * time.Hour, Method: "getNFTs"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			clock := &fixedClock{Now: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)}
+			limiter := newTestRateLimiter(c.RateLimit, clock)
+			cfg := limiter.Config.GetRateLimitConfig("ethereum", "1")
+			networkLimiter := limiter.getLimiter(networkAPIKey{Blockchain: "ethereum", Network: "1"}, burstSize(cfg))
+
+			for i, s := range c.Steps {
+				clock.Advance(s.Advance)
+				wait, err := limiter.reserve(networkLimiter, cfg, "ethereum", "1", s.Method, computeUnitCost(cfg, s.Method))
+				if s.ExpectedErr != nil {
+					if !apierrors.IsKind(err, *s.ExpectedErr) {
+						t.Fatalf("step %v: expected %v, got %v", i, s.ExpectedErr.Reason, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("step %v: unexpected error: %v", i, err)
+				}
+				if wait != s.ExpectedWait {
+					t.Errorf("step %v: expected wait %v, got %v", i, s.ExpectedWait, wait)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterAcquireWithoutConfig(t *testing.T) {
+	var nilLimiter *RateLimiter
+	if err := nilLimiter.Acquire(context.Background(), "ethereum", "1", "key", "getNFTs"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	limiter := NewRateLimiter(config.Config{}, &fixedClock{}, log.NewFactory(log.LevelInfo))
+	if err := limiter.Acquire(context.Background(), "ethereum", "1", "key", "getNFTs"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBurstSize(t *testing.T) {
+	cases := []struct {
+		Name      string
+		RateLimit config.RateLimitConfig
+		Expected  int
+	}{
+		{
+			Name:      "Burst above every cost",
+			RateLimit: config.RateLimitConfig{ComputeUnitsPerSecond: 330, Burst: 660},
+			Expected:  660,
+		},
+		{
+			Name:      "Default burst raised to the largest default cost",
+			RateLimit: config.RateLimitConfig{ComputeUnitsPerSecond: 100},
+			Expected:  350,
+		},
+		{
+			Name:      "Burst raised to an overridden cost",
+			RateLimit: config.RateLimitConfig{ComputeUnitsPerSecond: 100, ComputeUnitCosts: map[string]int{"getNFTs": 500}},
+			Expected:  500,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			if burst := burstSize(&c.RateLimit); burst != c.Expected {
+				t.Errorf("expected burst %v, got %v", c.Expected, burst)
+			}
+		})
+	}
+}
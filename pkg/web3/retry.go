@@ -0,0 +1,186 @@
+package web3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/authgear/authgear-nft-indexer/pkg/config"
+)
+
+var upstreamTransport http.RoundTripper = http.DefaultTransport
+
+func newUpstreamClient(cfg config.UpstreamConfig) *http.Client {
+	base := upstreamTransport
+	if mode := cfg.Fixtures.GetMode(); mode != config.FixturesModeOff {
+		base = &FixtureTransport{
+			Base: base,
+			Mode: mode,
+			Dir:  cfg.Fixtures.GetDir(),
+		}
+	}
+
+	return &http.Client{
+		Transport: &RetryTransport{
+			Base:           base,
+			AttemptTimeout: cfg.GetTimeout(),
+			MaxAttempts:    cfg.GetMaxAttempts(),
+			InitialBackoff: cfg.GetInitialBackoff(),
+			MaxBackoff:     cfg.GetMaxBackoff(),
+		},
+	}
+}
+
+func upstreamGet(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+func upstreamPostJSON(ctx context.Context, client *http.Client, url string, jsonBody []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return client.Do(req)
+}
+
+func isRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter supports both delay-seconds and HTTP-date
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(header); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// RetryTransport retries transient network errors, 429 and 5xx responses with jittered exponential backoff,
+// a Retry-After longer than MaxBackoff is not waited for and the response is returned as is
+type RetryTransport struct {
+	Base           http.RoundTripper
+	AttemptTimeout time.Duration
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	backoff := t.InitialBackoff << attempt
+	if backoff <= 0 || backoff > t.MaxBackoff {
+		backoff = t.MaxBackoff
+	}
+	// Full jitter
+	return time.Duration(rand.Int64N(int64(backoff) + 1))
+}
+
+func (t *RetryTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.AttemptTimeout)
+
+	attemptReq := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		attemptReq.Body = body
+	}
+
+	res, err := t.Base.RoundTrip(attemptReq)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	res.Body = &cancelOnCloseBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	canRetry := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	for attempt := 0; ; attempt++ {
+		res, err := t.roundTrip(req)
+
+		isLastAttempt := !canRetry || attempt+1 >= t.MaxAttempts || req.Context().Err() != nil
+		if isLastAttempt {
+			return res, err
+		}
+
+		var wait time.Duration
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil, err
+			}
+			wait = t.backoff(attempt)
+		} else {
+			if !isRetryableStatus(res.StatusCode) {
+				return res, nil
+			}
+
+			retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+			if ok && retryAfter > t.MaxBackoff {
+				return res, nil
+			}
+
+			wait = t.backoff(attempt)
+			if ok {
+				wait = retryAfter
+			}
+
+			// Drain the body so that the connection can be reused
+			_, _ = io.Copy(io.Discard, res.Body)
+			_ = res.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package web3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		Header   string
+		Expected time.Duration
+		OK       bool
+	}{
+		{Header: "", OK: false},
+		{Header: "5", Expected: 5 * time.Second, OK: true},
+		{Header: "-1", OK: false},
+		{Header: "Sun, 18 Oct 2026 00:00:30 GMT", Expected: 30 * time.Second, OK: true},
+		{Header: "Sat, 17 Oct 2026 23:59:00 GMT", Expected: 0, OK: true},
+		{Header: "soon", OK: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Header, func(t *testing.T) {
+			d, ok := parseRetryAfter(c.Header, now)
+			if ok != c.OK || d != c.Expected {
+				t.Errorf("expected %v %v, got %v %v", c.Expected, c.OK, d, ok)
+			}
+		})
+	}
+}
+
+type roundTripResult struct {
+	StatusCode int
+	RetryAfter string
+	Err        error
+}
+
+// sequenceTransport returns the results in order and records the request bodies
+type sequenceTransport struct {
+	Results []roundTripResult
+	Bodies  []string
+}
+
+func (s *sequenceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		b, _ := io.ReadAll(req.Body)
+		body = string(b)
+	}
+	s.Bodies = append(s.Bodies, body)
+
+	result := s.Results[len(s.Bodies)-1]
+	if result.Err != nil {
+		return nil, result.Err
+	}
+
+	header := http.Header{}
+	if result.RetryAfter != "" {
+		header.Set("Retry-After", result.RetryAfter)
+	}
+	return &http.Response{
+		StatusCode: result.StatusCode,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+func TestRetryTransport(t *testing.T) {
+	networkErr := errors.New("connection reset")
+
+	cases := []struct {
+		Name             string
+		Results          []roundTripResult
+		ExpectedAttempts int
+		ExpectedStatus   int
+		ExpectedErr      error
+	}{
+		{
+			Name:             "Success is not retried",
+			Results:          []roundTripResult{{StatusCode: 200}},
+			ExpectedAttempts: 1,
+			ExpectedStatus:   200,
+		},
+		{
+			Name:             "Client error is not retried",
+			Results:          []roundTripResult{{StatusCode: 400}},
+			ExpectedAttempts: 1,
+			ExpectedStatus:   400,
+		},
+		{
+			Name:             "5xx and network errors are retried",
+			Results:          []roundTripResult{{StatusCode: 503}, {Err: networkErr}, {StatusCode: 200}},
+			ExpectedAttempts: 3,
+			ExpectedStatus:   200,
+		},
+		{
+			Name:             "Last attempt is returned as is",
+			Results:          []roundTripResult{{StatusCode: 429}, {StatusCode: 502}, {StatusCode: 500}},
+			ExpectedAttempts: 3,
+			ExpectedStatus:   500,
+		},
+		{
+			Name:             "Last network error is returned",
+			Results:          []roundTripResult{{Err: networkErr}, {Err: networkErr}, {Err: networkErr}},
+			ExpectedAttempts: 3,
+			ExpectedErr:      networkErr,
+		},
+		{
+			Name:             "Short Retry-After is waited for",
+			Results:          []roundTripResult{{StatusCode: 429, RetryAfter: "0"}, {StatusCode: 200}},
+			ExpectedAttempts: 2,
+			ExpectedStatus:   200,
+		},
+		{
+			Name:             "Retry-After longer than the max backoff is not waited for",
+			Results:          []roundTripResult{{StatusCode: 429, RetryAfter: "60"}},
+			ExpectedAttempts: 1,
+			ExpectedStatus:   429,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			base := &sequenceTransport{Results: c.Results}
+			transport := &RetryTransport{
+				Base:           base,
+				AttemptTimeout: time.Second,
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     10 * time.Millisecond,
+			}
+
+			req, err := http.NewRequest(http.MethodPost, "http://upstream.invalid", bytes.NewBufferString("body"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := transport.RoundTrip(req)
+			if c.ExpectedErr != nil {
+				if !errors.Is(err, c.ExpectedErr) {
+					t.Fatalf("expected error %v, got %v", c.ExpectedErr, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				defer res.Body.Close()
+				if res.StatusCode != c.ExpectedStatus {
+					t.Errorf("expected status %v, got %v", c.ExpectedStatus, res.StatusCode)
+				}
+			}
+
+			if len(base.Bodies) != c.ExpectedAttempts {
+				t.Fatalf("expected %v attempts, got %v", c.ExpectedAttempts, len(base.Bodies))
+			}
+			// Every attempt resends the full body
+			for i, body := range base.Bodies {
+				if body != "body" {
+					t.Errorf("attempt %v: expected body %q, got %q", i, "body", body)
+				}
+			}
+		})
+	}
+}